@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// auditMinWidths are the minimum audit tail column widths. They keep rows
+// appended by --follow aligned with earlier batches in the common case.
+var auditMinWidths = []int{19, 21, 12, 6, 16}
+
+// newAuditCmd returns the "audit" command group.
+func newAuditCmd(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the core's audit log of blocked queries",
+	}
+	cmd.AddCommand(newAuditTailCmd(opts), newAuditRotateCmd(opts))
+	return cmd
+}
+
+// newAuditTailCmd returns the "audit tail" subcommand.
+func newAuditTailCmd(opts *rootOptions) *cobra.Command {
+	var (
+		limit    int
+		follow   bool
+		interval time.Duration
+		since    string
+		redact   bool
+		noRedact bool
+	)
+	cmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Print the most recent blocked queries",
+		Long: `Print up to --limit of the most recent entries in the core's ring buffer of
+blocked queries, newest first. --since keeps only entries recorded at or after
+a time, given as a duration before now (15m, 2h) or an RFC 3339 timestamp.
+
+Literal values in the queries are replaced with ? by default, since they may
+carry sensitive data; --no-redact shows the queries as recorded.
+
+With --follow the buffer is polled every --interval and only entries not seen
+before are printed, until Ctrl+C. A failed poll is reported on stderr; three
+consecutive failures end the command with a non-zero exit code.`,
+		Annotations: map[string]string{annotationCommand: "audit_tail"},
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit <= 0 {
+				return fmt.Errorf("invalid --limit %d: must be positive", limit)
+			}
+			var sinceTime time.Time
+			if since != "" {
+				t, err := parseSince(since)
+				if err != nil {
+					return fmt.Errorf("invalid --since: %w", err)
+				}
+				sinceTime = t
+			}
+			redact = redact && !noRedact
+			if !follow {
+				return runAuditTail(cmd.Context(), cmd.OutOrStdout(), opts, limit, sinceTime, redact)
+			}
+			if interval <= 0 {
+				return fmt.Errorf("invalid --interval %s: must be positive", interval)
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			return runAuditFollow(ctx, cmd.OutOrStdout(), opts, limit, sinceTime, interval, redact)
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 50, "Maximum number of entries to fetch")
+	cmd.Flags().StringVar(&since, "since", "", "Only show entries newer than a duration (15m) or RFC 3339 time")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep polling and print new entries as they arrive")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "Poll interval for --follow")
+	cmd.Flags().BoolVar(&redact, "redact", true, "Replace literal values in queries with ? (default)")
+	cmd.Flags().BoolVar(&noRedact, "no-redact", false, "Show queries with their literal values")
+	cmd.MarkFlagsMutuallyExclusive("redact", "no-redact")
+	return cmd
+}
+
+// newAuditRotateCmd returns the "audit rotate" subcommand.
+func newAuditRotateCmd(opts *rootOptions) *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Flush the core's audit ring buffer",
+		Long: `Ask the core to empty its ring buffer of blocked queries and print how many
+entries were flushed. The flushed entries are gone for good: without --yes the
+command asks for confirmation when stdout is a terminal and refuses otherwise.`,
+		Annotations: map[string]string{annotationCommand: "audit_rotate"},
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
+			return runAuditRotate(w, cmd.InOrStdin(), opts, yes, isTerminal(w))
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Rotate without asking for confirmation")
+	return cmd
+}
+
+// runAuditRotate flushes the audit log after the same confirmation as
+// runStatsReset.
+func runAuditRotate(w io.Writer, in io.Reader, opts *rootOptions, yes, interactive bool) error {
+	if !yes {
+		if !interactive {
+			return errors.New("audit rotate: refusing to flush the audit log without --yes")
+		}
+		ok, err := confirm(w, in, fmt.Sprintf("Flush the audit log on %s? [y/N] ", opts.socketPath()))
+		if err != nil {
+			return fmt.Errorf("audit rotate: %w", err)
+		}
+		if !ok {
+			return errors.New("audit rotate: aborted")
+		}
+	}
+
+	flushed, err := opts.newClient().AuditRotate()
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("audit rotate", "audit_rotate")
+	}
+	if err != nil {
+		return fmt.Errorf("audit rotate: %w", err)
+	}
+	if isJSONOutput(opts.output) {
+		return writeRecord(w, opts.output, client.AuditRotateResult{Flushed: flushed})
+	}
+	fmt.Fprintf(w, "flushed %d audit entries\n", flushed)
+	return nil
+}
+
+// parseSince parses a --since value: a Go duration, taken as that long before
+// now, or an RFC 3339 timestamp.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("duration %q must not be negative", s)
+		}
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration (e.g. 15m) nor an RFC 3339 time (e.g. 2025-03-01T00:00:00Z)", s)
+	}
+	return t, nil
+}
+
+// fetchAudit fetches up to limit audit entries recorded at or after since
+// (the zero time for all), newest first, with their queries passed through
+// client.RedactSQL if redact is set.
+func fetchAudit(ctx context.Context, opts *rootOptions, limit int, since time.Time, redact bool) ([]client.AuditEntry, error) {
+	entries, err := opts.newClient().AuditTailSinceContext(ctx, limit, since)
+	if errors.Is(err, client.ErrNotImplemented) {
+		return nil, notSupported("audit tail", "audit_tail")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit tail: %w", err)
+	}
+	if redact {
+		for i := range entries {
+			entries[i].Query = client.RedactSQL(entries[i].Query)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].TimestampMs != entries[j].TimestampMs {
+			return entries[i].TimestampMs > entries[j].TimestampMs
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+// runAuditTail prints the most recent audit entries once, as a table or in
+// the format selected by --output.
+func runAuditTail(ctx context.Context, w io.Writer, opts *rootOptions, limit int, since time.Time, redact bool) error {
+	entries, err := fetchAudit(ctx, opts, limit, since, redact)
+	if err != nil {
+		return err
+	}
+	if isJSONOutput(opts.output) {
+		return writeRecords(w, opts.output, entries)
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No audit entries.")
+		return nil
+	}
+	return printAuditRows(w, opts, entries, true)
+}
+
+// runAuditFollow prints the current audit entries and then polls every
+// interval until ctx is cancelled, printing only entries not seen before.
+// JSON output writes one record per entry. Failed polls are handled like
+// stats --watch.
+func runAuditFollow(ctx context.Context, w io.Writer, opts *rootOptions, limit int, since time.Time, interval time.Duration, redact bool) error {
+	stderr := opts.stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastID uint64
+	header := !isJSONOutput(opts.output)
+	failures := 0
+	for {
+		entries, err := fetchAudit(ctx, opts, limit, since, redact)
+		if ctxDone(ctx) {
+			return nil
+		}
+		if err != nil {
+			failures++
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			if failures >= maxWatchFailures {
+				return fmt.Errorf("audit tail --follow: giving up after %d consecutive failures", failures)
+			}
+		} else {
+			failures = 0
+			var fresh []client.AuditEntry
+			fresh, lastID = newAuditEntries(entries, lastID)
+			if isJSONOutput(opts.output) {
+				for _, e := range fresh {
+					if err := writeRecord(w, opts.output, e); err != nil {
+						return err
+					}
+				}
+			} else if len(fresh) > 0 {
+				if err := printAuditRows(w, opts, fresh, header); err != nil {
+					return err
+				}
+				header = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// newAuditEntries returns the entries of a poll that have not been printed
+// yet, i.e. those with an ID above lastID, and the new highest ID seen. If
+// every ID is below lastID the core's buffer was reset, e.g. by a restart,
+// and all entries count as new.
+func newAuditEntries(entries []client.AuditEntry, lastID uint64) ([]client.AuditEntry, uint64) {
+	var maxID uint64
+	for _, e := range entries {
+		maxID = max(maxID, e.ID)
+	}
+	if len(entries) > 0 && maxID < lastID {
+		return entries, maxID
+	}
+
+	var fresh []client.AuditEntry
+	for _, e := range entries {
+		if e.ID > lastID {
+			fresh = append(fresh, e)
+		}
+	}
+	return fresh, max(maxID, lastID)
+}
+
+// printAuditRows prints entries in the audit tail table layout, preceded by
+// the header line if header is set. Whitespace in queries, including
+// newlines, is collapsed so each entry stays on one line.
+func printAuditRows(w io.Writer, opts *rootOptions, entries []client.AuditEntry, header bool) error {
+	t := &table{minWidths: auditMinWidths, maxWidth: opts.maxColWidth}
+	if header {
+		t.header = []string{"Time", "Client", "User", "Action", "Rule", "Query"}
+	}
+	for _, e := range entries {
+		t.addRow(time.UnixMilli(e.TimestampMs).UTC().Format("2006-01-02 15:04:05"),
+			e.ClientAddr, e.User, e.Action, e.Rule, strings.Join(strings.Fields(e.Query), " "))
+	}
+	return t.render(w)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// auditIDs returns the IDs of entries in order.
+func auditIDs(entries []client.AuditEntry) []uint64 {
+	ids := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+// TestNewAuditEntries verifies that only unseen IDs are returned, and that a
+// buffer reset by a core restart starts over.
+func TestNewAuditEntries(t *testing.T) {
+	batch := []client.AuditEntry{{ID: 5}, {ID: 4}, {ID: 3}}
+
+	fresh, last := newAuditEntries(batch, 0)
+	if len(fresh) != 3 || last != 5 {
+		t.Fatalf("first poll: got %v, last %d", auditIDs(fresh), last)
+	}
+
+	// The next poll overlaps the previous one.
+	fresh, last = newAuditEntries([]client.AuditEntry{{ID: 7}, {ID: 6}, {ID: 5}, {ID: 4}}, last)
+	if got := auditIDs(fresh); len(got) != 2 || got[0] != 7 || got[1] != 6 || last != 7 {
+		t.Errorf("overlapping poll: got %v, last %d; want [7 6], 7", got, last)
+	}
+
+	fresh, last = newAuditEntries(nil, last)
+	if len(fresh) != 0 || last != 7 {
+		t.Errorf("empty poll: got %v, last %d", auditIDs(fresh), last)
+	}
+
+	fresh, last = newAuditEntries([]client.AuditEntry{{ID: 2}, {ID: 1}}, last)
+	if len(fresh) != 2 || last != 2 {
+		t.Errorf("after restart: got %v, last %d; want both entries, 2", auditIDs(fresh), last)
+	}
+}
+
+// TestRunAuditTail verifies the newest-first table and the 501 message.
+func TestRunAuditTail(t *testing.T) {
+	sock := mockUDSServer(t, []byte(`{"ok":true,"payload":[`+
+		`{"id":1,"timestamp_ms":1700000000000,"client_addr":"10.0.0.5:1","user":"app","query":"DROP\n TABLE a","rule":"no-ddl","action":"block"},`+
+		`{"id":2,"timestamp_ms":1700000060000,"client_addr":"10.0.0.6:2","user":"etl","query":"DELETE FROM b","rule":"no-delete","action":"log"}]}`))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second}
+
+	var out bytes.Buffer
+	if err := runAuditTail(context.Background(), &out, opts, 50, time.Time{}, false); err != nil {
+		t.Fatalf("runAuditTail: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[1], "2023-11-14 22:14:20  10.0.0.6:2") || !strings.HasSuffix(lines[2], "DROP TABLE a") {
+		t.Errorf("rows not newest first or query not collapsed:\n%s", out.String())
+	}
+	if strings.Index(lines[0], "Query") != strings.Index(lines[1], "DELETE") {
+		t.Errorf("columns not aligned:\n%s", out.String())
+	}
+
+	opts.socketPaths = []string{mockUDSServer(t, []byte(`{"ok":false,"error":"unknown command: audit_tail"}`))}
+	if err := runAuditTail(context.Background(), &out, opts, 50, time.Time{}, false); err == nil || !strings.Contains(err.Error(), "does not support audit_tail") {
+		t.Errorf("expected friendly 501 error, got: %v", err)
+	}
+}
+
+// TestParseSince verifies the relative and absolute forms and the error for
+// anything else.
+func TestParseSince(t *testing.T) {
+	before := time.Now()
+	got, err := parseSince("15m")
+	if err != nil {
+		t.Fatalf("duration: %v", err)
+	}
+	if lo, hi := before.Add(-15*time.Minute), time.Now().Add(-15*time.Minute); got.Before(lo) || got.After(hi) {
+		t.Errorf("15m = %v, want between %v and %v", got, lo, hi)
+	}
+
+	got, err = parseSince("2025-03-01T09:00:00+09:00")
+	if err != nil {
+		t.Fatalf("RFC 3339: %v", err)
+	}
+	if want := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("RFC 3339 = %v, want %v", got, want)
+	}
+
+	for _, in := range []string{"yesterday", "15", "2025-03-01", "-5m"} {
+		if _, err := parseSince(in); err == nil {
+			t.Errorf("parseSince(%q): expected an error", in)
+		}
+	}
+}
+
+// TestRunAuditTail_Since verifies that entries before --since are dropped
+// when the core returns them anyway, and one stamped exactly at it is kept.
+func TestRunAuditTail_Since(t *testing.T) {
+	sock := mockUDSServer(t, []byte(`{"ok":true,"payload":[`+
+		`{"id":1,"timestamp_ms":1699999999999,"query":"old"},`+
+		`{"id":2,"timestamp_ms":1700000000000,"query":"boundary"},`+
+		`{"id":3,"timestamp_ms":1700000060000,"query":"new"}]}`))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, output: "jsonl", stderr: io.Discard}
+
+	var out bytes.Buffer
+	if err := runAuditTail(context.Background(), &out, opts, 50, time.UnixMilli(1700000000000), false); err != nil {
+		t.Fatalf("runAuditTail: %v", err)
+	}
+	if got := out.String(); strings.Contains(got, `"old"`) || !strings.Contains(got, `"boundary"`) || !strings.Contains(got, `"new"`) {
+		t.Errorf("unexpected entries:\n%s", got)
+	}
+}
+
+// TestAuditTail_Redact verifies that literals are redacted unless
+// --no-redact is given, in text and JSON output.
+func TestAuditTail_Redact(t *testing.T) {
+	sock := mockUDSServer(t, []byte(`{"ok":true,"payload":[{"id":1,"query":"SELECT * FROM cards WHERE pan = '4111111111111111'"}]}`))
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"audit", "tail"}, "WHERE pan = ?"},
+		{[]string{"-o", "json", "audit", "tail"}, `WHERE pan = ?"`},
+		{[]string{"audit", "tail", "--no-redact"}, "WHERE pan = '4111111111111111'"},
+	} {
+		cmd := newRootCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(append([]string{"--socket", sock}, tt.args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("%v: output missing %q:\n%s", tt.args, tt.want, out.String())
+		}
+	}
+}
+
+// TestRunAuditFollow verifies that overlapping polls print each entry once.
+func TestRunAuditFollow(t *testing.T) {
+	sock := mockUDSServerSeq(t,
+		[]byte(`{"ok":true,"payload":[{"id":1,"query":"q1"}]}`),
+		[]byte(`{"ok":true,"payload":[{"id":2,"query":"q2"},{"id":1,"query":"q1"}]}`),
+	)
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, output: outputJSONL}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	if err := runAuditFollow(ctx, &out, opts, 50, time.Time{}, 10*time.Millisecond, true); err != nil {
+		t.Fatalf("runAuditFollow: %v", err)
+	}
+	if got := out.String(); strings.Count(got, `"id":1,`) != 1 || strings.Count(got, `"id":2,`) != 1 {
+		t.Errorf("each entry should be printed once:\n%s", got)
+	}
+}
+
+// TestRunAuditFollow_Cancel verifies that cancelling a follow aborts the poll
+// in flight instead of waiting out --timeout, and does not report it as a
+// failure.
+func TestRunAuditFollow_Cancel(t *testing.T) {
+	sock, _ := stalledUDSServer(t)
+	var stderr bytes.Buffer
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 10 * time.Second, stderr: &stderr}
+
+	// Ctrl+C cancels ctx rather than letting a deadline expire.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if err := runAuditFollow(ctx, io.Discard, opts, 50, time.Time{}, time.Second, false); err != nil {
+		t.Fatalf("runAuditFollow: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("follow took %s to stop, want it cancelled with ctx", elapsed)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("cancelled poll reported as a failure: %q", stderr.String())
+	}
+}
+
+// TestRunAuditRotate_Confirmation verifies that the flushed count is printed
+// with --yes and that a non-interactive run without it never contacts the
+// core.
+func TestRunAuditRotate_Confirmation(t *testing.T) {
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, []byte(`{"ok":true,"payload":{"flushed":12}}`))}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runAuditRotate(&out, strings.NewReader(""), opts, true, false); err != nil {
+		t.Fatalf("--yes: %v", err)
+	}
+	if out.String() != "flushed 12 audit entries\n" {
+		t.Errorf("--yes output = %q", out.String())
+	}
+
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, []byte(`{"ok":true,"payload":{"flushed":3}}`))}, timeout: 3 * time.Second, output: "json"}
+	out.Reset()
+	if err := runAuditRotate(&out, strings.NewReader("yes\n"), opts, false, true); err != nil {
+		t.Fatalf("confirmed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Flush the audit log on ") || !strings.Contains(out.String(), `"flushed": 3`) {
+		t.Errorf("confirmed output = %q", out.String())
+	}
+
+	for _, tt := range []struct {
+		name        string
+		input       string
+		interactive bool
+		wantErr     string
+	}{
+		{"declined", "n\n", true, "aborted"},
+		{"not a terminal", "y\n", false, "without --yes"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sock, accepted := stalledUDSServer(t)
+			opts := &rootOptions{socketPaths: []string{sock}, timeout: time.Second}
+			err := runAuditRotate(&bytes.Buffer{}, strings.NewReader(tt.input), opts, false, tt.interactive)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want error containing %q", err, tt.wantErr)
+			}
+			if n := accepted.Load(); n != 0 {
+				t.Errorf("core was contacted %d times", n)
+			}
+		})
+	}
+}
+
+// TestRunAuditRotate_NotImplemented verifies the friendly 501 message.
+func TestRunAuditRotate_NotImplemented(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{mockUDSServer(t, []byte(`{"ok":false,"error":"not implemented","code":501}`))},
+		timeout:     3 * time.Second,
+	}
+	err := runAuditRotate(&bytes.Buffer{}, strings.NewReader(""), opts, true, false)
+	if err == nil || !strings.Contains(err.Error(), "does not support audit_rotate") {
+		t.Errorf("expected not-supported error, got: %v", err)
+	}
+}
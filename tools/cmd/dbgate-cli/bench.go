@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// benchResult summarizes a bench run. Latency percentiles cover successful
+// requests only and are zero when there were none.
+type benchResult struct {
+	Concurrency int           `json:"concurrency"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	Requests    uint64        `json:"requests"`
+	Errors      uint64        `json:"errors"`
+	RPS         float64       `json:"requests_per_sec"`
+	ErrorRate   float64       `json:"error_rate"` // fraction of requests that failed, 0..1
+	P50         time.Duration `json:"p50_ns"`
+	P90         time.Duration `json:"p90_ns"`
+	P99         time.Duration `json:"p99_ns"`
+	Max         time.Duration `json:"max_ns"`
+	FirstError  string        `json:"first_error,omitempty"`
+}
+
+// newBenchCmd returns the hidden "bench" command, a load generator for
+// testing how the core copes with many simultaneous control-plane clients.
+func newBenchCmd(opts *rootOptions) *cobra.Command {
+	var (
+		concurrency int
+		duration    time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Load-test the core with concurrent stats requests",
+		Long: `Run --concurrency clients, each sending stats requests back to back for
+--duration, and report the achieved requests/s, the error rate and latency
+percentiles. Every request uses a fresh connection, as with the other
+commands. Ctrl+C stops early and still prints the summary.
+
+This is a load testing tool; do not point it at a production core.`,
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if concurrency <= 0 {
+				return fmt.Errorf("invalid --concurrency %d: must be positive", concurrency)
+			}
+			if duration <= 0 {
+				return fmt.Errorf("invalid --duration %s: must be positive", duration)
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			return runBench(ctx, cmd.OutOrStdout(), opts, concurrency, duration)
+		},
+	}
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", 50, "Number of concurrent clients")
+	cmd.Flags().DurationVarP(&duration, "duration", "d", 10*time.Second, "How long to run")
+	return cmd
+}
+
+// runBench runs concurrency workers, each with its own client, sending stats
+// until d has passed or ctx is cancelled, and prints the summary. Requests
+// cut off by the deadline are not counted. The command fails if no request
+// succeeded.
+func runBench(ctx context.Context, w io.Writer, opts *rootOptions, concurrency int, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	var (
+		requests, failures atomic.Uint64
+		errOnce            sync.Once
+		firstErr           error
+		wg                 sync.WaitGroup
+	)
+	latencies := make([][]time.Duration, concurrency)
+	start := time.Now()
+	deadline, _ := ctx.Deadline()
+	// ctx reports the deadline only once its timer has run, so a request
+	// failing right at the deadline is recognized by the clock instead.
+	done := func() bool { return ctx.Err() != nil || !time.Now().Before(deadline) }
+	for i := range concurrency {
+		c := opts.newClient()
+		wg.Go(func() {
+			for !done() {
+				t := time.Now()
+				_, err := c.GetStatsContext(ctx)
+				if done() {
+					return
+				}
+				requests.Add(1)
+				if err != nil {
+					failures.Add(1)
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				latencies[i] = append(latencies[i], time.Since(t))
+			}
+		})
+	}
+	wg.Wait()
+
+	res := summarizeBench(slices.Concat(latencies...), requests.Load(), failures.Load(), time.Since(start))
+	res.Concurrency = concurrency
+	if firstErr != nil {
+		res.FirstError = firstErr.Error()
+	}
+
+	if isJSONOutput(opts.output) {
+		if err := writeRecord(w, opts.output, res); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(w, "--- %s bench: %d clients for %s ---\n", opts.socketPath(), concurrency, res.Elapsed.Round(time.Millisecond))
+		fmt.Fprintf(w, "%d requests, %d errors (%.2f%%), %.1f requests/s\n", res.Requests, res.Errors, res.ErrorRate*100, res.RPS)
+		if res.Requests > res.Errors {
+			fmt.Fprintf(w, "latency p50/p90/p99/max = %s/%s/%s/%s\n",
+				formatMillis(res.P50), formatMillis(res.P90), formatMillis(res.P99), formatMillis(res.Max))
+		}
+		if res.FirstError != "" {
+			fmt.Fprintf(w, "first error: %s\n", res.FirstError)
+		}
+	}
+
+	if res.Requests == res.Errors {
+		return recordedError(opts, errors.New("bench: no request succeeded"))
+	}
+	return nil
+}
+
+// summarizeBench computes the rates and latency percentiles of a run that
+// completed requests, failures of them, in elapsed, with one latency per
+// successful request.
+func summarizeBench(latencies []time.Duration, requests, failures uint64, elapsed time.Duration) benchResult {
+	res := benchResult{Elapsed: elapsed, Requests: requests, Errors: failures}
+	if elapsed > 0 {
+		res.RPS = float64(requests) / elapsed.Seconds()
+	}
+	if requests > 0 {
+		res.ErrorRate = float64(failures) / float64(requests)
+	}
+	if len(latencies) == 0 {
+		return res
+	}
+	slices.Sort(latencies)
+	res.P50 = percentile(latencies, 0.50)
+	res.P90 = percentile(latencies, 0.90)
+	res.P99 = percentile(latencies, 0.99)
+	res.Max = latencies[len(latencies)-1]
+	return res
+}
+
+// percentile returns the nearest-rank p-th percentile (0 < p <= 1) of sorted,
+// which must not be empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSummarizeBench verifies the rates and nearest-rank percentiles.
+func TestSummarizeBench(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	got := summarizeBench(latencies, 125, 25, 5*time.Second)
+	want := benchResult{
+		Elapsed: 5 * time.Second, Requests: 125, Errors: 25, RPS: 25, ErrorRate: 0.2,
+		P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := summarizeBench(nil, 3, 3, time.Second); got.P50 != 0 || got.ErrorRate != 1 {
+		t.Errorf("all failed: got %+v", got)
+	}
+}
+
+// TestRunBench verifies that a short run against a mock core completes
+// requests on every worker and stops at the deadline, and that a run in
+// which nothing succeeds fails.
+func TestRunBench(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))},
+		timeout:     3 * time.Second,
+		output:      outputJSON,
+	}
+	var out bytes.Buffer
+	start := time.Now()
+	if err := runBench(context.Background(), &out, opts, 4, 200*time.Millisecond); err != nil {
+		t.Fatalf("runBench: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("workers did not stop at the deadline: took %v", elapsed)
+	}
+	var res benchResult
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if res.Requests == 0 || res.Errors == res.Requests || res.Concurrency != 4 || res.P50 <= 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	opts = &rootOptions{socketPaths: []string{filepath.Join(t.TempDir(), "missing.sock")}, timeout: time.Second}
+	out.Reset()
+	err := runBench(context.Background(), &out, opts, 2, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no request succeeded") {
+		t.Errorf("expected failure, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "first error: ") {
+		t.Errorf("output missing the first error:\n%s", out.String())
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// capabilitiesEntry is a cached answer to the capabilities command: the
+// commands the core implements, or ErrNotImplemented for a core that predates
+// it.
+type capabilitiesEntry struct {
+	commands []string
+	err      error
+}
+
+// newCapabilitiesCmd returns the "capabilities" subcommand.
+func newCapabilitiesCmd(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "capabilities",
+		Short: "List the commands the dbgate core supports",
+		Long: `List the protocol commands the connected core implements, one per line,
+or as {"commands": [...]} with --output json.
+
+The list is cached for 10 minutes per socket under the user cache directory,
+e.g. ~/.cache/dbgate/capabilities.json, together with the protocol version
+checked before the first command; a core reporting a new version invalidates
+it. --refresh-capabilities asks the core again, --no-capability-cache skips
+the cache.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCapabilities(cmd.OutOrStdout(), opts)
+		},
+	}
+}
+
+// runCapabilities prints the commands the core implements.
+func runCapabilities(w io.Writer, opts *rootOptions) error {
+	commands, err := opts.capabilities(opts.socketPath())
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("capabilities", "capabilities")
+	}
+	if err != nil {
+		return fmt.Errorf("capabilities: %w", err)
+	}
+	if isJSONOutput(opts.output) {
+		return writeRecord(w, opts.output, client.CapabilitiesResult{Commands: commands})
+	}
+	for _, name := range commands {
+		fmt.Fprintln(w, name)
+	}
+	return nil
+}
+
+// capabilities returns the commands implemented by the core at socketPath.
+// The answer, including a core that does not implement capabilities at all,
+// is cached for the life of the process and in the capability cache; other
+// errors are not.
+func (o *rootOptions) capabilities(socketPath string) ([]string, error) {
+	o.capsMu.Lock()
+	defer o.capsMu.Unlock()
+	if e, ok := o.caps[socketPath]; ok {
+		return e.commands, e.err
+	}
+	e, ok := o.capCache.capabilities(socketPath)
+	if !ok {
+		commands, err := o.newClientFor(socketPath).Capabilities()
+		if err != nil && !errors.Is(err, client.ErrNotImplemented) {
+			return nil, err
+		}
+		e = capabilitiesEntry{commands: commands, err: err}
+		o.capCache.setCapabilities(socketPath, e)
+	}
+	if o.caps == nil {
+		o.caps = make(map[string]capabilitiesEntry)
+	}
+	o.caps[socketPath] = e
+	return e.commands, e.err
+}
+
+// checkCapability returns a notSupported error for name when the core is
+// known not to implement command. If the core cannot list its commands the
+// check passes, so the command itself is sent and reports what went wrong.
+func (o *rootOptions) checkCapability(name, command string) error {
+	commands, err := o.capabilities(o.socketPath())
+	if err != nil {
+		if o.logger != nil {
+			o.logger.Debug("skipping capability check", "command", command, "err", err)
+		}
+		return nil
+	}
+	if !slices.Contains(commands, command) {
+		return notSupported(name, command)
+	}
+	return nil
+}
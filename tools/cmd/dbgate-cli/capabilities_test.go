@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunCapabilities verifies the text and JSON listings.
+func TestRunCapabilities(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"commands":["stats","health","sessions"]}}`)
+	for _, tt := range []struct {
+		output string
+		want   string
+	}{
+		{outputText, "health\nsessions\nstats\n"},
+		{outputJSONL, `{"commands":["health","sessions","stats"]}` + "\n"},
+	} {
+		opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second, output: tt.output}
+		var out bytes.Buffer
+		if err := runCapabilities(&out, opts); err != nil {
+			t.Fatalf("%s: runCapabilities: %v", tt.output, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.output, out.String(), tt.want)
+		}
+	}
+
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, []byte(`{"ok":false,"code":501}`))}, timeout: 3 * time.Second}
+	err := runCapabilities(io.Discard, opts)
+	if exitCode(err) != exitServerError || !strings.Contains(err.Error(), "does not support capabilities") {
+		t.Errorf("old core: got %v (exit %d)", err, exitCode(err))
+	}
+}
+
+// TestCheckCapabilities verifies that a subcommand whose protocol command is
+// not listed is refused before it is sent, that the list is fetched once per
+// process, and that a core without the capabilities command is not checked
+// at all.
+func TestCheckCapabilities(t *testing.T) {
+	caps := []byte(`{"ok":true,"payload":{"commands":["sessions","stats"]}}`)
+	ok := []byte(`{"ok":true}`)
+	sock := mockUDSServerSeq(t, caps, ok)
+	opts := &rootOptions{}
+	run := func(args ...string) (string, error) {
+		cmd := newRootCmdWithOptions(opts)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(append([]string{"--socket", sock, "--no-version-check", "--check-capabilities"}, args...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("policy", "versions")
+	if exitCode(err) != exitServerError || !strings.Contains(err.Error(), "policy versions: this dbgate core does not support policy_versions") {
+		t.Errorf("unsupported command: got %v (exit %d)", err, exitCode(err))
+	}
+	if out, err := run("session", "list", "--no-payload"); err != nil || out != "[sessions] OK\n" {
+		t.Errorf("supported command: got %q, %v", out, err)
+	}
+	// The server now answers everything with the bare ok, which would be
+	// an empty list, so the full list must come from the cache.
+	if got, err := opts.capabilities(opts.socketPath()); err != nil || !reflect.DeepEqual(got, []string{"sessions", "stats"}) {
+		t.Errorf("cached capabilities: got %q, %v", got, err)
+	}
+
+	opts = &rootOptions{socketPaths: []string{mockUDSServerSeq(t, caps, ok)}, timeout: 3 * time.Second, checkCapabilities: true}
+	err = runRaw(io.Discard, opts, "policy_show", nil)
+	if exitCode(err) != exitServerError || !strings.Contains(err.Error(), "raw policy_show: this dbgate core does not support policy_show") {
+		t.Errorf("unsupported raw command: got %v (exit %d)", err, exitCode(err))
+	}
+
+	old := []byte(`{"ok":false,"error":"unknown command","code":501}`)
+	opts = &rootOptions{socketPaths: []string{mockUDSServerSeq(t, old, ok)}, timeout: 3 * time.Second, checkCapabilities: true}
+	var out bytes.Buffer
+	if err := runRaw(&out, opts, "policy_show", nil); err != nil {
+		t.Errorf("core without capabilities: %v", err)
+	}
+	if !strings.Contains(out.String(), `"ok": true`) {
+		t.Errorf("command was not sent:\n%s", out.String())
+	}
+}
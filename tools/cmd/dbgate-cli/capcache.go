@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// capabilityCacheFile is the capability cache under the user cache
+// directory, e.g. ~/.cache/dbgate/capabilities.json on Linux.
+const capabilityCacheFile = "dbgate/capabilities.json"
+
+// capabilityCacheTTL is how long a cached protocol version or command list
+// is used before the core is asked again.
+const capabilityCacheTTL = 10 * time.Minute
+
+// capabilityCache keeps the protocol version and command list each core
+// reported in a file, keyed by socket, so that short-lived runs within
+// capabilityCacheTTL skip the hello and capabilities round trips. It is best
+// effort: a file that cannot be read counts as empty, and one that cannot be
+// written only costs the next run a round trip. A nil *capabilityCache
+// caches nothing.
+type capabilityCache struct {
+	path    string
+	refresh bool // --refresh-capabilities: ignore what is cached but store what is fetched
+	now     func() time.Time
+	logger  *slog.Logger // may be nil
+
+	mu      sync.Mutex
+	entries map[string]capabilityCacheEntry // read from path on first use
+}
+
+// capabilityCacheEntry is what the cache file holds for one socket.
+type capabilityCacheEntry struct {
+	Version        int       `json:"version,omitempty"`
+	NoHello        bool      `json:"no_hello,omitempty"` // the core predates the hello command
+	VersionAt      time.Time `json:"version_at,omitzero"`
+	Commands       []string  `json:"commands,omitempty"`
+	NoCapabilities bool      `json:"no_capabilities,omitempty"` // the core predates the capabilities command
+	CommandsAt     time.Time `json:"commands_at,omitzero"`
+}
+
+// newCapabilityCache returns the cache in the user cache directory, or nil
+// if there is none.
+func newCapabilityCache(refresh bool, logger *slog.Logger) *capabilityCache {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		if logger != nil {
+			logger.Debug("not caching capabilities", "err", err)
+		}
+		return nil
+	}
+	return &capabilityCache{path: filepath.Join(dir, capabilityCacheFile), refresh: refresh, now: time.Now, logger: logger}
+}
+
+// version returns the cached protocol version of the core at socket, and
+// whether it is fresh enough to use.
+func (c *capabilityCache) version(socket string) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.load()[socket]
+	return e.Version, e.Version > 0 && c.fresh(e.VersionAt)
+}
+
+// setVersion stores the protocol version the core at socket reported. A
+// version other than the cached one drops the cached command list, which
+// may have changed with it.
+func (c *capabilityCache) setVersion(socket string, v int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.load()[socket]
+	if e.Version != v {
+		e.dropCommands()
+	}
+	e.Version, e.NoHello, e.VersionAt = v, false, c.now()
+	c.entries[socket] = e
+	c.save()
+}
+
+// noHello reports whether the core at socket is cached as one without the
+// hello command, which is fresh enough to skip the version check.
+func (c *capabilityCache) noHello(socket string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.load()[socket]
+	return e.NoHello && c.fresh(e.VersionAt)
+}
+
+// setNoHello stores that the core at socket does not implement hello.
+func (c *capabilityCache) setNoHello(socket string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.load()[socket]
+	if !e.NoHello {
+		e.dropCommands()
+	}
+	e.Version, e.NoHello, e.VersionAt = 0, true, c.now()
+	c.entries[socket] = e
+	c.save()
+}
+
+// dropCommands forgets the cached command list of an entry whose core was
+// replaced by one with another protocol version.
+func (e *capabilityCacheEntry) dropCommands() {
+	if e.Version != 0 || e.NoHello {
+		e.Commands, e.NoCapabilities, e.CommandsAt = nil, false, time.Time{}
+	}
+}
+
+// capabilities returns the cached answer of the core at socket to the
+// capabilities command, and whether it is fresh enough to use.
+func (c *capabilityCache) capabilities(socket string) (capabilitiesEntry, bool) {
+	if c == nil {
+		return capabilitiesEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.load()[socket]
+	if !c.fresh(e.CommandsAt) {
+		return capabilitiesEntry{}, false
+	}
+	if e.NoCapabilities {
+		return capabilitiesEntry{err: fmt.Errorf("capabilities (cached): %w", client.ErrNotImplemented)}, true
+	}
+	return capabilitiesEntry{commands: e.Commands}, true
+}
+
+// setCapabilities stores the answer of the core at socket to the
+// capabilities command.
+func (c *capabilityCache) setCapabilities(socket string, caps capabilitiesEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.load()[socket]
+	e.Commands, e.NoCapabilities = caps.commands, errors.Is(caps.err, client.ErrNotImplemented)
+	e.CommandsAt = c.now()
+	c.entries[socket] = e
+	c.save()
+}
+
+// fresh reports whether an entry fetched at t may be used.
+func (c *capabilityCache) fresh(t time.Time) bool {
+	return !c.refresh && !t.IsZero() && c.now().Sub(t) < capabilityCacheTTL
+}
+
+// load reads the cache file on first use and returns the entries. The caller
+// holds c.mu.
+func (c *capabilityCache) load() map[string]capabilityCacheEntry {
+	if c.entries != nil {
+		return c.entries
+	}
+	c.entries = make(map[string]capabilityCacheEntry)
+	data, err := os.ReadFile(c.path)
+	if err == nil {
+		err = json.Unmarshal(data, &c.entries)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.debug("ignoring the capability cache", err)
+		c.entries = make(map[string]capabilityCacheEntry)
+	}
+	return c.entries
+}
+
+// save writes the entries to the cache file, through a temporary file so
+// that a concurrent run never reads a partial one. The caller holds c.mu.
+func (c *capabilityCache) save() {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		c.debug("not saving the capability cache", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		c.debug("not saving the capability cache", err)
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), ".capabilities-*.json")
+	if err != nil {
+		c.debug("not saving the capability cache", err)
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		c.debug("not saving the capability cache", err)
+	}
+}
+
+// debug logs a cache problem, which never fails a command.
+func (c *capabilityCache) debug(msg string, err error) {
+	if c.logger != nil {
+		c.logger.Debug(msg, "path", c.path, "err", err)
+	}
+}
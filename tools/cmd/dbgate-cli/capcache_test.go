@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// TestMain points the user cache directory at a temporary one, so that runs
+// through the root command do not write the capability cache of the user
+// running the tests.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "dbgate-cli-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_ = os.Setenv("XDG_CACHE_HOME", dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// capabilitiesJSON is a capabilities reply listing commands.
+func capabilitiesJSON(commands string) []byte {
+	return []byte(`{"ok":true,"payload":{"commands":[` + commands + `]}}`)
+}
+
+// TestCapabilityCache verifies that fetched capabilities are written to the
+// file and used by the next run instead of a round trip until the TTL
+// expires, and that a new protocol version or --refresh-capabilities makes
+// the next run ask again.
+func TestCapabilityCache(t *testing.T) {
+	sock := mockUDSServerSeq(t, capabilitiesJSON(`"ping","stats"`), capabilitiesJSON(`"ping"`))
+	path := filepath.Join(t.TempDir(), "capabilities.json")
+	now := time.Now()
+	run := func(refresh bool) []string {
+		t.Helper()
+		opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second}
+		opts.capCache = &capabilityCache{path: path, refresh: refresh, now: func() time.Time { return now }}
+		commands, err := opts.capabilities(sock)
+		if err != nil {
+			t.Fatalf("capabilities: %v", err)
+		}
+		return commands
+	}
+
+	if got := run(false); !reflect.DeepEqual(got, []string{"ping", "stats"}) {
+		t.Fatalf("first run: got %v", got)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("cache not written: %v", err)
+	}
+	now = now.Add(capabilityCacheTTL - time.Second)
+	if got := run(false); !reflect.DeepEqual(got, []string{"ping", "stats"}) {
+		t.Errorf("within the TTL: got %v, want the cached list", got)
+	}
+	now = now.Add(2 * time.Second)
+	if got := run(false); !reflect.DeepEqual(got, []string{"ping"}) {
+		t.Errorf("after the TTL: got %v, want a fresh list", got)
+	}
+
+	// The list fetched after the TTL was cached in turn; --refresh-capabilities
+	// ignores it, and so does a run after the core reported a new version.
+	cache := &capabilityCache{path: path, now: func() time.Time { return now }}
+	if _, ok := cache.capabilities(sock); !ok {
+		t.Fatal("expected the refetched list to be cached")
+	}
+	if _, ok := (&capabilityCache{path: path, refresh: true, now: time.Now}).capabilities(sock); ok {
+		t.Error("--refresh-capabilities should ignore the cached list")
+	}
+	cache.setVersion(sock, 1)
+	if v, ok := cache.version(sock); !ok || v != 1 {
+		t.Errorf("version = %d, %v; want 1, true", v, ok)
+	}
+	if _, ok := cache.capabilities(sock); !ok {
+		t.Error("the first version seen should keep the cached list")
+	}
+	cache.setVersion(sock, 2)
+	if _, ok := (&capabilityCache{path: path, now: time.Now}).capabilities(sock); ok {
+		t.Error("a new version should invalidate the cached list")
+	}
+}
+
+// TestCapabilityCache_NotImplemented verifies that a core without the
+// capabilities command is cached as such.
+func TestCapabilityCache_NotImplemented(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capabilities.json")
+	(&capabilityCache{path: path, now: time.Now}).setCapabilities("/run/dbgate.sock",
+		capabilitiesEntry{err: fmt.Errorf("capabilities: %w", client.ErrNotImplemented)})
+	e, ok := (&capabilityCache{path: path, now: time.Now}).capabilities("/run/dbgate.sock")
+	if !ok || !errors.Is(e.err, client.ErrNotImplemented) {
+		t.Errorf("got %+v, %v; want a cached ErrNotImplemented", e, ok)
+	}
+}
+
+// TestCapabilityCache_Flags verifies --refresh-capabilities and
+// --no-capability-cache through the root command.
+func TestCapabilityCache_Flags(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	sock := mockUDSServerSeq(t, capabilitiesJSON(`"stats"`), capabilitiesJSON(`"health"`), capabilitiesJSON(`"ping"`))
+	for _, tt := range []struct {
+		flag string
+		want string
+	}{
+		{"", "stats\n"},
+		{"", "stats\n"},
+		{"--refresh-capabilities", "health\n"},
+		{"", "health\n"},
+		{"--no-capability-cache", "ping\n"},
+		{"", "health\n"},
+	} {
+		args := []string{"--socket", sock, "--no-version-check"}
+		if tt.flag != "" {
+			args = append(args, tt.flag)
+		}
+		root := newRootCmd()
+		var out bytes.Buffer
+		root.SetOut(&out)
+		root.SetArgs(append(args, "capabilities"))
+		if err := root.Execute(); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%v: got %q, want %q", args, out.String(), tt.want)
+		}
+	}
+}
+
+// TestCapabilityCache_Version verifies that the version reported to the
+// check before the first command is cached and spares the next run its
+// hello.
+func TestCapabilityCache_Version(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	// A second hello would get the ok reply and warn about version 0.
+	sock := mockUDSServerSeq(t, []byte(`{"ok":true,"payload":{"version":1}}`), []byte(`{"ok":true}`))
+	for i := range 2 {
+		root := newRootCmd()
+		var stderr bytes.Buffer
+		root.SetOut(io.Discard)
+		root.SetErr(&stderr)
+		root.SetArgs([]string{"--socket", sock, "ping", "-c", "1"})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("run %d: unexpected stderr %q", i+1, stderr.String())
+		}
+	}
+	if v, ok := newCapabilityCache(false, nil).version(sock); !ok || v != 1 {
+		t.Errorf("cached version = %d, %v; want 1, true", v, ok)
+	}
+}
+
+// TestCapabilityCache_VersionOnFailure verifies that the version is cached
+// even when the command after the check fails.
+func TestCapabilityCache_VersionOnFailure(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	sock := mockUDSServerSeq(t, []byte(`{"ok":true,"payload":{"version":1}}`), []byte(`{"ok":false,"error":"boom"}`))
+	root := newRootCmd()
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--socket", sock, "stats"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected the stats command to fail")
+	}
+	if v, ok := newCapabilityCache(false, nil).version(sock); !ok || v != 1 {
+		t.Errorf("cached version = %d, %v; want 1, true", v, ok)
+	}
+}
+
+// TestCapabilityCache_NoHello verifies that a core without hello is cached as
+// such and that the next run skips its version check.
+func TestCapabilityCache_NoHello(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	// A second hello would get the ok reply and warn about version 0.
+	sock := mockUDSServerSeq(t, []byte(`{"ok":false,"error":"unknown command","code":501}`), []byte(`{"ok":true}`))
+	for i := range 2 {
+		root := newRootCmd()
+		var stderr bytes.Buffer
+		root.SetOut(io.Discard)
+		root.SetErr(&stderr)
+		root.SetArgs([]string{"--socket", sock, "ping", "-c", "1"})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("run %d: unexpected stderr %q", i+1, stderr.String())
+		}
+	}
+	cache := newCapabilityCache(false, nil)
+	if !cache.noHello(sock) {
+		t.Error("expected the core to be cached as one without hello")
+	}
+	cache.setVersion(sock, 1)
+	if cache.noHello(sock) {
+		t.Error("a reported version should clear the cached lack of hello")
+	}
+}
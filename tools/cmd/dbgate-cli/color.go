@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Values accepted by --color.
+const (
+	colorAuto   = "auto"   // color only when stdout is a terminal
+	colorAlways = "always" // color even when piped
+	colorNever  = "never"
+)
+
+// envNoColor disables color whatever --color says when set to a non-empty
+// value; see https://no-color.org.
+const envNoColor = "NO_COLOR"
+
+// validateColor checks a --color value.
+func validateColor(policy string) error {
+	switch policy {
+	case colorAuto, colorAlways, colorNever:
+		return nil
+	}
+	return fmt.Errorf("invalid --color %q: must be %s, %s or %s", policy, colorAuto, colorAlways, colorNever)
+}
+
+// resolveColor applies the color policy: a non-empty NO_COLOR wins, then
+// always and never, and auto follows whether stdout is a terminal.
+func resolveColor(policy, noColor string, terminal bool) bool {
+	if noColor != "" {
+		return false
+	}
+	switch policy {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	return terminal
+}
+
+// colorEnabled reports whether commands may write ANSI colors to stdout.
+// Every colored output consults it rather than checking the flags itself.
+func (o *rootOptions) colorEnabled() bool {
+	if o.noColor {
+		return false
+	}
+	return resolveColor(o.color, os.Getenv(envNoColor), o.stdout != nil && isTerminal(o.stdout))
+}
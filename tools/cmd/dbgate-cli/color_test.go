@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResolveColor verifies each --color value with and without a terminal,
+// and that NO_COLOR overrides all of them.
+func TestResolveColor(t *testing.T) {
+	tests := []struct {
+		policy   string
+		noColor  string
+		terminal bool
+		want     bool
+	}{
+		{colorAuto, "", true, true},
+		{colorAuto, "", false, false},
+		{colorAlways, "", false, true},
+		{colorAlways, "", true, true},
+		{colorNever, "", true, false},
+		{colorAlways, "1", true, false},
+		{colorAuto, "1", true, false},
+	}
+	for _, tt := range tests {
+		if got := resolveColor(tt.policy, tt.noColor, tt.terminal); got != tt.want {
+			t.Errorf("resolveColor(%q, NO_COLOR=%q, terminal=%v) = %v, want %v",
+				tt.policy, tt.noColor, tt.terminal, got, tt.want)
+		}
+	}
+}
+
+// TestColorFlag verifies that policy diff follows --color, --no-color and
+// NO_COLOR, and that invalid or conflicting flags are rejected.
+func TestColorFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("version: 2\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	sock := mockUDSServer(t, []byte(`{"ok":true,"payload":{"policy":"version: 1\n"}}`))
+
+	tests := []struct {
+		name      string
+		args      []string
+		noColor   string
+		wantColor bool
+		wantErr   string
+	}{
+		{"auto, not a terminal", nil, "", false, ""},
+		{"always", []string{"--color=always"}, "", true, ""},
+		{"never", []string{"--color=never"}, "", false, ""},
+		{"no-color", []string{"--no-color"}, "", false, ""},
+		{"NO_COLOR overrides always", []string{"--color=always"}, "1", false, ""},
+		{"invalid", []string{"--color=sometimes"}, "", false, "invalid --color"},
+		{"conflicting", []string{"--color=always", "--no-color"}, "", false, "none of the others can be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envNoColor, tt.noColor)
+			var out bytes.Buffer
+			cmd := newRootCmd()
+			cmd.SetOut(&out)
+			cmd.SetErr(&bytes.Buffer{})
+			cmd.SetArgs(append([]string{"--socket", sock, "policy", "diff", path}, tt.args...))
+			err := cmd.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if got := strings.Contains(out.String(), colorRed); got != tt.wantColor {
+				t.Errorf("colored = %v, want %v:\n%q", got, tt.wantColor, out.String())
+			}
+		})
+	}
+}
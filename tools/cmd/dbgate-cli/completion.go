@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the live lookups done during tab completion so a
+// hung or missing core never stalls the shell.
+const completionTimeout = 500 * time.Millisecond
+
+// newCompletionCmd returns the "completion" subcommand, which prints a shell
+// completion script generated by cobra for root.
+func newCompletionCmd(root *cobra.Command) *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate a shell completion script",
+		Long: `Generate a shell completion script for dbgate-cli.
+
+  bash:       source <(dbgate-cli completion bash)
+  zsh:        dbgate-cli completion zsh > "${fpath[1]}/_dbgate-cli"
+  fish:       dbgate-cli completion fish > ~/.config/fish/completions/dbgate-cli.fish
+  powershell: dbgate-cli completion powershell | Out-String | Invoke-Expression
+
+Besides subcommands and flags, "session kill <TAB>" offers the IDs of the
+sessions currently active on the core.`,
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return writeCompletion(cmd.OutOrStdout(), root, args[0])
+		},
+	}
+}
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(w io.Writer, root *cobra.Command, shell string) error {
+	var err error
+	switch shell {
+	case "bash":
+		err = root.GenBashCompletionV2(w, true)
+	case "zsh":
+		err = root.GenZshCompletion(w)
+	case "fish":
+		err = root.GenFishCompletion(w, true)
+	case "powershell":
+		err = root.GenPowerShellCompletionWithDesc(w)
+	default:
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+	if err != nil {
+		return fmt.Errorf("generate %s completion: %w", shell, err)
+	}
+	return nil
+}
+
+// completeSessionIDs offers the IDs of live sessions for "session kill". Any
+// failure, including an unreachable socket, yields no suggestions.
+func completeSessionIDs(opts *rootOptions) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		// cobra parses the flags twice while completing, so a --socket value
+		// shows up twice; "session kill" only ever uses the first one.
+		if len(opts.socketPaths) > 1 {
+			opts.socketPaths = opts.socketPaths[:1]
+		}
+		// Persistent hooks do not run during completion; apply --addr, TLS
+		// and validation the same way a real invocation would.
+		if root := cmd.Root(); root.PersistentPreRunE != nil {
+			if err := root.PersistentPreRunE(cmd, args); err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+		}
+		if opts.timeout <= 0 || opts.timeout > completionTimeout {
+			opts.timeout = completionTimeout
+		}
+		opts.retries = 0
+
+		sessions, err := opts.newClient().ListSessions()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		ids := make([]cobra.Completion, 0, len(sessions))
+		for _, s := range sessions {
+			ids = append(ids, cobra.CompletionWithDesc(s.ID, fmt.Sprintf("%s@%s from %s", s.User, s.Database, s.ClientAddr)))
+		}
+		return ids, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// completeSessionKill runs the hidden __complete command for "session kill"
+// and returns the offered candidates without descriptions.
+func completeSessionKill(t *testing.T, socket string) []string {
+	t.Helper()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"__complete", "--socket", socket, "session", "kill", ""})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("__complete: %v", err)
+	}
+
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue // directive line
+		}
+		id, _, _ := strings.Cut(line, "\t")
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// TestCompleteSessionIDs verifies that live session IDs are offered for
+// "session kill" and that an unreachable socket yields no suggestions.
+func TestCompleteSessionIDs(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","client_addr":"10.0.0.5:51234","database":"app","user":"svc","state":"idle","started_at_ms":0,"query_count":1},` +
+		`{"id":"s2","client_addr":"10.0.0.6:40000","database":"app","user":"bi","state":"active","started_at_ms":0,"query_count":2}]}`)
+
+	got := completeSessionKill(t, mockUDSServer(t, respJSON))
+	if strings.Join(got, ",") != "s1,s2" {
+		t.Errorf("got candidates %v, want [s1 s2]", got)
+	}
+
+	if got := completeSessionKill(t, filepath.Join(t.TempDir(), "missing.sock")); len(got) != 0 {
+		t.Errorf("expected no candidates for an unreachable socket, got %v", got)
+	}
+}
+
+// TestCompletionCommand verifies that a script is generated for each shell
+// and that unknown shells are rejected.
+func TestCompletionCommand(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		cmd := newRootCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"completion", shell})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("completion %s: %v", shell, err)
+		}
+		if !strings.Contains(out.String(), "dbgate-cli") {
+			t.Errorf("completion %s: script does not mention dbgate-cli", shell)
+		}
+	}
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"completion", "tcsh"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error for an unsupported shell")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultConfigFile is the profile file looked up under the home directory
+// when --config is not given.
+const defaultConfigFile = ".dbgate/config.yaml"
+
+// profile is one named entry under "profiles:" in the config file. Empty
+// fields leave the corresponding flag at its default.
+type profile struct {
+	Socket  string        `mapstructure:"socket"`
+	Addr    string        `mapstructure:"addr"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	Output  string        `mapstructure:"output"`
+	TLS     struct {
+		CA         string `mapstructure:"ca"`
+		Cert       string `mapstructure:"cert"`
+		Key        string `mapstructure:"key"`
+		ServerName string `mapstructure:"server_name"`
+		Insecure   bool   `mapstructure:"insecure"`
+	} `mapstructure:"tls"`
+}
+
+// defaultConfigPath returns ~/.dbgate/config.yaml, or "" if the home
+// directory cannot be determined.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, defaultConfigFile)
+}
+
+// loadProfile reads the config file at path and returns the named profile.
+// Profile names are matched case-insensitively, as viper lowercases keys.
+func loadProfile(path, name string) (*profile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--profile %s: no --config given and the home directory is unknown", name)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	var profiles map[string]profile
+	if err := v.UnmarshalKey("profiles", &profiles); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	p, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: %s defines no profiles", name, path)
+		}
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return &p, nil
+}
+
+// applyProfile fills in every setting of p that was not given as a flag or,
+// for the socket and timeout, through the environment. Precedence is
+// therefore flag > env > profile > built-in default.
+func applyProfile(cmd *cobra.Command, opts *rootOptions, p *profile) error {
+	flags := cmd.Flags()
+	unset := func(name string) bool { return !flags.Changed(name) }
+
+	if p.Socket != "" && unset("socket") && os.Getenv(envSocket) == "" {
+		opts.socketPaths = []string{p.Socket}
+	}
+	if p.Addr != "" && unset("addr") && unset("socket") {
+		opts.addr = p.Addr
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("profile timeout %s: must be positive", p.Timeout)
+	}
+	if p.Timeout > 0 && unset("timeout") && os.Getenv(envTimeout) == "" {
+		opts.timeout = p.Timeout
+	}
+	if p.Output != "" && unset("output") {
+		opts.output = p.Output
+	}
+
+	if p.TLS.CA != "" && unset("tls-ca") {
+		opts.tls.caFile = p.TLS.CA
+	}
+	if p.TLS.Cert != "" && unset("tls-cert") {
+		opts.tls.certFile = p.TLS.Cert
+	}
+	if p.TLS.Key != "" && unset("tls-key") {
+		opts.tls.keyFile = p.TLS.Key
+	}
+	if p.TLS.ServerName != "" && unset("tls-server-name") {
+		opts.tls.serverName = p.TLS.ServerName
+	}
+	if p.TLS.Insecure && unset("tls-insecure") {
+		opts.tls.insecure = true
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with a "prod" and a "staging" profile.
+func writeConfig(t *testing.T, prodSocket string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `profiles:
+  prod:
+    socket: ` + prodSocket + `
+    timeout: 1500ms
+    output: json
+  staging:
+    socket: /nonexistent/staging.sock
+    timeout: 10s
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+// TestProfile verifies that the selected profile's socket, timeout and output
+// are used.
+func TestProfile(t *testing.T) {
+	t.Setenv(envSocket, "")
+	t.Setenv(envTimeout, "")
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	path := writeConfig(t, sock)
+
+	opts := &rootOptions{}
+	cmd := newRootCmdWithOptions(opts)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--config", path, "--profile", "prod", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got := opts.socketPath(); got != sock {
+		t.Errorf("socket: got %q, want %q", got, sock)
+	}
+	if opts.timeout != 1500*time.Millisecond {
+		t.Errorf("timeout: got %s, want 1.5s", opts.timeout)
+	}
+	if !strings.Contains(out.String(), `"total_queries": 100`) {
+		t.Errorf("expected JSON output from the profile, got:\n%s", out.String())
+	}
+}
+
+// TestProfile_Precedence verifies flag > env > profile.
+func TestProfile_Precedence(t *testing.T) {
+	t.Setenv(envSocket, "")
+	t.Setenv(envTimeout, "4s")
+	path := writeConfig(t, "/nonexistent/prod.sock")
+
+	opts := &rootOptions{}
+	cmd := newRootCmdWithOptions(opts)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--config", path, "--profile", "staging", "--socket", "/flag.sock", "health"})
+	_ = cmd.Execute()
+
+	if got := opts.socketPath(); got != "/flag.sock" {
+		t.Errorf("socket: got %q, want the --socket flag", got)
+	}
+	if opts.timeout != 4*time.Second {
+		t.Errorf("timeout: got %s, want 4s from %s", opts.timeout, envTimeout)
+	}
+}
+
+// TestProfile_Unknown verifies that an unknown profile lists the available
+// ones.
+func TestProfile_Unknown(t *testing.T) {
+	path := writeConfig(t, "/nonexistent/prod.sock")
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--config", path, "--profile", "qa", "stats"})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "qa" (available: prod, staging)`) {
+		t.Fatalf("expected unknown-profile error, got: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// statsCSVHeader is the column order of --output csv for stats. Multi-socket
+// tables prepend a "socket" column.
+var statsCSVHeader = []string{
+	"captured_at", "qps", "block_rate", "active_sessions", "total_queries",
+	"blocked_queries", "monitored_blocks", "total_connections",
+}
+
+// sessionsCSVHeader is the column order of --output csv for sessions.
+var sessionsCSVHeader = []string{
+	"id", "client_addr", "user", "database", "state", "started_at", "query_count",
+}
+
+// csvDelimiter is a pflag.Value for the --csv-delimiter field separator: a
+// single character, or "tab" or "\t" for a tab. The zero value means a comma.
+type csvDelimiter rune
+
+// String implements pflag.Value.
+func (d *csvDelimiter) String() string {
+	switch *d {
+	case 0:
+		return ","
+	case '\t':
+		return `\t`
+	}
+	return string(rune(*d))
+}
+
+// Set implements pflag.Value.
+func (d *csvDelimiter) Set(v string) error {
+	if v == "tab" || v == `\t` {
+		v = "\t"
+	}
+	r, size := utf8.DecodeRuneInString(v)
+	if size == 0 || size != len(v) {
+		return fmt.Errorf("invalid CSV delimiter %q: must be a single character", v)
+	}
+	if r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return fmt.Errorf("invalid CSV delimiter %q: cannot be a quote or line break", v)
+	}
+	*d = csvDelimiter(r)
+	return nil
+}
+
+// Type implements pflag.Value.
+func (d *csvDelimiter) Type() string {
+	return "char"
+}
+
+// newCSVWriter returns a CSV writer to w separating fields with comma. Fields
+// containing the delimiter, a quote or a line break are quoted.
+func newCSVWriter(w io.Writer, comma csvDelimiter) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if comma != 0 {
+		cw.Comma = rune(comma)
+	}
+	return cw
+}
+
+// csvTime formats t as ISO-8601 in UTC.
+func csvTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// statsCSVRecord returns the data row for snap in statsCSVHeader order.
+func statsCSVRecord(snap *client.StatsSnapshot) []string {
+	return []string{
+		csvTime(snap.CapturedAt),
+		strconv.FormatFloat(snap.QPS, 'f', -1, 64),
+		strconv.FormatFloat(snap.BlockRate, 'f', -1, 64),
+		strconv.FormatUint(snap.ActiveSessions, 10),
+		strconv.FormatUint(snap.TotalQueries, 10),
+		strconv.FormatUint(snap.BlockedQueries, 10),
+		strconv.FormatUint(snap.MonitoredBlocks, 10),
+		strconv.FormatUint(snap.TotalConnections, 10),
+	}
+}
+
+// writeStatsCSV writes one row per reachable instance, preceded by the column
+// names when header is set. With perSocket the first column is the socket
+// path; otherwise results must hold a single snapshot (single socket or
+// aggregate). Unreachable instances are left out and reported by the caller's
+// error.
+func writeStatsCSV(w io.Writer, comma csvDelimiter, results []instanceStats, perSocket, header bool) error {
+	cw := newCSVWriter(w, comma)
+	if header {
+		h := statsCSVHeader
+		if perSocket {
+			h = append([]string{"socket"}, h...)
+		}
+		if err := cw.Write(h); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+	}
+	for _, r := range results {
+		if r.snap == nil {
+			continue
+		}
+		rec := statsCSVRecord(r.snap)
+		if perSocket {
+			rec = append([]string{r.socket}, rec...)
+		}
+		if err := cw.Write(rec); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+	}
+	return flushCSV(cw)
+}
+
+// streamSessionsCSV writes a header row plus one row per session matching
+// filter, as the sessions arrive from c.
+func streamSessionsCSV(ctx context.Context, w io.Writer, comma csvDelimiter, c *client.Client, filter client.SessionFilter) error {
+	cw := newCSVWriter(w, comma)
+	if err := cw.Write(sessionsCSVHeader); err != nil {
+		return fmt.Errorf("write CSV: %w", err)
+	}
+	err := c.StreamSessions(ctx, filter, func(s client.Session) error {
+		if err := cw.Write(sessionCSVRecord(s)); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+		return nil
+	})
+	if ferr := flushCSV(cw); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// writeSessionsCSV writes a header row plus one row per session.
+func writeSessionsCSV(w io.Writer, comma csvDelimiter, sessions []client.Session) error {
+	cw := newCSVWriter(w, comma)
+	if err := cw.Write(sessionsCSVHeader); err != nil {
+		return fmt.Errorf("write CSV: %w", err)
+	}
+	for _, s := range sessions {
+		if err := cw.Write(sessionCSVRecord(s)); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+	}
+	return flushCSV(cw)
+}
+
+// sessionCSVRecord returns the data row for s in sessionsCSVHeader order.
+func sessionCSVRecord(s client.Session) []string {
+	return []string{
+		s.ID, s.ClientAddr, s.User, s.Database, s.State,
+		csvTime(s.StartedAt), strconv.FormatUint(s.QueryCount, 10),
+	}
+}
+
+// flushCSV flushes cw and reports any buffered write error.
+func flushCSV(cw *csv.Writer) error {
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write CSV: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// readCSV parses s back into records, failing the test on malformed CSV.
+func readCSV(t *testing.T, s string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewBufferString(s)).ReadAll()
+	if err != nil {
+		t.Fatalf("parse CSV: %v\n%s", err, s)
+	}
+	return records
+}
+
+// TestRunStats_OutputCSV verifies the stats header and data row.
+func TestRunStats_OutputCSV(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(200, 50, 12.5, 1700000000000))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, output: outputCSV}
+
+	var out bytes.Buffer
+	if err := runStats(context.Background(), &out, opts, false, false); err != nil {
+		t.Fatalf("runStats: %v", err)
+	}
+	got := readCSV(t, out.String())
+	want := [][]string{
+		statsCSVHeader,
+		{"2023-11-14T22:13:20Z", "12.5", "0.25", "1", "200", "50", "0", "1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestRunStats_OutputCSVMultiSocket verifies the leading socket column.
+func TestRunStats_OutputCSVMultiSocket(t *testing.T) {
+	a := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	b := mockUDSServer(t, makeStatsResponse(300, 30, 2, 0))
+	opts := &rootOptions{socketPaths: []string{a, b}, timeout: 3 * time.Second, output: outputCSV}
+
+	var out bytes.Buffer
+	if err := runStats(context.Background(), &out, opts, false, false); err != nil {
+		t.Fatalf("runStats: %v", err)
+	}
+	got := readCSV(t, out.String())
+	if len(got) != 3 || got[0][0] != "socket" || got[1][0] != a || got[2][0] != b {
+		t.Fatalf("unexpected records: %v", got)
+	}
+	if got[2][5] != "300" {
+		t.Errorf("total_queries of %s: got %q, want 300", b, got[2][5])
+	}
+}
+
+// TestRunSessions_OutputCSV verifies the sessions header and one row per
+// session with ISO-8601 UTC timestamps.
+func TestRunSessions_OutputCSV(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","client_addr":"10.0.0.5:51234","database":"app","user":"svc",` +
+		`"state":"idle","started_at_ms":1700000000000,"query_count":42},` +
+		`{"id":"s2","client_addr":"10.0.0.6:40000","database":"app, reports","user":"bi",` +
+		`"state":"active","started_at_ms":1700000060000,"query_count":7}]}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second, output: outputCSV}
+
+	var out bytes.Buffer
+	if err := runSessions(context.Background(), &out, opts, false, client.SessionFilter{}, sessionOrder{}); err != nil {
+		t.Fatalf("runSessions: %v", err)
+	}
+	got := readCSV(t, out.String())
+	want := [][]string{
+		sessionsCSVHeader,
+		{"s1", "10.0.0.5:51234", "svc", "app", "idle", "2023-11-14T22:13:20Z", "42"},
+		{"s2", "10.0.0.6:40000", "bi", "app, reports", "active", "2023-11-14T22:14:20Z", "7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestRunStatsWatch_CSV verifies that watch mode prints the header once and
+// appends a data row per poll without clearing the screen.
+func TestRunStatsWatch_CSV(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, output: outputCSV, stderr: io.Discard}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var out bytes.Buffer
+	if err := runStatsWatch(ctx, &out, opts, false, false, 50*time.Millisecond); err != nil {
+		t.Fatalf("runStatsWatch: %v", err)
+	}
+	if bytes.Contains(out.Bytes(), []byte(clearScreen)) {
+		t.Errorf("CSV watch output must not clear the screen")
+	}
+	records := readCSV(t, out.String())
+	if len(records) < 3 {
+		t.Fatalf("expected a header and at least 2 rows, got %v", records)
+	}
+	if !reflect.DeepEqual(records[0], statsCSVHeader) {
+		t.Errorf("first record: got %v, want header", records[0])
+	}
+	for i, rec := range records[1:] {
+		if rec[0] == statsCSVHeader[0] {
+			t.Errorf("header repeated at row %d", i+1)
+		}
+	}
+}
+
+// TestCSVDelimiter verifies the accepted --csv-delimiter values.
+func TestCSVDelimiter(t *testing.T) {
+	for in, want := range map[string]csvDelimiter{";": ';', "|": '|', "tab": '\t', `\t`: '\t', "\t": '\t'} {
+		var d csvDelimiter
+		if err := d.Set(in); err != nil || d != want {
+			t.Errorf("Set(%q) = %q, %v; want %q", in, rune(d), err, rune(want))
+		}
+	}
+	for _, in := range []string{"", ";;", "ab", `"`, "\n", "\r"} {
+		var d csvDelimiter
+		if err := d.Set(in); err == nil || !strings.Contains(err.Error(), "invalid CSV delimiter") {
+			t.Errorf("Set(%q) should fail, got %v", in, err)
+		}
+	}
+}
+
+// TestRunSessions_CSVDelimiter verifies tab- and semicolon-separated output
+// through the root command, with a field containing the delimiter quoted.
+func TestRunSessions_CSVDelimiter(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","client_addr":"10.0.0.5:51234","database":"app;reports","user":"svc",` +
+		`"state":"idle","started_at_ms":1700000000000,"query_count":42}]}`)
+	for _, tt := range []struct {
+		delim string
+		want  string
+	}{
+		{"tab", "s1\t10.0.0.5:51234\tsvc\tapp;reports\tidle\t2023-11-14T22:13:20Z\t42\n"},
+		{";", `s1;10.0.0.5:51234;svc;"app;reports";idle;2023-11-14T22:13:20Z;42` + "\n"},
+	} {
+		root := newRootCmd()
+		var out bytes.Buffer
+		root.SetOut(&out)
+		root.SetArgs([]string{"--socket", mockUDSServer(t, respJSON), "--no-version-check",
+			"-o", "csv", "--csv-delimiter", tt.delim, "session", "list"})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("--csv-delimiter %s: %v", tt.delim, err)
+		}
+		lines := strings.SplitAfter(out.String(), "\n")
+		if len(lines) != 3 || lines[1] != tt.want {
+			t.Errorf("--csv-delimiter %s: got %q, want data row %q", tt.delim, out.String(), tt.want)
+		}
+		if sep := strings.ReplaceAll(tt.delim, "tab", "\t"); !strings.HasPrefix(lines[0], "id"+sep+"client_addr"+sep) {
+			t.Errorf("--csv-delimiter %s: header not separated by it: %q", tt.delim, lines[0])
+		}
+	}
+
+	root := newRootCmd()
+	root.SetOut(io.Discard)
+	root.SetArgs([]string{"--csv-delimiter", ";", "session", "list"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "requires --output csv") {
+		t.Errorf("--csv-delimiter without -o csv: got %v", err)
+	}
+}
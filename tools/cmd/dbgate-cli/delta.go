@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// statsDeltaJSON is the --output json form of stats --delta.
+type statsDeltaJSON struct {
+	Server   *client.StatsSnapshot `json:"server"`
+	Observed client.DeltaStats     `json:"observed"`
+}
+
+// statsDeltaCSVHeader is the column order of --output csv for stats --delta.
+var statsDeltaCSVHeader = []string{
+	"captured_at", "elapsed_seconds", "server_qps", "observed_qps",
+	"server_block_rate", "observed_block_rate", "queries", "blocked_queries", "reset",
+}
+
+// runStatsDelta takes two snapshots window apart and prints the last
+// server-reported rates next to the rates observed between the snapshots.
+func runStatsDelta(ctx context.Context, w io.Writer, opts *rootOptions, window time.Duration) error {
+	c := opts.newClient()
+	first, err := c.GetStatsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("stats: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("stats --delta: %w", ctx.Err())
+	case <-time.After(window):
+	}
+
+	second, err := c.GetStatsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("stats: %w", err)
+	}
+	d := client.ComputeDelta(first, second)
+
+	switch opts.output {
+	case outputJSON, outputJSONL:
+		return writeRecord(w, opts.output, statsDeltaJSON{Server: second, Observed: d})
+	case outputCSV:
+		cw := newCSVWriter(w, opts.csvDelimiter)
+		if err := cw.Write(statsDeltaCSVHeader); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+		rec := []string{
+			csvTime(second.CapturedAt),
+			strconv.FormatFloat(d.Elapsed.Seconds(), 'f', -1, 64),
+			strconv.FormatFloat(second.QPS, 'f', -1, 64),
+			strconv.FormatFloat(d.QPS, 'f', -1, 64),
+			strconv.FormatFloat(second.BlockRate, 'f', -1, 64),
+			strconv.FormatFloat(d.BlockRate, 'f', -1, 64),
+			strconv.FormatUint(d.Queries, 10),
+			strconv.FormatUint(d.BlockedQueries, 10),
+			strconv.FormatBool(d.Reset),
+		}
+		if err := cw.Write(rec); err != nil {
+			return fmt.Errorf("write CSV: %w", err)
+		}
+		return flushCSV(cw)
+	}
+
+	fmt.Fprintf(w, "=== dbgate stats (delta over %s) ===\n", d.Elapsed)
+	fmt.Fprintln(w, "                    Server  Observed")
+	fmt.Fprintf(w, "QPS:              %8.2f  %8.2f\n", second.QPS, d.QPS)
+	fmt.Fprintf(w, "Block Rate:       %7.2f%%  %7.2f%%\n", second.BlockRate*100, d.BlockRate*100)
+	fmt.Fprintf(w, "Queries:                    %8s\n", formatCounter(d.Queries, opts.human))
+	fmt.Fprintf(w, "Blocked Queries:            %8s\n", formatCounter(d.BlockedQueries, opts.human))
+	if d.Reset {
+		fmt.Fprintln(w, "Note: counters went backwards during the window (core restart?); observed values are partial.")
+	}
+	return nil
+}
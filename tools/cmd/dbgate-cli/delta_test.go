@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunStatsDelta verifies that server-reported and observed rates are
+// printed side by side.
+func TestRunStatsDelta(t *testing.T) {
+	sock := mockUDSServerSeq(t,
+		makeStatsResponse(1000, 10, 99, 1700000000000),
+		makeStatsResponse(1500, 60, 42, 1700000010000),
+	)
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second}
+
+	var out bytes.Buffer
+	if err := runStatsDelta(context.Background(), &out, opts, 10*time.Millisecond); err != nil {
+		t.Fatalf("runStatsDelta: %v", err)
+	}
+	for _, want := range []string{
+		"delta over 10s",
+		"QPS:                 42.00     50.00",
+		"Block Rate:          4.00%    10.00%",
+		"Queries:                         500",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Note:") {
+		t.Errorf("unexpected reset note:\n%s", out.String())
+	}
+}
+
+// TestRunStatsDelta_Reset verifies that a counter reset is called out.
+func TestRunStatsDelta_Reset(t *testing.T) {
+	sock := mockUDSServerSeq(t,
+		makeStatsResponse(1000, 10, 1, 1700000000000),
+		makeStatsResponse(20, 1, 1, 1700000010000),
+	)
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second}
+
+	var out bytes.Buffer
+	if err := runStatsDelta(context.Background(), &out, opts, time.Millisecond); err != nil {
+		t.Fatalf("runStatsDelta: %v", err)
+	}
+	if !strings.Contains(out.String(), "counters went backwards") {
+		t.Errorf("expected reset note:\n%s", out.String())
+	}
+}
+
+// TestStatsDelta_MultiSocket verifies that --delta rejects several sockets.
+func TestStatsDelta_MultiSocket(t *testing.T) {
+	cmd := newRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--socket", "a.sock", "--socket", "b.sock", "stats", "--delta", "1s"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "single --socket") {
+		t.Fatalf("expected single-socket error, got: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// deprecatedAlias returns a hidden command named oldName that keeps a renamed
+// command working: it shares target's flags and arguments, runs target, and
+// first prints a one-time warning on stderr pointing to replacement (the new
+// command line, e.g. "dbgate-cli session list").
+//
+// Register the alias next to where the old command used to live, as
+// "sessions" is for "session list". Warnings are suppressed with --no-deprecation-warnings.
+func deprecatedAlias(opts *rootOptions, oldName, replacement string, target *cobra.Command) *cobra.Command {
+	alias := &cobra.Command{
+		Use:         oldName,
+		Short:       fmt.Sprintf("Deprecated: use %q", replacement),
+		Hidden:      true,
+		Args:        target.Args,
+		Annotations: target.Annotations,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.warnDeprecated(cmd, replacement)
+			return target.RunE(cmd, args)
+		},
+	}
+	// Sharing the *pflag.Flag values binds the alias's flags to the same
+	// variables target reads.
+	alias.Flags().AddFlagSet(target.Flags())
+	return alias
+}
+
+// warnDeprecated prints the deprecation warning for cmd at most once per
+// process, unless warnings are disabled.
+func (o *rootOptions) warnDeprecated(cmd *cobra.Command, replacement string) {
+	if o.noDeprecationWarnings {
+		return
+	}
+	o.deprecationOnce.Do(func() {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %q is deprecated and will be removed in a future release; use %q instead.\n",
+			cmd.CommandPath(), replacement)
+	})
+}
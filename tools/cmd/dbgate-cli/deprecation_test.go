@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runSessionsAlias runs the deprecated "sessions" alias through the root
+// command with extra leading args against a core listing sessions s1 and s2.
+func runSessionsAlias(t *testing.T, args ...string) (stdout, stderr string) {
+	t.Helper()
+	sock := mockUDSServer(t, []byte(`{"ok":true,"payload":[{"id":"s1","user":"bob"},{"id":"s2","user":"eve"}]}`))
+	root := newRootCmd()
+	var out, errOut bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&errOut)
+	root.SetArgs(append(append([]string{"--socket", sock, "--no-version-check", "-o", "ids"}, args...), "sessions", "--user", "bob"))
+	if err := root.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	return out.String(), errOut.String()
+}
+
+// TestDeprecatedAlias verifies that "sessions" runs "session list" with its
+// flags and prints a single warning on stderr.
+func TestDeprecatedAlias(t *testing.T) {
+	stdout, stderr := runSessionsAlias(t)
+	if stdout != "s1\n" {
+		t.Errorf("alias did not run session list with its flags: got %q, want %q", stdout, "s1\n")
+	}
+	if c := strings.Count(stderr, "is deprecated"); c != 1 {
+		t.Errorf("expected exactly one warning, got %d: %q", c, stderr)
+	}
+	if !strings.Contains(stderr, `"dbgate-cli sessions" is deprecated`) || !strings.Contains(stderr, `"dbgate-cli session list"`) {
+		t.Errorf("warning should name the alias and point to the new command: %q", stderr)
+	}
+}
+
+// TestDeprecatedAlias_Suppressed verifies --no-deprecation-warnings.
+func TestDeprecatedAlias_Suppressed(t *testing.T) {
+	stdout, stderr := runSessionsAlias(t, "--no-deprecation-warnings")
+	if stdout != "s1\n" {
+		t.Errorf("alias did not run: got %q", stdout)
+	}
+	if strings.Contains(stderr, "deprecated") {
+		t.Errorf("expected no deprecation warning, got %q", stderr)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// ANSI colors for diff output on a terminal.
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+	colorReset = "\033[0m"
+)
+
+// diffOp is one line of an edit script: ' ' (kept), '-' (only in a) or '+'
+// (only in b).
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffLines returns an edit script turning a into b, based on the longest
+// common subsequence of lines. Common leading and trailing lines are
+// stripped first, so the quadratic table only covers the changed region,
+// which is small for policy files.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the LCS length of midA[i:] and midB[j:].
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i++
+			j++
+		case i < len(midA) && (j == len(midB) || lcs[i+1][j] >= lcs[i][j+1]):
+			// Prefer deletions so removed lines print before added ones.
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// unifiedDiff returns the unified diff of a and b labelled aName and bName,
+// or "" if the documents are identical.
+func unifiedDiff(aName, bName, a, b string) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+
+	// aPos[k] and bPos[k] count the lines of a and b before ops[k].
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for k, op := range ops {
+		aPos[k+1], bPos[k+1] = aPos[k], bPos[k]
+		if op.kind != '+' {
+			aPos[k+1]++
+		}
+		if op.kind != '-' {
+			bPos[k+1]++
+		}
+	}
+
+	// Emit one hunk per group of changes that are at most 2*diffContext
+	// unchanged lines apart, padded with diffContext lines on each side.
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		start := max(k-diffContext, 0)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = run
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start]+1, aPos[end]-aPos[start]),
+			hunkRange(bPos[start]+1, bPos[end]-bPos[start]))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.text)
+			sb.WriteByte('\n')
+		}
+		k = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats a unified diff range. An empty range is reported at the
+// line before it, as diff(1) does.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+}
+
+// splitLines splits s into lines without their terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// writeDiff writes diff to w, coloring removed, added and hunk-header lines
+// when color is set.
+func writeDiff(w io.Writer, diff string, color bool) error {
+	if !color {
+		_, err := io.WriteString(w, diff)
+		return err
+	}
+	for _, line := range splitLines(diff) {
+		c := ""
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+		case strings.HasPrefix(line, "@@"):
+			c = colorCyan
+		case strings.HasPrefix(line, "-"):
+			c = colorRed
+		case strings.HasPrefix(line, "+"):
+			c = colorGreen
+		}
+		if c != "" {
+			line = c + line + colorReset
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isTerminal reports whether w is a character device such as a TTY.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
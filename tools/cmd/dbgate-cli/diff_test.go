@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestUnifiedDiff verifies hunk ranges and context against known documents.
+func TestUnifiedDiff(t *testing.T) {
+	running := `version: 1
+rules:
+  - id: block-drop
+    action: block
+    statement: DROP
+  - id: allow-select
+    action: allow
+    statement: SELECT
+access:
+  - user: app_service
+    source: 10.0.0.0/8
+`
+	local := `version: 1
+rules:
+  - id: block-drop
+    action: block
+    statement: DROP
+  - id: block-truncate
+    action: block
+    statement: TRUNCATE
+  - id: allow-select
+    action: allow
+    statement: SELECT
+access:
+  - user: app_service
+    source: 172.16.0.0/12
+`
+	// Matches diff -u: the two changes are close enough to share a hunk.
+	want := `--- running policy
++++ policy.yaml
+@@ -3,9 +3,12 @@
+   - id: block-drop
+     action: block
+     statement: DROP
++  - id: block-truncate
++    action: block
++    statement: TRUNCATE
+   - id: allow-select
+     action: allow
+     statement: SELECT
+ access:
+   - user: app_service
+-    source: 10.0.0.0/8
++    source: 172.16.0.0/12
+`
+	if got := unifiedDiff("running policy", "policy.yaml", running, local); got != want {
+		t.Errorf("diff mismatch:\n got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := unifiedDiff("a", "b", running, running); got != "" {
+		t.Errorf("identical documents: got %q, want empty", got)
+	}
+}
+
+// TestUnifiedDiff_SeparateHunks verifies that distant changes get their own
+// hunks, as with diff -u.
+func TestUnifiedDiff_SeparateHunks(t *testing.T) {
+	var a, b strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&a, "%d\n", i)
+		switch i {
+		case 2:
+			b.WriteString("two\n")
+		case 18:
+			b.WriteString("eighteen\n")
+		default:
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	want := "--- a\n+++ b\n" +
+		"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+		"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+eighteen\n 19\n 20\n"
+	if got := unifiedDiff("a", "b", a.String(), b.String()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestUnifiedDiff_EmptySide verifies ranges when one document is empty.
+func TestUnifiedDiff_EmptySide(t *testing.T) {
+	want := "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n"
+	if got := unifiedDiff("a", "b", "", "x\ny\n"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestRunPolicyDiff verifies the command output, coloring and the
+// not-implemented message.
+func TestRunPolicyDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("version: 2\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	respJSON := []byte(`{"ok":true,"payload":{"policy":"version: 1\n"}}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runPolicyDiff(&out, opts, path, false); err != nil {
+		t.Fatalf("runPolicyDiff: %v", err)
+	}
+	if !strings.Contains(out.String(), "-version: 1\n+version: 2\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runPolicyDiff(&out, opts, path, true); err != nil {
+		t.Fatalf("runPolicyDiff (color): %v", err)
+	}
+	if !strings.Contains(out.String(), colorRed+"-version: 1"+colorReset) {
+		t.Errorf("expected colored removal, got %q", out.String())
+	}
+
+	notImpl := []byte(`{"ok":false,"error":"not implemented","code":501}`)
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, notImpl)}, timeout: 3 * time.Second}
+	err := runPolicyDiff(&out, opts, path, false)
+	if err == nil || !strings.Contains(err.Error(), "does not support policy_show") {
+		t.Fatalf("expected not-implemented message, got: %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// doctorCheck is one connectivity check run by doctor. A failed critical
+// check makes doctor exit non-zero and skips the checks after it, which
+// depend on it.
+type doctorCheck struct {
+	name     string
+	critical bool
+	// run performs the check and returns a short detail for the report. A
+	// check that does not apply, e.g. file checks for a TCP address, returns
+	// errCheckSkipped.
+	run func(ctx context.Context) (string, error)
+	// hint suggests a fix when run fails.
+	hint string
+}
+
+// errCheckSkipped is returned by a check that does not apply.
+var errCheckSkipped = errors.New("skipped")
+
+// doctorResult is the outcome of one check, also the --output json record.
+type doctorResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"` // "pass", "fail" or "skip"
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// newDoctorCmd returns the "doctor" command.
+func newDoctorCmd(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the connection to the dbgate core",
+		Long: `Run a series of checks on the connection to the dbgate core and print a
+pass (✓) or fail (✗) line for each, with a hint on how to fix a failure:
+
+  - the socket path exists and is a Unix socket
+  - the current user may read and write it
+  - it can be dialed within --timeout
+  - a ping (or stats) round trip succeeds
+  - the core speaks a protocol version this CLI supports
+
+The file checks are skipped for --addr tcp:// and abstract sockets. Once a
+critical check fails the checks that depend on it are skipped, and the
+command exits non-zero: 3 when the core cannot be reached, or the code the
+failed request maps to, e.g. 4 for a timeout.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+}
+
+// runDoctor runs doctorChecks against the configured address and prints the
+// report, as text or in the format selected by --output.
+func runDoctor(ctx context.Context, w io.Writer, opts *rootOptions) error {
+	var results []doctorResult
+	var failure error
+	for _, check := range doctorChecks(opts) {
+		r := doctorResult{Name: check.name, Critical: check.critical}
+		if failure != nil {
+			r.Status = "skip"
+			results = append(results, r)
+			continue
+		}
+		detail, err := check.run(ctx)
+		switch {
+		case errors.Is(err, errCheckSkipped):
+			r.Status, r.Detail = "skip", detail
+		case err != nil:
+			r.Status, r.Detail, r.Hint = "fail", err.Error(), check.hint
+			if check.critical {
+				failure = err
+			}
+		default:
+			r.Status, r.Detail = "pass", detail
+		}
+		results = append(results, r)
+	}
+
+	if isJSONOutput(opts.output) {
+		if err := writeRecords(w, opts.output, results); err != nil {
+			return err
+		}
+	} else {
+		printDoctorResults(w, results)
+	}
+	if failure != nil {
+		// Failed file checks are not client errors but still mean the core
+		// cannot be reached.
+		code := exitCode(failure)
+		if code == exitUsage {
+			code = exitConnect
+		}
+		return &exitError{code: code}
+	}
+	return nil
+}
+
+// printDoctorResults prints one line per check, followed by the hint of a
+// failed check.
+func printDoctorResults(w io.Writer, results []doctorResult) {
+	for _, r := range results {
+		mark := map[string]string{"pass": "✓", "fail": "✗", "skip": "-"}[r.Status]
+		line := mark + " " + r.Name
+		switch {
+		case r.Status == "skip" && r.Detail == "":
+			line += " (skipped)"
+		case r.Detail != "":
+			line += ": " + r.Detail
+		}
+		fmt.Fprintln(w, line)
+		if r.Hint != "" {
+			fmt.Fprintf(w, "    hint: %s\n", r.Hint)
+		}
+	}
+}
+
+// doctorChecks returns the checks for the configured address, in order.
+func doctorChecks(opts *rootOptions) []doctorCheck {
+	addr := opts.socketPath()
+	network, address, addrErr := client.ParseAddress(addr)
+	isFile := addrErr == nil && network == "unix" && !strings.HasPrefix(address, "\x00")
+
+	var fi fs.FileInfo
+	return []doctorCheck{
+		{
+			name:     "socket path exists",
+			critical: true,
+			hint:     "start the dbgate core, or point --socket (or DBGATE_SOCKET) at the path it listens on",
+			run: func(context.Context) (string, error) {
+				if addrErr != nil {
+					return "", addrErr
+				}
+				if !isFile {
+					return addr + " is not a file path", errCheckSkipped
+				}
+				var err error
+				fi, err = os.Stat(address)
+				if err != nil {
+					return "", err
+				}
+				return address, nil
+			},
+		},
+		{
+			name:     "path is a Unix socket",
+			critical: true,
+			hint:     "the path is not the core's socket; remove the stale file and restart the core, or fix --socket",
+			run: func(context.Context) (string, error) {
+				if !isFile {
+					return "", errCheckSkipped
+				}
+				return "", checkSocketFile(address, fi)
+			},
+		},
+		{
+			name:     "socket is readable and writable",
+			critical: true,
+			hint:     "run as the core's user, or add yourself to the socket's group and make it group-writable",
+			run: func(context.Context) (string, error) {
+				if !isFile {
+					return "", errCheckSkipped
+				}
+				uid, gids, ok := currentUser()
+				if !ok {
+					return "not checked on this platform", errCheckSkipped
+				}
+				return "", checkSocketAccess(fi, uid, gids)
+			},
+		},
+		{
+			name:     "dial",
+			critical: true,
+			hint:     "the core is not accepting connections; check that it is running and not overloaded, or raise --timeout",
+			run: func(ctx context.Context) (string, error) {
+				dialer := net.Dialer{Timeout: opts.timeout}
+				conn, err := dialer.DialContext(ctx, network, address)
+				if err != nil {
+					return "", err
+				}
+				if err := conn.Close(); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("connected within %s", opts.timeout), nil
+			},
+		},
+		{
+			name:     "round trip",
+			critical: true,
+			hint:     "the core accepted the connection but did not answer; check its logs, and --addr/--tls-* for TCP",
+			run: func(ctx context.Context) (string, error) {
+				c := opts.newClient()
+				rtt, err := c.PingContext(ctx)
+				if errors.Is(err, client.ErrNotImplemented) {
+					_, rtt, err = c.GetStatsTimed(ctx)
+					if err != nil {
+						return "", err
+					}
+					return "stats in " + formatMillis(rtt), nil
+				}
+				if err != nil {
+					return "", err
+				}
+				return "ping in " + formatMillis(rtt), nil
+			},
+		},
+		{
+			name:     "protocol version",
+			critical: true,
+			hint:     "upgrade dbgate-cli to a release that supports the core's protocol version",
+			run: func(ctx context.Context) (string, error) {
+				v, err := opts.newClient().NegotiateContext(ctx)
+				if errors.Is(err, client.ErrNotImplemented) {
+					return fmt.Sprintf("core does not report one; assuming %d", client.ProtocolVersion), nil
+				}
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("core %d, CLI up to %d", v, client.ProtocolVersion), nil
+			},
+		},
+	}
+}
+
+// checkSocketFile returns an error unless fi, the stat of path, is a socket.
+func checkSocketFile(path string, fi fs.FileInfo) error {
+	if fi.Mode().Type() == fs.ModeSocket {
+		return nil
+	}
+	kind := "regular file"
+	switch {
+	case fi.IsDir():
+		kind = "directory"
+	case fi.Mode().Type() != 0:
+		kind = "non-socket file"
+	}
+	return fmt.Errorf("%s is a %s", path, kind)
+}
+
+// checkSocketAccess returns an error unless the user with uid and group IDs
+// gids may both read and write the file described by fi, judged by its
+// permission bits as the kernel does: the owner bits apply to the owner, the
+// group bits to group members, and the other bits to everyone else. Root may
+// access any file.
+func checkSocketAccess(fi fs.FileInfo, uid int, gids []int) error {
+	if uid == 0 {
+		return nil
+	}
+	owner, group, ok := fileOwner(fi)
+	if !ok {
+		return nil
+	}
+	perm := fi.Mode().Perm()
+	var bits fs.FileMode
+	switch {
+	case uid == owner:
+		bits = perm >> 6
+	case slices.Contains(gids, group):
+		bits = perm >> 3
+	default:
+		bits = perm
+	}
+	if bits&0o6 != 0o6 {
+		return fmt.Errorf("mode %s, owner %d, group %d does not allow read and write for uid %d", perm, owner, group, uid)
+	}
+	return nil
+}
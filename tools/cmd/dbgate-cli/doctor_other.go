@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// currentUser is not implemented on this platform; doctor skips the
+// permission check.
+func currentUser() (uid int, gids []int, ok bool) {
+	return 0, nil, false
+}
+
+// fileOwner is not implemented on this platform.
+func fileOwner(fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckSocketFile verifies that only a socket passes, and that the
+// error names what the path is instead.
+func TestCheckSocketFile(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "file.sock")
+	if err := os.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	sock := filepath.Join(dir, "real.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	for _, tt := range []struct {
+		path    string
+		wantErr string
+	}{
+		{sock, ""},
+		{regular, "is a regular file"},
+		{dir, "is a directory"},
+	} {
+		fi, err := os.Stat(tt.path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		err = checkSocketFile(tt.path, fi)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("checkSocketFile(%s) = %v, want %q", filepath.Base(tt.path), err, tt.wantErr)
+		}
+	}
+}
+
+// TestCheckSocketAccess verifies that the owner, group and other permission
+// bits are applied to the matching users, and that root is always allowed.
+func TestCheckSocketAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perm.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if os.Geteuid() == 0 {
+		// Root may access anything, so give the file to an ordinary user.
+		if err := os.Chown(path, 4242, 4343); err != nil {
+			t.Fatalf("chown: %v", err)
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	owner, group, ok := fileOwner(fi)
+	if !ok {
+		t.Skip("file ownership is not available on this platform")
+	}
+	other := owner + 1000
+	otherGroup := group + 1000
+
+	for _, tt := range []struct {
+		name string
+		mode os.FileMode
+		uid  int
+		gids []int
+		want bool
+	}{
+		{"owner rw", 0o600, owner, nil, true},
+		{"owner read-only", 0o400, owner, nil, false},
+		{"group rw", 0o660, other, []int{group}, true},
+		{"group read-only", 0o640, other, []int{group}, false},
+		{"not in group", 0o660, other, []int{otherGroup}, false},
+		{"other rw", 0o666, other, []int{otherGroup}, true},
+		{"owner bits win over other", 0o066, owner, nil, false},
+		{"root", 0o000, 0, nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatalf("chmod: %v", err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+			err = checkSocketAccess(fi, tt.uid, tt.gids)
+			if got := err == nil; got != tt.want {
+				t.Errorf("allowed = %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunDoctor verifies a passing report against a mock core, and that a
+// missing socket fails, skips the dependent checks and exits with the
+// connect code.
+func TestRunDoctor(t *testing.T) {
+	sock := mockUDSServerSeq(t, []byte(`{"ok":true}`), []byte(`{"ok":true}`), []byte(`{"ok":true,"payload":{"version":1}}`))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runDoctor(context.Background(), &out, opts); err != nil {
+		t.Fatalf("runDoctor: %v\n%s", err, out.String())
+	}
+	if strings.Count(out.String(), "✓") != 6 {
+		t.Errorf("expected six passing checks:\n%s", out.String())
+	}
+
+	opts = &rootOptions{socketPaths: []string{filepath.Join(t.TempDir(), "missing.sock")}, timeout: time.Second}
+	out.Reset()
+	err := runDoctor(context.Background(), &out, opts)
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != exitConnect {
+		t.Fatalf("expected exit code %d, got %v", exitConnect, err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if !strings.HasPrefix(lines[0], "✗ socket path exists") || !strings.HasPrefix(lines[1], "    hint: start the dbgate core") {
+		t.Errorf("expected the failed check with a hint first:\n%s", out.String())
+	}
+	if n := strings.Count(out.String(), "(skipped)"); n != 5 {
+		t.Errorf("expected the 5 dependent checks to be skipped, got %d:\n%s", n, out.String())
+	}
+}
+
+// TestRunDoctor_Context verifies that the round trip is bounded by the
+// command's context rather than only by --timeout.
+func TestRunDoctor_Context(t *testing.T) {
+	sock, _ := stalledUDSServer(t)
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: time.Minute, noVersionCheck: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	start := time.Now()
+	err := runDoctor(ctx, &out, opts)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("round trip ignored the context: took %v", elapsed)
+	}
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != exitTimeout {
+		t.Fatalf("expected exit code %d, got %v\n%s", exitTimeout, err, out.String())
+	}
+	if !strings.Contains(out.String(), "✗ round trip") {
+		t.Errorf("expected the round trip to fail:\n%s", out.String())
+	}
+}
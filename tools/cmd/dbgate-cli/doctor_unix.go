@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// currentUser returns the effective user and group IDs of the process,
+// including supplementary groups.
+func currentUser() (uid int, gids []int, ok bool) {
+	groups, err := os.Getgroups()
+	if err != nil {
+		return 0, nil, false
+	}
+	return os.Geteuid(), append(groups, os.Getegid()), true
+}
+
+// fileOwner returns the owner and group IDs of the file fi describes.
+func fileOwner(fi fs.FileInfo) (uid, gid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/exporter"
+	"github.com/spf13/cobra"
+)
+
+// newExporterCmd returns the "exporter" command, which serves core stats as
+// Prometheus metrics until interrupted.
+func newExporterCmd(opts *rootOptions) *cobra.Command {
+	var listen string
+	var interval time.Duration
+	var labels []string
+
+	cmd := &cobra.Command{
+		Use:   "exporter",
+		Short: "Serve proxy statistics as Prometheus metrics",
+		Long: `Poll the dbgate core's stats on a fixed interval and expose them on
+/metrics for Prometheus. Core counters (total_queries, blocked_queries,
+total_connections, monitored_blocks) are exported as counters; qps,
+block_rate and active_sessions as gauges. Failed polls increment
+dbgate_scrape_errors_total and the last good values keep being served.
+
+Repeated --label name=value pairs are attached to every metric, e.g.
+--label env=prod --label region=us, so that several dbgate instances feeding
+one Prometheus are told apart without relabeling.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval <= 0 {
+				return fmt.Errorf("invalid --interval %s: must be positive", interval)
+			}
+			var err error
+			if opts.labels, err = exporter.ParseLabels(labels); err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			return runExporter(ctx, opts, listen, interval)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":9090", "HTTP listen address for /metrics")
+	cmd.Flags().DurationVar(&interval, "interval", 15*time.Second, "How often to poll the core for stats")
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "Static label name=value added to every metric (repeatable)")
+	return cmd
+}
+
+// runExporter serves /metrics on listen until ctx is cancelled.
+func runExporter(ctx context.Context, opts *rootOptions, listen string, interval time.Duration) error {
+	logger := slog.New(slog.NewTextHandler(opts.stderr, nil))
+	e := exporter.New(opts.newClient(), interval, logger, opts.labels)
+	if err := e.Run(ctx, listen); err != nil {
+		return fmt.Errorf("exporter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// instanceStats is the outcome of querying one dbgate instance.
+type instanceStats struct {
+	socket string
+	snap   *client.StatsSnapshot
+	err    error
+}
+
+// errSkippedFailFast marks instances whose result was not awaited because an
+// earlier instance failed under --fail-fast.
+var errSkippedFailFast = errors.New("skipped after an earlier failure (--fail-fast)")
+
+// maxStatsConcurrency bounds how many instances collectStats queries at once,
+// so a long --socket list does not open one connection per instance at once.
+const maxStatsConcurrency = 8
+
+// collectStats queries every configured socket in parallel through its
+// client in clients, at most maxStatsConcurrency at a time, and returns one
+// result per socket, in flag order.
+//
+// All requests share one deadline of opts.timeout, so a slow instance cannot
+// stretch the command beyond a single timeout however many sockets are
+// configured. Instances still waiting for a pool slot when the deadline
+// passes report the context error.
+//
+// With failFast the first failure ends collection: instances that have not
+// answered yet are reported as errSkippedFailFast and their in-flight requests
+// are cancelled. Otherwise every instance is awaited.
+func collectStats(ctx context.Context, opts *rootOptions, clients map[string]*client.Client, failFast bool) []instanceStats {
+	var cancel context.CancelFunc
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type indexed struct {
+		i int
+		r instanceStats
+	}
+	// Buffered so abandoned goroutines never block after a fail-fast return.
+	ch := make(chan indexed, len(opts.socketPaths))
+	sem := make(chan struct{}, maxStatsConcurrency)
+	for i, socket := range opts.socketPaths {
+		go func(i int, socket string) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				ch <- indexed{i: i, r: instanceStats{socket: socket, err: ctx.Err()}}
+				return
+			}
+			snap, err := clients[socket].GetStatsContext(ctx)
+			ch <- indexed{i: i, r: instanceStats{socket: socket, snap: snap, err: err}}
+		}(i, socket)
+	}
+
+	results := make([]instanceStats, len(opts.socketPaths))
+	done := make([]bool, len(opts.socketPaths))
+	for range opts.socketPaths {
+		res := <-ch
+		results[res.i] = res.r
+		done[res.i] = true
+		if failFast && res.r.err != nil {
+			break
+		}
+	}
+	for i, socket := range opts.socketPaths {
+		if !done[i] {
+			results[i] = instanceStats{socket: socket, err: errSkippedFailFast}
+		}
+	}
+	return results
+}
+
+// aggregateStats combines the reachable instances into a fleet-wide snapshot
+// and returns it together with the number of instances that contributed.
+//
+// Counters and QPS are summed. BlockRate is recomputed from the summed
+// counters, which weights each instance's rate by its query volume.
+// CapturedAt is the most recent capture time.
+func aggregateStats(results []instanceStats) (client.StatsSnapshot, int) {
+	var total client.StatsSnapshot
+	reachable := 0
+	for _, r := range results {
+		if r.err != nil || r.snap == nil {
+			continue
+		}
+		reachable++
+		total.TotalConnections += r.snap.TotalConnections
+		total.ActiveSessions += r.snap.ActiveSessions
+		total.TotalQueries += r.snap.TotalQueries
+		total.BlockedQueries += r.snap.BlockedQueries
+		total.MonitoredBlocks += r.snap.MonitoredBlocks
+		total.QPS += r.snap.QPS
+		if r.snap.CapturedAt.After(total.CapturedAt) {
+			total.CapturedAt = r.snap.CapturedAt
+		}
+	}
+	if total.TotalQueries > 0 {
+		total.BlockRate = float64(total.BlockedQueries) / float64(total.TotalQueries)
+	}
+	return total, reachable
+}
+
+// printStatsTable prints one row per instance, marking unreachable instances
+// as unavailable. Counters are passed through formatCounter.
+func printStatsTable(w io.Writer, results []instanceStats, opts *rootOptions) error {
+	t := newTable("Socket", "QPS", "Block Rate", "Active", "Total Queries", "Blocked", "Monitored", "Connections")
+	t.maxWidth = opts.maxColWidth
+	for _, r := range results {
+		if r.err != nil {
+			t.addRow(r.socket, fmt.Sprintf("unavailable: %v", r.err))
+			continue
+		}
+		s := r.snap
+		t.addRow(r.socket, fmt.Sprintf("%.2f", s.QPS), fmt.Sprintf("%.2f%%", s.BlockRate*100),
+			formatCounter(s.ActiveSessions, opts.human), formatCounter(s.TotalQueries, opts.human),
+			formatCounter(s.BlockedQueries, opts.human), formatCounter(s.MonitoredBlocks, opts.human),
+			formatCounter(s.TotalConnections, opts.human))
+	}
+	return t.render(w)
+}
+
+// instanceStatsJSON is the --output json form of one instance's result.
+type instanceStatsJSON struct {
+	Socket string                `json:"socket"`
+	Stats  *client.StatsSnapshot `json:"stats,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
+// writeStatsJSON writes results in the JSON format output: one record per
+// instance, or with aggregate the combined StatsSnapshot alone, and reports
+// whether it wrote anything, which it does not for an aggregate of no
+// reachable instance.
+func writeStatsJSON(w io.Writer, output string, results []instanceStats, aggregate bool) (bool, error) {
+	if aggregate {
+		total, reachable := aggregateStats(results)
+		if reachable == 0 {
+			return false, nil
+		}
+		return true, writeRecord(w, output, &total)
+	}
+
+	out := make([]instanceStatsJSON, 0, len(results))
+	for _, r := range results {
+		item := instanceStatsJSON{Socket: r.socket, Stats: r.snap}
+		if r.err != nil {
+			item.Error = r.err.Error()
+		}
+		out = append(out, item)
+	}
+	return true, writeRecords(w, output, out)
+}
+
+// statsFanOutError returns a non-nil error if any instance failed, so that a
+// partially reachable fleet still yields a non-zero exit code in both
+// --keep-going and --fail-fast modes. The error wraps the instances' errors,
+// so the exit code keeps their category.
+func statsFanOutError(results []instanceStats) error {
+	var errs []error
+	skipped := 0
+	for _, r := range results {
+		switch {
+		case errors.Is(r.err, errSkippedFailFast):
+			skipped++
+		case r.err != nil:
+			errs = append(errs, r.err)
+		}
+	}
+	switch {
+	case len(errs) == 0 && skipped == 0:
+		return nil
+	case skipped == 0:
+		return &causedError{fmt.Sprintf("stats: %d of %d instances unavailable", len(errs), len(results)), errs}
+	default:
+		return &causedError{fmt.Sprintf("stats: %d of %d instances unavailable, %d skipped (--fail-fast)", len(errs), len(results), skipped), errs}
+	}
+}
+
+// causedError summarizes several failures in one message while still
+// matching their errors, which the message does not repeat.
+type causedError struct {
+	msg    string
+	causes []error
+}
+
+// Error implements error.
+func (e *causedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the errors e summarizes.
+func (e *causedError) Unwrap() []error {
+	return e.causes
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// exitUnhealthy is the exit code for an unhealthy or unreachable core, kept
+// distinct from usage and other errors (exit 1) for liveness probes.
+const exitUnhealthy = 2
+
+// newHealthCmd returns the "health" command.
+func newHealthCmd(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "health",
+		Short: "Check core health for liveness/readiness probes",
+		Long: `Send a health check to the dbgate core and print OK (exit 0) or
+UNHEALTHY: <reason> (exit 2). An unreachable core or an error response is
+also reported as unhealthy with exit code 2.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHealth(cmd.OutOrStdout(), opts)
+		},
+	}
+}
+
+// runHealth prints the health verdict to w. An unhealthy verdict is returned
+// as an exitError carrying exitUnhealthy.
+func runHealth(w io.Writer, opts *rootOptions) error {
+	report, err := opts.newClient().Health()
+	if errors.Is(err, client.ErrDryRun) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(w, "UNHEALTHY: %v\n", err)
+		return &exitError{code: exitUnhealthy}
+	}
+
+	var reasons []string
+	if !strings.EqualFold(report.Status, "ok") {
+		reasons = append(reasons, fmt.Sprintf("status %q", report.Status))
+	}
+	if !report.PolicyLoaded {
+		reasons = append(reasons, "policy not loaded")
+	}
+	if !report.BackendReachable {
+		reasons = append(reasons, "backend unreachable")
+	}
+	if len(reasons) > 0 {
+		fmt.Fprintf(w, "UNHEALTHY: %s\n", strings.Join(reasons, ", "))
+		return &exitError{code: exitUnhealthy}
+	}
+
+	fmt.Fprintln(w, "OK")
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRunHealth verifies the printed verdict and the exit-code mapping:
+// 0 when healthy, 2 when unhealthy, on an error response, or unreachable.
+func TestRunHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		socket   string
+		wantOut  string
+		wantCode int
+	}{
+		{
+			name: "healthy",
+			socket: mockUDSServer(t, []byte(`{"ok":true,"payload":{"status":"ok","uptime_seconds":42,`+
+				`"policy_loaded":true,"backend_reachable":true}}`)),
+			wantOut:  "OK\n",
+			wantCode: 0,
+		},
+		{
+			name: "degraded",
+			socket: mockUDSServer(t, []byte(`{"ok":true,"payload":{"status":"degraded","uptime_seconds":42,`+
+				`"policy_loaded":true,"backend_reachable":false}}`)),
+			wantOut:  "UNHEALTHY: status \"degraded\", backend unreachable\n",
+			wantCode: exitUnhealthy,
+		},
+		{
+			name:     "error response",
+			socket:   mockUDSServer(t, []byte(`{"ok":false,"error":"not implemented","code":501}`)),
+			wantOut:  "UNHEALTHY: health: server error: not implemented\n",
+			wantCode: exitUnhealthy,
+		},
+		{
+			name:     "unreachable",
+			socket:   filepath.Join(t.TempDir(), "missing.sock"),
+			wantCode: exitUnhealthy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runHealth(&out, &rootOptions{socketPaths: []string{tt.socket}, timeout: time.Second})
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("runHealth: %v", err)
+				}
+			} else if got := exitCode(err); got != tt.wantCode {
+				t.Fatalf("exit code: got %d, want %d (err=%v)", got, tt.wantCode, err)
+			}
+			if tt.wantOut != "" && out.String() != tt.wantOut {
+				t.Errorf("output: got %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+// TestExitCode verifies that ordinary errors exit 1.
+func TestExitCode(t *testing.T) {
+	if got := exitCode(errors.New("usage")); got != 1 {
+		t.Errorf("exitCode(plain error) = %d, want 1", got)
+	}
+	if got := exitCode(&exitError{code: exitUnhealthy}); got != exitUnhealthy {
+		t.Errorf("exitCode(exitError) = %d, want %d", got, exitUnhealthy)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// sessionFilter selects the sessions killed by session kill-all. Zero fields
+// match every session.
+type sessionFilter struct {
+	user           string
+	database       string
+	idleLongerThan time.Duration
+}
+
+// match reports whether s passes every set criterion at now. A session is
+// idle since its last activity; if the core does not report that, only a
+// session that never ran a query is considered idle, since its start.
+func (f sessionFilter) match(s client.Session, now time.Time) bool {
+	if f.user != "" && s.User != f.user {
+		return false
+	}
+	if f.database != "" && s.Database != f.database {
+		return false
+	}
+	if f.idleLongerThan > 0 {
+		var idleSince time.Time
+		switch {
+		case s.LastActivityMs > 0:
+			idleSince = time.UnixMilli(s.LastActivityMs)
+		case s.QueryCount == 0:
+			idleSince = s.StartedAt
+		default:
+			return false
+		}
+		if now.Sub(idleSince) <= f.idleLongerThan {
+			return false
+		}
+	}
+	return true
+}
+
+// killFailure is one session that could not be killed.
+type killFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// killAllResult is the outcome of session kill-all, and its --output json
+// form.
+type killAllResult struct {
+	Matched int           `json:"matched"`
+	Killed  int           `json:"killed"`
+	Failed  []killFailure `json:"failed,omitempty"`
+}
+
+// newSessionKillAllCmd returns the "session kill-all" subcommand.
+func newSessionKillAllCmd(opts *rootOptions) *cobra.Command {
+	var (
+		filter sessionFilter
+		yes    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "kill-all",
+		Short: "Terminate every session matching the filters",
+		Long: `Terminate every active session matching all of the given filters, e.g.
+
+  dbgate-cli session kill-all --user readonly --idle-longer-than 5m
+
+Without filters every session matches. Idle time is measured from the
+session's last query; with a core that does not report it, only sessions
+that never ran a query count as idle. Without --yes the command asks for
+confirmation when stdout is a terminal and refuses otherwise.
+
+The number of sessions killed is printed along with any that could not be
+killed; any failure makes the command exit non-zero.`,
+		Annotations: map[string]string{annotationCommand: "kill_session"},
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filter.idleLongerThan < 0 {
+				return fmt.Errorf("invalid --idle-longer-than %s: must not be negative", filter.idleLongerThan)
+			}
+			w := cmd.OutOrStdout()
+			return runSessionKillAll(w, cmd.InOrStdin(), opts, filter, yes, isTerminal(w))
+		},
+	}
+	cmd.Flags().StringVar(&filter.user, "user", "", "Only sessions of this user")
+	cmd.Flags().StringVar(&filter.database, "db", "", "Only sessions on this database")
+	cmd.Flags().DurationVar(&filter.idleLongerThan, "idle-longer-than", 0, "Only sessions idle for longer than this (e.g. 5m)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Kill without asking for confirmation")
+	return cmd
+}
+
+// runSessionKillAll kills the sessions matching filter after confirming like
+// stats reset, and reports the counts and failures.
+func runSessionKillAll(w io.Writer, in io.Reader, opts *rootOptions, filter sessionFilter, yes, interactive bool) error {
+	if !yes && !interactive {
+		return errors.New("session kill-all: refusing to kill sessions without --yes")
+	}
+
+	c := opts.newClient()
+	sessions, err := c.ListSessions()
+	if err != nil {
+		return sessionsError(err)
+	}
+	now := time.Now()
+	var matched []client.Session
+	for _, s := range sessions {
+		if filter.match(s, now) {
+			matched = append(matched, s)
+		}
+	}
+	if len(matched) == 0 {
+		if isJSONOutput(opts.output) {
+			return writeRecord(w, opts.output, killAllResult{})
+		}
+		fmt.Fprintln(w, "No matching sessions")
+		return nil
+	}
+
+	if !yes {
+		ok, err := confirm(w, in, fmt.Sprintf("Kill %d of %d sessions on %s? [y/N] ", len(matched), len(sessions), opts.socketPath()))
+		if err != nil {
+			return fmt.Errorf("session kill-all: %w", err)
+		}
+		if !ok {
+			return errors.New("session kill-all: aborted")
+		}
+	}
+
+	result := killAllResult{Matched: len(matched)}
+	for _, s := range matched {
+		err := c.KillSession(s.ID)
+		if errors.Is(err, client.ErrNotImplemented) {
+			return notSupported("session kill-all", "kill_session")
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, killFailure{ID: s.ID, Error: err.Error()})
+			continue
+		}
+		result.Killed++
+	}
+
+	if isJSONOutput(opts.output) {
+		if err := writeRecord(w, opts.output, result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(w, "Killed %d of %d matching sessions\n", result.Killed, result.Matched)
+		for _, f := range result.Failed {
+			fmt.Fprintf(w, "Failed to kill %s: %s\n", f.ID, f.Error)
+		}
+	}
+	if len(result.Failed) > 0 {
+		return recordedError(opts, fmt.Errorf("session kill-all: %d of %d kills failed", len(result.Failed), result.Matched))
+	}
+	return nil
+}
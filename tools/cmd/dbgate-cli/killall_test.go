@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// TestSessionFilter verifies each criterion, including the idle fallback for
+// cores that do not report the last activity.
+func TestSessionFilter(t *testing.T) {
+	now := time.UnixMilli(1700000600000)
+	s := client.Session{ID: "s1", User: "readonly", Database: "app", StartedAt: now.Add(-time.Hour),
+		QueryCount: 3, LastActivityMs: now.Add(-10 * time.Minute).UnixMilli()}
+
+	tests := []struct {
+		name   string
+		filter sessionFilter
+		s      client.Session
+		want   bool
+	}{
+		{"no filters", sessionFilter{}, s, true},
+		{"user", sessionFilter{user: "readonly"}, s, true},
+		{"other user", sessionFilter{user: "admin"}, s, false},
+		{"other database", sessionFilter{user: "readonly", database: "billing"}, s, false},
+		{"idle long enough", sessionFilter{idleLongerThan: 5 * time.Minute}, s, true},
+		{"not idle long enough", sessionFilter{idleLongerThan: 15 * time.Minute}, s, false},
+		{"no activity reported", sessionFilter{idleLongerThan: 5 * time.Minute},
+			client.Session{StartedAt: now.Add(-time.Hour), QueryCount: 3}, false},
+		{"never queried", sessionFilter{idleLongerThan: 5 * time.Minute},
+			client.Session{StartedAt: now.Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.match(tt.s, now); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRunSessionKillAll verifies that only matching sessions are killed and
+// that a failed kill is reported without stopping the others.
+func TestRunSessionKillAll(t *testing.T) {
+	sessions := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","user":"readonly","started_at_ms":0},` +
+		`{"id":"s2","user":"admin","started_at_ms":0},` +
+		`{"id":"s3","user":"readonly","started_at_ms":0},` +
+		`{"id":"s4","user":"readonly","started_at_ms":0}]}`)
+	ok := []byte(`{"ok":true}`)
+	gone := []byte(`{"ok":false,"error":"no such session"}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServerSeq(t, sessions, ok, gone, ok)}, timeout: 3 * time.Second}
+
+	var out bytes.Buffer
+	err := runSessionKillAll(&out, strings.NewReader(""), opts, sessionFilter{user: "readonly"}, true, false)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 kills failed") {
+		t.Errorf("expected a partial failure, got: %v", err)
+	}
+	for _, want := range []string{"Killed 2 of 3 matching sessions", "Failed to kill s3: kill_session s3: server error: no such session"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "s2") {
+		t.Errorf("non-matching session mentioned:\n%s", out.String())
+	}
+
+	// Without --yes and no terminal nothing is listed or killed.
+	if err := runSessionKillAll(&out, strings.NewReader(""), opts, sessionFilter{}, false, false); err == nil || !strings.Contains(err.Error(), "without --yes") {
+		t.Errorf("expected refusal without --yes, got: %v", err)
+	}
+}
+
+// TestSessionKillAll_Flags verifies that kill-all names its filters like
+// session list does.
+func TestSessionKillAll_Flags(t *testing.T) {
+	root := newRootCmd()
+	for _, path := range [][]string{{"session", "list"}, {"session", "kill-all"}} {
+		cmd, _, err := root.Find(path)
+		if err != nil {
+			t.Fatalf("find %v: %v", path, err)
+		}
+		for _, name := range []string{"user", "db"} {
+			if cmd.Flags().Lookup(name) == nil {
+				t.Errorf("%s has no --%s flag", cmd.CommandPath(), name)
+			}
+		}
+	}
+}
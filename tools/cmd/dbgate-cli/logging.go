@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// logLevel maps the number of -v flags to a slog level: -v logs the
+// resolved socket and each command, -vv adds byte counts and round-trip
+// durations, and -vvv adds hex dumps of responses.
+func logLevel(verbose int) slog.Level {
+	switch {
+	case verbose >= 3:
+		return client.LevelTrace
+	case verbose == 2:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// newLogger returns a text logger on w for the given -v count, or nil when
+// verbose is 0. Logs never go to stdout, so machine-readable output stays
+// clean.
+func newLogger(w io.Writer, verbose int) *slog.Logger {
+	if verbose <= 0 {
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: logLevel(verbose),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == client.LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestVerbose verifies what each -v level logs to stderr and that stdout
+// stays a clean JSON document.
+func TestVerbose(t *testing.T) {
+	for _, tt := range []struct {
+		flag        string
+		want, avoid []string
+	}{
+		{"-v", []string{"level=INFO msg=\"resolved target\"", "msg=\"sending command\" command=stats"}, []string{"bytes_read", "hex="}},
+		{"-vv", []string{"sending command", "bytes_written=", "bytes_read=", "msg=\"command done\""}, []string{"hex="}},
+		{"-vvv", []string{"level=TRACE", "hex="}, nil},
+	} {
+		t.Run(tt.flag, func(t *testing.T) {
+			cmd := newRootCmd()
+			var stdout, stderr bytes.Buffer
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+			cmd.SetArgs([]string{"--socket", mockUDSServer(t, makeStatsResponse(10, 1, 1, 0)), tt.flag, "-o", "json", "stats"})
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			var v map[string]interface{}
+			if err := json.Unmarshal(stdout.Bytes(), &v); err != nil {
+				t.Errorf("stdout is not clean JSON: %v\n%s", err, stdout.String())
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(stderr.String(), w) {
+					t.Errorf("stderr missing %q:\n%s", w, stderr.String())
+				}
+			}
+			for _, a := range tt.avoid {
+				if strings.Contains(stderr.String(), a) {
+					t.Errorf("stderr should not contain %q:\n%s", a, stderr.String())
+				}
+			}
+		})
+	}
+
+	cmd := newRootCmd()
+	var stderr bytes.Buffer
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&stderr)
+	cmd.SetArgs([]string{"--socket", mockUDSServer(t, makeStatsResponse(10, 1, 1, 0)), "--no-version-check", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("stderr without -v: %q", stderr.String())
+	}
+}
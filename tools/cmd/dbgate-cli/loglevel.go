@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// newLogLevelCmd returns the "loglevel" command group.
+func newLogLevelCmd(opts *rootOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "loglevel",
+		Short: "Show or change the core's log level at runtime",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:         "get",
+		Short:       "Print the core's current log level",
+		Annotations: map[string]string{annotationCommand: "get_log_level"},
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLogLevelGet(cmd.OutOrStdout(), opts)
+		},
+	}, &cobra.Command{
+		Use:   "set <level>",
+		Short: "Change the core's log level",
+		Long: `Change the core's log level without restarting it, e.g. to debug a live
+problem, and print the new level. The level is one of ` + strings.Join(client.LogLevels, ", ") + `.`,
+		Annotations: map[string]string{annotationCommand: "set_log_level"},
+		Args:        cobra.ExactArgs(1),
+		ValidArgs:   client.LogLevels,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLogLevelSet(cmd.OutOrStdout(), opts, args[0])
+		},
+	})
+	return cmd
+}
+
+// runLogLevelGet prints the core's log level.
+func runLogLevelGet(w io.Writer, opts *rootOptions) error {
+	level, err := opts.newClient().GetLogLevel()
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("loglevel get", "get_log_level")
+	}
+	if err != nil {
+		return fmt.Errorf("loglevel get: %w", err)
+	}
+	return printLogLevel(w, opts, level)
+}
+
+// runLogLevelSet changes the core's log level to level and prints it.
+func runLogLevelSet(w io.Writer, opts *rootOptions, level string) error {
+	err := opts.newClient().SetLogLevel(level)
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("loglevel set", "set_log_level")
+	}
+	if err != nil {
+		return fmt.Errorf("loglevel set: %w", err)
+	}
+	return printLogLevel(w, opts, level)
+}
+
+// printLogLevel prints level as text or in the format selected by --output.
+func printLogLevel(w io.Writer, opts *rootOptions, level string) error {
+	if isJSONOutput(opts.output) {
+		return writeRecord(w, opts.output, client.LogLevelResult{Level: level})
+	}
+	fmt.Fprintf(w, "log level: %s\n", level)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunLogLevel verifies the get and set output and that an unknown level
+// is refused without contacting the core.
+func TestRunLogLevel(t *testing.T) {
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, []byte(`{"ok":true,"payload":{"level":"info"}}`))}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runLogLevelGet(&out, opts); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if out.String() != "log level: info\n" {
+		t.Errorf("get output = %q", out.String())
+	}
+
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, []byte(`{"ok":true}`))}, timeout: 3 * time.Second, output: "json"}
+	out.Reset()
+	if err := runLogLevelSet(&out, opts, "debug"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if !strings.Contains(out.String(), `"level": "debug"`) {
+		t.Errorf("set output = %q", out.String())
+	}
+
+	sock, accepted := stalledUDSServer(t)
+	opts = &rootOptions{socketPaths: []string{sock}, timeout: time.Second}
+	err := runLogLevelSet(&bytes.Buffer{}, opts, "loud")
+	if err == nil || !strings.Contains(err.Error(), `unknown level "loud"`) {
+		t.Errorf("expected unknown level error, got: %v", err)
+	}
+	if n := accepted.Load(); n != 0 {
+		t.Errorf("core was contacted %d times", n)
+	}
+}
+
+// TestRunLogLevel_NotImplemented verifies that a core without the commands
+// gets a not-supported error.
+func TestRunLogLevel_NotImplemented(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{mockUDSServer(t, []byte(`{"ok":false,"error":"not implemented","code":501}`))},
+		timeout:     3 * time.Second,
+	}
+	if err := runLogLevelGet(&bytes.Buffer{}, opts); err == nil || !strings.Contains(err.Error(), "does not support get_log_level") {
+		t.Errorf("get: expected not-supported error, got: %v", err)
+	}
+	if err := runLogLevelSet(&bytes.Buffer{}, opts, "warn"); err == nil || !strings.Contains(err.Error(), "does not support set_log_level") {
+		t.Errorf("set: expected not-supported error, got: %v", err)
+	}
+}
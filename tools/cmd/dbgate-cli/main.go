@@ -1,78 +1,933 @@
 // Command dbgate-cli is a CLI management tool for the dbgate proxy.
 //
-// It communicates with the C++ dbgate core via Unix Domain Socket using a
-// 4-byte LE length-prefixed JSON protocol.
+// It communicates with the C++ dbgate core via Unix Domain Socket (or TCP with
+// --addr) using a 4-byte LE length-prefixed JSON protocol.
 //
 // Usage:
 //
-//	dbgate-cli [--socket /tmp/dbgate.sock] [--timeout 5s] <command>
+//	dbgate-cli [--profile NAME] [--socket /var/run/dbgate/dbgate.sock | --addr tcp://host:port] [--timeout 5s] [--strict-length-prefix] [-o text|json|jsonl|csv|prometheus] [--color auto|always|never] [-v...] <command>
 //
 // Commands:
 //
-//	stats                        Print QPS, block rate, active sessions, and query counters.
-//	sessions                     List active sessions (server-side not yet implemented).
+//	stats [--aggregate] [--fail-fast|--keep-going] [--watch 2s | --delta 10s]
+//	                             Print QPS, block rate, active sessions, and query counters.
+//	                             Repeat --socket to query several instances in parallel.
+//	                             -o prometheus [--label env=prod] prints the text exposition format once.
+//	stats reset [--yes]          Zero the cumulative counters (asks for confirmation).
+//	session list [--no-payload] [--user U] [--db D] [--state S] [--sort duration|queries|user] [--limit N]
+//	                             List active sessions as a table, filtered by the core.
+//	                             "sessions" still works but is deprecated.
+//	session kill <id>            Terminate a session by ID.
+//	session kill-all [--user U] [--db D] [--idle-longer-than 5m] [--yes]
+//	                             Terminate every session matching the filters.
+//	top [--interval 2s]          Interactive session view with kill and sort by queries or duration.
 //	policy reload                Trigger a policy reload and print the new version.
 //	policy explain               Dry-run SQL evaluation against the policy engine.
+//	policy test --query Q        Report whether a query would be allowed or blocked, and by which rule.
+//	policy validate [--local] <path>
+//	                             Check a policy file for errors without applying it;
+//	                             --local uses the built-in schema instead of the core.
+//	policy diff <path>           Diff the running policy against a local file.
 //	policy versions              List all stored policy versions.
 //	policy rollback --version N  Roll back to a specific policy version.
+//	audit tail [--limit 50] [--since 15m] [--follow] [--no-redact]
+//	                             Print the most recent blocked queries, newest first, with literals redacted.
+//	audit rotate [--yes]         Flush the audit ring buffer and print how many entries were dropped.
+//	loglevel get                 Print the core's current log level.
+//	loglevel set <level>         Change the core's log level (trace, debug, info, warn or error).
+//	health                       Print OK (exit 0) or UNHEALTHY: <reason> (exit 2).
+//	ping [--count 4 --interval 1s]
+//	                             Print per-request round-trip times and a min/avg/max/p99 summary.
+//	version                      Print the CLI and core versions.
+//	capabilities                 List the commands the core supports.
+//	doctor                       Check the socket, permissions, dial, round trip and protocol version.
+//	exporter [--listen :9090] [--label env=prod]
+//	                             Serve stats as Prometheus metrics on /metrics.
+//	completion <shell>           Print a bash, zsh, fish or powershell completion script.
+//
+// Exit codes: 0 success, 1 usage or other error, 2 the core answered ok:false,
+// 3 connection error, 4 timeout, 5 protocol or decode error, 130 interrupted.
+//
+// Profiles:
+//
+// --profile NAME reads defaults from ~/.dbgate/config.yaml (or --config):
+//
+//	profiles:
+//	  prod:
+//	    socket: /var/run/dbgate/prod.sock   # or addr: tcp://host:port
+//	    timeout: 3s
+//	    output: json
+//	    tls: {ca: ca.pem, cert: cli.pem, key: cli-key.pem, server_name: dbgate.internal}
+//
+// Explicit flags win over DBGATE_SOCKET/DBGATE_TIMEOUT, which win over the
+// profile, which wins over the built-in defaults.
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/dongwonkwak/dbgate/tools/internal/exporter"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 const (
-	defaultSocket  = "/tmp/dbgate.sock"
+	defaultSocket  = "/var/run/dbgate/dbgate.sock"
 	defaultTimeout = 5 * time.Second
+
+	// envSocket and envTimeout override the --socket and --timeout defaults.
+	envSocket  = "DBGATE_SOCKET"
+	envTimeout = "DBGATE_TIMEOUT"
+
+	// annotationMultiSocket marks commands that accept a repeated --socket flag.
+	annotationMultiSocket = "dbgate-cli/multi-socket"
+
+	// annotationOutputs lists, comma-separated, the command-specific --output
+	// formats a command accepts on top of the common ones.
+	annotationOutputs = "dbgate-cli/outputs"
+
+	// annotationCommand names the protocol command a subcommand sends, which
+	// --check-capabilities looks up before the subcommand runs.
+	annotationCommand = "dbgate-cli/command"
+
+	// Values accepted by --output.
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputCSV   = "csv"
+
+	// Command-specific values, enabled through annotationOutputs.
+	outputPrometheus = "prometheus" // stats
+	outputIDs        = "ids"        // sessions: one ID per line
+	outputIDs0       = "ids0"       // sessions: NUL-terminated IDs, for xargs -0
 )
 
+// exitInterrupted is the exit code after SIGINT or SIGTERM cut a command
+// short, following the shell's 128+SIGINT convention.
+const exitInterrupted = 130
+
 func main() {
-	if err := newRootCmd().Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// SIGINT/SIGTERM cancel the command context, so in-flight requests return
+	// promptly and their connections are closed. The default handlers are
+	// restored after the first signal, so a second one kills a command that
+	// is not context-aware.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	opts := &rootOptions{}
+	err := interruptedErr(ctx, newRootCmdWithOptions(opts).ExecuteContext(ctx))
+	if errors.Is(err, client.ErrDryRun) {
+		// --dry-run printed the request instead of sending it, as asked.
+		err = nil
+	}
+	stop()
+	opts.stopTracing()
+	if err != nil {
+		os.Exit(reportError(os.Stdout, os.Stderr, opts, err))
+	}
+}
+
+// errorReport is the object a failed command prints to stdout with --output
+// json or jsonl, so one jq pipeline can handle success and failure alike.
+type errorReport struct {
+	OK         bool   `json:"ok"` // always false
+	Error      string `json:"error"`
+	Code       int    `json:"code"`                  // the process exit code
+	ServerCode int    `json:"server_code,omitempty"` // the core's code, for an ok:false reply
+}
+
+// reportError prints the failure of a command and returns the exit code. The
+// message goes to stderr and, with a JSON output format, also to stdout as an
+// errorReport. An exitError without an error has already reported itself.
+func reportError(stdout, stderr io.Writer, opts *rootOptions, err error) int {
+	code := exitCode(err)
+	var exitErr *exitError
+	if errors.As(err, &exitErr) && exitErr.err == nil {
+		return code
+	}
+	msg := errorMessage(err)
+	fmt.Fprintf(stderr, "Error: %s\n", msg)
+	if isJSONOutput(opts.output) {
+		report := errorReport{Error: msg, Code: code}
+		var serverErr *client.ServerError
+		if errors.As(err, &serverErr) {
+			report.ServerCode = serverErr.Code
+		}
+		if werr := writeRecord(stdout, opts.output, report); werr != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", werr)
+		}
+	}
+	return code
+}
+
+// recordedError returns err for a command that has already written its
+// result record to stdout. With a JSON output format the record reports the
+// failure, so only the exit code is kept and stdout holds a single document.
+func recordedError(opts *rootOptions, err error) error {
+	if err == nil || !isJSONOutput(opts.output) {
+		return err
+	}
+	return &exitError{code: exitCode(err)}
+}
+
+// interruptedErr replaces err with an exitInterrupted error when the command
+// failed after ctx was cancelled by a signal. Commands that treat Ctrl+C as
+// the normal way to stop, such as stats --watch, return nil and keep exit 0.
+func interruptedErr(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	return &exitError{code: exitInterrupted, err: errors.New("interrupted")}
+}
+
+// errorMessage returns err's message followed, for transport failures, by
+// the exchange phase at which the core was lost.
+func errorMessage(err error) string {
+	var pe *client.ProtocolError
+	if !errors.As(err, &pe) {
+		return err.Error()
+	}
+
+	var hint string
+	switch pe.Phase {
+	case client.PhaseDial:
+		hint = "during dial"
+	case client.PhaseWrite:
+		hint = "while writing the request"
+	case client.PhaseReadHeader, client.PhaseReadBody:
+		switch {
+		case errors.Is(err, client.ErrTimeout):
+			hint = "core did not reply in time"
+		case errors.Is(err, client.ErrResponseTooLarge):
+			hint = "raise --max-response to accept it"
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+			hint = "core closed connection while reading response"
+		default:
+			hint = "while reading the response"
+		}
+	case client.PhaseDecode:
+		hint = "core sent an invalid response"
+	default:
+		return err.Error()
+	}
+	return fmt.Sprintf("%v (%s)", err, hint)
+}
+
+// exitError makes the process exit with a specific code. A nil err means the
+// command already reported the failure and nothing more is printed.
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error implements error.
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// Exit codes for scripts, documented in the root command's help. health
+// keeps its own exitUnhealthy and interrupts exit with exitInterrupted.
+const (
+	exitUsage       = 1 // bad flags or arguments, and failures not listed below
+	exitServerError = 2 // the core answered ok:false, including "not implemented"
+	exitConnect     = 3 // the core could not be reached or dropped the connection
+	exitTimeout     = 4 // a deadline expired: --timeout, --attempt-timeout or a read limit
+	exitProtocol    = 5 // the core's reply could not be framed or decoded
+)
+
+// exitCode maps a command error to the process exit code: the code carried by
+// an exitError, otherwise the category of the client error in err's chain,
+// or exitUsage for anything else.
+func exitCode(err error) int {
+	var exitErr *exitError
+	var protoErr *client.ProtocolError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, client.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, client.ErrConnect), errors.Is(err, client.ErrNoResponse):
+		return exitConnect
+	case errors.Is(err, client.ErrServerError), errors.Is(err, client.ErrNotImplemented):
+		return exitServerError
+	case errors.As(err, &protoErr), errors.Is(err, client.ErrNonFiniteStat), errors.Is(err, client.ErrVersionMismatch):
+		return exitProtocol
+	}
+	return exitUsage
+}
+
+// notSupported returns the error for a command the core answered with "not
+// implemented". The message replaces the server's, and the exit code keeps
+// it in the server error category.
+func notSupported(name, command string) error {
+	return &exitError{code: exitServerError, err: fmt.Errorf("%s: this dbgate core does not support %s", name, command)}
+}
+
+// rootOptions holds the persistent flags shared by every subcommand.
+type rootOptions struct {
+	configPath         string
+	profile            string
+	socketPaths        []string
+	addr               string
+	tls                tlsOptions
+	retries            int
+	retryBackoff       time.Duration
+	attemptTimeout     time.Duration
+	tcpKeepAlive       time.Duration
+	tlsConfig          *tls.Config
+	timeout            time.Duration
+	strictLengthPrefix bool
+	strictStats        bool
+	compress           bool
+	compressRequests   bool
+	readBudget         time.Duration
+	timeoutPerByte     time.Duration
+	requestVersion     int
+	requestVersionUsed bool // the deprecated --request-version spelling was given
+	maxResponse        byteSize
+	printIOStats       bool
+	timing             bool
+	dryRun             bool
+	wireDump           bool // --wire-dump: hex dump every frame to stderr
+	trace              bool
+	tracerProvider     *sdktrace.TracerProvider // set by --trace; see startTracing
+	verbose            int
+	logger             *slog.Logger
+	output             string
+	csvDelimiter       csvDelimiter
+	human              bool // stats text output groups counter digits
+	maxColWidth        int  // text tables truncate longer cells; 0 = no limit
+	pageSize           int  // --page-size: items per page of sessions and audit listings; 0 = core default
+	color              string
+	noColor            bool // --no-color, shorthand for --color=never
+	stdout             io.Writer
+	stderr             io.Writer
+
+	labels prometheus.Labels // --label: static labels on stats -o prometheus and exporter metrics
+
+	noDeprecationWarnings bool
+	deprecationOnce       sync.Once
+
+	clientsMu sync.Mutex
+	clients   []*client.Client
+
+	checkCapabilities bool // commands are checked against capabilities first, see annotationCommand
+	capsMu            sync.Mutex
+	caps              map[string]capabilitiesEntry // by socket, see capabilities
+
+	noCapabilityCache   bool
+	refreshCapabilities bool
+	capCache            *capabilityCache // nil with --no-capability-cache
+
+	timingMu sync.Mutex // serializes --timing lines from parallel requests
+
+	noVersionCheck bool
+	versionMu      sync.Mutex
+	versionChecked map[string]bool // sockets whose first client checks the version
+}
+
+// socketPath returns the socket used by single-instance commands.
+func (o *rootOptions) socketPath() string {
+	if len(o.socketPaths) == 0 {
+		return defaultSocket
+	}
+	return o.socketPaths[0]
+}
+
+// newClient builds a UDS client for the single-instance socket.
+func (o *rootOptions) newClient() *client.Client {
+	return o.newClientFor(o.socketPath())
+}
+
+// newClientFor builds a UDS client for socketPath configured from the
+// persistent flags.
+func (o *rootOptions) newClientFor(socketPath string) *client.Client {
+	var opts []client.Option
+	if o.strictLengthPrefix {
+		opts = append(opts, client.WithStrictLengthPrefix())
+	}
+	if o.strictStats {
+		opts = append(opts, client.WithStrictStats())
+	}
+	if o.compress {
+		opts = append(opts, client.WithCompression())
+	}
+	if o.compressRequests {
+		opts = append(opts, client.WithRequestCompression())
+	}
+	if o.readBudget > 0 {
+		opts = append(opts, client.WithReadBudget(o.readBudget))
+	}
+	if o.timeoutPerByte > 0 {
+		opts = append(opts, client.WithIdleReadTimeout(o.timeoutPerByte))
+	}
+	if o.requestVersion != 0 {
+		opts = append(opts, client.WithRequestVersion(o.requestVersion))
+	}
+	if o.maxResponse > 0 {
+		opts = append(opts, client.WithMaxResponseBytes(uint32(o.maxResponse)))
+	}
+	if o.tlsConfig != nil {
+		opts = append(opts, client.WithTLSConfig(o.tlsConfig))
+	}
+	if o.tcpKeepAlive > 0 {
+		opts = append(opts, client.WithTCPKeepAlive(o.tcpKeepAlive))
+	}
+	if o.retries > 0 {
+		opts = append(opts, client.WithRetry(o.retries+1, o.retryBackoff))
+	}
+	if o.attemptTimeout > 0 {
+		opts = append(opts, client.WithAttemptTimeout(o.attemptTimeout))
+	}
+	if o.stderr != nil {
+		opts = append(opts, client.WithWarningHandler(func(msg string) {
+			fmt.Fprintf(o.stderr, "Warning: %s\n", msg)
+		}))
+	}
+	if o.logger != nil {
+		opts = append(opts, client.WithLogger(o.logger))
+	}
+	if o.timing && o.stderr != nil {
+		opts = append(opts, client.WithObserver(o.printTiming))
+	}
+	if o.pageSize > 0 {
+		opts = append(opts, client.WithPageSize(o.pageSize))
+	}
+	if o.wireDump {
+		w := o.stderr
+		if w == nil {
+			w = os.Stderr
+		}
+		opts = append(opts, client.WithWireDump(w))
+	}
+	if o.checkVersionOf(socketPath) {
+		if v, ok := o.capCache.version(socketPath); ok {
+			opts = append(opts, client.WithKnownVersion(v))
+		} else {
+			opts = append(opts, client.WithVersionCheck())
+			if o.capCache != nil {
+				opts = append(opts, client.WithVersionHandler(func(v int, err error) {
+					o.cacheVersion(socketPath, v, err)
+				}))
+			}
+		}
+	}
+	if o.dryRun {
+		opts = append(opts, client.WithDryRun(func(body []byte) { o.printDryRun(socketPath, body) }))
+	}
+	if o.tracerProvider != nil {
+		opts = append(opts, client.WithTracer(o.tracerProvider.Tracer("github.com/dongwonkwak/dbgate/tools/cmd/dbgate-cli")))
+	}
+	c := client.NewClient(socketPath, o.timeout, opts...)
+	o.clientsMu.Lock()
+	o.clients = append(o.clients, c)
+	o.clientsMu.Unlock()
+	return c
+}
+
+// checkVersionOf reports whether the client being built for socketPath
+// should check the core's protocol version: only the first one per socket
+// does, so that watch loops and retries warn about a skew once per run. The
+// warning goes to stderr, so there is no check without one, and none for a
+// core the capability cache knows has no hello to check with.
+func (o *rootOptions) checkVersionOf(socketPath string) bool {
+	if o.noVersionCheck || o.stderr == nil || o.capCache.noHello(socketPath) {
+		return false
 	}
+	o.versionMu.Lock()
+	defer o.versionMu.Unlock()
+	if o.versionChecked[socketPath] {
+		return false
+	}
+	if o.versionChecked == nil {
+		o.versionChecked = make(map[string]bool)
+	}
+	o.versionChecked[socketPath] = true
+	return true
+}
+
+// cacheVersion stores the outcome of the version check of the core at
+// socketPath in the capability cache as soon as the hello returns, so that a
+// command that fails afterwards still spares the next run its hello.
+func (o *rootOptions) cacheVersion(socketPath string, v int, err error) {
+	switch {
+	case err == nil, errors.Is(err, client.ErrVersionMismatch) && v > 0:
+		o.capCache.setVersion(socketPath, v)
+	case errors.Is(err, client.ErrNotImplemented):
+		o.capCache.setNoHello(socketPath)
+	}
+}
+
+// printDryRun writes the request --dry-run stopped from being sent to
+// socketPath, with its framed size, to stderr.
+func (o *rootOptions) printDryRun(socketPath string, body []byte) {
+	w := o.stderr
+	if w == nil {
+		w = os.Stderr
+	}
+	// The frame is the body behind its 4-byte length prefix.
+	fmt.Fprintf(w, "dry run: would send %d bytes to %s:\n%s\n", 4+len(body), socketPath, body)
+}
+
+// printTiming writes one --timing line for a completed command to stderr.
+func (o *rootOptions) printTiming(m client.CommandMetrics) {
+	line := fmt.Sprintf("timing: %s dial=%v write=%v read=%v total=%v",
+		m.Command, m.DialDuration.Round(time.Microsecond), m.WriteDuration.Round(time.Microsecond),
+		m.ReadDuration.Round(time.Microsecond), m.TotalDuration.Round(time.Microsecond))
+	if m.Err != nil {
+		line += " (failed)"
+	}
+	o.timingMu.Lock()
+	defer o.timingMu.Unlock()
+	fmt.Fprintln(o.stderr, line)
+}
+
+// totalIOStats sums the IO counters of every client created by this run.
+func (o *rootOptions) totalIOStats() client.IOStats {
+	o.clientsMu.Lock()
+	defer o.clientsMu.Unlock()
+
+	var total client.IOStats
+	for _, c := range o.clients {
+		s := c.IOStats()
+		total.Requests += s.Requests
+		total.BytesSent += s.BytesSent
+		total.BytesReceived += s.BytesReceived
+	}
+	return total
 }
 
 func newRootCmd() *cobra.Command {
-	var socketPath string
-	var timeout time.Duration
+	return newRootCmdWithOptions(&rootOptions{})
+}
+
+// newRootCmdWithOptions builds the command tree with its persistent flags
+// bound to opts.
+func newRootCmdWithOptions(opts *rootOptions) *cobra.Command {
+	// Environment defaults are resolved before the flags are registered so
+	// that --help shows them and an explicit flag still wins.
+	socketDefault := defaultSocket
+	if v := os.Getenv(envSocket); v != "" {
+		socketDefault = v
+	}
+	timeoutDefault := defaultTimeout
+	var timeoutEnvErr error
+	if v := os.Getenv(envTimeout); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			timeoutEnvErr = fmt.Errorf("invalid %s %q: %w", envTimeout, v, err)
+		} else {
+			timeoutDefault = d
+		}
+	}
 
 	root := &cobra.Command{
 		Use:   "dbgate-cli",
 		Short: "CLI management tool for the dbgate proxy",
 		Long: `dbgate-cli connects to the dbgate proxy via Unix Domain Socket and
-provides commands to inspect statistics, list sessions, and reload policies.`,
+provides commands to inspect statistics, list sessions, and reload policies.
+
+Exit codes:
+  0    success
+  1    usage or flag error, or any other failure
+  2    the core answered ok:false (including commands it does not implement)
+  3    connection error: the core is unreachable or dropped the connection
+  4    timeout
+  5    protocol error: the reply could not be framed or decoded
+  130  interrupted by SIGINT or SIGTERM
+"health" exits 2 for an unhealthy or unreachable core. A command that fails
+on several sockets or requests exits with the code of those failures,
+preferring 4 over 3 when they differ.
+
+With --output json or jsonl a failure is also printed to stdout as
+{"ok": false, "error": "...", "code": <exit code>}, plus "server_code" when
+the core rejected the request, unless the command already printed a result
+that reports it, such as the per-instance records of stats.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			opts.stdout = cmd.OutOrStdout()
+			opts.stderr = cmd.ErrOrStderr()
+			if opts.profile != "" {
+				path := opts.configPath
+				if path == "" {
+					path = defaultConfigPath()
+				}
+				p, err := loadProfile(path, opts.profile)
+				if err != nil {
+					return err
+				}
+				if err := applyProfile(cmd, opts, p); err != nil {
+					return fmt.Errorf("profile %s: %w", opts.profile, err)
+				}
+			}
+			if timeoutEnvErr != nil && !cmd.Flags().Changed("timeout") {
+				return timeoutEnvErr
+			}
+			if opts.addr != "" {
+				if cmd.Flags().Changed("socket") {
+					return errors.New("--addr and --socket cannot be used together")
+				}
+				if _, _, err := client.ParseAddress(opts.addr); err != nil {
+					return fmt.Errorf("--addr: %w", err)
+				}
+				opts.socketPaths = []string{opts.addr}
+			}
+			if opts.tls.enabled() {
+				if network, _, _ := client.ParseAddress(opts.addr); network != "tcp" {
+					return errors.New("--tls-* flags require --addr tcp://host:port")
+				}
+				cfg, err := opts.tls.config()
+				if err != nil {
+					return err
+				}
+				opts.tlsConfig = cfg
+			}
+			if len(opts.socketPaths) > 1 && cmd.Annotations[annotationMultiSocket] == "" {
+				return fmt.Errorf("%s: --socket may only be repeated for commands that support multiple instances", cmd.CommandPath())
+			}
+			if opts.retries < 0 {
+				return fmt.Errorf("invalid --retries %d: must not be negative", opts.retries)
+			}
+			if opts.requestVersionUsed {
+				fmt.Fprintln(opts.stderr, "Flag --request-version has been deprecated, use --protocol-version instead")
+			}
+			if opts.requestVersion < 1 {
+				return fmt.Errorf("invalid --protocol-version %d: must be at least 1", opts.requestVersion)
+			}
+			if opts.tcpKeepAlive < 0 {
+				return fmt.Errorf("invalid --tcp-keepalive %s: must not be negative", opts.tcpKeepAlive)
+			}
+			if err := validateColor(opts.color); err != nil {
+				return err
+			}
+			if opts.maxColWidth < 0 {
+				return fmt.Errorf("invalid --max-col-width %d: must not be negative", opts.maxColWidth)
+			}
+			if opts.pageSize < 0 {
+				return fmt.Errorf("invalid --page-size %d: must not be negative", opts.pageSize)
+			}
+			if opts.attemptTimeout < 0 {
+				return fmt.Errorf("invalid --attempt-timeout %s: must not be negative", opts.attemptTimeout)
+			}
+			switch opts.output {
+			case outputText, outputJSON, outputJSONL, outputCSV:
+			case outputPrometheus, outputIDs, outputIDs0:
+				if !slices.Contains(strings.Split(cmd.Annotations[annotationOutputs], ","), opts.output) {
+					return fmt.Errorf("%s: --output %s is not supported by this command", cmd.CommandPath(), opts.output)
+				}
+			default:
+				return fmt.Errorf("invalid --output %q: must be %q, %q, %q, %q, or a command-specific %q, %q or %q",
+					opts.output, outputText, outputJSON, outputJSONL, outputCSV, outputPrometheus, outputIDs, outputIDs0)
+			}
+			if cmd.Flags().Changed("csv-delimiter") && opts.output != outputCSV {
+				return errors.New("--csv-delimiter requires --output csv")
+			}
+			if opts.logger = newLogger(opts.stderr, opts.verbose); opts.logger != nil {
+				opts.logger.Info("resolved target", "sockets", opts.socketPaths, "timeout", opts.timeout)
+			}
+			if !opts.noCapabilityCache {
+				opts.capCache = newCapabilityCache(opts.refreshCapabilities, opts.logger)
+			}
+			if opts.trace {
+				if err := opts.startTracing(cmd.Context()); err != nil {
+					return err
+				}
+			}
+			if command := cmd.Annotations[annotationCommand]; opts.checkCapabilities && command != "" {
+				return opts.checkCapability(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "), command)
+			}
+			return nil
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if opts.printIOStats {
+				s := opts.totalIOStats()
+				fmt.Fprintf(cmd.ErrOrStderr(), "I/O: %d request(s), %d bytes sent, %d bytes received\n",
+					s.Requests, s.BytesSent, s.BytesReceived)
+			}
+		},
 	}
 
-	root.PersistentFlags().StringVar(&socketPath, "socket", defaultSocket, "Path to dbgate Unix Domain Socket")
-	root.PersistentFlags().DurationVar(&timeout, "timeout", defaultTimeout, "Timeout for UDS requests")
+	root.PersistentFlags().StringVar(&opts.configPath, "config", "",
+		"Config file with named profiles (default ~/"+defaultConfigFile+")")
+	root.PersistentFlags().StringVar(&opts.profile, "profile", "",
+		"Profile from --config to use for socket, timeout, output and TLS settings")
+	root.PersistentFlags().StringArrayVar(&opts.socketPaths, "socket", []string{socketDefault},
+		"Path to dbgate Unix Domain Socket, or @name for a Linux abstract socket (repeatable for stats; env "+envSocket+")")
+	root.PersistentFlags().StringVar(&opts.addr, "addr", "",
+		"dbgate control address as unix:///path or tcp://host:port (overrides --socket)")
+	root.PersistentFlags().StringVar(&opts.tls.caFile, "tls-ca", "",
+		"PEM CA bundle used to verify the server certificate (default: system roots)")
+	root.PersistentFlags().StringVar(&opts.tls.certFile, "tls-cert", "", "PEM client certificate for mutual TLS")
+	root.PersistentFlags().StringVar(&opts.tls.keyFile, "tls-key", "", "PEM private key for --tls-cert")
+	root.PersistentFlags().StringVar(&opts.tls.serverName, "tls-server-name", "",
+		"Server name to verify (default: host from --addr)")
+	root.PersistentFlags().BoolVar(&opts.tls.insecure, "tls-insecure", false,
+		"Skip server certificate verification (insecure; testing only)")
+	root.PersistentFlags().DurationVar(&opts.tcpKeepAlive, "tcp-keepalive", 30*time.Second,
+		"TCP keepalive probe interval for --addr tcp:// connections (0 = Go default; no effect on Unix sockets)")
+	root.PersistentFlags().DurationVar(&opts.timeout, "timeout", timeoutDefault, "Timeout for UDS requests (env "+envTimeout+")")
+	root.PersistentFlags().IntVar(&opts.retries, "retries", 0,
+		"Retry a request up to N times if the core is unreachable, drops the connection or exceeds --attempt-timeout; all attempts share --timeout")
+	root.PersistentFlags().DurationVar(&opts.retryBackoff, "retry-backoff", 100*time.Millisecond,
+		"Initial delay between retries; doubles on each attempt, with jitter")
+	root.PersistentFlags().DurationVar(&opts.attemptTimeout, "attempt-timeout", 0,
+		"Timeout for a single attempt; with --retries a timed-out attempt is retried while --timeout, "+
+			"the budget for all attempts combined, lasts (0 = one attempt may use all of --timeout)")
+	root.PersistentFlags().BoolVar(&opts.strictLengthPrefix, "strict-length-prefix", false,
+		"Fail if the server sends bytes beyond the declared response length (protocol conformance testing)")
+	root.PersistentFlags().BoolVar(&opts.strictStats, "strict-stats", false,
+		"Fail instead of substituting 0 when the server reports NaN/Inf for qps or block_rate")
+	root.PersistentFlags().BoolVar(&opts.compress, "compress", false,
+		"Ask the core to gzip large responses, e.g. long session lists")
+	root.PersistentFlags().BoolVar(&opts.compressRequests, "compress-requests", false,
+		"Gzip large requests, e.g. a policy to validate; only for a core that reads compressed requests")
+	root.PersistentFlags().DurationVar(&opts.readBudget, "read-budget", 0,
+		"Maximum time to read a full response once the request is sent (0 = bounded only by --timeout)")
+	root.PersistentFlags().DurationVar(&opts.timeoutPerByte, "timeout-per-byte", 0,
+		"Maximum wait for the next response bytes; the read deadline is extended whenever data arrives, "+
+			"so large responses are not cut off by --timeout (0 = disabled)")
+	opts.maxResponse = client.MaxResponseBytes
+	root.PersistentFlags().Var(&opts.maxResponse, "max-response",
+		"Largest response the core may send, e.g. 32MiB; larger replies are rejected unread")
+	root.PersistentFlags().BoolVar(&opts.printIOStats, "print-io-stats", false,
+		"Print request and byte counts for this run to stderr after a successful command")
+	root.PersistentFlags().CountVarP(&opts.verbose, "verbose", "v",
+		"Log what the CLI does to stderr; repeat for more detail (-vv byte counts and durations, -vvv response hex dumps)")
+	root.PersistentFlags().BoolVar(&opts.timing, "timing", false,
+		"Print dial, write, read and total time of each request to stderr")
+	root.PersistentFlags().BoolVar(&opts.dryRun, "dry-run", false,
+		"Print each request and its framed size to stderr instead of sending it; nothing is dialed")
+	root.PersistentFlags().BoolVar(&opts.wireDump, "wire-dump", false,
+		"Print every frame sent and received, length prefix included, to stderr as hex and ASCII")
+	root.PersistentFlags().BoolVar(&opts.trace, "trace", false,
+		"Export an OpenTelemetry span per request over OTLP/HTTP, configured by the standard OTEL_EXPORTER_OTLP_* env vars")
+	root.PersistentFlags().BoolVar(&opts.checkCapabilities, "check-capabilities", false,
+		"Before sending a command, ask the core whether it supports it and refuse it with a clear message if not")
+	root.PersistentFlags().BoolVar(&opts.noCapabilityCache, "no-capability-cache", false,
+		"Always ask the core for its protocol version and capabilities instead of using the answers cached for "+
+			capabilityCacheTTL.String()+" under the user cache directory")
+	root.PersistentFlags().BoolVar(&opts.refreshCapabilities, "refresh-capabilities", false,
+		"Ask the core for its protocol version and capabilities and update the cache with the answers")
+	root.MarkFlagsMutuallyExclusive("no-capability-cache", "refresh-capabilities")
+	root.PersistentFlags().BoolVar(&opts.noDeprecationWarnings, "no-deprecation-warnings", false,
+		"Do not warn when a deprecated command alias is used")
+	root.PersistentFlags().IntVar(&opts.requestVersion, "protocol-version", client.ProtocolVersion,
+		"Protocol version to send in every request, e.g. to test against older cores")
+	root.PersistentFlags().BoolVar(&opts.noVersionCheck, "no-version-check", false,
+		"Do not ask the core for its protocol version before the first command and warn when it differs")
+	// --request-version is the deprecated name of --protocol-version.
+	root.SetGlobalNormalizationFunc(func(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "request-version" {
+			opts.requestVersionUsed = true
+			name = "protocol-version"
+		}
+		return pflag.NormalizedName(name)
+	})
+	root.PersistentFlags().StringVarP(&opts.output, "output", "o", outputText,
+		"Output format: text, json, jsonl (one compact object per line), csv, prometheus (stats only) or ids/ids0 (sessions only)")
+	root.PersistentFlags().Var(&opts.csvDelimiter, "csv-delimiter",
+		`Field separator for --output csv: a single character such as ";", or "tab"`)
+	root.PersistentFlags().StringVar(&opts.color, "color", colorAuto,
+		"Color output: auto (only on a terminal), always or never; NO_COLOR overrides")
+	root.PersistentFlags().BoolVar(&opts.noColor, "no-color", false, "Same as --color=never")
+	root.MarkFlagsMutuallyExclusive("color", "no-color")
+	root.PersistentFlags().IntVar(&opts.pageSize, "page-size", 0,
+		"Ask the core to return session and audit listings in pages of this many items, fetched in turn (0 = core default)")
+	root.PersistentFlags().IntVar(&opts.maxColWidth, "max-col-width", 0,
+		"Truncate table cells longer than this many characters with an ellipsis (0 = no limit)")
 
 	// stats subcommand
+	var statsAggregate bool
+	var statsFailFast bool
+	var statsKeepGoing bool
+	var statsWatch time.Duration
+	var statsDelta time.Duration
+	var statsStream time.Duration
+	var statsHuman bool
+	var statsNoHuman bool
+	var statsLabels []string
 	statsCmd := &cobra.Command{
 		Use:   "stats",
 		Short: "Print proxy statistics (QPS, block rate, active sessions, etc.)",
+		Long: `Print proxy statistics (QPS, block rate, active sessions, etc.).
+
+Repeat --socket to query several dbgate instances in parallel. Each instance
+is printed as a row; --aggregate prints a single fleet-wide total instead.
+Unreachable instances are reported as unavailable and make the command exit
+non-zero, but never hide the instances that did respond.
+
+By default every instance is attempted (--keep-going). With --fail-fast the
+first failure stops waiting for the remaining instances, which are reported
+as skipped. The exit code is non-zero on any failure in both modes.
+
+With --watch the stats are re-queried on the given interval and redrawn like
+watch(1) until Ctrl+C. A failed poll is reported on stderr; three consecutive
+failures end the command with a non-zero exit code. With --output csv each
+poll appends a data row and the header is printed only once. When color is
+enabled, each number that changed since the previous poll is highlighted
+with an up or down arrow; this covers a single instance and --aggregate.
+
+With --delta two snapshots are taken the given interval apart and the
+server-reported QPS and block rate are printed next to the rates observed
+between them. --delta works against a single instance.
+
+With --stream the core pushes a snapshot every interval over one connection
+that stays open until Ctrl+C, drawn like --watch. It needs a core with the
+stats_subscribe command and works against a single instance; a lost
+connection ends the command with an error rather than being retried.
+
+With --output prometheus the stats are printed once in the Prometheus text
+exposition format, under the metric names served by the exporter command,
+e.g. for node_exporter's textfile collector. Several instances need
+--aggregate; --watch, --delta and --stream are not supported. Repeated
+--label name=value pairs are attached to every metric line.
+
+In text output, counters are printed with thousands separators (12,345,678)
+when stdout is a terminal or with --human; --no-human prints them raw. Other
+output formats always carry the raw numbers.`,
+		Annotations: map[string]string{annotationMultiSocket: "true", annotationOutputs: outputPrometheus},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runStats(socketPath, timeout)
+			if statsWatch < 0 {
+				return fmt.Errorf("invalid --watch %s: must be positive", statsWatch)
+			}
+			if statsDelta < 0 {
+				return fmt.Errorf("invalid --delta %s: must be positive", statsDelta)
+			}
+			if statsStream < 0 {
+				return fmt.Errorf("invalid --stream %s: must be positive", statsStream)
+			}
+			if opts.output == outputPrometheus && (statsWatch > 0 || statsDelta > 0 || statsStream > 0) {
+				return fmt.Errorf("--output %s prints a single snapshot and cannot be combined with --watch, --delta or --stream", outputPrometheus)
+			}
+			if len(statsLabels) > 0 && opts.output != outputPrometheus {
+				return fmt.Errorf("--label needs --output %s", outputPrometheus)
+			}
+			labels, err := exporter.ParseLabels(statsLabels)
+			if err != nil {
+				return err
+			}
+			opts.labels = labels
+			opts.human = statsHuman || !statsNoHuman && isTerminal(cmd.OutOrStdout())
+			if statsDelta > 0 {
+				if len(opts.socketPaths) > 1 || statsAggregate {
+					return errors.New("--delta supports a single --socket only")
+				}
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				return runStatsDelta(ctx, cmd.OutOrStdout(), opts, statsDelta)
+			}
+			if statsStream > 0 {
+				if len(opts.socketPaths) > 1 || statsAggregate {
+					return errors.New("--stream supports a single --socket only")
+				}
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				return runStatsStream(ctx, cmd.OutOrStdout(), opts, statsStream)
+			}
+			if statsWatch > 0 {
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				return runStatsWatch(ctx, cmd.OutOrStdout(), opts, statsAggregate, statsFailFast, statsWatch)
+			}
+			return runStats(cmd.Context(), cmd.OutOrStdout(), opts, statsAggregate, statsFailFast)
 		},
 	}
+	statsCmd.Flags().BoolVar(&statsAggregate, "aggregate", false, "Print one aggregated total across all --socket instances")
+	statsCmd.Flags().BoolVar(&statsFailFast, "fail-fast", false, "Stop at the first unreachable instance")
+	statsCmd.Flags().BoolVar(&statsKeepGoing, "keep-going", true, "Attempt every instance and report all failures (default)")
+	statsCmd.Flags().DurationVar(&statsWatch, "watch", 0, "Re-query every interval and redraw until interrupted (e.g. 2s)")
+	statsCmd.Flags().DurationVar(&statsDelta, "delta", 0, "Measure QPS and block rate between two snapshots this far apart (e.g. 10s)")
+	statsCmd.Flags().DurationVar(&statsStream, "stream", 0, "Have the core push a snapshot every interval over one connection (e.g. 1s)")
+	statsCmd.Flags().BoolVarP(&statsHuman, "human", "H", false, "Print counters with thousands separators (default when stdout is a terminal)")
+	statsCmd.Flags().BoolVar(&statsNoHuman, "no-human", false, "Print counters without thousands separators")
+	statsCmd.Flags().StringArrayVar(&statsLabels, "label", nil, "Static label name=value added to every --output prometheus metric (repeatable)")
+	statsCmd.MarkFlagsMutuallyExclusive("fail-fast", "keep-going")
+	statsCmd.MarkFlagsMutuallyExclusive("human", "no-human")
+	statsCmd.AddCommand(newStatsResetCmd(opts))
+	statsCmd.MarkFlagsMutuallyExclusive("watch", "delta", "stream")
 
-	// sessions subcommand
-	sessionsCmd := &cobra.Command{
-		Use:   "sessions",
+	// session list subcommand
+	var sessionsNoPayload bool
+	var sessionsFilter client.SessionFilter
+	var sessionsOrder sessionOrder
+	sessionListCmd := &cobra.Command{
+		Use:   "list",
 		Short: "List active sessions",
+		Long: `List active sessions.
+
+--output ids prints only the session IDs, one per line, and --output ids0
+terminates each ID with a NUL byte for xargs -0, e.g.
+
+  dbgate-cli session list --output ids0 | xargs -0 -n1 dbgate-cli session kill
+
+--user, --db and --state list only the matching sessions. The filter is sent
+to the core; if the core ignores it, the sessions are filtered locally.
+
+--sort orders the sessions by duration or queries (largest first) or by user,
+keeping the core's order among equal keys, and --limit then keeps the first N.
+Both are applied locally after filtering.`,
+		Annotations: map[string]string{annotationOutputs: outputIDs + "," + outputIDs0, annotationCommand: "sessions"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runGenericCommand(socketPath, timeout, "sessions")
+			if err := sessionsOrder.validate(); err != nil {
+				return err
+			}
+			return runSessions(cmd.Context(), cmd.OutOrStdout(), opts, sessionsNoPayload, sessionsFilter, sessionsOrder)
 		},
 	}
+	sessionListCmd.Flags().BoolVar(&sessionsNoPayload, "no-payload", false, "Print only the OK status line, not the session table")
+	sessionListCmd.Flags().StringVar(&sessionsFilter.User, "user", "", "Only sessions of this user")
+	sessionListCmd.Flags().StringVar(&sessionsFilter.Database, "db", "", "Only sessions on this database")
+	sessionListCmd.Flags().StringVar(&sessionsFilter.State, "state", "", "Only sessions in this state, e.g. active or idle")
+	sessionListCmd.Flags().StringVar(&sessionsOrder.key, "sort", "", "Sort by "+strings.Join(sessionSortKeys, ", "))
+	sessionListCmd.Flags().IntVar(&sessionsOrder.limit, "limit", 0, "Print at most N sessions, after sorting (0 = all)")
+
+	// session subcommand (parent)
+	sessionCmd := &cobra.Command{
+		Use:   "session",
+		Short: "List and manage sessions",
+	}
+
+	// session kill subcommand
+	sessionKillCmd := &cobra.Command{
+		Use:               "kill <id>",
+		Short:             "Terminate a session by ID",
+		Annotations:       map[string]string{annotationCommand: "kill_session"},
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSessionIDs(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessionKill(cmd.OutOrStdout(), opts, args[0])
+		},
+	}
+	sessionCmd.AddCommand(sessionListCmd, sessionKillCmd, newSessionKillAllCmd(opts))
 
 	// policy subcommand (parent)
 	policyCmd := &cobra.Command{
@@ -82,10 +937,11 @@ provides commands to inspect statistics, list sessions, and reload policies.`,
 
 	// policy reload subcommand
 	policyReloadCmd := &cobra.Command{
-		Use:   "reload",
-		Short: "Reload the access control policy",
+		Use:         "reload",
+		Short:       "Reload the access control policy",
+		Annotations: map[string]string{annotationCommand: "policy_reload"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPolicyReload(socketPath, timeout)
+			return runPolicyReload(opts)
 		},
 	}
 
@@ -100,8 +956,9 @@ provides commands to inspect statistics, list sessions, and reload policies.`,
 		Short: "Dry-run SQL evaluation against the policy engine",
 		Long: `Evaluate a SQL statement against the current policy without executing it.
 Useful for debugging policy rules and auditing access control decisions.`,
+		Annotations: map[string]string{annotationCommand: "policy_explain"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPolicyExplain(socketPath, timeout, explainSQL, explainUser, explainIP, explainJSON)
+			return runPolicyExplain(opts, explainSQL, explainUser, explainIP, explainJSON)
 		},
 	}
 	policyExplainCmd.Flags().StringVar(&explainSQL, "sql", "", "SQL statement to evaluate (required)")
@@ -118,22 +975,76 @@ Useful for debugging policy rules and auditing access control decisions.`,
 		panic(err)
 	}
 
+	// policy test subcommand
+	var testQuery string
+	var testDB string
+	var testJSON bool
+
+	policyTestCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Check whether a query would be allowed or blocked by the policy",
+		Long: `Ask the core's policy engine whether a query would be allowed or blocked,
+and by which rule, without executing it. Useful for validating rules before
+deploying them.`,
+		Annotations: map[string]string{annotationCommand: "policy_eval"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyTest(cmd.OutOrStdout(), opts, testQuery, testDB, testJSON)
+		},
+	}
+	policyTestCmd.Flags().StringVar(&testQuery, "query", "", "SQL query to evaluate (required)")
+	policyTestCmd.Flags().StringVar(&testDB, "db", "", "Default database the query runs against")
+	policyTestCmd.Flags().BoolVar(&testJSON, "json", false, "Output raw JSON decision")
+	if err := policyTestCmd.MarkFlagRequired("query"); err != nil {
+		panic(err)
+	}
+
+	// policy validate subcommand
+	var policyValidateLocal bool
+	policyValidateCmd := &cobra.Command{
+		Use:   "validate <path>",
+		Short: "Check a policy file for errors without applying it",
+		Long: `Check a policy file for errors without applying it. By default the core
+validates the file. With --local it is checked against the policy schema built
+into the CLI instead, without contacting a core, e.g. in CI; errors then name
+the JSON pointer of the offending value. The schema covers the file's
+structure only, so the core may still refuse a file that passes --local.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyValidate(cmd.OutOrStdout(), opts, args[0], policyValidateLocal)
+		},
+	}
+	policyValidateCmd.Flags().BoolVar(&policyValidateLocal, "local", false,
+		"Validate against the built-in policy schema without contacting the core")
+
+	// policy diff subcommand
+	policyDiffCmd := &cobra.Command{
+		Use:         "diff <path>",
+		Short:       "Show a unified diff between the running policy and a local file",
+		Annotations: map[string]string{annotationCommand: "policy_show"},
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyDiff(cmd.OutOrStdout(), opts, args[0], opts.colorEnabled())
+		},
+	}
+
 	// policy versions subcommand
 	policyVersionsCmd := &cobra.Command{
-		Use:   "versions",
-		Short: "List all stored policy versions",
+		Use:         "versions",
+		Short:       "List all stored policy versions",
+		Annotations: map[string]string{annotationCommand: "policy_versions"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPolicyVersions(socketPath, timeout)
+			return runPolicyVersions(opts)
 		},
 	}
 
 	// policy rollback subcommand
 	var rollbackVersion uint64
 	policyRollbackCmd := &cobra.Command{
-		Use:   "rollback",
-		Short: "Roll back to a specific policy version",
+		Use:         "rollback",
+		Short:       "Roll back to a specific policy version",
+		Annotations: map[string]string{annotationCommand: "policy_rollback"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPolicyRollback(socketPath, timeout, rollbackVersion)
+			return runPolicyRollback(opts, rollbackVersion)
 		},
 	}
 	policyRollbackCmd.Flags().Uint64Var(&rollbackVersion, "version", 0, "Target policy version to roll back to (required)")
@@ -141,37 +1052,156 @@ Useful for debugging policy rules and auditing access control decisions.`,
 		panic(err)
 	}
 
-	policyCmd.AddCommand(policyReloadCmd, policyExplainCmd, policyVersionsCmd, policyRollbackCmd)
-	root.AddCommand(statsCmd, sessionsCmd, policyCmd)
+	policyCmd.AddCommand(policyReloadCmd, policyExplainCmd, policyTestCmd, policyValidateCmd, policyDiffCmd, policyVersionsCmd, policyRollbackCmd)
+	root.AddCommand(statsCmd, sessionCmd, policyCmd, newHealthCmd(opts), newPingCmd(opts), newAuditCmd(opts), newLogLevelCmd(opts), newTopCmd(opts), newVersionCmd(opts), newCapabilitiesCmd(opts), newDoctorCmd(opts), newExporterCmd(opts), newRawCmd(opts), newBenchCmd(opts), newSelftestCmd())
+
+	// "sessions" was renamed to "session list".
+	root.AddCommand(deprecatedAlias(opts, "sessions", "dbgate-cli session list", sessionListCmd))
+
+	// Replace cobra's implicit completion command with our own, which
+	// documents the live session ID completion.
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.AddCommand(newCompletionCmd(root))
 
 	return root
 }
 
-// runStats executes the "stats" command and prints the result in human-readable format.
-func runStats(socketPath string, timeout time.Duration) error {
-	c := client.NewClient(socketPath, timeout)
-	snap, err := c.GetStats()
-	if err != nil {
-		return fmt.Errorf("stats: %w", err)
+// runStats executes the "stats" command against every configured socket and
+// prints the result in the format selected by --output. A single socket keeps
+// the classic block layout; several sockets print one row per instance, or one
+// aggregated block when aggregate is set. failFast stops at the first failing
+// instance.
+func runStats(ctx context.Context, w io.Writer, opts *rootOptions, aggregate, failFast bool) error {
+	return renderStats(ctx, w, opts, opts.statsClients(), aggregate, failFast, true, nil)
+}
+
+// statsClients builds one client per configured socket, keyed by socket, for
+// renderStats.
+func (o *rootOptions) statsClients() map[string]*client.Client {
+	clients := map[string]*client.Client{o.socketPath(): o.newClient()}
+	for _, socket := range o.socketPaths {
+		if _, ok := clients[socket]; !ok {
+			clients[socket] = o.newClientFor(socket)
+		}
 	}
+	return clients
+}
 
-	fmt.Println("=== dbgate stats ===")
-	fmt.Printf("QPS:              %8.2f\n", snap.QPS)
-	fmt.Printf("Block Rate:       %7.2f%%\n", snap.BlockRate*100)
-	fmt.Printf("Active Sessions:  %8d\n", snap.ActiveSessions)
-	fmt.Printf("Total Queries:    %8d\n", snap.TotalQueries)
-	fmt.Printf("Blocked Queries:  %8d\n", snap.BlockedQueries)
-	fmt.Printf("Monitored Blocks: %8d\n", snap.MonitoredBlocks)
-	fmt.Printf("Total Connections:%8d\n", snap.TotalConnections)
-	fmt.Printf("Captured At:      %s\n", snap.CapturedAt.Format("2006-01-02 15:04:05 UTC"))
+// renderStats is runStats with the clients from statsClients passed in and
+// control over the CSV header row, so that stats --watch can reuse its
+// clients and append data rows without repeating the header. A non-nil hl
+// highlights the changes in the single-snapshot text output.
+func renderStats(ctx context.Context, w io.Writer, opts *rootOptions, clients map[string]*client.Client, aggregate, failFast, csvHeader bool, hl *statsHighlighter) error {
+	if opts.output == outputPrometheus && len(opts.socketPaths) > 1 && !aggregate {
+		// Per-instance series would need a label the exporter does not have.
+		return fmt.Errorf("--output %s needs --aggregate with several --socket instances", outputPrometheus)
+	}
+	if len(opts.socketPaths) <= 1 && !aggregate {
+		snap, rtt, err := clients[opts.socketPath()].GetStatsTimed(ctx)
+		if err != nil {
+			return fmt.Errorf("stats: %w", err)
+		}
+		switch opts.output {
+		case outputJSON, outputJSONL:
+			return writeRecord(w, opts.output, timedStats{StatsSnapshot: snap, ControlRTTMs: durationMillis(rtt)})
+		case outputCSV:
+			return writeStatsCSV(w, opts.csvDelimiter, []instanceStats{{snap: snap}}, false, csvHeader)
+		case outputPrometheus:
+			return exporter.WriteText(w, snap, opts.labels)
+		}
+		hl.print(w, "=== dbgate stats ===", snap, opts.human)
+		fmt.Fprintf(w, "Control RTT:      %s\n", formatMillis(rtt))
+		return nil
+	}
+
+	results := collectStats(ctx, opts, clients, failFast)
+	switch {
+	case isJSONOutput(opts.output):
+		written, err := writeStatsJSON(w, opts.output, results, aggregate)
+		if err != nil {
+			return err
+		}
+		if written {
+			return recordedError(opts, statsFanOutError(results))
+		}
+	case opts.output == outputPrometheus:
+		if total, reachable := aggregateStats(results); reachable > 0 {
+			if err := exporter.WriteText(w, &total, opts.labels); err != nil {
+				return err
+			}
+		}
+	case opts.output == outputCSV && aggregate:
+		total, reachable := aggregateStats(results)
+		var rows []instanceStats
+		if reachable > 0 {
+			rows = []instanceStats{{snap: &total}}
+		}
+		if err := writeStatsCSV(w, opts.csvDelimiter, rows, false, csvHeader); err != nil {
+			return err
+		}
+	case opts.output == outputCSV:
+		if err := writeStatsCSV(w, opts.csvDelimiter, results, true, csvHeader); err != nil {
+			return err
+		}
+	case aggregate:
+		total, reachable := aggregateStats(results)
+		if reachable > 0 {
+			hl.print(w, fmt.Sprintf("=== dbgate stats (aggregate of %d/%d instances) ===", reachable, len(results)), &total, opts.human)
+		}
+		for _, r := range results {
+			if r.err != nil {
+				fmt.Fprintf(w, "Unavailable:      %s (%v)\n", r.socket, r.err)
+			}
+		}
+	default:
+		if err := printStatsTable(w, results, opts); err != nil {
+			return err
+		}
+	}
+	return statsFanOutError(results)
+}
 
+// writeJSON writes v to w as a single indented JSON document.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encode JSON: %w", err)
+	}
 	return nil
 }
 
+// timedStats is the --output json form of a single instance's stats: the
+// snapshot plus the round trip of the stats request that fetched it.
+type timedStats struct {
+	*client.StatsSnapshot
+	ControlRTTMs float64 `json:"control_rtt_ms"`
+}
+
+// printStats prints snap as the classic aligned stats block under title, with
+// counters passed through formatCounter.
+func printStats(w io.Writer, title string, snap *client.StatsSnapshot, human bool) {
+	printStatsChanges(w, title, snap, human, statsChanges{})
+}
+
+// printStatsChanges is printStats with every field that moved according to
+// changes drawn in color with an up or down arrow.
+func printStatsChanges(w io.Writer, title string, snap *client.StatsSnapshot, human bool, changes statsChanges) {
+	fmt.Fprintln(w, title)
+	fmt.Fprintf(w, "QPS:              %s\n", changes.QPS.mark(fmt.Sprintf("%8.2f", snap.QPS)))
+	fmt.Fprintf(w, "Block Rate:       %s\n", changes.BlockRate.mark(fmt.Sprintf("%7.2f%%", snap.BlockRate*100)))
+	fmt.Fprintf(w, "Active Sessions:  %s\n", changes.ActiveSessions.mark(fmt.Sprintf("%8s", formatCounter(snap.ActiveSessions, human))))
+	fmt.Fprintf(w, "Total Queries:    %s\n", changes.TotalQueries.mark(fmt.Sprintf("%8s", formatCounter(snap.TotalQueries, human))))
+	fmt.Fprintf(w, "Blocked Queries:  %s\n", changes.BlockedQueries.mark(fmt.Sprintf("%8s", formatCounter(snap.BlockedQueries, human))))
+	fmt.Fprintf(w, "Monitored Blocks: %s\n", changes.MonitoredBlocks.mark(fmt.Sprintf("%8s", formatCounter(snap.MonitoredBlocks, human))))
+	fmt.Fprintf(w, "Total Connections:%s\n", changes.TotalConnections.mark(fmt.Sprintf("%8s", formatCounter(snap.TotalConnections, human))))
+	fmt.Fprintf(w, "Captured At:      %s\n", snap.CapturedAt.Format("2006-01-02 15:04:05 UTC"))
+}
+
 // runPolicyExplain evaluates a SQL statement against the policy engine (dry-run)
 // and prints the result in human-readable or JSON format.
-func runPolicyExplain(socketPath string, timeout time.Duration, sql, user, ip string, asJSON bool) error {
-	c := client.NewClient(socketPath, timeout)
+func runPolicyExplain(opts *rootOptions, sql, user, ip string, asJSON bool) error {
+	c := opts.newClient()
 	result, err := c.PolicyExplain(sql, user, ip)
 	if err != nil {
 		return fmt.Errorf("policy explain: %w", err)
@@ -206,34 +1236,200 @@ func runPolicyExplain(socketPath string, timeout time.Duration, sql, user, ip st
 	return nil
 }
 
-// runGenericCommand sends a raw command to the server and prints the response.
-// Any non-OK response from the server is returned as an error so that callers
-// (including shell scripts and CI pipelines) receive a non-zero exit code.
-func runGenericCommand(socketPath string, timeout time.Duration, cmd string) error {
-	c := client.NewClient(socketPath, timeout)
-	resp, err := c.SendCommand(cmd)
+// runPolicyTest asks the policy engine whether query would be allowed and
+// prints the decision and matched rule in human-readable or JSON format.
+func runPolicyTest(w io.Writer, opts *rootOptions, query, db string, asJSON bool) error {
+	c := opts.newClient()
+	decision, err := c.EvalPolicy(query, db)
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("policy test", "policy_eval")
+	}
+	if err != nil {
+		return fmt.Errorf("policy test: %w", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(decision); err != nil {
+			return fmt.Errorf("encode JSON: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(w, "Decision: %s\n", strings.ToUpper(decision.Action))
+	fmt.Fprintf(w, "Rule    : %s\n", decision.MatchedRule)
+	if decision.Reason != "" {
+		fmt.Fprintf(w, "Reason  : %s\n", decision.Reason)
+	}
+	return nil
+}
+
+// runSessions lists active sessions as an aligned table, as a JSON array with
+// --output json, one object per line with --output jsonl, or as CSV with
+// --output csv, or as bare IDs with --output ids or ids0. CSV and JSON lines
+// are written as the sessions are streamed from the core. When noPayload is
+// set only the "[sessions] OK" status line is printed. Only sessions matching
+// filter are listed; the filter is sent to the core, and applied locally only
+// if the core ignores it.
+func runSessions(ctx context.Context, w io.Writer, opts *rootOptions, noPayload bool, filter client.SessionFilter, order sessionOrder) error {
+	c := opts.newClient()
+	switch {
+	case !order.isZero():
+		// Sorting and limiting need the whole list, so nothing is streamed.
+	case opts.output == outputCSV:
+		return sessionsError(streamSessionsCSV(ctx, w, opts.csvDelimiter, c, filter))
+	case opts.output == outputJSONL:
+		return sessionsError(c.StreamSessions(ctx, filter, func(s client.Session) error {
+			return writeRecord(w, outputJSONL, s)
+		}))
+	}
+
+	sessions, err := c.ListSessionsFilteredContext(ctx, filter)
+	if err != nil {
+		return sessionsError(err)
+	}
+	sessions = order.apply(sessions)
+	switch opts.output {
+	case outputCSV:
+		return writeSessionsCSV(w, opts.csvDelimiter, sessions)
+	case outputJSON, outputJSONL:
+		return writeRecords(w, opts.output, sessions)
+	case outputIDs, outputIDs0:
+		term := "\n"
+		if opts.output == outputIDs0 {
+			term = "\x00"
+		}
+		for _, id := range client.SessionList(sessions).IDs() {
+			if _, err := io.WriteString(w, id+term); err != nil {
+				return fmt.Errorf("write output: %w", err)
+			}
+		}
+		return nil
+	}
+	if noPayload {
+		fmt.Fprintln(w, "[sessions] OK")
+		return nil
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintln(w, "No active sessions")
+		return nil
+	}
+
+	t := newTable("ID", "Client", "User", "Database", "State", "Started At", "Queries")
+	t.maxWidth = opts.maxColWidth
+	for _, s := range sessions {
+		t.addRow(s.ID, s.ClientAddr, s.User, s.Database, s.State,
+			s.StartedAt.Format("2006-01-02 15:04:05 UTC"), strconv.FormatUint(s.QueryCount, 10))
+	}
+	return t.render(w)
+}
+
+// sessionsError maps a sessions failure to the message printed by the CLI.
+func sessionsError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, client.ErrNotImplemented):
+		return &exitError{code: exitServerError, err: errors.New("sessions: this dbgate core does not implement the sessions command yet")}
+	default:
+		return fmt.Errorf("sessions: %w", err)
+	}
+}
+
+// runSessionKill asks the core to terminate the session with the given ID.
+func runSessionKill(w io.Writer, opts *rootOptions, id string) error {
+	err := opts.newClient().KillSession(id)
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("session kill", "kill_session")
+	}
+	if err != nil {
+		return fmt.Errorf("session kill: %w", err)
+	}
+	fmt.Fprintf(w, "Session %s killed\n", id)
+	return nil
+}
+
+// runPolicyValidate sends the policy file at path to the core for a dry-run
+// validation, or checks it against the built-in schema if local is set, and
+// prints each reported error as path:line: message. An invalid policy yields
+// a non-nil error so the exit code is non-zero.
+func runPolicyValidate(w io.Writer, opts *rootOptions, path string, local bool) error {
+	contents, err := os.ReadFile(path) // #nosec G304 -- path is the operator's own argument
+	if err != nil {
+		return fmt.Errorf("policy validate: %w", err)
+	}
+
+	var result *client.PolicyValidation
+	if local {
+		result, err = client.ValidatePolicyLocal(contents)
+	} else {
+		result, err = opts.newClient().ValidatePolicy(contents)
+	}
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("policy validate", "policy_validate")
+	}
 	if err != nil {
-		return fmt.Errorf("%s: %w", cmd, err)
+		return fmt.Errorf("policy validate: %w", err)
 	}
 
-	if !resp.OK {
-		errMsg := resp.Error
-		if errMsg == "" {
-			errMsg = "not implemented"
+	if isJSONOutput(opts.output) {
+		if err := writeRecord(w, opts.output, result); err != nil {
+			return err
 		}
-		return fmt.Errorf("%s: server error: %s", cmd, errMsg)
+	} else {
+		for _, e := range result.Errors {
+			msg := e.Message
+			if e.Path != "" {
+				msg = e.Path + ": " + msg
+			}
+			if e.Line > 0 {
+				fmt.Fprintf(w, "%s:%d: %s\n", path, e.Line, msg)
+			} else {
+				fmt.Fprintf(w, "%s: %s\n", path, msg)
+			}
+		}
+		if result.Valid {
+			fmt.Fprintf(w, "%s: policy is valid\n", path)
+		}
+	}
+
+	if !result.Valid {
+		return recordedError(opts, fmt.Errorf("policy validate: %s is invalid (%d error(s))", path, len(result.Errors)))
 	}
+	return nil
+}
 
-	fmt.Printf("[%s] OK\n", cmd)
-	if resp.Payload != nil {
-		fmt.Printf("payload: %v\n", resp.Payload)
+// runPolicyDiff prints a unified diff from the policy loaded by the core to
+// the local file at path, or "No differences".
+func runPolicyDiff(w io.Writer, opts *rootOptions, path string, color bool) error {
+	local, err := os.ReadFile(path) // #nosec G304 -- path is the operator's own argument
+	if err != nil {
+		return fmt.Errorf("policy diff: %w", err)
+	}
+
+	running, err := opts.newClient().GetPolicy()
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("policy diff", "policy_show")
+	}
+	if err != nil {
+		return fmt.Errorf("policy diff: %w", err)
+	}
+
+	diff := unifiedDiff("running policy", path, string(running), string(local))
+	if diff == "" {
+		fmt.Fprintln(w, "No differences")
+		return nil
+	}
+	if err := writeDiff(w, diff, color); err != nil {
+		return fmt.Errorf("write output: %w", err)
 	}
 	return nil
 }
 
 // runPolicyReload triggers a policy reload and prints version information.
-func runPolicyReload(socketPath string, timeout time.Duration) error {
-	c := client.NewClient(socketPath, timeout)
+func runPolicyReload(opts *rootOptions) error {
+	c := opts.newClient()
 	result, err := c.PolicyReload()
 	if err != nil {
 		return fmt.Errorf("policy reload: %w", err)
@@ -248,8 +1444,8 @@ func runPolicyReload(socketPath string, timeout time.Duration) error {
 }
 
 // runPolicyVersions lists all stored policy versions.
-func runPolicyVersions(socketPath string, timeout time.Duration) error {
-	c := client.NewClient(socketPath, timeout)
+func runPolicyVersions(opts *rootOptions) error {
+	c := opts.newClient()
 	result, err := c.PolicyVersions()
 	if err != nil {
 		return fmt.Errorf("policy versions: %w", err)
@@ -278,8 +1474,8 @@ func runPolicyVersions(socketPath string, timeout time.Duration) error {
 }
 
 // runPolicyRollback rolls back the policy to a specific version.
-func runPolicyRollback(socketPath string, timeout time.Duration, targetVersion uint64) error {
-	c := client.NewClient(socketPath, timeout)
+func runPolicyRollback(opts *rootOptions, targetVersion uint64) error {
+	c := opts.newClient()
 	result, err := c.PolicyRollback(targetVersion)
 	if err != nil {
 		return fmt.Errorf("policy rollback: %w", err)
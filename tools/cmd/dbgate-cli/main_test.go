@@ -1,20 +1,39 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/dongwonkwak/dbgate/tools/internal/top"
 )
 
-// mockUDSServer starts a mock Unix Domain Socket server that accepts one
-// connection, drains the request frame, and responds with respJSON (framed).
+// mockUDSServer starts a mock Unix Domain Socket server that, for every
+// connection, drains the request frame and responds with respJSON (framed).
 func mockUDSServer(t *testing.T, respJSON []byte) string {
 	t.Helper()
+	return mockUDSServerSeq(t, respJSON)
+}
+
+// mockUDSServerSeq is like mockUDSServer but answers the n-th connection with
+// the n-th response, repeating the last one once the sequence is exhausted.
+func mockUDSServerSeq(t *testing.T, responses ...[]byte) string {
+	t.Helper()
 
 	dir := t.TempDir()
 	sockPath := filepath.Join(dir, "mock.sock")
@@ -28,34 +47,45 @@ func mockUDSServer(t *testing.T, respJSON []byte) string {
 		_ = os.Remove(sockPath)
 	})
 
-	// Pre-build the framed response: 4-byte LE length + JSON body.
-	frame := make([]byte, 4+len(respJSON))
-	binary.LittleEndian.PutUint32(frame[:4], uint32(len(respJSON)))
-	copy(frame[4:], respJSON)
+	// Pre-build the framed responses: 4-byte LE length + JSON body.
+	frames := make([][]byte, len(responses))
+	for i, respJSON := range responses {
+		frame := make([]byte, 4+len(respJSON))
+		binary.LittleEndian.PutUint32(frame[:4], uint32(len(respJSON)))
+		copy(frame[4:], respJSON)
+		frames[i] = frame
+	}
 
 	go func() {
-		conn, err := ln.Accept()
-		if err != nil {
-			return
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveMockConn(conn, frames[min(i, len(frames)-1)])
 		}
-		defer func() { _ = conn.Close() }()
-
-		// Drain the request: 4-byte LE prefix + body.
-		var hdr [4]byte
-		if _, err := drainFull(conn, hdr[:]); err != nil {
-			return
-		}
-		reqBody := make([]byte, binary.LittleEndian.Uint32(hdr[:]))
-		if _, err := drainFull(conn, reqBody); err != nil {
-			return
-		}
-
-		_, _ = conn.Write(frame)
 	}()
 
 	return sockPath
 }
 
+// serveMockConn drains one framed request from conn and replies with frame.
+func serveMockConn(conn net.Conn, frame []byte) {
+	defer func() { _ = conn.Close() }()
+
+	// Drain the request: 4-byte LE prefix + body.
+	var hdr [4]byte
+	if _, err := drainFull(conn, hdr[:]); err != nil {
+		return
+	}
+	reqBody := make([]byte, binary.LittleEndian.Uint32(hdr[:]))
+	if _, err := drainFull(conn, reqBody); err != nil {
+		return
+	}
+
+	_, _ = conn.Write(frame)
+}
+
 // drainFull reads exactly len(buf) bytes from conn.
 func drainFull(conn net.Conn, buf []byte) (int, error) {
 	total := 0
@@ -69,55 +99,62 @@ func drainFull(conn net.Conn, buf []byte) (int, error) {
 	return total, nil
 }
 
-// TestRunGenericCommand_OK verifies that a successful server response (ok=true)
-// causes runGenericCommand to return nil.
-func TestRunGenericCommand_OK(t *testing.T) {
-	respJSON, _ := json.Marshal(map[string]interface{}{"ok": true})
-	sockPath := mockUDSServer(t, respJSON)
+// TestRunSessions_NoPayload verifies that the session table is printed by
+// default and replaced by the status line when noPayload is set.
+func TestRunSessions_NoPayload(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[{"id":"s1","started_at_ms":0}]}`)
 
-	if err := runGenericCommand(sockPath, 3*time.Second, "sessions"); err != nil {
+	var full bytes.Buffer
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+	if err := runSessions(context.Background(), &full, opts, false, client.SessionFilter{}, sessionOrder{}); err != nil {
 		t.Fatalf("expected nil error, got: %v", err)
 	}
+	if !strings.Contains(full.String(), "s1") {
+		t.Errorf("expected the session table by default, got: %q", full.String())
+	}
+
+	var quiet bytes.Buffer
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+	if err := runSessions(context.Background(), &quiet, opts, true, client.SessionFilter{}, sessionOrder{}); err != nil {
+		t.Fatalf("expected nil error, got: %v", err)
+	}
+	if got, want := quiet.String(), "[sessions] OK\n"; got != want {
+		t.Errorf("output with noPayload: got %q, want %q", got, want)
+	}
 }
 
-// TestRunGenericCommand_ServerError verifies that ok=false with an error message
-// is returned as a non-nil error (non-zero exit code for automation).
-func TestRunGenericCommand_ServerError(t *testing.T) {
-	respJSON, _ := json.Marshal(map[string]interface{}{
-		"ok":    false,
-		"error": "not implemented",
-	})
-	sockPath := mockUDSServer(t, respJSON)
+// TestRunSessions_Code501 verifies that a 501 code is reported as not
+// implemented even when the server's message does not say so.
+func TestRunSessions_Code501(t *testing.T) {
+	respJSON := []byte(`{"ok":false,"error":"coming in phase 3","code":501,"command":"sessions"}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
 
-	err := runGenericCommand(sockPath, 3*time.Second, "sessions")
-	if err == nil {
-		t.Fatal("expected error for ok=false, got nil")
-	}
-	if !strings.Contains(err.Error(), "server error") {
-		t.Errorf("error should contain 'server error', got: %v", err)
+	err := runSessions(context.Background(), io.Discard, opts, false, client.SessionFilter{}, sessionOrder{})
+	if exitCode(err) != exitServerError || !strings.Contains(err.Error(), "does not implement the sessions command") {
+		t.Fatalf("expected not-implemented message, got: %v (exit %d)", err, exitCode(err))
 	}
 }
 
-// TestRunGenericCommand_ServerError_EmptyMsg verifies that ok=false with no
-// error field still returns a non-nil error containing "not implemented".
-func TestRunGenericCommand_ServerError_EmptyMsg(t *testing.T) {
-	respJSON, _ := json.Marshal(map[string]interface{}{"ok": false})
-	sockPath := mockUDSServer(t, respJSON)
+// TestRunSessions_ServerError verifies that ok=false is returned as a non-nil
+// error (non-zero exit code for automation) carrying the server's message.
+func TestRunSessions_ServerError(t *testing.T) {
+	respJSON := []byte(`{"ok":false,"error":"session table locked","code":500}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
 
-	err := runGenericCommand(sockPath, 3*time.Second, "policy_reload")
+	err := runSessions(context.Background(), io.Discard, opts, false, client.SessionFilter{}, sessionOrder{})
 	if err == nil {
-		t.Fatal("expected error for ok=false with empty error field, got nil")
+		t.Fatal("expected error for ok=false, got nil")
 	}
-	if !strings.Contains(err.Error(), "not implemented") {
-		t.Errorf("error should contain 'not implemented', got: %v", err)
+	if !strings.Contains(err.Error(), "session table locked") {
+		t.Errorf("error should carry the server message, got: %v", err)
 	}
 }
 
-// TestRunGenericCommand_ConnectionError verifies that an unreachable socket
-// path returns a non-nil error.
-func TestRunGenericCommand_ConnectionError(t *testing.T) {
-	err := runGenericCommand("/nonexistent/path.sock", 500*time.Millisecond, "sessions")
-	if err == nil {
+// TestRunSessions_ConnectionError verifies that an unreachable socket path
+// returns a non-nil error.
+func TestRunSessions_ConnectionError(t *testing.T) {
+	opts := &rootOptions{socketPaths: []string{"/nonexistent/path.sock"}, timeout: 500 * time.Millisecond}
+	if err := runSessions(context.Background(), io.Discard, opts, false, client.SessionFilter{}, sessionOrder{}); err == nil {
 		t.Fatal("expected error for unreachable socket, got nil")
 	}
 }
@@ -144,7 +181,7 @@ func makePolicyExplainResponse(action string) []byte {
 func TestRunPolicyExplain_Block(t *testing.T) {
 	sockPath := mockUDSServer(t, makePolicyExplainResponse("block"))
 
-	if err := runPolicyExplain(sockPath, 3*time.Second, "DROP TABLE users", "app_service", "172.16.0.1", false); err != nil {
+	if err := runPolicyExplain(&rootOptions{socketPaths: []string{sockPath}, timeout: 3 * time.Second}, "DROP TABLE users", "app_service", "172.16.0.1", false); err != nil {
 		t.Fatalf("expected nil error, got: %v", err)
 	}
 }
@@ -153,7 +190,7 @@ func TestRunPolicyExplain_Block(t *testing.T) {
 func TestRunPolicyExplain_JSON(t *testing.T) {
 	sockPath := mockUDSServer(t, makePolicyExplainResponse("block"))
 
-	if err := runPolicyExplain(sockPath, 3*time.Second, "DROP TABLE users", "app_service", "172.16.0.1", true); err != nil {
+	if err := runPolicyExplain(&rootOptions{socketPaths: []string{sockPath}, timeout: 3 * time.Second}, "DROP TABLE users", "app_service", "172.16.0.1", true); err != nil {
 		t.Fatalf("expected nil error with --json, got: %v", err)
 	}
 }
@@ -166,7 +203,7 @@ func TestRunPolicyExplain_ServerError(t *testing.T) {
 	})
 	sockPath := mockUDSServer(t, respJSON)
 
-	err := runPolicyExplain(sockPath, 3*time.Second, "", "user", "127.0.0.1", false)
+	err := runPolicyExplain(&rootOptions{socketPaths: []string{sockPath}, timeout: 3 * time.Second}, "", "user", "127.0.0.1", false)
 	if err == nil {
 		t.Fatal("expected error for server-side error, got nil")
 	}
@@ -174,8 +211,1314 @@ func TestRunPolicyExplain_ServerError(t *testing.T) {
 
 // TestRunPolicyExplain_ConnectionError verifies that an unreachable socket returns an error.
 func TestRunPolicyExplain_ConnectionError(t *testing.T) {
-	err := runPolicyExplain("/nonexistent/path.sock", 500*time.Millisecond, "SELECT 1", "user", "127.0.0.1", false)
+	err := runPolicyExplain(&rootOptions{socketPaths: []string{"/nonexistent/path.sock"}, timeout: 500 * time.Millisecond}, "SELECT 1", "user", "127.0.0.1", false)
 	if err == nil {
 		t.Fatal("expected error for unreachable socket, got nil")
 	}
 }
+
+// TestRunBenchFraming verifies that the framing micro-benchmark reports a row
+// for every payload size.
+func TestRunBenchFraming(t *testing.T) {
+	var out bytes.Buffer
+	if err := runBenchFraming(&out, 5*time.Millisecond); err != nil {
+		t.Fatalf("runBenchFraming: %v", err)
+	}
+	for _, size := range benchFramingSizes {
+		if label := fmt.Sprintf("%dB", size); !strings.Contains(out.String(), label) {
+			t.Errorf("output missing row for %s:\n%s", label, out.String())
+		}
+	}
+}
+
+// makeStatsResponse builds a mock stats response with the given counters.
+func makeStatsResponse(total, blocked uint64, qps float64, capturedAtMs int64) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"ok": true,
+		"payload": map[string]interface{}{
+			"total_connections": 1,
+			"active_sessions":   1,
+			"total_queries":     total,
+			"blocked_queries":   blocked,
+			"qps":               qps,
+			"block_rate":        float64(blocked) / float64(total),
+			"captured_at_ms":    capturedAtMs,
+		},
+	})
+	return b
+}
+
+// TestAggregateStats verifies that counters and QPS are summed and that the
+// block rate is weighted by query volume rather than averaged per instance.
+func TestAggregateStats(t *testing.T) {
+	older := time.UnixMilli(1000).UTC()
+	newer := time.UnixMilli(2000).UTC()
+	results := []instanceStats{
+		{socket: "a", snap: &client.StatsSnapshot{TotalConnections: 2, ActiveSessions: 1, TotalQueries: 900, BlockedQueries: 9, QPS: 10, CapturedAt: older}},
+		{socket: "b", snap: &client.StatsSnapshot{TotalConnections: 3, ActiveSessions: 2, TotalQueries: 100, BlockedQueries: 91, QPS: 5, CapturedAt: newer}},
+		{socket: "c", err: errors.New("connect refused")},
+	}
+
+	total, reachable := aggregateStats(results)
+	if reachable != 2 {
+		t.Errorf("reachable: got %d, want 2", reachable)
+	}
+	if total.TotalQueries != 1000 || total.BlockedQueries != 100 {
+		t.Errorf("counters: got total=%d blocked=%d, want 1000/100", total.TotalQueries, total.BlockedQueries)
+	}
+	if total.TotalConnections != 5 || total.ActiveSessions != 3 {
+		t.Errorf("connections/sessions: got %d/%d, want 5/3", total.TotalConnections, total.ActiveSessions)
+	}
+	if total.QPS != 15 {
+		t.Errorf("QPS: got %v, want 15", total.QPS)
+	}
+	if total.BlockRate != 0.1 {
+		t.Errorf("BlockRate: got %v, want 0.1", total.BlockRate)
+	}
+	if !total.CapturedAt.Equal(newer) {
+		t.Errorf("CapturedAt: got %v, want %v", total.CapturedAt, newer)
+	}
+}
+
+// TestRunStats_PartialFailure verifies that a reachable instance is still
+// printed when another is unavailable, and that the command fails overall.
+func TestRunStats_PartialFailure(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{mockUDSServer(t, makeStatsResponse(100, 5, 1.5, 0)), "/nonexistent/path.sock"},
+		timeout:     500 * time.Millisecond,
+	}
+
+	var out bytes.Buffer
+	err := runStats(context.Background(), &out, opts, false, false)
+	if err == nil {
+		t.Fatal("expected error for unavailable instance, got nil")
+	}
+	if !strings.Contains(err.Error(), "1 of 2 instances unavailable") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !regexp.MustCompile(`/nonexistent/path\.sock\s+unavailable:`).MatchString(out.String()) {
+		t.Errorf("output should mark the unreachable instance:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), opts.socketPaths[0]) {
+		t.Errorf("output should still include the reachable instance:\n%s", out.String())
+	}
+}
+
+// TestRunStats_MultiSocket verifies that two instances are queried and each
+// row carries that instance's own counters.
+func TestRunStats_MultiSocket(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{
+			mockUDSServer(t, makeStatsResponse(111, 1, 1, 0)),
+			mockUDSServer(t, makeStatsResponse(222, 2, 2, 0)),
+		},
+		timeout: 3 * time.Second,
+	}
+
+	var out bytes.Buffer
+	if err := runStats(context.Background(), &out, opts, false, false); err != nil {
+		t.Fatalf("runStats: %v", err)
+	}
+	for i, total := range []string{"111", "222"} {
+		row := regexp.MustCompile(regexp.QuoteMeta(opts.socketPaths[i]) + `\s+.*\s` + total + `\s`)
+		if !row.MatchString(out.String()) {
+			t.Errorf("output missing row for %s with total %s:\n%s", opts.socketPaths[i], total, out.String())
+		}
+	}
+}
+
+// TestRunStats_Aggregate verifies the aggregated block across two instances.
+func TestRunStats_Aggregate(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{
+			mockUDSServer(t, makeStatsResponse(100, 10, 1, 0)),
+			mockUDSServer(t, makeStatsResponse(300, 10, 2, 0)),
+		},
+		timeout: 3 * time.Second,
+	}
+
+	var out bytes.Buffer
+	if err := runStats(context.Background(), &out, opts, true, false); err != nil {
+		t.Fatalf("runStats: %v", err)
+	}
+	for _, want := range []string{"aggregate of 2/2 instances", "Total Queries:         400", "Block Rate:          5.00%"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestStats_OutputJSON verifies that -o json prints only the snapshot as one
+// JSON object, with captured_at in RFC 3339 and the control round trip.
+func TestStats_OutputJSON(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(200, 20, 12.5, 1700000000123))
+
+	cmd := newRootCmd()
+	var stdout, stderr bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs([]string{"--socket", sock, "--no-version-check", "-o", "json", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("stdout is not a single JSON object: %v\n%s", err, stdout.String())
+	}
+	if got["total_queries"] != float64(200) || got["qps"] != 12.5 {
+		t.Errorf("unexpected counters: %v", got)
+	}
+	if got["captured_at"] != "2023-11-14T22:13:20.123Z" {
+		t.Errorf("captured_at = %v, want RFC 3339", got["captured_at"])
+	}
+	if rtt, ok := got["control_rtt_ms"].(float64); !ok || rtt <= 0 {
+		t.Errorf("control_rtt_ms = %v, want a positive number", got["control_rtt_ms"])
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+}
+
+// TestStats_OutputPrometheus verifies the one-shot text exposition and that
+// the format is limited to stats.
+func TestStats_OutputPrometheus(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(200, 20, 12.5, 1700000000123))
+
+	cmd := newRootCmd()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "-o", "prometheus", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	for _, want := range []string{
+		"# dbgate stats captured at 2023-11-14T22:13:20.123Z\n",
+		"# HELP dbgate_qps ",
+		"# TYPE dbgate_qps gauge\n",
+		"\ndbgate_qps 12.5\n",
+		"\ndbgate_total_queries_total 200\n",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, stdout.String())
+		}
+	}
+
+	cmd = newRootCmd()
+	stdout.Reset()
+	cmd.SetOut(&stdout)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "-o", "prometheus", "stats", "--label", "env=prod", "--label", "region=us"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute with --label: %v", err)
+	}
+	if want := "\ndbgate_qps{env=\"prod\",region=\"us\"} 12.5\n"; !strings.Contains(stdout.String(), want) {
+		t.Errorf("output missing %q:\n%s", want, stdout.String())
+	}
+
+	for _, args := range [][]string{
+		{"--socket", sock, "stats", "--label", "env=prod"},
+		{"--socket", sock, "-o", "prometheus", "stats", "--label", "env-name=prod"},
+		{"--socket", sock, "-o", "prometheus", "session", "list"},
+		{"--socket", sock, "--socket", sock, "-o", "prometheus", "stats"},
+		{"--socket", sock, "-o", "prometheus", "stats", "--watch", "1s"},
+	} {
+		cmd := newRootCmd()
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+// TestOutput_Invalid verifies that an unknown --output value is rejected.
+func TestOutput_Invalid(t *testing.T) {
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--output", "yaml", "stats"})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), `invalid --output "yaml"`) {
+		t.Fatalf("expected invalid --output error, got: %v", err)
+	}
+}
+
+// TestRunPolicyTest verifies the human-readable decision output for allow and
+// block, including the matched rule.
+func TestRunPolicyTest(t *testing.T) {
+	for _, tt := range []struct{ action, rule, want string }{
+		{"allow", "default-allow", "Decision: ALLOW"},
+		{"block", "block-statement", "Decision: BLOCK"},
+	} {
+		respJSON, _ := json.Marshal(map[string]interface{}{
+			"ok":      true,
+			"payload": map[string]interface{}{"action": tt.action, "matched_rule": tt.rule},
+		})
+		opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+
+		var out bytes.Buffer
+		if err := runPolicyTest(&out, opts, "SELECT 1", "app", false); err != nil {
+			t.Fatalf("runPolicyTest: %v", err)
+		}
+		if !strings.Contains(out.String(), tt.want) || !strings.Contains(out.String(), "Rule    : "+tt.rule) {
+			t.Errorf("unexpected output:\n%s", out.String())
+		}
+	}
+}
+
+// TestRunPolicyTest_NotImplemented verifies the friendly message when the core
+// does not support policy_eval.
+func TestRunPolicyTest_NotImplemented(t *testing.T) {
+	respJSON := []byte(`{"ok":false,"error":"not implemented","code":501}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+
+	err := runPolicyTest(io.Discard, opts, "SELECT 1", "", false)
+	if err == nil || !strings.Contains(err.Error(), "does not support policy_eval") {
+		t.Errorf("expected not-supported error, got: %v", err)
+	}
+}
+
+// TestPrintIOStats verifies that --print-io-stats writes the request and byte
+// counters to stderr after a successful command.
+func TestPrintIOStats(t *testing.T) {
+	sockPath := mockUDSServer(t, makeStatsResponse(10, 1, 1, 0))
+
+	root := newRootCmd()
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--socket", sockPath, "--print-io-stats", "--no-version-check", "stats"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "I/O: 1 request(s)") {
+		t.Errorf("stderr missing I/O footer: %q", stderr.String())
+	}
+	if strings.Contains(stdout.String(), "I/O:") {
+		t.Errorf("I/O footer must not be written to stdout: %q", stdout.String())
+	}
+}
+
+// TestTiming verifies that --timing prints one timing line per request to
+// stderr and nothing to stdout.
+func TestTiming(t *testing.T) {
+	sockPath := mockUDSServer(t, makeStatsResponse(10, 1, 1, 0))
+
+	root := newRootCmd()
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--socket", sockPath, "--timing", "--no-version-check", "stats"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !regexp.MustCompile(`^timing: stats dial=\S+ write=\S+ read=\S+ total=\S+\n$`).MatchString(stderr.String()) {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+	if strings.Contains(stdout.String(), "timing:") {
+		t.Errorf("timing must not be written to stdout: %q", stdout.String())
+	}
+}
+
+// TestWireDumpFlag verifies that --wire-dump dumps both frames of a request
+// to stderr and leaves stdout to the command.
+func TestWireDumpFlag(t *testing.T) {
+	sockPath := mockUDSServer(t, makeStatsResponse(10, 1, 1, 0))
+
+	root := newRootCmd()
+	var stdout, stderr bytes.Buffer
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"--socket", sockPath, "--wire-dump", "--no-version-check", "stats"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "--> sent ") || !strings.Contains(stderr.String(), "<-- received ") {
+		t.Errorf("stderr lacks the frame dumps: %q", stderr.String())
+	}
+	if strings.Contains(stdout.String(), "-->") || !strings.Contains(stdout.String(), "QPS") {
+		t.Errorf("unexpected stdout: %q", stdout.String())
+	}
+}
+
+// stalledUDSServer starts a mock server that accepts connections but never
+// responds, and counts how many connections it accepted.
+func stalledUDSServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "stalled.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var accepted atomic.Int32
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	return sockPath, &accepted
+}
+
+// TestInterrupt_StalledRequest verifies that cancelling the command context,
+// as the SIGINT/SIGTERM handler in main does, makes a stats request to a
+// stalled core return promptly and maps to exit code 130.
+func TestInterrupt_StalledRequest(t *testing.T) {
+	sockPath, accepted := stalledUDSServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	root := newRootCmd()
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--socket", sockPath, "--timeout", "10s", "stats"})
+
+	start := time.Now()
+	err := interruptedErr(ctx, root.ExecuteContext(ctx))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("interrupted request took %v to return", elapsed)
+	}
+	if accepted.Load() != 1 {
+		t.Errorf("server accepted %d connections, want 1", accepted.Load())
+	}
+	if got := exitCode(err); got != exitInterrupted {
+		t.Errorf("exit code = %d (err %v), want %d", got, err, exitInterrupted)
+	}
+
+	if err := interruptedErr(ctx, nil); err != nil {
+		t.Errorf("a command that returned nil must keep exit 0, got %v", err)
+	}
+}
+
+// TestExitCodes verifies the exit code of each error category, driven through
+// real commands.
+func TestExitCodes(t *testing.T) {
+	stalled, _ := stalledUDSServer(t)
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"--socket", mockUDSServer(t, makeStatsResponse(1, 0, 0, 0)), "stats"}, 0},
+		{"usage", []string{"--output", "bogus", "stats"}, exitUsage},
+		{"unknown flag", []string{"stats", "--bogus"}, exitUsage},
+		{"server error", []string{"--socket", mockUDSServer(t, []byte(`{"ok":false,"error":"boom"}`)), "session", "kill", "s1"}, exitServerError},
+		{"not implemented", []string{"--socket", mockUDSServer(t, []byte(`{"ok":false,"code":501,"error":"not implemented"}`)), "ping", "-c", "1"}, exitServerError},
+		{"connect", []string{"--socket", filepath.Join(t.TempDir(), "missing.sock"), "stats"}, exitConnect},
+		{"timeout", []string{"--socket", stalled, "--timeout", "100ms", "stats"}, exitTimeout},
+		{"connect fan-out", []string{"--socket", filepath.Join(t.TempDir(), "a.sock"), "--socket", filepath.Join(t.TempDir(), "b.sock"), "stats"}, exitConnect},
+		{"timeout fan-out", []string{"--socket", stalled, "--socket", stalled, "--timeout", "100ms", "stats"}, exitTimeout},
+		{"ping connect", []string{"--socket", filepath.Join(t.TempDir(), "missing.sock"), "ping", "-c", "2", "-i", "1ms"}, exitConnect},
+		{"ping timeout", []string{"--socket", stalled, "--timeout", "100ms", "ping", "-c", "1"}, exitTimeout},
+		{"protocol", []string{"--socket", mockUDSServer(t, []byte(`<html>oops</html>`)), "stats"}, exitProtocol},
+		{"bad payload", []string{"--socket", mockUDSServer(t, []byte(`{"ok":true,"payload":{"qps":"fast"}}`)), "stats"}, exitProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRootCmd()
+			root.SetOut(io.Discard)
+			root.SetErr(io.Discard)
+			root.SetArgs(tt.args)
+			got := 0
+			err := root.Execute()
+			if err != nil {
+				got = exitCode(err)
+			}
+			if got != tt.want {
+				t.Errorf("exit code = %d (err %v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestAttemptTimeout_Retries verifies that --attempt-timeout splits --timeout
+// into several attempts against a stalled core.
+func TestAttemptTimeout_Retries(t *testing.T) {
+	sockPath, accepted := stalledUDSServer(t)
+
+	root := newRootCmd()
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--socket", sockPath, "--timeout", "400ms", "--attempt-timeout", "100ms",
+		"--retries", "10", "--retry-backoff", "1ms", "--no-version-check", "stats"})
+	if err := root.Execute(); !errors.Is(err, client.ErrTimeout) {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+	if got := accepted.Load(); got < 3 || got > 4 {
+		t.Errorf("server accepted %d connections, want 3-4 attempts", got)
+	}
+}
+
+// TestRunStats_FailFast verifies that --fail-fast returns as soon as one
+// instance fails, without waiting for a stalled instance, while the default
+// keep-going mode waits for every instance.
+func TestRunStats_FailFast(t *testing.T) {
+	stalled, _ := stalledUDSServer(t)
+	opts := &rootOptions{
+		socketPaths: []string{stalled, "/nonexistent/path.sock"},
+		timeout:     time.Second,
+	}
+
+	var out bytes.Buffer
+	start := time.Now()
+	err := runStats(context.Background(), &out, opts, false, true)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("fail-fast should not wait for the stalled instance, took %v", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "1 skipped") {
+		t.Errorf("expected error reporting a skipped instance, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "--fail-fast") {
+		t.Errorf("output should mark the skipped instance:\n%s", out.String())
+	}
+}
+
+// TestRunStats_KeepGoing verifies that every instance is attempted and each
+// failure is reported individually.
+func TestRunStats_KeepGoing(t *testing.T) {
+	stalled, accepted := stalledUDSServer(t)
+	opts := &rootOptions{
+		socketPaths: []string{"/nonexistent/path.sock", stalled},
+		timeout:     200 * time.Millisecond,
+	}
+
+	var out bytes.Buffer
+	err := runStats(context.Background(), &out, opts, false, false)
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 instances unavailable") {
+		t.Errorf("expected both instances to be reported, got: %v", err)
+	}
+	if accepted.Load() != 1 {
+		t.Errorf("stalled instance should have been attempted once, got %d", accepted.Load())
+	}
+	if strings.Contains(out.String(), "--fail-fast") {
+		t.Errorf("keep-going must not skip instances:\n%s", out.String())
+	}
+}
+
+// TestRunStatsWatch_Interrupt verifies that watch mode redraws on every poll
+// and exits cleanly with a trailing newline when the context is cancelled.
+func TestRunStatsWatch_Interrupt(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, stderr: io.Discard}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var out bytes.Buffer
+	if err := runStatsWatch(ctx, &out, opts, false, false, 50*time.Millisecond); err != nil {
+		t.Fatalf("runStatsWatch: %v", err)
+	}
+	if n := strings.Count(out.String(), clearScreen); n < 2 {
+		t.Errorf("expected at least 2 redraws, got %d", n)
+	}
+	if !strings.Contains(out.String(), "=== dbgate stats ===") || !strings.HasSuffix(out.String(), "\n\n") {
+		t.Errorf("unexpected output:\n%q", out.String())
+	}
+	if !regexp.MustCompile(`\nControl RTT: +\d+\.\d{3} ms\n`).MatchString(out.String()) {
+		t.Errorf("output missing the control RTT:\n%s", out.String())
+	}
+}
+
+// TestTop_NotTerminal verifies that top without a terminal falls back to the
+// output of stats --watch.
+func TestTop_NotTerminal(t *testing.T) {
+	if top.IsTerminal(os.Stdin, os.Stdout) {
+		t.Skip("the test runs on a terminal")
+	}
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	root := newRootCmd()
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"--socket", sock, "--no-version-check", "top", "--interval", "50ms"})
+	if err := root.ExecuteContext(ctx); err != nil {
+		t.Fatalf("top: %v", err)
+	}
+	if n := strings.Count(out.String(), "=== dbgate stats ==="); n < 2 {
+		t.Errorf("expected at least 2 polls of stats, got %d:\n%s", n, out.String())
+	}
+}
+
+// TestCompareStats verifies the direction reported for each field, that a
+// rate moving below the printed precision does not count, and that the first
+// poll has no changes.
+func TestCompareStats(t *testing.T) {
+	prev := &client.StatsSnapshot{QPS: 10, BlockRate: 0.25, ActiveSessions: 3, TotalQueries: 100, BlockedQueries: 5, TotalConnections: 9}
+	cur := &client.StatsSnapshot{QPS: 10.001, BlockRate: 0.2, ActiveSessions: 2, TotalQueries: 120, BlockedQueries: 5, TotalConnections: 9}
+	want := statsChanges{BlockRate: -1, ActiveSessions: -1, TotalQueries: 1}
+	if got := compareStats(prev, cur); got != want {
+		t.Errorf("compareStats = %+v, want %+v", got, want)
+	}
+	if got := compareStats(nil, cur); got != (statsChanges{}) {
+		t.Errorf("compareStats without a previous snapshot = %+v, want no changes", got)
+	}
+}
+
+// TestRunStatsWatch_Highlight verifies that with color the numbers that
+// changed since the previous poll are marked, and that without color the
+// output stays plain.
+func TestRunStatsWatch_Highlight(t *testing.T) {
+	t.Setenv(envNoColor, "")
+	for _, color := range []string{colorAlways, colorNever} {
+		sock := mockUDSServerSeq(t, makeStatsResponse(100, 10, 1, 0), makeStatsResponse(150, 10, 1, 0))
+		opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, stderr: io.Discard, color: color, noVersionCheck: true}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		var out bytes.Buffer
+		err := runStatsWatch(ctx, &out, opts, false, false, 50*time.Millisecond)
+		cancel()
+		if err != nil {
+			t.Fatalf("runStatsWatch: %v", err)
+		}
+		frames := strings.Split(out.String(), clearScreen)
+		if len(frames) < 3 {
+			t.Fatalf("--color %s: expected at least 2 redraws, got:\n%q", color, out.String())
+		}
+		first, second := frames[1], frames[2]
+		marked := colorGreen + "     150 ↑" + colorReset
+		switch {
+		case strings.Contains(first, "↑") || strings.Contains(first, "↓"):
+			t.Errorf("--color %s: first poll should not be highlighted:\n%q", color, first)
+		case color == colorAlways && !strings.Contains(second, "Total Queries:    "+marked):
+			t.Errorf("--color %s: expected the total queries marked as up:\n%q", color, second)
+		case color == colorAlways && strings.Contains(second, "Blocked Queries:  "+colorGreen):
+			t.Errorf("--color %s: unchanged blocked queries should not be marked:\n%q", color, second)
+		case color == colorNever && strings.Contains(second, "\033["):
+			t.Errorf("--color %s: expected plain output:\n%q", color, second)
+		}
+	}
+}
+
+// TestRunStatsWatch_ConsecutiveFailures verifies that failed polls are
+// reported on stderr and that the loop aborts after three in a row.
+func TestRunStatsWatch_ConsecutiveFailures(t *testing.T) {
+	var stderr bytes.Buffer
+	opts := &rootOptions{
+		socketPaths: []string{filepath.Join(t.TempDir(), "missing.sock")},
+		timeout:     time.Second,
+		stderr:      &stderr,
+	}
+
+	err := runStatsWatch(context.Background(), io.Discard, opts, false, false, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "3 consecutive failures") {
+		t.Fatalf("expected abort after 3 failures, got: %v", err)
+	}
+	if n := strings.Count(stderr.String(), "Error: stats:"); n != 3 {
+		t.Errorf("expected 3 poll errors on stderr, got %d:\n%s", n, stderr.String())
+	}
+}
+
+// TestRunStatsWatch_Timeouts verifies that polls timing out count as
+// failures rather than as an interrupt, and that every poll goes through the
+// one client built for the loop.
+func TestRunStatsWatch_Timeouts(t *testing.T) {
+	sock, accepted := stalledUDSServer(t)
+	var stderr bytes.Buffer
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 50 * time.Millisecond, stderr: &stderr, noVersionCheck: true}
+
+	err := runStatsWatch(context.Background(), io.Discard, opts, false, false, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "3 consecutive failures") {
+		t.Fatalf("expected abort after 3 timed-out polls, got: %v", err)
+	}
+	if n := accepted.Load(); n != 3 {
+		t.Errorf("expected 3 polls, got %d", n)
+	}
+	if n := len(opts.clients); n != 1 {
+		t.Errorf("expected 1 client for the whole loop, got %d", n)
+	}
+}
+
+// streamUDSServer is like mockUDSServer but answers with a stream: each body
+// framed in turn, followed by the empty terminating frame.
+func streamUDSServer(t *testing.T, bodies ...[]byte) string {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "stream.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var stream []byte
+	for _, body := range bodies {
+		stream = binary.LittleEndian.AppendUint32(stream, uint32(len(body)))
+		stream = append(stream, body...)
+	}
+	stream = append(stream, 0, 0, 0, 0)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveMockConn(conn, stream)
+		}
+	}()
+	return sockPath
+}
+
+// TestRunStatsStream verifies that every pushed snapshot is written, that a
+// core without stats_subscribe is reported as unsupported, and that --stream
+// is limited to one socket.
+func TestRunStatsStream(t *testing.T) {
+	sock := streamUDSServer(t,
+		[]byte(`{"ok":true,"stream":true}`),
+		[]byte(`{"total_queries":100,"captured_at_ms":1700000000000}`),
+		[]byte(`{"total_queries":250,"captured_at_ms":1700000001000}`))
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 3 * time.Second, output: outputJSONL}
+
+	var out bytes.Buffer
+	if err := runStatsStream(context.Background(), &out, opts, time.Second); err != nil {
+		t.Fatalf("runStatsStream: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"total_queries":100`) || !strings.Contains(lines[1], `"total_queries":250`) {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	notImpl := []byte(`{"ok":false,"error":"unknown command","code":501}`)
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, notImpl)}, timeout: 3 * time.Second}
+	err := runStatsStream(context.Background(), io.Discard, opts, time.Second)
+	if exitCode(err) != exitServerError || !strings.Contains(err.Error(), "does not support stats_subscribe") {
+		t.Errorf("expected unsupported error, got: %v", err)
+	}
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "--socket", sock, "stats", "--stream", "1s"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "single --socket") {
+		t.Errorf("expected a single-socket error, got: %v", err)
+	}
+}
+
+// TestRunSessions verifies the aligned session table, with the query count
+// right-aligned, and the not-implemented message.
+func TestRunSessions(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","client_addr":"10.0.0.5:51234","database":"app","user":"svc",` +
+		`"state":"idle","started_at_ms":1700000000000,"query_count":42}]}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+
+	var out bytes.Buffer
+	if err := runSessions(context.Background(), &out, opts, false, client.SessionFilter{}, sessionOrder{}); err != nil {
+		t.Fatalf("runSessions: %v", err)
+	}
+	for _, want := range []string{"ID  Client", "s1  10.0.0.5:51234", "2023-11-14 22:13:20 UTC       42\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	notImpl := []byte(`{"ok":false,"error":"not implemented","code":501,"command":"sessions"}`)
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, notImpl)}, timeout: 3 * time.Second}
+	err := runSessions(context.Background(), io.Discard, opts, false, client.SessionFilter{}, sessionOrder{})
+	if err == nil || !strings.Contains(err.Error(), "does not implement the sessions command") {
+		t.Fatalf("expected not-implemented message, got: %v", err)
+	}
+}
+
+// TestSessions_Filter verifies that --user, --db and --state are sent as the
+// sessions args, and that sessions from a core ignoring them are filtered
+// locally.
+func TestSessions_Filter(t *testing.T) {
+	cmd := newRootCmd()
+	var stderr bytes.Buffer
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs([]string{"--dry-run", "session", "list", "--user", "bob", "--db", "orders", "--state", "active"})
+	if err := cmd.Execute(); !errors.Is(err, client.ErrDryRun) {
+		t.Fatalf("expected ErrDryRun, got %v", err)
+	}
+	if want := `{"command":"sessions","version":1,"args":{"database":"orders","state":"active","user":"bob"}}`; !strings.Contains(stderr.String(), want) {
+		t.Errorf("request not carrying the filter:\n%s", stderr.String())
+	}
+
+	all := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","user":"bob","database":"orders","state":"active"},` +
+		`{"id":"s2","user":"bob","database":"orders","state":"idle"},` +
+		`{"id":"s3","user":"eve","database":"orders","state":"active"}]}`)
+	for _, output := range []string{outputIDs, outputJSONL} {
+		cmd = newRootCmd()
+		var stdout bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"--socket", mockUDSServer(t, all), "-o", output, "session", "list", "--user", "bob", "--state", "active"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%s: execute: %v", output, err)
+		}
+		if got := strings.Count(stdout.String(), "\n"); got != 1 || !strings.Contains(stdout.String(), "s1") {
+			t.Errorf("%s: want only s1, got:\n%s", output, stdout.String())
+		}
+	}
+}
+
+// TestSessions_OutputIDs verifies the bare ID formats end to end: NUL
+// terminated for ids0 (including an ID with a space, the case xargs -0 is
+// for) and newline terminated for ids. Other commands reject them.
+func TestSessions_OutputIDs(t *testing.T) {
+	sock := mockUDSServer(t, []byte(`{"ok":true,"payload":[`+
+		`{"id":"s1","started_at_ms":0},{"id":"s 2","started_at_ms":0},{"id":"s3","started_at_ms":0}]}`))
+
+	run := func(args ...string) (string, error) {
+		cmd := newRootCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(append([]string{"--socket", sock}, args...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("session", "list", "--output", "ids0")
+	if err != nil {
+		t.Fatalf("ids0: %v", err)
+	}
+	if !strings.HasSuffix(out, "\x00") {
+		t.Errorf("ids0 output should end with NUL: %q", out)
+	}
+	if got := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00"); !slices.Equal(got, []string{"s1", "s 2", "s3"}) {
+		t.Errorf("ids0 = %q", got)
+	}
+
+	if out, err := run("session", "list", "-o", "ids"); err != nil || out != "s1\ns 2\ns3\n" {
+		t.Errorf("ids = %q, %v", out, err)
+	}
+	if _, err := run("-o", "ids0", "stats"); err == nil {
+		t.Error("stats should reject --output ids0")
+	}
+}
+
+// TestSessionKill verifies the session kill command end to end, including the
+// not-implemented message.
+func TestSessionKill(t *testing.T) {
+	sock := mockUDSServer(t, []byte(`{"ok":true}`))
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "session", "kill", "s42"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got, want := out.String(), "Session s42 killed\n"; got != want {
+		t.Errorf("output: got %q, want %q", got, want)
+	}
+
+	notImpl := []byte(`{"ok":false,"error":"not implemented","code":501,"command":"kill_session"}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, notImpl)}, timeout: 3 * time.Second}
+	err := runSessionKill(io.Discard, opts, "s42")
+	if err == nil || !strings.Contains(err.Error(), "does not support kill_session") {
+		t.Fatalf("expected not-implemented message, got: %v", err)
+	}
+}
+
+// TestAddrFlag verifies that --addr reaches a TCP server and cannot be
+// combined with --socket.
+func TestAddrFlag(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	respJSON := makeStatsResponse(100, 10, 1, 0)
+	frame := make([]byte, 4+len(respJSON))
+	binary.LittleEndian.PutUint32(frame[:4], uint32(len(respJSON)))
+	copy(frame[4:], respJSON)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		serveMockConn(conn, frame)
+	}()
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--addr", "tcp://" + ln.Addr().String(), "--no-version-check", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(out.String(), "Total Queries:         100") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--addr", "tcp://127.0.0.1:1", "--socket", "/tmp/x.sock", "stats"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+		t.Errorf("expected conflict error, got: %v", err)
+	}
+}
+
+// TestProtocolVersionFlag verifies that --protocol-version overrides the
+// version sent in requests.
+func TestProtocolVersionFlag(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "capture.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		var hdr [4]byte
+		if _, err := drainFull(conn, hdr[:]); err != nil {
+			return
+		}
+		body := make([]byte, binary.LittleEndian.Uint32(hdr[:]))
+		if _, err := drainFull(conn, body); err != nil {
+			return
+		}
+		received <- body
+		resp := makeStatsResponse(1, 0, 0, 0)
+		frame := make([]byte, 4+len(resp))
+		binary.LittleEndian.PutUint32(frame[:4], uint32(len(resp)))
+		copy(frame[4:], resp)
+		_, _ = conn.Write(frame)
+	}()
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sockPath, "--protocol-version", "2", "--no-version-check", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	var req client.CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Version != 2 {
+		t.Errorf("version: got %d, want 2", req.Version)
+	}
+}
+
+// TestProtocolVersionFlag_Alias verifies that the deprecated
+// --request-version sets the same version with a warning, that the default
+// is the client's protocol version, and that versions below 1 are rejected.
+func TestProtocolVersionFlag_Alias(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		want     string // in the dry-run request
+		wantWarn bool
+		wantErr  string
+	}{
+		{nil, fmt.Sprintf(`"version":%d`, client.ProtocolVersion), false, ""},
+		{[]string{"--request-version", "3"}, `"version":3`, true, ""},
+		{[]string{"--protocol-version", "0"}, "", false, "invalid --protocol-version 0"},
+		{[]string{"--request-version", "-1"}, "", true, "invalid --protocol-version -1"},
+	} {
+		cmd := newRootCmd()
+		var stderr bytes.Buffer
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs(append(tt.args, "--dry-run", "--no-version-check", "stats"))
+		err := cmd.Execute()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%v: expected %q, got %v", tt.args, tt.wantErr, err)
+			}
+		} else if !strings.Contains(stderr.String(), tt.want) {
+			t.Errorf("%v: dry run does not show %s:\n%s", tt.args, tt.want, stderr.String())
+		}
+		if got := strings.Contains(stderr.String(), "--request-version has been deprecated"); got != tt.wantWarn {
+			t.Errorf("%v: deprecation warning = %v, want %v:\n%s", tt.args, got, tt.wantWarn, stderr.String())
+		}
+	}
+}
+
+// TestVersionCheck verifies that a core speaking another protocol version
+// draws one stderr warning without failing the command, unless
+// --no-version-check is set.
+func TestVersionCheck(t *testing.T) {
+	hello := []byte(fmt.Sprintf(`{"ok":true,"payload":{"version":%d}}`, client.ProtocolVersion+1))
+	for _, noCheck := range []bool{false, true} {
+		sockPath := mockUDSServerSeq(t, hello, makeStatsResponse(10, 1, 1, 0))
+		args := []string{"--socket", sockPath, "stats"}
+		if noCheck {
+			args = append([]string{"--no-version-check"}, args...)
+		}
+
+		cmd := newRootCmd()
+		var stderr bytes.Buffer
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("execute %v: %v", args, err)
+		}
+		want := 1
+		if noCheck {
+			want = 0
+		}
+		if got := strings.Count(stderr.String(), "Warning: dbgate core speaks protocol version"); got != want {
+			t.Errorf("%v: %d version warnings, want %d; stderr %q", args, got, want, stderr.String())
+		}
+	}
+
+	opts := &rootOptions{stderr: io.Discard}
+	if !opts.checkVersionOf("a.sock") || opts.checkVersionOf("a.sock") || !opts.checkVersionOf("b.sock") {
+		t.Error("checkVersionOf should hold for only the first client per socket")
+	}
+}
+
+// TestEnvDefaults verifies that DBGATE_SOCKET and DBGATE_TIMEOUT replace the
+// flag defaults and that explicit flags still take precedence.
+func TestEnvDefaults(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	t.Setenv(envSocket, sock)
+	t.Setenv(envTimeout, "750ms")
+
+	opts := &rootOptions{}
+	cmd := newRootCmdWithOptions(opts)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if got := opts.socketPath(); got != sock {
+		t.Errorf("socket: got %q, want %q from %s", got, sock, envSocket)
+	}
+	if opts.timeout != 750*time.Millisecond {
+		t.Errorf("timeout: got %s, want 750ms from %s", opts.timeout, envTimeout)
+	}
+	if !strings.Contains(out.String(), "Total Queries:         100") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	opts = &rootOptions{}
+	cmd = newRootCmdWithOptions(opts)
+	cmd.SetArgs([]string{"--socket", "/flag.sock", "--timeout", "2s", "health"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	_ = cmd.Execute()
+	if opts.socketPath() != "/flag.sock" || opts.timeout != 2*time.Second {
+		t.Errorf("flags must win over env: socket=%q timeout=%s", opts.socketPath(), opts.timeout)
+	}
+}
+
+// TestEnvTimeout_Invalid verifies that a malformed DBGATE_TIMEOUT is reported
+// unless --timeout is given.
+func TestEnvTimeout_Invalid(t *testing.T) {
+	t.Setenv(envTimeout, "soon")
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"stats"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid DBGATE_TIMEOUT") {
+		t.Fatalf("expected invalid DBGATE_TIMEOUT error, got: %v", err)
+	}
+
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+	cmd = newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "--timeout", "1s", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("explicit --timeout should bypass the env value: %v", err)
+	}
+}
+
+// TestRunPolicyValidate verifies the valid, invalid and not-implemented
+// outcomes of policy validate.
+func TestRunPolicyValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("rules: []\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+
+	valid := []byte(`{"ok":true,"payload":{"valid":true}}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, valid)}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runPolicyValidate(&out, opts, path, false); err != nil {
+		t.Fatalf("valid policy: %v", err)
+	}
+	if !strings.Contains(out.String(), "policy is valid") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	invalid := []byte(`{"ok":true,"payload":{"valid":false,"errors":[` +
+		`{"line":7,"message":"unknown action \"deny\""},"duplicate rule id"]}}`)
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, invalid)}, timeout: 3 * time.Second}
+	out.Reset()
+	err := runPolicyValidate(&out, opts, path, false)
+	if err == nil || !strings.Contains(err.Error(), "is invalid (2 error(s))") {
+		t.Fatalf("expected invalid-policy error, got: %v", err)
+	}
+	want := path + ":7: unknown action \"deny\"\n" + path + ": duplicate rule id\n"
+	if out.String() != want {
+		t.Errorf("output: got %q, want %q", out.String(), want)
+	}
+
+	notImpl := []byte(`{"ok":false,"error":"not implemented","code":501}`)
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, notImpl)}, timeout: 3 * time.Second}
+	err = runPolicyValidate(io.Discard, opts, path, false)
+	if err == nil || !strings.Contains(err.Error(), "does not support policy_validate") {
+		t.Fatalf("expected not-implemented message, got: %v", err)
+	}
+}
+
+// TestReportError_AfterRecord verifies that a command that fails after
+// writing its JSON result leaves a single document on stdout, with the exit
+// code of the failure.
+func TestReportError_AfterRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("rules: []\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	invalid := mockUDSServer(t, []byte(`{"ok":true,"payload":{"valid":false,"errors":["duplicate rule id"]}}`))
+	missing := filepath.Join(t.TempDir(), "missing.sock")
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"--socket", missing, "--socket", missing, "-o", "json", "stats"}, exitConnect},
+		{[]string{"--socket", invalid, "--no-version-check", "-o", "json", "policy", "validate", path}, exitUsage},
+		{[]string{"--socket", missing, "-o", "json", "ping", "-c", "1"}, exitConnect},
+	} {
+		opts := &rootOptions{}
+		cmd := newRootCmdWithOptions(opts)
+		var stdout bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(tt.args)
+		err := cmd.Execute()
+		if err == nil {
+			t.Fatalf("%v: expected failure", tt.args)
+		}
+		if code := reportError(&stdout, io.Discard, opts, err); code != tt.want {
+			t.Errorf("%v: exit code %d, want %d", tt.args, code, tt.want)
+		}
+		dec := json.NewDecoder(&stdout)
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatalf("%v: stdout is not JSON: %v", tt.args, err)
+		}
+		if dec.More() {
+			t.Errorf("%v: more than one JSON document on stdout", tt.args)
+		}
+	}
+}
+
+// TestRunPolicyValidate_Local verifies that --local checks the file against
+// the built-in schema without contacting the core.
+func TestRunPolicyValidate_Local(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("sql_rules:\n  mode: monitr\n  block_patterns: [\"SLEEP\"]\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	sock, accepted := stalledUDSServer(t)
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: time.Second}
+
+	var out bytes.Buffer
+	err := runPolicyValidate(&out, opts, path, true)
+	if err == nil || !strings.Contains(err.Error(), "is invalid (1 error(s))") {
+		t.Fatalf("expected invalid-policy error, got: %v", err)
+	}
+	want := path + ":2: /sql_rules/mode: value must be one of 'enforce', 'monitor'\n"
+	if out.String() != want {
+		t.Errorf("output: got %q, want %q", out.String(), want)
+	}
+	if n := accepted.Load(); n != 0 {
+		t.Errorf("core was contacted %d times", n)
+	}
+}
+
+// TestRunVersion verifies the version output for a reachable and an
+// unreachable core; the latter is a warning, not an error.
+func TestRunVersion(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"version":"0.4.0","build_hash":"3f2a9c1","protocol_version":1}}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runVersion(&out, opts); err != nil {
+		t.Fatalf("runVersion: %v", err)
+	}
+	want := "dbgate-cli:  dev (protocol 1)\ndbgate core: 0.4.0 (build 3f2a9c1, protocol 1)\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	var stderr bytes.Buffer
+	opts = &rootOptions{
+		socketPaths: []string{filepath.Join(t.TempDir(), "missing.sock")},
+		timeout:     time.Second,
+		stderr:      &stderr,
+	}
+	out.Reset()
+	if err := runVersion(&out, opts); err != nil {
+		t.Fatalf("unreachable core must not fail: %v", err)
+	}
+	if !strings.Contains(out.String(), "dbgate core: unreachable") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if !strings.Contains(stderr.String(), "Warning: cannot query core version") {
+		t.Errorf("expected a warning on stderr, got %q", stderr.String())
+	}
+}
+
+// TestErrorMessage verifies that transport failures name the phase.
+func TestErrorMessage(t *testing.T) {
+	opts := &rootOptions{socketPaths: []string{filepath.Join(t.TempDir(), "missing.sock")}, timeout: time.Second}
+	err := runStats(context.Background(), io.Discard, opts, false, false)
+	if err == nil || !strings.HasSuffix(errorMessage(err), "(during dial)") {
+		t.Errorf("got %q, want a dial hint", errorMessage(err))
+	}
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", mockUDSServer(t, makeStatsResponse(1, 0, 0, 0)), "--max-response", "16B", "stats"})
+	err = cmd.Execute()
+	if !errors.Is(err, client.ErrResponseTooLarge) || !strings.Contains(errorMessage(err), "raise --max-response") {
+		t.Errorf("got %v, want a --max-response hint", err)
+	}
+
+	plain := errors.New("invalid --output")
+	if got := errorMessage(plain); got != "invalid --output" {
+		t.Errorf("non-transport error changed: %q", got)
+	}
+}
+
+// TestDryRun verifies that --dry-run prints each command's request and framed
+// size to stderr without connecting, and that health, which otherwise turns
+// any failure into UNHEALTHY, stops at the dry run too.
+func TestDryRun(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "dry.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			_ = conn.Close()
+		}
+	}()
+
+	for _, tt := range []struct {
+		args []string
+		body string
+	}{
+		{[]string{"session", "kill", "abc123"}, `{"command":"kill_session","version":1,"args":{"id":"abc123"}}`},
+		{[]string{"stats"}, `{"command":"stats","version":1}`},
+		{[]string{"health"}, `{"command":"health","version":1}`},
+	} {
+		cmd := newRootCmd()
+		var stdout, stderr bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs(append([]string{"--socket", sockPath, "--dry-run"}, tt.args...))
+		if err := cmd.Execute(); !errors.Is(err, client.ErrDryRun) {
+			t.Errorf("%v: expected ErrDryRun, got %v", tt.args, err)
+		}
+		want := fmt.Sprintf("dry run: would send %d bytes to %s:\n%s\n", 4+len(tt.body), sockPath, tt.body)
+		if stderr.String() != want {
+			t.Errorf("%v: stderr = %q, want %q", tt.args, stderr.String(), want)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("%v: unexpected stdout %q", tt.args, stdout.String())
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if n := accepted.Load(); n != 0 {
+		t.Errorf("dry run connected %d times", n)
+	}
+}
+
+// TestReportError_JSON verifies that a failed command in json and jsonl mode
+// prints an error object with the exit code to stdout, including the core's
+// code for an ok:false reply, while text mode keeps stdout clean.
+func TestReportError_JSON(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.sock")
+	rejected := mockUDSServer(t, []byte(`{"ok":false,"error":"no such session","code":404}`))
+	for _, tt := range []struct {
+		args []string
+		want errorReport
+	}{
+		{[]string{"--socket", missing, "-o", "json", "stats"}, errorReport{Code: exitConnect}},
+		{[]string{"--socket", rejected, "-o", "jsonl", "session", "kill", "s9"}, errorReport{Code: exitServerError, ServerCode: 404}},
+	} {
+		opts := &rootOptions{}
+		cmd := newRootCmdWithOptions(opts)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(tt.args)
+		err := cmd.Execute()
+		if err == nil {
+			t.Fatalf("%v: expected failure", tt.args)
+		}
+
+		var stdout, stderr bytes.Buffer
+		if code := reportError(&stdout, &stderr, opts, err); code != tt.want.Code {
+			t.Errorf("%v: exit code %d, want %d", tt.args, code, tt.want.Code)
+		}
+		var got errorReport
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatalf("%v: stdout is not a JSON object: %v\n%s", tt.args, err, stdout.String())
+		}
+		tt.want.Error = errorMessage(err)
+		if got != tt.want {
+			t.Errorf("%v: got %+v, want %+v", tt.args, got, tt.want)
+		}
+		if !strings.Contains(stdout.String(), `"ok":false`) && !strings.Contains(stdout.String(), `"ok": false`) {
+			t.Errorf("%v: missing ok:false:\n%s", tt.args, stdout.String())
+		}
+		if !strings.HasPrefix(stderr.String(), "Error: ") {
+			t.Errorf("%v: stderr = %q", tt.args, stderr.String())
+		}
+	}
+
+	var stdout bytes.Buffer
+	reportError(&stdout, io.Discard, &rootOptions{output: outputText}, errors.New("boom"))
+	if stdout.Len() != 0 {
+		t.Errorf("text mode wrote to stdout: %q", stdout.String())
+	}
+}
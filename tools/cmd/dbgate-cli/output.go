@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// isJSONOutput reports whether output is one of the JSON formats.
+func isJSONOutput(output string) bool {
+	return output == outputJSON || output == outputJSONL
+}
+
+// isMachineOutput reports whether output is meant for programs rather than a
+// terminal, so it must not carry screen control sequences.
+func isMachineOutput(output string) bool {
+	switch output {
+	case outputCSV, outputPrometheus, outputIDs, outputIDs0:
+		return true
+	}
+	return isJSONOutput(output)
+}
+
+// writeRecord writes a single record: indented JSON for --output json, or one
+// compact line for --output jsonl.
+func writeRecord(w io.Writer, output string, v interface{}) error {
+	if output != outputJSONL {
+		return writeJSON(w, v)
+	}
+	// Encode emits the compact form followed by exactly one '\n'.
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return fmt.Errorf("encode JSON: %w", err)
+	}
+	return nil
+}
+
+// writeRecords writes items as one JSON array for --output json, or as one
+// compact line per item for --output jsonl.
+func writeRecords[T any](w io.Writer, output string, items []T) error {
+	if output != outputJSONL {
+		return writeJSON(w, items)
+	}
+	for _, item := range items {
+		if err := writeRecord(w, output, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatCount renders n with a comma between each group of three digits, e.g.
+// 12,345,678.
+func formatCount(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	head := len(s) % 3
+	if head == 0 {
+		head = 3
+	}
+	var b strings.Builder
+	b.WriteString(s[:head])
+	for i := head; i < len(s); i += 3 {
+		b.WriteByte(',')
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
+
+// formatCounter renders a counter for text output: with formatCount if human
+// is set, otherwise as a plain decimal number.
+func formatCounter(n uint64, human bool) string {
+	if human {
+		return formatCount(n)
+	}
+	return strconv.FormatUint(n, 10)
+}
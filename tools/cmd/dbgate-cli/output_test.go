@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestOutputJSONL_Sessions verifies that every session is one compact JSON
+// object terminated by a single newline.
+func TestOutputJSONL_Sessions(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","client_addr":"10.0.0.5:51234","database":"app","user":"svc","state":"idle","started_at_ms":1700000000000,"query_count":42},` +
+		`{"id":"s2","client_addr":"10.0.0.6:40000","database":"app","user":"bi","state":"active","started_at_ms":1700000060000,"query_count":7}]}`)
+	sock := mockUDSServer(t, respJSON)
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "-o", "jsonl", "session", "list"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if !strings.HasSuffix(out.String(), "}\n") || strings.HasSuffix(out.String(), "\n\n") {
+		t.Errorf("each record must end with exactly one newline: %q", out.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d:\n%s", len(lines), out.String())
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) != line {
+			t.Errorf("line %d has surrounding whitespace: %q", i, line)
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Errorf("line %d is not valid JSON: %v\n%s", i, err, line)
+		}
+	}
+	if !strings.Contains(lines[1], `"id":"s2"`) {
+		t.Errorf("unexpected second record: %s", lines[1])
+	}
+}
+
+// TestOutputJSONL_Stats verifies that a single-record command prints one line.
+func TestOutputJSONL_Stats(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(100, 10, 1, 0))
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", sock, "--output", "jsonl", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if strings.Count(out.String(), "\n") != 1 || !strings.Contains(out.String(), `"total_queries":100`) {
+		t.Errorf("expected one compact line, got %q", out.String())
+	}
+}
+
+// TestFormatCount verifies digit grouping at the group boundaries.
+func TestFormatCount(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0"},
+		{7, "7"},
+		{999, "999"},
+		{1000, "1,000"},
+		{12345, "12,345"},
+		{999999, "999,999"},
+		{1000000, "1,000,000"},
+		{12345678, "12,345,678"},
+		{math.MaxUint64, "18,446,744,073,709,551,615"},
+	}
+	for _, tt := range tests {
+		if got := formatCount(tt.n); got != tt.want {
+			t.Errorf("formatCount(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestStats_Human verifies that --human groups the counters of the text
+// output, --no-human and non-terminal stdout keep them raw, and JSON output
+// is unaffected.
+func TestStats_Human(t *testing.T) {
+	sock := mockUDSServer(t, makeStatsResponse(12345678, 1000, 1.5, 1700000000000))
+	tests := []struct {
+		args    []string
+		want    string
+		notWant string
+	}{
+		{[]string{"stats", "--human"}, "Total Queries:    12,345,678\n", ""},
+		{[]string{"stats", "-H"}, "Blocked Queries:     1,000\n", ""},
+		{[]string{"stats", "--no-human"}, "Total Queries:    12345678\n", ","},
+		{[]string{"stats"}, "Total Queries:    12345678\n", ","},
+		{[]string{"-o", "json", "stats", "--human"}, `"total_queries": 12345678`, "12,345,678"},
+	}
+	for _, tt := range tests {
+		cmd := newRootCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(append([]string{"--socket", sock}, tt.args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("%v: output missing %q:\n%s", tt.args, tt.want, out.String())
+		}
+		if tt.notWant != "" && strings.Contains(out.String(), tt.notWant) {
+			t.Errorf("%v: output contains %q:\n%s", tt.args, tt.notWant, out.String())
+		}
+	}
+}
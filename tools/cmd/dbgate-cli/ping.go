@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// pingResult is the outcome of one ping request.
+type pingResult struct {
+	rtt time.Duration
+	err error
+}
+
+// pingStats summarizes a ping run like ping(8). The RTT fields cover only
+// successful requests and are zero when there were none.
+type pingStats struct {
+	Sent     int
+	Received int
+	Loss     float64 // fraction of requests that failed, 0..1
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+	P99      time.Duration
+}
+
+// pingStatsJSON is the --output json form of pingStats, with the RTTs in
+// fractional milliseconds.
+type pingStatsJSON struct {
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss"`
+	MinMs    float64 `json:"min_ms"`
+	AvgMs    float64 `json:"avg_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+// summarizePings computes the loss and RTT statistics of results. P99 uses
+// the nearest-rank method, so with fewer than 100 replies it is the maximum.
+func summarizePings(results []pingResult) pingStats {
+	st := pingStats{Sent: len(results)}
+	var rtts []time.Duration
+	for _, r := range results {
+		if r.err == nil {
+			rtts = append(rtts, r.rtt)
+		}
+	}
+	st.Received = len(rtts)
+	if st.Sent > 0 {
+		st.Loss = float64(st.Sent-st.Received) / float64(st.Sent)
+	}
+	if len(rtts) == 0 {
+		return st
+	}
+
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	var sum time.Duration
+	for _, d := range rtts {
+		sum += d
+	}
+	st.Min, st.Max = rtts[0], rtts[len(rtts)-1]
+	st.Avg = sum / time.Duration(len(rtts))
+	st.P99 = percentile(rtts, 0.99)
+	return st
+}
+
+// newPingCmd returns the "ping" subcommand.
+func newPingCmd(opts *rootOptions) *cobra.Command {
+	var (
+		count    int
+		interval time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "ping",
+		Short: "Measure round-trip latency to the core",
+		Long: `Send a lightweight ping command --count times, --interval apart, printing
+the round-trip time of each request and a min/avg/max/p99 summary like
+ping(8). Failed requests count as lost. Ctrl+C stops early and still prints
+the summary. The command fails if every request was lost.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count <= 0 {
+				return fmt.Errorf("invalid --count %d: must be positive", count)
+			}
+			if interval <= 0 {
+				return fmt.Errorf("invalid --interval %s: must be positive", interval)
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			return runPing(ctx, cmd.OutOrStdout(), opts, count, interval)
+		},
+	}
+	cmd.Flags().IntVarP(&count, "count", "c", 4, "Number of requests to send")
+	cmd.Flags().DurationVarP(&interval, "interval", "i", time.Second, "Wait between requests")
+	return cmd
+}
+
+// runPing pings the core count times, or until ctx is cancelled, and prints
+// each result and the summary. With --output json only the summary is
+// printed.
+func runPing(ctx context.Context, w io.Writer, opts *rootOptions, count int, interval time.Duration) error {
+	c := opts.newClient()
+	text := !isJSONOutput(opts.output)
+
+	var results []pingResult
+loop:
+	for seq := 1; seq <= count; seq++ {
+		rtt, err := c.PingContext(ctx)
+		if ctxDone(ctx) {
+			break // interrupted: the request in flight is not a loss
+		}
+		if errors.Is(err, client.ErrNotImplemented) {
+			return notSupported("ping", "ping")
+		}
+		if errors.Is(err, client.ErrDryRun) {
+			return err
+		}
+		results = append(results, pingResult{rtt: rtt, err: err})
+		if text {
+			if err != nil {
+				fmt.Fprintf(w, "seq=%d failed: %v\n", seq, err)
+			} else {
+				fmt.Fprintf(w, "reply from %s: seq=%d time=%s\n", opts.socketPath(), seq, formatMillis(rtt))
+			}
+		}
+
+		if seq == count {
+			break
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			break loop
+		case <-timer.C:
+		}
+	}
+
+	st := summarizePings(results)
+	if text {
+		fmt.Fprintf(w, "\n--- %s ping statistics ---\n", opts.socketPath())
+		fmt.Fprintf(w, "%d requests sent, %d replies received, %.1f%% loss\n", st.Sent, st.Received, st.Loss*100)
+		if st.Received > 0 {
+			fmt.Fprintf(w, "rtt min/avg/max/p99 = %s/%s/%s/%s\n",
+				formatMillis(st.Min), formatMillis(st.Avg), formatMillis(st.Max), formatMillis(st.P99))
+		}
+	} else if err := writeRecord(w, opts.output, pingStatsJSON{
+		Sent: st.Sent, Received: st.Received, Loss: st.Loss,
+		MinMs: durationMillis(st.Min), AvgMs: durationMillis(st.Avg), MaxMs: durationMillis(st.Max), P99Ms: durationMillis(st.P99),
+	}); err != nil {
+		return err
+	}
+
+	if st.Sent > 0 && st.Received == 0 {
+		errs := make([]error, 0, len(results))
+		for _, r := range results {
+			errs = append(errs, r.err)
+		}
+		return recordedError(opts, &causedError{"ping: 100% loss", errs})
+	}
+	return nil
+}
+
+// formatMillis renders d in milliseconds with microsecond precision.
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.3f ms", durationMillis(d))
+}
+
+// durationMillis returns d in fractional milliseconds, for JSON fields
+// suffixed _ms.
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSummarizePings verifies loss and min/avg/max/p99 for a fixed set of
+// results, including the all-lost and empty cases.
+func TestSummarizePings(t *testing.T) {
+	ms := time.Millisecond
+	lost := errors.New("timeout")
+	results := []pingResult{
+		{rtt: 4 * ms}, {err: lost}, {rtt: 1 * ms}, {rtt: 3 * ms}, {rtt: 2 * ms},
+	}
+	got := summarizePings(results)
+	want := pingStats{Sent: 5, Received: 4, Loss: 0.2, Min: ms, Avg: 2500 * time.Microsecond, Max: 4 * ms, P99: 4 * ms}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Nearest-rank p99 of 1..200 ms is the 198th value.
+	results = results[:0]
+	for i := 200; i >= 1; i-- {
+		results = append(results, pingResult{rtt: time.Duration(i) * ms})
+	}
+	if got := summarizePings(results); got.P99 != 198*ms || got.Loss != 0 {
+		t.Errorf("p99 of 200 = %v (loss %v), want 198ms", got.P99, got.Loss)
+	}
+
+	if got := summarizePings([]pingResult{{err: lost}, {err: lost}}); got != (pingStats{Sent: 2, Loss: 1}) {
+		t.Errorf("all lost: got %+v", got)
+	}
+	if got := summarizePings(nil); got != (pingStats{}) {
+		t.Errorf("empty: got %+v", got)
+	}
+}
+
+// TestRunPing verifies the per-request lines and summary, and that 100% loss
+// fails.
+func TestRunPing(t *testing.T) {
+	ok := []byte(`{"ok":true}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServerSeq(t, ok, ok)}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runPing(context.Background(), &out, opts, 2, time.Millisecond); err != nil {
+		t.Fatalf("runPing: %v", err)
+	}
+	for _, want := range []string{"seq=1 time=", "seq=2 time=", "2 requests sent, 2 replies received, 0.0% loss", "rtt min/avg/max/p99 = "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	opts = &rootOptions{socketPaths: []string{"/nonexistent/path.sock"}, timeout: time.Second}
+	out.Reset()
+	err := runPing(context.Background(), &out, opts, 2, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "100% loss") {
+		t.Errorf("expected 100%% loss error, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "seq=2 failed:") || strings.Contains(out.String(), "rtt ") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+// TestRunPing_JSON verifies that the JSON summary reports the RTTs in
+// fractional milliseconds.
+func TestRunPing_JSON(t *testing.T) {
+	ok := []byte(`{"ok":true}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, ok)}, timeout: 3 * time.Second, output: outputJSON}
+	var out bytes.Buffer
+	if err := runPing(context.Background(), &out, opts, 1, time.Millisecond); err != nil {
+		t.Fatalf("runPing: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("summary is not JSON: %v\n%s", err, out.String())
+	}
+	for _, key := range []string{"min_ms", "avg_ms", "max_ms", "p99_ms"} {
+		if v, ok := got[key].(float64); !ok || v <= 0 {
+			t.Errorf("%s = %v, want a positive number of milliseconds", key, got[key])
+		}
+	}
+	if got["sent"] != 1.0 || got["received"] != 1.0 {
+		t.Errorf("summary = %v", got)
+	}
+}
+
+// TestRunPing_Cancel verifies that cancelling ctx aborts the request in
+// flight without counting it as lost.
+func TestRunPing_Cancel(t *testing.T) {
+	sock, _ := stalledUDSServer(t)
+	opts := &rootOptions{socketPaths: []string{sock}, timeout: 10 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	var out bytes.Buffer
+	if err := runPing(ctx, &out, opts, 3, time.Millisecond); err != nil {
+		t.Fatalf("runPing: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ping took %s to stop, want it cancelled with ctx", elapsed)
+	}
+	if !strings.Contains(out.String(), "0 requests sent") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
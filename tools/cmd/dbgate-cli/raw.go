@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// newRawCmd returns the "raw" subcommand.
+func newRawCmd(opts *rootOptions) *cobra.Command {
+	var (
+		argPairs []string
+		jsonArgs bool
+	)
+	cmd := &cobra.Command{
+		Use:   "raw <command>",
+		Short: "Send an arbitrary command and print the raw response",
+		Long: `Send any command to the core and print the full response (ok, error, code
+and payload) as JSON, e.g.
+
+  dbgate-cli raw audit_tail --arg limit=5 --json-args
+
+This is a debugging aid for commands the CLI has no first-class support for
+yet. Arguments are given as repeated --arg key=value and sent as strings;
+with --json-args, values that are valid JSON (numbers, booleans, null,
+arrays, objects) are sent as those types instead.
+
+A response with ok:false is printed like any other, and the command then
+exits with code 2.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rawArgs, err := parseRawArgs(argPairs, jsonArgs)
+			if err != nil {
+				return err
+			}
+			return runRaw(cmd.OutOrStdout(), opts, args[0], rawArgs)
+		},
+	}
+	cmd.Flags().StringArrayVar(&argPairs, "arg", nil, "Command argument as key=value (repeatable)")
+	cmd.Flags().BoolVar(&jsonArgs, "json-args", false, "Send --arg values that are valid JSON as JSON types")
+	return cmd
+}
+
+// parseRawArgs turns key=value pairs into command arguments. Values are
+// strings unless jsonArgs is set and the value is valid JSON, in which case
+// it is decoded, keeping numbers exact. A nil map is returned for no pairs so
+// that the request carries no args at all.
+func parseRawArgs(pairs []string, jsonArgs bool) (map[string]interface{}, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	args := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --arg %q: want key=value", pair)
+		}
+		if _, dup := args[key]; dup {
+			return nil, fmt.Errorf("invalid --arg %q: %s given more than once", pair, key)
+		}
+		args[key] = value
+		if jsonArgs && json.Valid([]byte(value)) {
+			dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+			dec.UseNumber()
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, fmt.Errorf("invalid --arg %q: %w", pair, err)
+			}
+			args[key] = v
+		}
+	}
+	return args, nil
+}
+
+// runRaw sends command with args and prints the response as JSON, or as one
+// compact line with --output jsonl. With --check-capabilities a command the
+// core does not list is refused without being sent.
+func runRaw(w io.Writer, opts *rootOptions, command string, args map[string]interface{}) error {
+	if opts.checkCapabilities {
+		if err := opts.checkCapability("raw "+command, command); err != nil {
+			return err
+		}
+	}
+	resp, err := opts.newClient().SendCommandArgs(command, args)
+	if err != nil {
+		return fmt.Errorf("raw %s: %w", command, err)
+	}
+	if err := writeRecord(w, opts.output, resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		// The error is already in the printed response.
+		return &exitError{code: exitServerError}
+	}
+	return nil
+}
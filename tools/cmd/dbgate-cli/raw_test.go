@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseRawArgs verifies that values stay strings by default, become JSON
+// types with --json-args, and that malformed pairs are rejected.
+func TestParseRawArgs(t *testing.T) {
+	pairs := []string{"limit=5", "verbose=true", "name=alice", "eq=a=b", "big=12345678901234567890"}
+
+	got, err := parseRawArgs(pairs, false)
+	if err != nil {
+		t.Fatalf("parseRawArgs: %v", err)
+	}
+	want := map[string]interface{}{"limit": "5", "verbose": "true", "name": "alice", "eq": "a=b", "big": "12345678901234567890"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("string args: got %#v, want %#v", got, want)
+	}
+
+	got, err = parseRawArgs(pairs, true)
+	if err != nil {
+		t.Fatalf("parseRawArgs --json-args: %v", err)
+	}
+	want = map[string]interface{}{
+		"limit": json.Number("5"), "verbose": true, "name": "alice", "eq": "a=b",
+		"big": json.Number("12345678901234567890"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON args: got %#v, want %#v", got, want)
+	}
+
+	if got, err := parseRawArgs(nil, true); err != nil || got != nil {
+		t.Errorf("no pairs: got %#v, %v", got, err)
+	}
+	for _, bad := range [][]string{{"limit"}, {"=5"}, {"a=1", "a=2"}} {
+		if _, err := parseRawArgs(bad, false); err == nil {
+			t.Errorf("parseRawArgs(%q): expected error", bad)
+		}
+	}
+}
+
+// TestRunRaw verifies that the full response is printed, and that an ok:false
+// response is printed too but exits with exitServerError.
+func TestRunRaw(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{mockUDSServer(t, []byte(`{"ok":true,"payload":{"entries":[{"id":7}]}}`))},
+		timeout:     3 * time.Second,
+	}
+	var out bytes.Buffer
+	if err := runRaw(&out, opts, "audit_tail", map[string]interface{}{"limit": json.Number("5")}); err != nil {
+		t.Fatalf("runRaw: %v", err)
+	}
+	var resp struct {
+		OK      bool                        `json:"ok"`
+		Payload map[string][]map[string]int `json:"payload"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if !resp.OK || resp.Payload["entries"][0]["id"] != 7 {
+		t.Errorf("unexpected response: %s", out.String())
+	}
+
+	opts.socketPaths = []string{mockUDSServer(t, []byte(`{"ok":false,"error":"unknown command","code":400}`))}
+	out.Reset()
+	err := runRaw(&out, opts, "bogus", nil)
+	if exitCode(err) != exitServerError {
+		t.Errorf("exit code: got %d (%v), want %d", exitCode(err), err, exitServerError)
+	}
+	for _, want := range []string{`"ok": false`, `"error": "unknown command"`, `"code": 400`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %s:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestRunRaw_NotImplemented verifies that an ok:false response without an
+// error message, as sent by cores that predate a command, still exits with
+// exitServerError.
+func TestRunRaw_NotImplemented(t *testing.T) {
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, []byte(`{"ok":false}`))}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	err := runRaw(&out, opts, "policy_reload", nil)
+	if exitCode(err) != exitServerError {
+		t.Errorf("exit code: got %d (%v), want %d", exitCode(err), err, exitServerError)
+	}
+	if !strings.Contains(out.String(), `"ok": false`) {
+		t.Errorf("response not printed:\n%s", out.String())
+	}
+}
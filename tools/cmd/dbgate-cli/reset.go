@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// newStatsResetCmd returns the "stats reset" subcommand.
+func newStatsResetCmd(opts *rootOptions) *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Zero the core's cumulative stats counters",
+		Long: `Ask the core to zero its cumulative counters, e.g. after deploying a fix,
+so that fresh rates can be observed. This cannot be undone: without --yes the
+command asks for confirmation when stdout is a terminal and refuses otherwise.`,
+		Annotations: map[string]string{annotationCommand: "stats_reset"},
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := cmd.OutOrStdout()
+			return runStatsReset(w, cmd.InOrStdin(), opts, yes, isTerminal(w))
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Reset without asking for confirmation")
+	return cmd
+}
+
+// runStatsReset resets the counters after confirming: yes skips the check,
+// otherwise an interactive session is asked y/N on in and a non-interactive
+// one is refused.
+func runStatsReset(w io.Writer, in io.Reader, opts *rootOptions, yes, interactive bool) error {
+	if !yes {
+		if !interactive {
+			return errors.New("stats reset: refusing to reset counters without --yes")
+		}
+		ok, err := confirm(w, in, fmt.Sprintf("Reset all stats counters on %s? [y/N] ", opts.socketPath()))
+		if err != nil {
+			return fmt.Errorf("stats reset: %w", err)
+		}
+		if !ok {
+			return errors.New("stats reset: aborted")
+		}
+	}
+
+	err := opts.newClient().ResetStats()
+	if errors.Is(err, client.ErrNotImplemented) {
+		return notSupported("stats reset", "stats_reset")
+	}
+	if err != nil {
+		return fmt.Errorf("stats reset: %w", err)
+	}
+	fmt.Fprintln(w, "stats reset")
+	return nil
+}
+
+// confirm prints prompt to w and reports whether the line read from in is
+// "y" or "yes" (case-insensitive). End of input counts as no.
+func confirm(w io.Writer, in io.Reader, prompt string) (bool, error) {
+	fmt.Fprint(w, prompt)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunStatsReset_Confirmation verifies the gating: --yes resets without a
+// prompt, an interactive "y" confirms, a declined prompt or a
+// non-interactive run without --yes never contacts the core.
+func TestRunStatsReset_Confirmation(t *testing.T) {
+	okResp := []byte(`{"ok":true}`)
+
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, okResp)}, timeout: 3 * time.Second}
+	var out bytes.Buffer
+	if err := runStatsReset(&out, strings.NewReader(""), opts, true, true); err != nil {
+		t.Fatalf("--yes: %v", err)
+	}
+	if out.String() != "stats reset\n" {
+		t.Errorf("--yes output = %q, want no prompt", out.String())
+	}
+
+	opts = &rootOptions{socketPaths: []string{mockUDSServer(t, okResp)}, timeout: 3 * time.Second}
+	out.Reset()
+	if err := runStatsReset(&out, strings.NewReader("y\n"), opts, false, true); err != nil {
+		t.Fatalf("confirmed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Reset all stats counters on ") || !strings.HasSuffix(out.String(), "stats reset\n") {
+		t.Errorf("confirmed output = %q", out.String())
+	}
+
+	for _, tt := range []struct {
+		name        string
+		input       string
+		interactive bool
+		wantErr     string
+	}{
+		{"declined", "n\n", true, "aborted"},
+		{"empty answer", "\n", true, "aborted"},
+		{"end of input", "", true, "aborted"},
+		{"not a terminal", "y\n", false, "without --yes"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sock, accepted := stalledUDSServer(t)
+			opts := &rootOptions{socketPaths: []string{sock}, timeout: time.Second}
+			err := runStatsReset(&bytes.Buffer{}, strings.NewReader(tt.input), opts, false, tt.interactive)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want error containing %q", err, tt.wantErr)
+			}
+			if n := accepted.Load(); n != 0 {
+				t.Errorf("core was contacted %d times", n)
+			}
+		})
+	}
+}
+
+// TestRunStatsReset_NotImplemented verifies the friendly 501 message.
+func TestRunStatsReset_NotImplemented(t *testing.T) {
+	opts := &rootOptions{
+		socketPaths: []string{mockUDSServer(t, []byte(`{"ok":false,"error":"not implemented","code":501}`))},
+		timeout:     3 * time.Second,
+	}
+	err := runStatsReset(&bytes.Buffer{}, strings.NewReader(""), opts, true, false)
+	if err == nil || !strings.Contains(err.Error(), "does not support stats_reset") {
+		t.Errorf("expected not-supported error, got: %v", err)
+	}
+}
+
+// TestStatsReset_Command verifies that "stats reset --yes" is wired up.
+func TestStatsReset_Command(t *testing.T) {
+	cmd := newRootCmd()
+	var stdout bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--socket", mockUDSServer(t, []byte(`{"ok":true}`)), "stats", "reset", "--yes"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if stdout.String() != "stats reset\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// benchFramingSizes are the payload sizes exercised by selftest --bench-framing.
+var benchFramingSizes = []int{64, 1 << 10, 64 << 10, 1 << 20}
+
+// newSelftestCmd returns the hidden "selftest" command used for built-in
+// diagnostics such as the framing codec micro-benchmark.
+func newSelftestCmd() *cobra.Command {
+	var benchFraming bool
+	var benchDuration time.Duration
+
+	cmd := &cobra.Command{
+		Use:    "selftest",
+		Short:  "Run built-in client self-tests",
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !benchFraming {
+				return fmt.Errorf("selftest: no test selected (use --bench-framing)")
+			}
+			return runBenchFraming(cmd.OutOrStdout(), benchDuration)
+		},
+	}
+	cmd.Flags().BoolVar(&benchFraming, "bench-framing", false, "Benchmark WriteFrame/ReadFrame over an in-memory pipe")
+	cmd.Flags().DurationVar(&benchDuration, "bench-duration", 500*time.Millisecond, "How long to run each payload size")
+	return cmd
+}
+
+// runBenchFraming benchmarks the frame codec for each size in
+// benchFramingSizes and prints frames/s and MB/s as an aligned table.
+func runBenchFraming(w io.Writer, perSize time.Duration) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Size\tFrames\tns/frame\tMB/s\t")
+	for _, size := range benchFramingSizes {
+		frames, elapsed, err := benchFramingSize(size, perSize)
+		if err != nil {
+			return fmt.Errorf("bench framing %dB: %w", size, err)
+		}
+		nsPerFrame := float64(elapsed.Nanoseconds()) / float64(frames)
+		mbPerSec := float64(size) * float64(frames) / elapsed.Seconds() / 1e6
+		fmt.Fprintf(tw, "%dB\t%d\t%.0f\t%.2f\t\n", size, frames, nsPerFrame, mbPerSec)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("flush output: %w", err)
+	}
+	return nil
+}
+
+// benchFramingSize writes frames of the given size into one end of a net.Pipe
+// for roughly d while a reader goroutine decodes them from the other end.
+// It returns the number of frames decoded and the elapsed time.
+func benchFramingSize(size int, d time.Duration) (int, time.Duration, error) {
+	body := bytes.Repeat([]byte{'x'}, size)
+	w, r := net.Pipe()
+
+	type result struct {
+		frames int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() { _ = r.Close() }()
+		frames := 0
+		for {
+			if _, err := client.ReadFrame(r, uint32(size)); err != nil { // #nosec G115 -- sizes are small constants.
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				done <- result{frames: frames, err: err}
+				return
+			}
+			frames++
+		}
+	}()
+
+	start := time.Now()
+	for time.Since(start) < d {
+		if err := client.WriteFrame(w, body); err != nil {
+			_ = w.Close()
+			<-done
+			return 0, 0, err
+		}
+	}
+	_ = w.Close()
+	res := <-done
+	elapsed := time.Since(start)
+	if res.err != nil {
+		return 0, 0, res.err
+	}
+	if res.frames == 0 {
+		return 0, 0, fmt.Errorf("no frames completed")
+	}
+	return res.frames, elapsed, nil
+}
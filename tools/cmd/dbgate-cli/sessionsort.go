@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// Values accepted by sessions --sort.
+const (
+	sessionSortDuration = "duration" // longest-running first
+	sessionSortQueries  = "queries"  // most queries first
+	sessionSortUser     = "user"     // alphabetical
+)
+
+// sessionSortKeys lists the --sort values, for help and errors.
+var sessionSortKeys = []string{sessionSortDuration, sessionSortQueries, sessionSortUser}
+
+// sessionOrder is the client-side ordering and cap applied by sessions
+// --sort and --limit. The zero value keeps the server's order and every
+// session.
+type sessionOrder struct {
+	key   string
+	limit int // 0 means no limit
+}
+
+// validate checks the --sort and --limit values.
+func (o sessionOrder) validate() error {
+	if o.key != "" && !slices.Contains(sessionSortKeys, o.key) {
+		return fmt.Errorf("invalid --sort %q: must be one of %s", o.key, strings.Join(sessionSortKeys, ", "))
+	}
+	if o.limit < 0 {
+		return fmt.Errorf("invalid --limit %d: must not be negative", o.limit)
+	}
+	return nil
+}
+
+// isZero reports whether o leaves the session list unchanged, so it can be
+// streamed as it arrives.
+func (o sessionOrder) isZero() bool {
+	return o.key == "" && o.limit == 0
+}
+
+// apply sorts sessions by o.key and then keeps the first o.limit.
+func (o sessionOrder) apply(sessions []client.Session) []client.Session {
+	sortSessions(sessions, o.key)
+	if o.limit > 0 && len(sessions) > o.limit {
+		sessions = sessions[:o.limit]
+	}
+	return sessions
+}
+
+// sortSessions orders sessions in place by key: duration and queries
+// descending, user ascending. The sort is stable, so sessions with equal keys
+// keep the server's order. An empty key leaves the order unchanged.
+func sortSessions(sessions []client.Session, key string) {
+	var less func(a, b client.Session) int
+	switch key {
+	case sessionSortDuration:
+		// The session that started first has run the longest.
+		less = func(a, b client.Session) int { return a.StartedAt.Compare(b.StartedAt) }
+	case sessionSortQueries:
+		less = func(a, b client.Session) int { return cmp.Compare(b.QueryCount, a.QueryCount) }
+	case sessionSortUser:
+		less = func(a, b client.Session) int { return strings.Compare(a.User, b.User) }
+	default:
+		return
+	}
+	slices.SortStableFunc(sessions, less)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// sessionIDs returns the IDs of sessions in order.
+func sessionIDs(sessions []client.Session) []string {
+	return client.SessionList(sessions).IDs()
+}
+
+// TestSortSessions verifies each key's direction and that ties keep the
+// server's order.
+func TestSortSessions(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	server := []client.Session{
+		{ID: "a", User: "svc", StartedAt: t0.Add(2 * time.Minute), QueryCount: 5},
+		{ID: "b", User: "app", StartedAt: t0, QueryCount: 9},
+		{ID: "c", User: "svc", StartedAt: t0.Add(time.Minute), QueryCount: 5},
+		{ID: "d", User: "app", StartedAt: t0, QueryCount: 1},
+	}
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{sessionSortDuration, []string{"b", "d", "c", "a"}},
+		{sessionSortQueries, []string{"b", "a", "c", "d"}},
+		{sessionSortUser, []string{"b", "d", "a", "c"}},
+		{"", []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		sessions := append([]client.Session(nil), server...)
+		sortSessions(sessions, tt.key)
+		if got := sessionIDs(sessions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort by %q = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+// TestSessionOrder verifies that the limit applies after sorting and that
+// invalid values are rejected.
+func TestSessionOrder(t *testing.T) {
+	sessions := []client.Session{{ID: "a", QueryCount: 1}, {ID: "b", QueryCount: 3}, {ID: "c", QueryCount: 2}}
+	got := sessionOrder{key: sessionSortQueries, limit: 2}.apply(sessions)
+	if ids := sessionIDs(got); !reflect.DeepEqual(ids, []string{"b", "c"}) {
+		t.Errorf("top 2 by queries = %v, want [b c]", ids)
+	}
+	if got := (sessionOrder{limit: 10}).apply(sessions); len(got) != 3 {
+		t.Errorf("limit above the count kept %d sessions, want 3", len(got))
+	}
+
+	for _, o := range []sessionOrder{{key: "age"}, {limit: -1}} {
+		if err := o.validate(); err == nil {
+			t.Errorf("validate(%+v): expected an error", o)
+		}
+	}
+}
+
+// TestRunSessions_Order verifies that --sort and --limit also apply to
+// --output jsonl, which otherwise streams in server order.
+func TestRunSessions_Order(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","query_count":1},{"id":"s2","query_count":7},{"id":"s3","query_count":3}]}`)
+	opts := &rootOptions{socketPaths: []string{mockUDSServer(t, respJSON)}, timeout: 3 * time.Second, output: outputJSONL}
+
+	var out bytes.Buffer
+	if err := runSessions(context.Background(), &out, opts, false, client.SessionFilter{}, sessionOrder{key: sessionSortQueries, limit: 2}); err != nil {
+		t.Fatalf("runSessions: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":"s2"`) || !strings.Contains(lines[1], `"id":"s3"`) {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
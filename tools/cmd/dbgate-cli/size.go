@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// byteSize is a pflag.Value for byte counts written as a plain number or with
+// a binary unit suffix: B, KiB, MiB or GiB (case-insensitive, e.g. "32MiB").
+// Sizes must fit the 31 bits of the frame length that are not the compressed
+// flag, i.e. be below 2 GiB.
+type byteSize uint32
+
+// sizeUnits lists the accepted suffixes, largest first so String picks the
+// biggest exact unit.
+var sizeUnits = []struct {
+	suffix string
+	mult   uint64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// String implements pflag.Value.
+func (s *byteSize) String() string {
+	n := uint64(*s)
+	for _, u := range sizeUnits {
+		if n != 0 && n%u.mult == 0 {
+			return fmt.Sprintf("%d%s", n/u.mult, u.suffix)
+		}
+	}
+	return "0"
+}
+
+// Set implements pflag.Value.
+func (s *byteSize) Set(v string) error {
+	num, mult := strings.TrimSpace(v), uint64(1)
+	for _, u := range sizeUnits {
+		if len(num) > len(u.suffix) && strings.EqualFold(num[len(num)-len(u.suffix):], u.suffix) {
+			num, mult = strings.TrimSpace(num[:len(num)-len(u.suffix)]), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q: want a number of bytes or a KiB/MiB/GiB suffix", v)
+	}
+	if n == 0 || n > client.MaxFrameLength/mult {
+		return fmt.Errorf("invalid size %q: must be at least 1B and below 2GiB", v)
+	}
+	*s = byteSize(n * mult) // #nosec G115 -- bounded by the check above.
+	return nil
+}
+
+// Type implements pflag.Value.
+func (s *byteSize) Type() string {
+	return "size"
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestByteSize verifies parsing of plain and suffixed sizes and the bounds.
+func TestByteSize(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want byteSize
+	}{
+		{"1048576", 1 << 20},
+		{"512B", 512},
+		{"64KiB", 64 << 10},
+		{"32MiB", 32 << 20},
+		{"32mib", 32 << 20},
+		{"1GiB", 1 << 30},
+		{"2047MiB", 2047 << 20},
+	} {
+		var s byteSize
+		if err := s.Set(tt.in); err != nil || s != tt.want {
+			t.Errorf("Set(%q) = %d, %v; want %d", tt.in, s, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "0", "-1", "32MB", "2GiB", "2048MiB", "4GiB", "1.5MiB"} {
+		var s byteSize
+		if err := s.Set(in); err == nil || !strings.Contains(err.Error(), "invalid size") {
+			t.Errorf("Set(%q) should fail, got %v", in, err)
+		}
+	}
+
+	s := byteSize(16 << 20)
+	if got := s.String(); got != "16MiB" {
+		t.Errorf("String() = %q, want 16MiB", got)
+	}
+	s = 1000
+	if got := s.String(); got != "1000B" {
+		t.Errorf("String() = %q, want 1000B", got)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// table renders rows of text cells as aligned columns separated by two
+// spaces. Column widths fit the widest cell, and columns whose cells are all
+// numbers are right-aligned. As with text/tabwriter, the last cell of a row
+// shorter than the widest row is not part of a column: it is printed as is,
+// which suits a trailing message such as "unavailable: <error>".
+type table struct {
+	header []string   // column titles; nil prints no header line
+	rows   [][]string // rows may have differing numbers of cells
+	// minWidths holds per-column minimum widths, so that tables printed in
+	// batches, e.g. by audit tail --follow, stay aligned with each other.
+	minWidths []int
+	// maxWidth truncates longer cells with an ellipsis; 0 means no limit.
+	maxWidth int
+}
+
+// tableSep separates adjacent columns.
+const tableSep = "  "
+
+// newTable returns a table with the given column titles.
+func newTable(header ...string) *table {
+	return &table{header: header}
+}
+
+// addRow appends a row of cells.
+func (t *table) addRow(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// render writes the header, if any, and the rows to w.
+func (t *table) render(w io.Writer) error {
+	lines := t.rows
+	if t.header != nil {
+		lines = append([][]string{t.header}, t.rows...)
+	}
+	cols := 0
+	for _, cells := range lines {
+		cols = max(cols, len(cells))
+	}
+
+	widths := make([]int, cols)
+	copy(widths, t.minWidths)
+	numeric := make([]bool, cols)
+	for i := range numeric {
+		numeric[i] = true
+	}
+	for n, cells := range lines {
+		for i, cell := range cells {
+			if !t.inColumn(cells, i, cols) {
+				continue
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(t.truncate(cell)))
+			if (t.header == nil || n > 0) && cell != "" && !isNumericCell(cell) {
+				numeric[i] = false
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, cells := range lines {
+		b.Reset()
+		for i, cell := range cells {
+			if i > 0 {
+				b.WriteString(tableSep)
+			}
+			cell = t.truncate(cell)
+			pad := strings.Repeat(" ", max(widths[i]-utf8.RuneCountInString(cell), 0))
+			switch {
+			case !t.inColumn(cells, i, cols):
+				b.WriteString(cell)
+			case numeric[i]:
+				b.WriteString(pad + cell)
+			case i < len(cells)-1:
+				b.WriteString(cell + pad)
+			default:
+				b.WriteString(cell) // no trailing spaces
+			}
+		}
+		b.WriteByte('\n')
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+	}
+	return nil
+}
+
+// inColumn reports whether cells[i] is aligned as part of column i, i.e. it
+// is not the trailing cell of a row with fewer than cols cells.
+func (t *table) inColumn(cells []string, i, cols int) bool {
+	return i < len(cells)-1 || len(cells) == cols
+}
+
+// truncate shortens cell to maxWidth runes, ending it with an ellipsis.
+func (t *table) truncate(cell string) string {
+	if t.maxWidth <= 0 || utf8.RuneCountInString(cell) <= t.maxWidth {
+		return cell
+	}
+	if t.maxWidth == 1 {
+		return "…"
+	}
+	return string([]rune(cell)[:t.maxWidth-1]) + "…"
+}
+
+// isNumericCell reports whether cell is a number as the CLI prints them:
+// optionally with thousands separators (see formatCount) or a percent sign.
+func isNumericCell(cell string) bool {
+	s := strings.TrimSuffix(strings.ReplaceAll(cell, ",", ""), "%")
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
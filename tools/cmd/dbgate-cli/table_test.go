@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestTable verifies auto-width alignment with numeric columns
+// right-aligned, and that a short row's trailing cell is not a column.
+func TestTable(t *testing.T) {
+	tbl := newTable("Socket", "QPS", "Rate")
+	tbl.addRow("/run/a.sock", "1.50", "12.00%")
+	tbl.addRow("/b", "1,250.00", "0.50%")
+	tbl.addRow("/run/long.sock", "unavailable: connection refused")
+
+	var out bytes.Buffer
+	if err := tbl.render(&out); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "" +
+		"Socket               QPS    Rate\n" +
+		"/run/a.sock         1.50  12.00%\n" +
+		"/b              1,250.00   0.50%\n" +
+		"/run/long.sock  unavailable: connection refused\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+// TestTable_Truncate verifies that cells longer than maxWidth end in an
+// ellipsis and that the widths follow the truncated text.
+func TestTable_Truncate(t *testing.T) {
+	tbl := newTable("User", "Query", "N")
+	tbl.maxWidth = 8
+	tbl.addRow("app", "SELECT * FROM users", "7")
+	tbl.addRow("reporting_user", "DROP", "12")
+
+	var out bytes.Buffer
+	if err := tbl.render(&out); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "" +
+		"User      Query      N\n" +
+		"app       SELECT …   7\n" +
+		"reporti…  DROP      12\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
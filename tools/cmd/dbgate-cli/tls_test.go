@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTLSFlags verifies that --tls-ca builds a verifying config that reaches
+// a TLS server, and that TLS flags are rejected without a tcp:// --addr.
+func TestTLSFlags(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	serverCfg := srv.TLS.Clone()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	respJSON := makeStatsResponse(100, 10, 1, 0)
+	frame := make([]byte, 4+len(respJSON))
+	binary.LittleEndian.PutUint32(frame[:4], uint32(len(respJSON)))
+	copy(frame[4:], respJSON)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		serveMockConn(conn, frame)
+	}()
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--addr", "tcp://" + ln.Addr().String(), "--tls-ca", caFile, "--no-version-check", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(out.String(), "Total Queries:         100") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"--socket", "/tmp/x.sock", "--tls-insecure", "stats"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "require --addr tcp://") {
+		t.Errorf("expected TLS/unix error, got: %v", err)
+	}
+}
+
+// TestTLSOptions_CertWithoutKey verifies that a client certificate requires
+// its key.
+func TestTLSOptions_CertWithoutKey(t *testing.T) {
+	_, err := (&tlsOptions{certFile: "client.pem"}).config()
+	if err == nil || !strings.Contains(err.Error(), "must be given together") {
+		t.Fatalf("expected cert/key error, got: %v", err)
+	}
+}
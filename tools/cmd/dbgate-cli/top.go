@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/top"
+	"github.com/spf13/cobra"
+)
+
+// defaultTopInterval is the refresh interval of the top command.
+const defaultTopInterval = 2 * time.Second
+
+// newTopCmd returns the "top" subcommand.
+func newTopCmd(opts *rootOptions) *cobra.Command {
+	var interval time.Duration
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Interactive view of sessions and stats",
+		Long: `Show active sessions under the stats, a sparkline of recent QPS and gauges
+of the blocked and monitored share of queries, refreshed every --interval.
+Each refresh is bounded by --timeout. Without a terminal on stdin and stdout,
+top prints the stats every --interval like "stats --watch" instead.
+
+Keys: up/down select a session, s toggles the sort between query count and
+duration (n and d pick one), r refreshes now, k kills the selected session
+after a y/N confirmation, and q or Ctrl+C quits and restores the terminal.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval <= 0 {
+				return fmt.Errorf("invalid --interval %s: must be positive", interval)
+			}
+			if len(opts.socketPaths) > 1 {
+				return errors.New("top supports a single --socket only")
+			}
+			if !top.IsTerminal(os.Stdin, os.Stdout) {
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				return runStatsWatch(ctx, cmd.OutOrStdout(), opts, false, false, interval)
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM)
+			defer stop()
+			return top.Run(ctx, os.Stdin, os.Stdout, opts.newClient(), interval, opts.timeout)
+		},
+	}
+	cmd.Flags().DurationVar(&interval, "interval", defaultTopInterval, "Refresh interval")
+	return cmd
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracingShutdownTimeout bounds how long the CLI waits on exit for buffered
+// spans to be exported.
+const tracingShutdownTimeout = 5 * time.Second
+
+// startTracing sets up --trace: an OTLP/HTTP exporter configured from the
+// standard OTEL_EXPORTER_OTLP_* environment variables, fed by a batching
+// tracer provider. The service name defaults to dbgate-cli and, like other
+// resource attributes, can be overridden with OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES.
+func (o *rootOptions) startTracing(ctx context.Context) error {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return fmt.Errorf("--trace: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "dbgate-cli")),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return fmt.Errorf("--trace: %w", err)
+	}
+	o.tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return nil
+}
+
+// stopTracing flushes and shuts down the tracer provider started by --trace,
+// if any. An export failure is only warned about: it must not change the
+// outcome of the command that was traced.
+func (o *rootOptions) stopTracing() {
+	if o.tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := o.tracerProvider.Shutdown(ctx); err != nil && o.stderr != nil {
+		fmt.Fprintf(o.stderr, "Warning: --trace: export spans: %v\n", err)
+	}
+	o.tracerProvider = nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTrace verifies that --trace exports the command's span to the OTLP
+// endpoint named by the standard environment variable when the CLI exits.
+func TestTrace(t *testing.T) {
+	exported := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/v1/traces" {
+			exported <- body
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(collector.Close)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+
+	opts := &rootOptions{}
+	cmd := newRootCmdWithOptions(opts)
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--socket", mockUDSServer(t, makeStatsResponse(10, 1, 1, 0)), "--trace", "stats"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	opts.stopTracing()
+
+	select {
+	case body := <-exported:
+		for _, want := range []string{"dbgate.command", "dbgate-cli", "bytes.received"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("exported spans missing %q", want)
+			}
+		}
+	default:
+		t.Fatal("no spans were exported")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/spf13/cobra"
+)
+
+// version is the CLI build version, set at build time with
+// -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+// versionReport is the --output json form of the version command.
+type versionReport struct {
+	CLI struct {
+		Version         string `json:"version"`
+		ProtocolVersion int    `json:"protocol_version"`
+	} `json:"cli"`
+	Core      *client.VersionInfo `json:"core,omitempty"`
+	CoreError string              `json:"core_error,omitempty"`
+}
+
+// newVersionCmd returns the "version" subcommand.
+func newVersionCmd(opts *rootOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the CLI and dbgate core versions",
+		Long: `Print the CLI build version and the version, build hash and protocol
+version reported by the core. An unreachable core is reported with a warning
+and does not fail the command.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVersion(cmd.OutOrStdout(), opts)
+		},
+	}
+}
+
+// runVersion prints the CLI version and, if the core answers, its version.
+func runVersion(w io.Writer, opts *rootOptions) error {
+	var report versionReport
+	report.CLI.Version = version
+	report.CLI.ProtocolVersion = client.ProtocolVersion
+
+	info, err := opts.newClient().ServerVersion()
+	if errors.Is(err, client.ErrDryRun) {
+		return err
+	}
+	if err != nil {
+		report.CoreError = err.Error()
+		if opts.stderr != nil {
+			fmt.Fprintf(opts.stderr, "Warning: cannot query core version: %v\n", err)
+		}
+	} else {
+		report.Core = info
+	}
+
+	if isJSONOutput(opts.output) {
+		return writeRecord(w, opts.output, report)
+	}
+
+	fmt.Fprintf(w, "dbgate-cli:  %s (protocol %d)\n", report.CLI.Version, report.CLI.ProtocolVersion)
+	switch {
+	case errors.Is(err, client.ErrNotImplemented):
+		fmt.Fprintln(w, "dbgate core: unknown (core does not support the version command)")
+		return nil
+	case err != nil:
+		fmt.Fprintln(w, "dbgate core: unreachable")
+		return nil
+	}
+	fmt.Fprintf(w, "dbgate core: %s (build %s, protocol %d)\n", info.Version, info.BuildHash, info.ProtocolVersion)
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// clearScreen moves the cursor home and clears the terminal (ANSI).
+const clearScreen = "\033[H\033[2J"
+
+// maxWatchFailures is the number of consecutive failed polls after which
+// stats --watch gives up.
+const maxWatchFailures = 3
+
+// runStatsWatch polls stats every interval until ctx is cancelled, redrawing
+// the output each time, or appending rows with --output csv. Each poll is a
+// fresh request bounded by --timeout, made by clients built once for the
+// whole loop. A failed poll, including one that timed out, is reported on
+// stderr; maxWatchFailures consecutive failures end the loop with an error.
+// Cancellation (Ctrl+C) prints a final newline and returns nil.
+func runStatsWatch(ctx context.Context, w io.Writer, opts *rootOptions, aggregate, failFast bool, interval time.Duration) error {
+	stderr := opts.stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	clients := opts.statsClients()
+	hl := newStatsHighlighter(opts)
+	failures := 0
+	csvHeader := true
+	for {
+		// Render into a buffer first so the screen is cleared and redrawn in
+		// one write, without flicker while the request is in flight.
+		var buf bytes.Buffer
+		err := renderStats(ctx, &buf, opts, clients, aggregate, failFast, csvHeader, hl)
+		if ctxDone(ctx) {
+			fmt.Fprintln(w)
+			return nil
+		}
+
+		if !isMachineOutput(opts.output) {
+			fmt.Fprint(w, clearScreen)
+		}
+		if opts.output == outputCSV && buf.Len() > 0 {
+			csvHeader = false
+		}
+		if _, werr := w.Write(buf.Bytes()); werr != nil {
+			return fmt.Errorf("write output: %w", werr)
+		}
+
+		if err != nil {
+			failures++
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			if failures >= maxWatchFailures {
+				return fmt.Errorf("stats --watch: giving up after %d consecutive failures", failures)
+			}
+		} else {
+			failures = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(w)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ctxDone reports whether ctx is cancelled or past its deadline. A poll
+// failing right at the deadline can return before ctx reports it, since ctx
+// does so only once its timer has run, so the deadline is checked by the clock
+// too.
+func ctxDone(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// runStatsStream subscribes to the snapshots the core pushes every interval
+// and renders each like stats --watch until ctx is cancelled, which prints a
+// final newline and returns nil. Unlike --watch there is one long-lived
+// connection and no failure budget: losing it ends the command with an error.
+func runStatsStream(ctx context.Context, w io.Writer, opts *rootOptions, interval time.Duration) error {
+	csvHeader := true
+	hl := newStatsHighlighter(opts)
+	err := opts.newClient().SubscribeStats(ctx, interval, func(snap *client.StatsSnapshot) error {
+		var buf bytes.Buffer
+		switch opts.output {
+		case outputJSON, outputJSONL:
+			if err := writeRecord(&buf, opts.output, snap); err != nil {
+				return err
+			}
+		case outputCSV:
+			if err := writeStatsCSV(&buf, opts.csvDelimiter, []instanceStats{{snap: snap}}, false, csvHeader); err != nil {
+				return err
+			}
+			csvHeader = false
+		default:
+			fmt.Fprint(&buf, clearScreen)
+			hl.print(&buf, "=== dbgate stats ===", snap, opts.human)
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("write output: %w", err)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(w)
+		return nil
+	case errors.Is(err, client.ErrNotImplemented):
+		return notSupported("stats --stream", "stats_subscribe")
+	case err != nil:
+		return fmt.Errorf("stats --stream: %w", err)
+	}
+	return nil
+}
+
+// statsChange is how a stats field moved between two snapshots: -1, 0 or 1.
+type statsChange int
+
+// mark returns s, the formatted field, in color with an arrow if c is a move.
+func (c statsChange) mark(s string) string {
+	switch {
+	case c > 0:
+		return colorGreen + s + " ↑" + colorReset
+	case c < 0:
+		return colorRed + s + " ↓" + colorReset
+	}
+	return s
+}
+
+// statsChanges holds the move of each field printStats shows.
+type statsChanges struct {
+	QPS              statsChange
+	BlockRate        statsChange
+	ActiveSessions   statsChange
+	TotalQueries     statsChange
+	BlockedQueries   statsChange
+	MonitoredBlocks  statsChange
+	TotalConnections statsChange
+}
+
+// compareStats returns how each field moved from prev to cur. Rates are
+// compared at the two decimals printStats shows, so that noise below that
+// is not highlighted. A nil prev, the first poll, has no changes.
+func compareStats(prev, cur *client.StatsSnapshot) statsChanges {
+	if prev == nil {
+		return statsChanges{}
+	}
+	return statsChanges{
+		QPS:              compareRounded(prev.QPS, cur.QPS),
+		BlockRate:        compareRounded(prev.BlockRate*100, cur.BlockRate*100),
+		ActiveSessions:   statsChange(cmp.Compare(cur.ActiveSessions, prev.ActiveSessions)),
+		TotalQueries:     statsChange(cmp.Compare(cur.TotalQueries, prev.TotalQueries)),
+		BlockedQueries:   statsChange(cmp.Compare(cur.BlockedQueries, prev.BlockedQueries)),
+		MonitoredBlocks:  statsChange(cmp.Compare(cur.MonitoredBlocks, prev.MonitoredBlocks)),
+		TotalConnections: statsChange(cmp.Compare(cur.TotalConnections, prev.TotalConnections)),
+	}
+}
+
+// compareRounded returns the move from a to b at two decimals.
+func compareRounded(a, b float64) statsChange {
+	return statsChange(cmp.Compare(math.Round(b*100), math.Round(a*100)))
+}
+
+// statsHighlighter draws the snapshots of stats --watch and --stream,
+// highlighting what changed since the one drawn before. A nil
+// *statsHighlighter draws plainly.
+type statsHighlighter struct {
+	prev *client.StatsSnapshot
+}
+
+// newStatsHighlighter returns a highlighter if color is enabled, so that
+// piped output stays plain, and nil otherwise.
+func newStatsHighlighter(opts *rootOptions) *statsHighlighter {
+	if !opts.colorEnabled() {
+		return nil
+	}
+	return &statsHighlighter{}
+}
+
+// print prints snap like printStats, highlighting the fields that changed
+// since the previous call.
+func (h *statsHighlighter) print(w io.Writer, title string, snap *client.StatsSnapshot, human bool) {
+	if h == nil {
+		printStats(w, title, snap, human)
+		return
+	}
+	printStatsChanges(w, title, snap, human, compareStats(h.prev, snap))
+	h.prev = snap
+}
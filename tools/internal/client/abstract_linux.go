@@ -0,0 +1,5 @@
+package client
+
+// abstractSockets reports whether the platform has the abstract Unix socket
+// namespace.
+const abstractSockets = true
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestAbstractSocket verifies that an "@name" address dials the Linux
+// abstract namespace and completes a round-trip, with and without unix://.
+func TestAbstractSocket(t *testing.T) {
+	name := fmt.Sprintf("@dbgate-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+	ln, err := net.Listen("unix", name)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if _, err := ReadFrame(conn, MaxResponseBytes); err == nil {
+				_, _ = conn.Write(frameResponse([]byte(`{"ok":true}`)))
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	for _, addr := range []string{name, "unix://" + name} {
+		network, address, err := ParseAddress(addr)
+		if err != nil || network != "unix" || address != "\x00"+name[1:] {
+			t.Errorf("ParseAddress(%q) = %q, %q, %v", addr, network, address, err)
+		}
+		resp, err := NewClient(addr, 3*time.Second).SendCommand("stats")
+		if err != nil || !resp.OK {
+			t.Errorf("SendCommand via %q: %+v, %v", addr, resp, err)
+		}
+	}
+
+	if _, _, err := ParseAddress("@"); err == nil {
+		t.Error(`ParseAddress("@") should fail`)
+	}
+}
+
+// TestAbstractSocket_NoPathCheck verifies that abstract names skip the socket
+// path check and fail with the dial error instead.
+func TestAbstractSocket_NoPathCheck(t *testing.T) {
+	name := fmt.Sprintf("@dbgate-missing-%d-%d", os.Getpid(), time.Now().UnixNano())
+	_, err := NewClient(name, time.Second).SendCommand("stats")
+	if !errors.Is(err, ErrConnect) || errors.Is(err, ErrSocketNotFound) || errors.Is(err, ErrNotASocket) {
+		t.Errorf("expected a plain connect error, got: %v", err)
+	}
+}
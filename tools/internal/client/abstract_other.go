@@ -0,0 +1,7 @@
+//go:build !linux
+
+package client
+
+// abstractSockets reports whether the platform has the abstract Unix socket
+// namespace.
+const abstractSockets = false
@@ -1,4 +1,6 @@
 // Package client provides a UDS client for communicating with the C++ dbgate core.
+// The same framing is also spoken over TCP for deployments where the core is
+// not on the local filesystem.
 //
 // Protocol: 4-byte LE length prefix + JSON body
 //
@@ -8,172 +10,1641 @@ package client
 
 import (
 	"context"
-	"encoding/binary"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/rand/v2"
 	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
-// Client is a Unix Domain Socket client for the dbgate control plane.
-type Client struct {
-	socketPath string
-	timeout    time.Duration
+// ProtocolVersion is the highest UDS protocol version this client speaks. It
+// is sent in every request unless overridden with WithRequestVersion.
+const ProtocolVersion = 1
+
+// maxRetryDelay caps a single retry backoff.
+const maxRetryDelay = 5 * time.Second
+
+// MaxRequestBytes is the default limit on a marshaled request body; larger
+// requests fail before anything is written. See WithMaxRequestBytes.
+const MaxRequestBytes = 1024 * 1024 // 1 MiB
+
+// MaxResponseBytes is the default limit on a response frame's declared
+// length. It guards against a corrupt or hostile length prefix. See
+// WithMaxResponseBytes.
+const MaxResponseBytes = 16 * 1024 * 1024 // 16 MiB
+
+// MaxFrameLength is the largest body length a frame can declare, as the high
+// bit of the length prefix marks a compressed body (see WithCompression).
+const MaxFrameLength = compressedFlag - 1
+
+// LevelTrace is the slog level below Debug at which the client hex-dumps
+// response bodies (see WithLogger).
+const LevelTrace = slog.LevelDebug - 4
+
+// logDumpBytes caps the response bytes hex-dumped at LevelTrace.
+const logDumpBytes = 256
+
+// strictTrailingWindow is how long strict length-prefix mode waits for extra
+// bytes after the declared response body has been read.
+const strictTrailingWindow = 50 * time.Millisecond
+
+// Client is a Unix Domain Socket (or TCP) client for the dbgate control plane.
+//
+// A Client is safe for concurrent use by multiple goroutines once NewClient
+// returns. Options are only applied by NewClient; the state that changes
+// afterwards, the persistent connection of WithKeepAlive, the negotiated
+// protocol version and the I/O counters, is guarded by its own mutex. Without
+// keep-alive each request uses its own connection, so concurrent requests do
+// not wait for each other.
+type Client struct {
+	addr               string // address as given to NewClient, for messages
+	network            string // "unix" or "tcp"
+	address            string // dial address for network
+	addrErr            error  // non-nil if addr could not be parsed
+	timeout            time.Duration
+	strictLengthPrefix bool
+	compression        bool
+	requestCompression bool
+	dryRun             func(body []byte)
+	strictStats        bool
+	readBudget         time.Duration
+	idleReadTimeout    time.Duration
+	dialTimeout        time.Duration
+	writeTimeout       time.Duration
+	readTimeout        time.Duration
+	attemptTimeout     time.Duration
+	tcpKeepAlive       time.Duration
+	requestVersion     int
+	maxRequestBytes    int
+	maxResponseBytes   uint32
+	tlsConfig          *tls.Config
+	retryAttempts      int
+	retryBase          time.Duration
+	keepAlive          bool
+	idempotent         map[string]bool // per-command overrides of IsIdempotent
+	warn               func(msg string)
+	observer           func(CommandMetrics)
+	versionHandler     func(version int, err error)
+	logger             *slog.Logger
+	codec              Codec
+	versionCheck       bool      // negotiate before the first command; see WithVersionCheck
+	versionOnce        sync.Once // guards the lazy negotiation
+	versionMu          sync.Mutex
+	negotiated         int       // version last reported by "hello", 0 if none; see NegotiatedVersion
+	knownVersion       int       // version the check uses instead of a hello; see WithKnownVersion
+	wireDump           *wireDump // see WithWireDump
+	pageSize           int       // see WithPageSize
+	dialFunc           DialFunc
+	tracer             oteltrace.Tracer
+	checkSocketPath    bool // stat Unix socket paths before dialing (default dialer only)
+
+	ioMu    sync.Mutex
+	ioStats IOStats
+
+	connMu sync.Mutex // serializes requests in keep-alive mode
+	conn   net.Conn   // persistent connection (keep-alive mode only)
+}
+
+// Option configures optional Client behaviour.
+type Option func(*Client)
+
+// DialFunc opens a connection to addr on network, as net.Dialer.DialContext
+// does. network and addr are the values returned by ParseAddress.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithStrictLengthPrefix makes the client fail a request when the server sends
+// any bytes beyond the declared response length. It is intended for protocol
+// conformance testing and adds a short wait after every response.
+func WithStrictLengthPrefix() Option {
+	return func(c *Client) {
+		c.strictLengthPrefix = true
+	}
+}
+
+// WithCompression sets the compress flag on every request, asking the core to
+// gzip large response bodies, which it marks with the high bit of the length
+// prefix. This pays off for big session lists and streamed audit dumps.
+// Requests are still sent uncompressed unless WithRequestCompression is also
+// given, and a core that ignores the flag answers with plain frames, which
+// are read as before.
+func WithCompression() Option {
+	return func(c *Client) {
+		c.compression = true
+	}
+}
+
+// WithRequestCompression makes the client gzip request bodies of at least
+// MinCompressBytes, e.g. a large policy to validate, and mark them with the
+// high bit of the length prefix as the core marks compressed responses.
+// Smaller requests are sent plain. Only use it with a core that reads
+// compressed requests: one that does not takes the flagged length for an
+// oversized frame and rejects the request.
+func WithRequestCompression() Option {
+	return func(c *Client) {
+		c.requestCompression = true
+	}
+}
+
+// WithDryRun makes the client hand every marshaled request body to fn
+// instead of sending it, and fail the call with ErrDryRun without dialing.
+// The body is exactly what would follow the 4-byte length prefix, so
+// operators can preview what a destructive command would send.
+func WithDryRun(fn func(body []byte)) Option {
+	return func(c *Client) {
+		c.dryRun = fn
+	}
+}
+
+// WithStrictStats makes GetStats return ErrNonFiniteStat when the server
+// reports NaN or Inf for qps or block_rate. By default such values are
+// replaced with 0 and reported through the warning handler.
+func WithStrictStats() Option {
+	return func(c *Client) {
+		c.strictStats = true
+	}
+}
+
+// WithWarningHandler registers fn to receive non-fatal warnings, such as a
+// non-finite stats value that was replaced with 0. Warnings are dropped when
+// no handler is set.
+func WithWarningHandler(fn func(msg string)) Option {
+	return func(c *Client) {
+		c.warn = fn
+	}
+}
+
+// WithObserver registers fn to receive the timing of every command after it
+// completes, successful or not, so callers can tell whether slowness is in
+// the core or the connection. fn runs on the calling goroutine; a panic in fn
+// is recovered and reported through the warning handler.
+func WithObserver(fn func(CommandMetrics)) Option {
+	return func(c *Client) {
+		c.observer = fn
+	}
+}
+
+// WithLogger makes the client log each command to logger: the command and
+// address at Info, the framed byte counts and round-trip duration at Debug,
+// and a hex dump of the start of each response at LevelTrace. By default, or
+// with a nil logger, nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		if logger == nil {
+			logger = slog.New(slog.DiscardHandler)
+		}
+		c.logger = logger
+	}
+}
+
+// WithReadBudget bounds the time allowed to read a complete response, measured
+// from the moment the request has been written. It protects against servers
+// that declare a large frame and then dribble bytes slowly. The budget never
+// extends the overall request timeout; 0 disables it.
+func WithReadBudget(d time.Duration) Option {
+	return func(c *Client) {
+		c.readBudget = d
+	}
+}
+
+// WithIdleReadTimeout switches response reads to an adaptive deadline: the
+// read deadline is pushed out by d every time response bytes arrive, so a
+// large but steadily flowing response is not cut off by the overall request
+// timeout, while a stalled one still fails after d of silence. A read budget
+// set with WithReadBudget remains a hard cap. 0 disables idle-based reads.
+func WithIdleReadTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.idleReadTimeout = d
+	}
+}
+
+// WithDialTimeout limits connecting, including the TLS handshake, to d, so an
+// unreachable server fails fast instead of using up the request timeout. The
+// limit never extends the overall request timeout; 0 disables it.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = d
+	}
+}
+
+// WithWriteTimeout gives writing the request a fresh deadline of d, set when
+// the write starts. The deadline never extends the overall request timeout;
+// 0 disables it.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.writeTimeout = d
+	}
+}
+
+// WithReadTimeout gives reading the response a fresh deadline of d, set once
+// the request has been written, so time spent dialing does not shorten it.
+// Streamed responses get a fresh deadline per frame. The deadline never
+// extends the overall request timeout, so raise that as well for large
+// payloads; 0 disables it. With WithReadBudget the earlier limit wins.
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.readTimeout = d
+	}
+}
+
+// WithRequestVersion overrides CommandRequest.Version on every request sent by
+// the client, which defaults to ProtocolVersion. It lets operators probe how a
+// server handles older or newer protocol versions. 0 omits the field so the
+// server assumes version 1.
+func WithRequestVersion(v int) Option {
+	return func(c *Client) {
+		c.requestVersion = v
+	}
+}
+
+// WithMaxRequestBytes overrides MaxRequestBytes, the largest marshaled
+// request body the client will send.
+func WithMaxRequestBytes(n int) Option {
+	return func(c *Client) {
+		c.maxRequestBytes = n
+	}
+}
+
+// WithMaxResponseBytes overrides MaxResponseBytes, the largest response frame
+// the client will read. A larger declared length fails with an error matching
+// ErrResponseTooLarge before any body bytes are read. A limit above
+// MaxFrameLength is lowered to it.
+func WithMaxResponseBytes(n uint32) Option {
+	return func(c *Client) {
+		c.maxResponseBytes = min(n, MaxFrameLength)
+	}
+}
+
+// WithDialer makes the client open connections with dial instead of a plain
+// net.Dialer, e.g. to go through a SOCKS proxy in TCP mode or to hand tests an
+// in-memory net.Pipe. TLS, when configured, is still layered on top. A nil
+// dial restores the default.
+func WithDialer(dial DialFunc) Option {
+	return func(c *Client) {
+		c.dialFunc = dial
+	}
+}
+
+// WithTLSConfig wraps tcp:// connections in TLS using cfg. If cfg has no
+// ServerName, the host part of the address is used for verification. Unix
+// socket connections are never wrapped.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithRetry retries a request up to maxAttempts times in total when the dial
+// fails or the server closes the connection before responding, waiting an
+// exponentially growing, jittered delay starting at base between attempts.
+// All attempts share the client timeout. maxAttempts <= 1 disables retries.
+// Commands that are not idempotent (see IsIdempotent) are only retried when
+// the request cannot have reached the server. Idempotent commands are also
+// retried when the core answers CodeBusy, after its retry_after_ms if given.
+func WithRetry(maxAttempts int, base time.Duration) Option {
+	return func(c *Client) {
+		c.retryAttempts = maxAttempts
+		c.retryBase = base
+	}
+}
+
+// WithAttemptTimeout bounds each attempt made under WithRetry to d, while the
+// client timeout keeps bounding all attempts combined. An attempt cut off by
+// d is retried like a dropped connection, as long as the overall budget
+// allows. The core may have processed a request whose reply timed out, so a
+// retried command can run more than once. 0 lets one attempt use the whole
+// client timeout.
+func WithAttemptTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.attemptTimeout = d
+	}
+}
+
+// WithTCPKeepAlive enables TCP keepalive probes every d on tcp://
+// connections, so that middleboxes do not reap a connection kept idle by
+// WithKeepAlive. Unix socket connections are not affected. 0 keeps the
+// dialer's default.
+func WithTCPKeepAlive(d time.Duration) Option {
+	return func(c *Client) {
+		c.tcpKeepAlive = d
+	}
+}
+
+// WithKeepAlive keeps one connection open across requests instead of dialing
+// per request. Requests are serialized on that connection. If the server has
+// closed it in the meantime, the client redials once and resends the request;
+// a command that is not idempotent (see IsIdempotent) is resent only if
+// writing it failed, since a response lost after a successful write may
+// belong to a request the server already carried out. Call Close to release
+// the connection.
+//
+// The current dbgate core closes the connection after each response, so
+// against it every request after the first pays one failed write or read
+// before redialing; keep-alive pays off with cores that keep connections open.
+func WithKeepAlive() Option {
+	return func(c *Client) {
+		c.keepAlive = true
+	}
+}
+
+// WithIdempotent overrides IsIdempotent for cmd on this client, so commands
+// sent with SendCommandArgs or Do that this package does not know can be
+// marked safe to resend, or known ones marked unsafe.
+func WithIdempotent(cmd string, idempotent bool) Option {
+	return func(c *Client) {
+		if c.idempotent == nil {
+			c.idempotent = make(map[string]bool)
+		}
+		c.idempotent[cmd] = idempotent
+	}
+}
+
+// NewClient returns a new Client that connects to addr, which is either a
+// bare Unix socket path, "unix:///path/to.sock", or "tcp://host:port".
+// timeout applies to the entire round-trip (dial + write + read); WithDialTimeout,
+// WithWriteTimeout and WithReadTimeout add tighter per-phase limits within it.
+func NewClient(addr string, timeout time.Duration, opts ...Option) *Client {
+	c := &Client{
+		addr:             addr,
+		timeout:          timeout,
+		requestVersion:   ProtocolVersion,
+		maxRequestBytes:  MaxRequestBytes,
+		maxResponseBytes: MaxResponseBytes,
+		logger:           slog.New(slog.DiscardHandler),
+		codec:            stdlibCodec{},
+	}
+	c.network, c.address, c.addrErr = ParseAddress(addr)
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.dialFunc == nil {
+		c.dialFunc = (&net.Dialer{}).DialContext
+		c.checkSocketPath = true
+	}
+	return c
+}
+
+// tlsConfigFor returns the client's TLS config with ServerName defaulted to the
+// host being dialed.
+func (c *Client) tlsConfigFor() *tls.Config {
+	if c.tlsConfig.ServerName != "" {
+		return c.tlsConfig
+	}
+	cfg := c.tlsConfig.Clone()
+	if host, _, err := net.SplitHostPort(c.address); err == nil {
+		cfg.ServerName = host
+	}
+	return cfg
+}
+
+// ParseAddress splits a client address into the network and dial address.
+// A bare path or "unix://" URL selects a Unix socket; "tcp://host:port"
+// selects TCP. Any other scheme is an error.
+//
+// A socket path starting with "@" names a socket in the Linux abstract
+// namespace, which needs no filesystem cleanup; the dial address then starts
+// with a NUL byte instead. Other platforms reject such paths.
+func ParseAddress(addr string) (network, address string, err error) {
+	scheme, rest, ok := strings.Cut(addr, "://")
+	if !ok {
+		return unixAddress(addr, addr)
+	}
+	switch scheme {
+	case "unix":
+		if rest == "" {
+			return "", "", fmt.Errorf("invalid address %q: missing socket path", addr)
+		}
+		return unixAddress(addr, rest)
+	case "tcp":
+		if _, _, err := net.SplitHostPort(rest); err != nil {
+			return "", "", fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+		return "tcp", rest, nil
+	default:
+		return "", "", fmt.Errorf("invalid address %q: unsupported scheme %q (want unix or tcp)", addr, scheme)
+	}
+}
+
+// unixAddress returns the dial address for the Unix socket path, mapping an
+// "@name" path to the abstract namespace. addr is used in error messages.
+func unixAddress(addr, path string) (network, address string, err error) {
+	name, abstract := strings.CutPrefix(path, "@")
+	if !abstract {
+		return "unix", path, nil
+	}
+	if !abstractSockets {
+		return "", "", fmt.Errorf("invalid address %q: abstract Unix sockets are only supported on Linux", addr)
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("invalid address %q: missing abstract socket name", addr)
+	}
+	return "unix", "\x00" + name, nil
+}
+
+// SendCommand sends a simple command (no payload) to the C++ dbgate core and
+// returns the parsed Response. The connection is closed after each call
+// unless WithKeepAlive is set.
+func (c *Client) SendCommand(cmd string) (*Response, error) {
+	return c.SendCommandArgs(cmd, nil)
+}
+
+// SendCommandArgs is like SendCommand but also sends args as the request's
+// "args" object. A nil or empty args map is omitted from the wire format.
+func (c *Client) SendCommandArgs(cmd string, args map[string]interface{}) (*Response, error) {
+	return c.sendRequest(context.Background(), CommandRequest{Command: cmd, Args: args})
+}
+
+// SendCommandContext is like SendCommand but honors ctx for dial, write, and
+// read. The effective deadline is the earlier of ctx's deadline and the client
+// timeout. Cancelling ctx aborts an in-flight request; the returned error then
+// wraps ctx.Err().
+func (c *Client) SendCommandContext(ctx context.Context, cmd string) (*Response, error) {
+	return c.sendRequest(ctx, CommandRequest{Command: cmd})
+}
+
+// Do sends cmd with args, bounded by ctx and the client timeout, and decodes
+// the response payload into out, which must be a pointer as for
+// json.Unmarshal. It lets callers use commands this package has no typed
+// method for. A nil out discards the payload, and a missing payload leaves
+// out untouched. If the core answers ok:false, Do returns the server error
+// (see Response.Err), so errors.Is works with ErrNotImplemented.
+func (c *Client) Do(ctx context.Context, cmd string, args map[string]interface{}, out interface{}) error {
+	resp, err := c.sendRequest(ctx, CommandRequest{Command: cmd, Args: args})
+	if err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("%s: %w", cmd, resp.Err())
+	}
+	if out == nil || resp.Payload == nil {
+		return nil
+	}
+
+	if err := c.decodePayload(resp.Payload, out); err != nil {
+		return &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("%s: %w", cmd, err)}
+	}
+	return nil
+}
+
+// sendRequest performs a single request/response exchange bounded by ctx and
+// the client timeout. If the exchange fails after ctx is done, the returned
+// error wraps ctx.Err() as well as the underlying I/O error. Timeouts also
+// match ErrTimeout.
+//
+// With WithVersionCheck the first request is preceded by the version check,
+// whose hello has a budget of its own; the client timeout of req starts once
+// it is done.
+func (c *Client) sendRequest(ctx context.Context, req CommandRequest) (resp *Response, err error) {
+	if req.Command != "hello" {
+		c.checkVersion(ctx)
+	}
+	return c.send(ctx, req, c.retryAttempts)
+}
+
+// send encodes req and sends it in up to attempts attempts (see
+// roundTripWithRetry), without the version check.
+func (c *Client) send(ctx context.Context, req CommandRequest, attempts int) (resp *Response, err error) {
+	ctx, finish := c.startTrace(ctx, req.Command)
+	defer func() { finish(err) }()
+
+	body, err := c.encodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = c.roundTripWithRetry(ctx, body, c.isIdempotent(req.Command), attempts)
+	if err != nil {
+		return nil, transportErr(ctx, err)
+	}
+	return resp, nil
+}
+
+// trace follows one command through dial and exchange on behalf of the
+// observer, the tracer and the logger.
+type trace struct {
+	metrics CommandMetrics
+	log     *slog.Logger // the client logger with the command attached
+}
+
+// traceKey is the context key under which startTrace stores the *trace of the
+// current command.
+type traceKey struct{}
+
+// startTrace begins tracing cmd when an observer or tracer is registered or
+// the logger is enabled. The returned context carries the trace so dial and
+// exchange can add their phases, and finish completes it with the command's
+// error, ends the span, logs the outcome and hands the metrics to the
+// observer. Otherwise ctx is returned unchanged and finish does nothing.
+func (c *Client) startTrace(ctx context.Context, cmd string) (context.Context, func(error)) {
+	if c.observer == nil && c.tracer == nil && !c.logger.Enabled(ctx, slog.LevelInfo) {
+		return ctx, func(error) {}
+	}
+	t := &trace{metrics: CommandMetrics{Command: cmd}, log: c.logger.With("command", cmd)}
+	t.log.InfoContext(ctx, "sending command", "addr", c.addr)
+	ctx, endSpan := c.startSpan(ctx, cmd)
+	start := time.Now()
+	return context.WithValue(ctx, traceKey{}, t), func(err error) {
+		t.metrics.TotalDuration = time.Since(start)
+		t.metrics.Err = err
+		endSpan(t.metrics)
+		if err != nil {
+			t.log.DebugContext(ctx, "command failed", "duration", t.metrics.TotalDuration, "err", err)
+		} else {
+			t.log.DebugContext(ctx, "command done", "duration", t.metrics.TotalDuration)
+		}
+		if c.observer != nil {
+			c.observe(t.metrics)
+		}
+	}
+}
+
+// observe calls the observer, recovering from a panic in it so a faulty
+// callback cannot break the request path.
+func (c *Client) observe(m CommandMetrics) {
+	defer func() {
+		if r := recover(); r != nil {
+			if c.warn != nil {
+				c.warn(fmt.Sprintf("observer panicked on %q: %v", m.Command, r))
+			}
+		}
+	}()
+	c.observer(m)
+}
+
+// traceFrom returns the trace carried by ctx, or nil if the command is not
+// being traced.
+func traceFrom(ctx context.Context) *trace {
+	t, _ := ctx.Value(traceKey{}).(*trace)
+	return t
+}
+
+// transportErr annotates an exchange error with ctx.Err() when ctx is done
+// and marks timeouts with ErrTimeout.
+func transportErr(ctx context.Context, err error) error {
+	if ctxErr := contextErr(ctx, err); ctxErr != nil && !errors.Is(err, ctxErr) {
+		err = fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		err = &kindError{kind: ErrTimeout, err: err}
+	}
+	return err
+}
+
+// encodeRequest stamps the protocol version on req and marshals it. Empty or
+// oversized bodies are rejected here, before any connection is made. In dry
+// run mode the body goes to the hook and ErrDryRun is returned, which stops
+// every send path before it dials.
+func (c *Client) encodeRequest(req CommandRequest) ([]byte, error) {
+	if c.requestVersion != 0 {
+		req.Version = c.requestVersion
+	}
+	if c.compression {
+		req.Compress = true
+	}
+
+	body, err := c.codec.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	if len(body) == 0 {
+		return nil, fmt.Errorf("marshal request %q: empty body", req.Command)
+	}
+	if len(body) > c.maxRequestBytes {
+		return nil, fmt.Errorf("%w: %q is %d bytes, limit is %d", ErrRequestTooLarge, req.Command, len(body), c.maxRequestBytes)
+	}
+	if c.dryRun != nil {
+		c.dryRun(body)
+		return nil, ErrDryRun
+	}
+	return body, nil
+}
+
+// contextErr returns ctx.Err(), or context.DeadlineExceeded when err is a
+// connection deadline that fired at ctx's deadline before ctx itself noticed.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// roundTripWithRetry bounds all attempts by the client timeout, and each one
+// by the attempt timeout if set, and retries transient failures (see
+// isRetryable) and, for idempotent commands, attempts that hit their own
+// timeout with exponential backoff and jitter, making up to attempts attempts
+// (see WithRetry). Idempotent commands the core answers as busy are retried too, waiting the
+// response's retry_after_ms when it sends one. A backoff that would outlast
+// the remaining budget is not started; the last error, or busy response, is
+// returned instead.
+func (c *Client) roundTripWithRetry(parent context.Context, body []byte, idempotent bool, attempts int) (*Response, error) {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		resp, attemptTimedOut, err := c.attempt(ctx, body, idempotent)
+		busy := err == nil && idempotent && resp.busy()
+		if attempt >= attempts || err == nil && !busy ||
+			err != nil && !isRetryable(err, idempotent) && !(attemptTimedOut && idempotent) {
+			return resp, err
+		}
+
+		delay := retryDelay(c.retryBase, attempt)
+		if busy && resp.RetryAfterMs > 0 {
+			delay = min(time.Duration(resp.RetryAfterMs)*time.Millisecond, maxRetryDelay)
+		}
+		if err != nil {
+			resp = nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt runs one round trip bounded by the attempt timeout, if any. It
+// reports whether the attempt failed because its own timeout expired while
+// ctx, the overall budget, was still live.
+func (c *Client) attempt(ctx context.Context, body []byte, idempotent bool) (*Response, bool, error) {
+	if c.attemptTimeout <= 0 {
+		resp, err := c.timedRoundTrip(ctx, body, idempotent)
+		return resp, false, err
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, c.attemptTimeout)
+	defer cancel()
+	resp, err := c.timedRoundTrip(attemptCtx, body, idempotent)
+	timedOut := err != nil && contextErr(ctx, err) == nil && errors.Is(contextErr(attemptCtx, err), context.DeadlineExceeded)
+	return resp, timedOut, err
+}
+
+// timedRoundTrip is roundTrip recording its duration in the response's rtt.
+func (c *Client) timedRoundTrip(ctx context.Context, body []byte, idempotent bool) (*Response, error) {
+	start := time.Now()
+	resp, err := c.roundTrip(ctx, body, idempotent)
+	if resp != nil {
+		resp.rtt = time.Since(start)
+	}
+	return resp, err
+}
+
+// isRetryable reports whether err is a transient transport failure that is
+// safe to retry: the dial failed, including on a missing socket path, or the
+// server closed the connection before sending any response bytes. For a
+// command that is not idempotent the close must have happened while writing
+// the request; once it was written the server may have acted on it. Server
+// answers, including ok:false, are never retried.
+func isRetryable(err error, idempotent bool) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" || errors.Is(err, ErrSocketNotFound) {
+		return true
+	}
+	if !errors.Is(err, ErrNoResponse) {
+		return false
+	}
+	var protoErr *ProtocolError
+	return idempotent || errors.As(err, &protoErr) && protoErr.Phase == PhaseWrite
+}
+
+// idempotentCommands lists the commands that only read state, so resending
+// one whose response was lost cannot change anything on the core.
+var idempotentCommands = map[string]bool{
+	"audit_tail":      true,
+	"capabilities":    true,
+	"health":          true,
+	"hello":           true,
+	"ping":            true,
+	"policy_eval":     true,
+	"policy_explain":  true,
+	"policy_show":     true,
+	"policy_validate": true,
+	"policy_versions": true,
+	"sessions":        true,
+	"stats":           true,
+	"version":         true,
+}
+
+// IsIdempotent reports whether cmd is safe to resend after a connection was
+// lost with the request possibly delivered: true for the read-only commands
+// such as "stats", "sessions", "ping" and "health", false for commands that
+// change state such as "kill_session", "stats_reset" and "policy_reload",
+// and false for commands this package does not know. See WithIdempotent.
+func IsIdempotent(cmd string) bool {
+	return idempotentCommands[cmd]
+}
+
+// isIdempotent is IsIdempotent with the client's WithIdempotent overrides.
+func (c *Client) isIdempotent(cmd string) bool {
+	if v, ok := c.idempotent[cmd]; ok {
+		return v
+	}
+	return IsIdempotent(cmd)
+}
+
+// checkSocketPath returns an error matching ErrSocketNotFound if path does
+// not exist and one matching ErrNotASocket if it is not a socket. Other stat
+// failures, such as permission errors, are left for the dial to report.
+func checkSocketPath(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s does not exist", ErrSocketNotFound, path)
+	}
+	if err != nil {
+		return nil
+	}
+	switch {
+	case fi.Mode().Type() == fs.ModeSocket:
+		return nil
+	case fi.IsDir():
+		return fmt.Errorf("%w: %s is a directory", ErrNotASocket, path)
+	default:
+		return fmt.Errorf("%w: %s is a %s", ErrNotASocket, path, fileKind(fi.Mode()))
+	}
+}
+
+// fileKind names the type of a file that is neither a socket nor a
+// directory, for checkSocketPath's errors.
+func fileKind(mode fs.FileMode) string {
+	switch mode.Type() {
+	case 0:
+		return "regular file"
+	case fs.ModeNamedPipe:
+		return "named pipe"
+	case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+		return "device"
+	}
+	return "non-socket file"
+}
+
+// isConnClosed reports whether err means the peer closed or reset the
+// connection.
+func isConnClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// retryDelay returns the backoff before retry number attempt (1-based):
+// base doubled per attempt, with up to 50% random jitter subtracted.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	d := base << (attempt - 1)
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d - rand.N(d/2+1) // #nosec G404 -- jitter does not need a CSPRNG
+}
+
+// roundTrip performs one request/response exchange, on a fresh connection or,
+// with WithKeepAlive, on the client's persistent connection.
+func (c *Client) roundTrip(ctx context.Context, body []byte, idempotent bool) (*Response, error) {
+	if c.keepAlive {
+		return c.keepAliveRoundTrip(ctx, body, idempotent)
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	return c.exchange(ctx, conn, body)
+}
+
+// keepAliveRoundTrip runs the exchange on the persistent connection, dialing
+// it first if needed. If a reused connection turns out to have been closed by
+// the server while idle, it redials once and repeats the request, provided
+// isRetryable allows it for the command. Any failure drops the connection so
+// the next call starts fresh.
+func (c *Client) keepAliveRoundTrip(ctx context.Context, body []byte, idempotent bool) (*Response, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	reused := c.conn != nil
+	if !reused {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	resp, err := c.exchange(ctx, c.conn, body)
+	if err != nil && reused && isRetryable(err, idempotent) {
+		c.closeConnLocked()
+		conn, dialErr := c.dial(ctx)
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		c.conn = conn
+		resp, err = c.exchange(ctx, c.conn, body)
+	}
+	if err != nil {
+		c.closeConnLocked()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// closeConnLocked closes and forgets the persistent connection.
+// c.connMu must be held.
+func (c *Client) closeConnLocked() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// Close closes the persistent connection opened by WithKeepAlive, if any.
+// The client remains usable; the next request dials again.
+func (c *Client) Close() error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// dial connects to the client's address and, for TLS-enabled TCP addresses,
+// completes the TLS handshake. A Unix socket path is checked first, unless a
+// custom dialer is set, so that a missing path or one that is not a socket
+// fails with ErrSocketNotFound or ErrNotASocket instead of a bare dial error.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	if t := traceFrom(ctx); t != nil {
+		defer func(start time.Time) { t.metrics.DialDuration += time.Since(start) }(time.Now())
+	}
+	if c.addrErr != nil {
+		return nil, &ProtocolError{Phase: PhaseDial, Err: &kindError{kind: ErrConnect, err: fmt.Errorf("connect to %s: %w", c.addr, c.addrErr)}}
+	}
+	if c.checkSocketPath && c.network == "unix" && !strings.HasPrefix(c.address, "\x00") {
+		if err := checkSocketPath(c.address); err != nil {
+			return nil, &ProtocolError{Phase: PhaseDial, Err: &kindError{kind: ErrConnect, err: fmt.Errorf("connect to %s: %w", c.addr, err)}}
+		}
+	}
+	if c.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+	}
+	conn, err := c.dialFunc(ctx, c.network, c.address)
+	if err != nil {
+		return nil, &ProtocolError{Phase: PhaseDial, Err: &kindError{kind: ErrConnect, err: fmt.Errorf("connect to %s: %w", c.addr, err)}}
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok && c.tcpKeepAlive > 0 {
+		if err := setTCPKeepAlive(tcpConn, c.tcpKeepAlive); err != nil {
+			_ = conn.Close()
+			return nil, &ProtocolError{Phase: PhaseDial, Err: &kindError{kind: ErrConnect, err: fmt.Errorf("connect to %s: %w", c.addr, err)}}
+		}
+	}
+
+	if c.tlsConfig != nil && c.network == "tcp" {
+		tlsConn := tls.Client(conn, c.tlsConfigFor())
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, &ProtocolError{Phase: PhaseDial, Err: &kindError{kind: ErrConnect, err: fmt.Errorf("tls handshake with %s: %w", c.addr, err)}}
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// setTCPKeepAlive turns on keepalive probes every period on conn.
+func setTCPKeepAlive(conn *net.TCPConn, period time.Duration) error {
+	if err := conn.SetKeepAlive(true); err != nil {
+		return fmt.Errorf("enable tcp keepalive: %w", err)
+	}
+	if err := conn.SetKeepAlivePeriod(period); err != nil {
+		return fmt.Errorf("set tcp keepalive period: %w", err)
+	}
+	return nil
+}
+
+// exchange writes the marshaled request body as a framed message on conn,
+// reads the framed response, and returns the parsed Response. It does not
+// close conn.
+func (c *Client) exchange(ctx context.Context, conn net.Conn, body []byte) (*Response, error) {
+	// Deadlines are enforced through the connection deadline below (which the
+	// idle-read mode may relax); cancellation must interrupt blocked I/O
+	// immediately, so expire the connection deadline when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			_ = conn.SetDeadline(time.Now())
+		}
+	})
+	defer stop()
+
+	// Apply deadline derived from context to the underlying connection.
+	deadline, ok := ctx.Deadline()
+	if ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, fmt.Errorf("set deadline: %w", err)
+		}
+	}
+
+	t := traceFrom(ctx)
+	start := time.Now()
+	c.addIO(func(s *IOStats) { s.Requests++ })
+	if c.writeTimeout > 0 {
+		if err := conn.SetWriteDeadline(phaseDeadline(ctx, c.writeTimeout)); err != nil {
+			return nil, fmt.Errorf("set write deadline: %w", err)
+		}
+	}
+	cw := &countingWriter{w: conn, c: c}
+	err := c.sendFrame(cw, body)
+	if t != nil {
+		t.metrics.WriteDuration += time.Since(start)
+		t.metrics.BytesSent += cw.n
+		start = time.Now()
+		defer func() { t.metrics.ReadDuration += time.Since(start) }()
+	}
+	if err != nil {
+		if isConnClosed(err) {
+			err = fmt.Errorf("write request: %w: %w", ErrNoResponse, err)
+		} else {
+			err = fmt.Errorf("write request: %w", err)
+		}
+		return nil, &ProtocolError{Phase: PhaseWrite, Err: err}
+	}
+
+	var budgetDeadline time.Time
+	if c.readBudget > 0 {
+		budgetDeadline = time.Now().Add(c.readBudget)
+	}
+	if c.readTimeout > 0 {
+		if d := time.Now().Add(c.readTimeout); budgetDeadline.IsZero() || d.Before(budgetDeadline) {
+			budgetDeadline = d
+		}
+	}
+
+	// readDeadline bounds the whole response read: the read budget or the
+	// request deadline, whichever comes first. The idle-read mode manages
+	// its own deadlines instead.
+	readDeadline := budgetDeadline
+	if deadline, ok := ctx.Deadline(); ok && (readDeadline.IsZero() || deadline.Before(readDeadline)) {
+		readDeadline = deadline
+	}
+	var respReader io.Reader = conn
+	var beforeBody func() error
+	if c.idleReadTimeout > 0 {
+		respReader = &idleReader{ctx: ctx, conn: conn, idle: c.idleReadTimeout, hardDeadline: budgetDeadline}
+	} else if !readDeadline.IsZero() {
+		if err := armReadDeadline(ctx, conn, readDeadline); err != nil {
+			return nil, fmt.Errorf("set read deadline: %w", err)
+		}
+		// A header can advertise a body far larger than the peer will send
+		// in time. Re-arm the deadline before reading it, so that a body
+		// dribbled in byte by byte still fails at readDeadline whatever
+		// happened to the connection's deadline since.
+		beforeBody = func() error {
+			if err := armReadDeadline(ctx, conn, readDeadline); err != nil {
+				return fmt.Errorf("set body read deadline: %w", err)
+			}
+			return nil
+		}
+	}
+
+	cr := &countingReader{r: respReader, c: c}
+	respBody, err := c.receiveFrame(cr, false, beforeBody)
+	if t != nil {
+		t.metrics.BytesReceived += cr.n
+	}
+	if err != nil && cr.n == 0 && isConnClosed(err) {
+		// Closed before any response bytes: the request was likely not
+		// processed (e.g. the core is restarting).
+		return nil, fmt.Errorf("read response: %w: %w", ErrNoResponse, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if t != nil {
+		t.logExchange(ctx, len(body), respBody)
+	}
+
+	var resp Response
+	if err := c.codec.Unmarshal(respBody, &resp); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("parse response JSON: %w", err)}
+	}
+	resp.normalizeCode()
+
+	// A streamed response is followed by item frames, which are expected.
+	if c.strictLengthPrefix && !resp.Stream {
+		if err := checkNoTrailingBytes(ctx, conn, len(respBody)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &resp, nil
+}
+
+// armReadDeadline sets the read deadline of conn without undoing a
+// cancellation: if ctx was cancelled before the deadline was set, the
+// deadline is expired again, as exchange's cancel hook did.
+func armReadDeadline(ctx context.Context, conn net.Conn, deadline time.Time) error {
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return conn.SetReadDeadline(time.Now())
+	}
+	return nil
+}
+
+// phaseDeadline returns the deadline for a phase limited to d, starting now,
+// capped at ctx's deadline.
+func phaseDeadline(ctx context.Context, d time.Duration) time.Time {
+	deadline := time.Now().Add(d)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// logExchange logs the framed sizes of a completed exchange at debug level
+// and, at LevelTrace, a hex dump of the first logDumpBytes of the response.
+func (t *trace) logExchange(ctx context.Context, reqLen int, respBody []byte) {
+	t.log.DebugContext(ctx, "exchange done",
+		"bytes_written", frameHeaderLen+reqLen, "bytes_read", frameHeaderLen+len(respBody))
+	if t.log.Enabled(ctx, LevelTrace) {
+		dump := respBody[:min(len(respBody), logDumpBytes)]
+		t.log.Log(ctx, LevelTrace, "response body", "dump_bytes", len(dump), "hex", hex.Dump(dump))
+	}
+}
+
+// PolicyExplain sends a "policy_explain" command with the given SQL, user, and
+// sourceIP and returns the decoded PolicyExplainResult.
+// This is a dry-run evaluation — no actual blocking occurs.
+func (c *Client) PolicyExplain(sql, user, sourceIP string) (*PolicyExplainResult, error) {
+	req := CommandRequest{
+		Command: "policy_explain",
+		Payload: PolicyExplainRequest{
+			SQL:      sql,
+			User:     user,
+			SourceIP: sourceIP,
+		},
+	}
+	resp, err := c.sendRequest(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("policy_explain: %w", resp.Err())
+	}
+	var result PolicyExplainResult
+	if err := c.decodePayload(resp.Payload, &result); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("policy_explain: %w", err)}
+	}
+
+	return &result, nil
+}
+
+// EvalPolicy sends a "policy_eval" command asking the policy engine whether
+// query, run against database db, would be allowed. It returns
+// ErrNotImplemented if the core does not support policy_eval.
+func (c *Client) EvalPolicy(query, db string) (PolicyDecision, error) {
+	req := CommandRequest{
+		Command: "policy_eval",
+		Payload: PolicyEvalRequest{Query: query, DB: db},
+	}
+	resp, err := c.sendRequest(context.Background(), req)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	if !resp.OK {
+		return PolicyDecision{}, fmt.Errorf("policy_eval: %w", resp.Err())
+	}
+	var decision PolicyDecision
+	if err := c.decodePayload(resp.Payload, &decision); err != nil {
+		return PolicyDecision{}, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("policy_eval: %w", err)}
+	}
+
+	return decision, nil
+}
+
+// ValidatePolicy sends a "policy_validate" command with contents in
+// args["policy"] and returns the core's verdict. Nothing is applied. It
+// returns an error wrapping ErrNotImplemented if the core does not support
+// the command.
+func (c *Client) ValidatePolicy(contents []byte) (*PolicyValidation, error) {
+	resp, err := c.SendCommandArgs("policy_validate", map[string]interface{}{"policy": string(contents)})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("policy_validate: %w", resp.Err())
+	}
+	var result PolicyValidation
+	if err := c.decodePayload(resp.Payload, &result); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("policy_validate: %w", err)}
+	}
+	return &result, nil
+}
+
+// GetPolicy sends a "policy_show" command and returns the policy document
+// currently loaded by the core. The payload may be the document itself or an
+// object carrying it in "policy". It returns an error wrapping
+// ErrNotImplemented if the core does not support the command.
+func (c *Client) GetPolicy() ([]byte, error) {
+	resp, err := c.SendCommand("policy_show")
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("policy_show: %w", resp.Err())
+	}
+
+	switch p := resp.Payload.(type) {
+	case string:
+		return []byte(p), nil
+	case map[string]interface{}:
+		if doc, ok := p["policy"].(string); ok {
+			return []byte(doc), nil
+		}
+	}
+	return nil, fmt.Errorf("policy_show: response has no policy document")
+}
+
+// ServerVersion sends a "version" command and returns the core's release,
+// build hash and protocol version. It returns an error wrapping
+// ErrNotImplemented if the core does not support the command.
+func (c *Client) ServerVersion() (*VersionInfo, error) {
+	resp, err := c.SendCommand("version")
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("version: %w", resp.Err())
+	}
+	var info VersionInfo
+	if err := c.decodePayload(resp.Payload, &info); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("version: %w", err)}
+	}
+	return &info, nil
 }
 
-// NewClient returns a new Client that connects to socketPath.
-// timeout applies to the entire round-trip (dial + write + read).
-func NewClient(socketPath string, timeout time.Duration) *Client {
-	return &Client{
-		socketPath: socketPath,
-		timeout:    timeout,
+// Capabilities sends a "capabilities" command and returns the sorted names of
+// the commands the core implements. It returns an error wrapping
+// ErrNotImplemented if the core predates the command.
+func (c *Client) Capabilities() ([]string, error) {
+	var result CapabilitiesResult
+	if err := c.Do(context.Background(), "capabilities", nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Commands == nil {
+		return []string{}, nil
 	}
+	slices.Sort(result.Commands)
+	return result.Commands, nil
 }
 
-// SendCommand sends a simple command (no payload) to the C++ dbgate core and
-// returns the parsed Response. The connection is closed after each call.
-func (c *Client) SendCommand(cmd string) (*Response, error) {
-	return c.sendRequest(CommandRequest{Command: cmd})
+// ListSessions sends a "sessions" command and returns the decoded sessions,
+// following the core's pages (see WithPageSize). It returns an error wrapping
+// ErrNotImplemented if the core does not implement the command yet.
+func (c *Client) ListSessions() ([]Session, error) {
+	return c.listSessions(context.Background(), nil)
+}
+
+// listSessions sends a "sessions" command with args and assembles the
+// sessions of every page.
+func (c *Client) listSessions(ctx context.Context, args map[string]interface{}) ([]Session, error) {
+	sessions := []Session{}
+	err := c.paginate(ctx, "sessions", args, func(resp *Response) (string, error) {
+		page, err := c.decodeSessions(resp.Payload)
+		if err != nil {
+			return "", err
+		}
+		sessions = append(sessions, page...)
+		return resp.NextCursor, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// ListSessionsFiltered sends a "sessions" command carrying the set fields of
+// f as args, so the core returns only the matching sessions. A core that
+// ignores the args returns every session; that is noticed by a session that
+// does not match, reported through the warning handler, and the list is
+// filtered client-side instead.
+func (c *Client) ListSessionsFiltered(f SessionFilter) ([]Session, error) {
+	return c.ListSessionsFilteredContext(context.Background(), f)
+}
+
+// ListSessionsFilteredContext is ListSessionsFiltered bounded by ctx as well
+// as the client timeout.
+func (c *Client) ListSessionsFilteredContext(ctx context.Context, f SessionFilter) ([]Session, error) {
+	sessions, err := c.listSessions(ctx, f.args())
+	if err != nil {
+		return nil, err
+	}
+	total := len(sessions)
+	sessions = slices.DeleteFunc(sessions, func(s Session) bool { return !f.Match(s) })
+	if len(sessions) < total {
+		c.warnFilterIgnored(total-len(sessions), total)
+	}
+	return sessions, nil
+}
+
+// warnFilterIgnored reports through the warning handler that the core sent
+// skipped of total sessions that did not match the filter it was given.
+func (c *Client) warnFilterIgnored(skipped, total int) {
+	if c.warn != nil {
+		c.warn(fmt.Sprintf("core ignored the sessions filter; filtered %d of %d sessions client-side", skipped, total))
+	}
 }
 
-// sendRequest marshals req, writes it as a framed UDS message, reads the
-// framed response, and returns the parsed Response.
-// The connection is closed after each call.
-func (c *Client) sendRequest(req CommandRequest) (*Response, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+// decodeSessions converts a "sessions" payload into Sessions. A nil payload
+// yields an empty slice.
+func (c *Client) decodeSessions(payload interface{}) ([]Session, error) {
+	if payload == nil {
+		return []Session{}, nil
+	}
+
+	var raw []rawSession
+	if err := c.decodePayload(payload, &raw); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("sessions: %w", err)}
+	}
+
+	sessions := make([]Session, 0, len(raw))
+	for _, r := range raw {
+		sessions = append(sessions, r.session())
+	}
+	return sessions, nil
+}
+
+// StreamSessions sends a "sessions" command asking for a streamed reply and
+// calls fn for each session as it arrives, so memory stays bounded however
+// many sessions the core reports. A streaming core answers with a header
+// response carrying "stream":true, then one frame per Session and an empty
+// terminating frame. A core that replies with the regular payload is handled
+// too. The stream always uses its own connection and is bounded by ctx and
+// the client timeout. An error returned by fn stops the stream and is
+// returned as is.
+//
+// The set fields of f are sent as args like ListSessionsFiltered does, so
+// the core streams only the matching sessions. Sessions from a core that
+// ignores them are skipped instead of passed to fn, and reported through the
+// warning handler once the stream ends.
+func (c *Client) StreamSessions(ctx context.Context, f SessionFilter, fn func(Session) error) (err error) {
+	c.checkVersion(ctx)
+	ctx, finish := c.startTrace(ctx, "sessions")
+	defer func() { finish(err) }()
+
+	args := f.args()
+	if args == nil {
+		args = make(map[string]interface{}, 1)
+	}
+	args["stream"] = true
+	body, err := c.encodeRequest(CommandRequest{Command: "sessions", Args: args})
+	if err != nil {
+		return err
+	}
+
+	var total, skipped int
+	emit := func(s Session) error {
+		total++
+		if !f.Match(s) {
+			skipped++
+			return nil
+		}
+		return fn(s)
+	}
+	defer func() {
+		if err == nil && skipped > 0 {
+			c.warnFilterIgnored(skipped, total)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
-	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", c.socketPath)
+	conn, err := c.dial(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("connect to %s: %w", c.socketPath, err)
+		return transportErr(ctx, err)
 	}
 	defer func() {
 		_ = conn.Close()
 	}()
 
-	// Apply deadline derived from context to the underlying connection.
-	deadline, ok := ctx.Deadline()
-	if ok {
-		if err := conn.SetDeadline(deadline); err != nil {
-			return nil, fmt.Errorf("set deadline: %w", err)
+	resp, err := c.exchange(ctx, conn, body)
+	if err != nil {
+		return transportErr(ctx, err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("sessions: %w", resp.Err())
+	}
+
+	if !resp.Stream {
+		sessions, err := c.decodeSessions(resp.Payload)
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			if err := emit(s); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 
-	// Marshal request.
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	r := &countingReader{r: conn, c: c}
+	for {
+		if c.readTimeout > 0 {
+			if err := conn.SetReadDeadline(phaseDeadline(ctx, c.readTimeout)); err != nil {
+				return fmt.Errorf("sessions: set read deadline: %w", err)
+			}
+			// A cancellation that expired the deadline before the reset
+			// above must still stop the stream.
+			if err := ctx.Err(); err != nil {
+				return transportErr(ctx, fmt.Errorf("sessions: read stream: %w", err))
+			}
+		}
+		frame, err := c.receiveFrame(r, true, nil)
+		if err != nil {
+			return transportErr(ctx, fmt.Errorf("sessions: read stream: %w", err))
+		}
+		if frame == nil {
+			return nil
+		}
+		var raw rawSession
+		if err := c.codec.Unmarshal(frame, &raw); err != nil {
+			return &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("sessions: parse stream item: %w", err)}
+		}
+		if err := emit(raw.session()); err != nil {
+			return err
+		}
 	}
+}
+
+// KillSession sends a "kill_session" command asking the core to terminate the
+// session with the given ID. It returns an error wrapping ErrNotImplemented if
+// the core does not support the command.
+func (c *Client) KillSession(id string) error {
+	return c.KillSessionContext(context.Background(), id)
+}
 
-	// Write 4-byte LE length prefix.
-	var lenBuf [4]byte
-	if uint64(len(body)) > uint64(^uint32(0)) {
-		return nil, fmt.Errorf("request body too large: %d", len(body))
+// KillSessionContext is like KillSession but honors ctx; see
+// SendCommandContext.
+func (c *Client) KillSessionContext(ctx context.Context, id string) error {
+	resp, err := c.sendRequest(ctx, CommandRequest{Command: "kill_session", Args: map[string]interface{}{"id": id}})
+	if err != nil {
+		return err
 	}
-	reqLen := uint32(len(body)) // #nosec G115 -- bounded by the explicit check above.
-	binary.LittleEndian.PutUint32(lenBuf[:], reqLen)
-	if err := writeFull(conn, lenBuf[:]); err != nil {
-		return nil, fmt.Errorf("write length prefix: %w", err)
+	if !resp.OK {
+		return fmt.Errorf("kill_session %s: %w", id, resp.Err())
 	}
+	return nil
+}
 
-	// Write JSON body.
-	if err := writeFull(conn, body); err != nil {
-		return nil, fmt.Errorf("write request body: %w", err)
+// ResetStats sends a "stats_reset" command asking the core to zero its
+// cumulative counters. It returns an error wrapping ErrNotImplemented if the
+// core does not support the command.
+func (c *Client) ResetStats() error {
+	resp, err := c.SendCommand("stats_reset")
+	if err != nil {
+		return err
 	}
-
-	// Read 4-byte LE length prefix of response.
-	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
-		return nil, fmt.Errorf("read response length: %w", err)
+	if !resp.OK {
+		return fmt.Errorf("stats_reset: %w", resp.Err())
 	}
-	respLen := binary.LittleEndian.Uint32(lenBuf[:])
+	return nil
+}
 
-	const maxResponseBytes = 16 * 1024 * 1024 // 16 MiB guard
-	if respLen == 0 || respLen > maxResponseBytes {
-		return nil, fmt.Errorf("invalid response length %d", respLen)
-	}
+// rawSession mirrors Session as sent by the C++ core, which serialises the
+// start time as started_at_ms (Unix epoch milliseconds), like rawStats.
+type rawSession struct {
+	ID          string `json:"id"`
+	ClientAddr  string `json:"client_addr"`
+	Database    string `json:"database"`
+	User        string `json:"user"`
+	State       string `json:"state"`
+	StartedAtMs int64  `json:"started_at_ms"`
+	QueryCount  uint64 `json:"query_count"`
+
+	LastActivityMs int64 `json:"last_activity_ms"`
+}
+
+// session converts r to a Session.
+func (r rawSession) session() Session {
+	return Session{
+		ID:         r.ID,
+		ClientAddr: r.ClientAddr,
+		Database:   r.Database,
+		User:       r.User,
+		State:      r.State,
+		StartedAt:  time.UnixMilli(r.StartedAtMs).UTC(),
+		QueryCount: r.QueryCount,
 
-	// Read JSON body.
-	respBody := make([]byte, respLen)
-	if _, err := io.ReadFull(conn, respBody); err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
+		LastActivityMs: r.LastActivityMs,
 	}
+}
 
-	var resp Response
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return nil, fmt.Errorf("parse response JSON: %w", err)
+// Negotiate sends a "hello" command and returns the protocol version reported
+// by the server. If that version is newer than ProtocolVersion, the version is
+// returned together with an error wrapping ErrVersionMismatch so callers can
+// decide whether to proceed. A core without "hello" yields ErrNotImplemented.
+func (c *Client) Negotiate() (int, error) {
+	return c.NegotiateContext(context.Background())
+}
+
+// NegotiateContext is like Negotiate but honors ctx; see SendCommandContext.
+func (c *Client) NegotiateContext(ctx context.Context) (int, error) {
+	return c.negotiate(ctx, c.retryAttempts)
+}
+
+// negotiate is Negotiate bounded by ctx, sending the hello in up to attempts
+// attempts.
+func (c *Client) negotiate(ctx context.Context, attempts int) (int, error) {
+	resp, err := c.send(ctx, CommandRequest{Command: "hello"}, attempts)
+	if err != nil {
+		return 0, err
+	}
+	if !resp.OK {
+		return 0, fmt.Errorf("hello: %w", resp.Err())
+	}
+	var hello HelloResult
+	if err := c.decodePayload(resp.Payload, &hello); err != nil {
+		return 0, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("hello: %w", err)}
 	}
+	if hello.Version <= 0 {
+		return 0, fmt.Errorf("hello: invalid server version %d", hello.Version)
+	}
+	c.versionMu.Lock()
+	c.negotiated = hello.Version
+	c.versionMu.Unlock()
+	if hello.Version > ProtocolVersion {
+		return hello.Version, fmt.Errorf("%w: server speaks version %d, client supports up to %d",
+			ErrVersionMismatch, hello.Version, ProtocolVersion)
+	}
+	return hello.Version, nil
+}
 
-	return &resp, nil
+// AuditTail sends an "audit_tail" command and returns up to limit of the most
+// recent entries in the core's audit ring buffer, following the core's pages
+// until limit entries have arrived (see WithPageSize). It returns an error
+// wrapping ErrNotImplemented if the core does not support the command.
+func (c *Client) AuditTail(limit int) ([]AuditEntry, error) {
+	return c.AuditTailSince(limit, time.Time{})
 }
 
-// PolicyExplain sends a "policy_explain" command with the given SQL, user, and
-// sourceIP and returns the decoded PolicyExplainResult.
-// This is a dry-run evaluation — no actual blocking occurs.
-func (c *Client) PolicyExplain(sql, user, sourceIP string) (*PolicyExplainResult, error) {
-	req := CommandRequest{
-		Command: "policy_explain",
-		Payload: PolicyExplainRequest{
-			SQL:      sql,
-			User:     user,
-			SourceIP: sourceIP,
-		},
+// AuditTailSince is like AuditTail but, unless since is the zero time, sends
+// it as args["since_ms"] so the core returns only entries recorded at or
+// after since. A core that ignores the arg is noticed by an older entry,
+// reported through the warning handler, and the entries are filtered
+// client-side instead.
+func (c *Client) AuditTailSince(limit int, since time.Time) ([]AuditEntry, error) {
+	return c.AuditTailSinceContext(context.Background(), limit, since)
+}
+
+// AuditTailSinceContext is like AuditTailSince but honors ctx; see
+// SendCommandContext.
+func (c *Client) AuditTailSinceContext(ctx context.Context, limit int, since time.Time) ([]AuditEntry, error) {
+	args := map[string]interface{}{"limit": limit}
+	if !since.IsZero() {
+		args["since_ms"] = since.UnixMilli()
 	}
-	resp, err := c.sendRequest(req)
+	var entries []AuditEntry
+	err := c.paginate(ctx, "audit_tail", args, func(resp *Response) (string, error) {
+		var page []AuditEntry
+		if resp.Payload != nil {
+			if err := c.decodePayload(resp.Payload, &page); err != nil {
+				return "", &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("audit_tail: %w", err)}
+			}
+		}
+		entries = append(entries, page...)
+		if limit > 0 && len(entries) >= limit {
+			entries = entries[:limit]
+			return "", nil // enough for limit; skip the remaining pages
+		}
+		return resp.NextCursor, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if !resp.OK {
-		errMsg := resp.Error
-		if errMsg == "" {
-			errMsg = "unknown server error"
-		}
-		return nil, fmt.Errorf("policy_explain: server error: %s", errMsg)
+	if since.IsZero() {
+		return entries, nil
 	}
-	if resp.Payload == nil {
-		return nil, fmt.Errorf("policy_explain: response has no payload")
+	sinceMs := since.UnixMilli()
+	total := len(entries)
+	entries = slices.DeleteFunc(entries, func(e AuditEntry) bool { return e.TimestampMs < sinceMs })
+	if len(entries) < total && c.warn != nil {
+		c.warn(fmt.Sprintf("core ignored since_ms; filtered %d of %d audit entries client-side", total-len(entries), total))
 	}
+	return entries, nil
+}
 
-	// Re-marshal the payload interface{} so we can unmarshal into PolicyExplainResult.
-	payloadBytes, err := json.Marshal(resp.Payload)
-	if err != nil {
-		return nil, fmt.Errorf("policy_explain: re-marshal payload: %w", err)
+// AuditRotate sends an "audit_rotate" command asking the core to empty its
+// audit ring buffer, and returns how many entries were flushed. It returns an
+// error wrapping ErrNotImplemented if the core does not support the command.
+func (c *Client) AuditRotate() (uint64, error) {
+	var result AuditRotateResult
+	if err := c.Do(context.Background(), "audit_rotate", nil, &result); err != nil {
+		return 0, err
 	}
+	return result.Flushed, nil
+}
 
-	var result PolicyExplainResult
-	if err := json.Unmarshal(payloadBytes, &result); err != nil {
-		return nil, fmt.Errorf("policy_explain: parse payload: %w", err)
+// SetLogLevel sends a "set_log_level" command changing the core's log level
+// to level, one of LogLevels. An unknown level is rejected without sending
+// anything. It returns an error wrapping ErrNotImplemented if the core does
+// not support the command.
+func (c *Client) SetLogLevel(level string) error {
+	if !slices.Contains(LogLevels, level) {
+		return fmt.Errorf("set_log_level: unknown level %q (want one of %s)", level, strings.Join(LogLevels, ", "))
 	}
+	return c.Do(context.Background(), "set_log_level", map[string]interface{}{"level": level}, nil)
+}
 
-	return &result, nil
+// GetLogLevel sends a "get_log_level" command and returns the core's current
+// log level. It returns an error wrapping ErrNotImplemented if the core does
+// not support the command.
+func (c *Client) GetLogLevel() (string, error) {
+	var result LogLevelResult
+	if err := c.Do(context.Background(), "get_log_level", nil, &result); err != nil {
+		return "", err
+	}
+	return result.Level, nil
 }
 
-// PolicyVersions sends a "policy_versions" command and returns the decoded
-// PolicyVersionsResult containing the current version and version history.
-func (c *Client) PolicyVersions() (*PolicyVersionsResult, error) {
-	resp, err := c.SendCommand("policy_versions")
+// Ping sends a "ping" command and returns the round-trip time of the attempt
+// that got the response, measured from before the dial until the response
+// has been decoded; retries and the version check are not included. It
+// returns an error wrapping ErrNotImplemented if the core does not support
+// the command.
+func (c *Client) Ping() (time.Duration, error) {
+	return c.PingContext(context.Background())
+}
+
+// PingContext is like Ping but honors ctx; see SendCommandContext.
+func (c *Client) PingContext(ctx context.Context) (time.Duration, error) {
+	resp, err := c.SendCommandContext(ctx, "ping")
+	if err != nil {
+		return 0, err
+	}
+	if !resp.OK {
+		return 0, fmt.Errorf("ping: %w", resp.Err())
+	}
+	return resp.rtt, nil
+}
+
+// Health sends a "health" command and returns the decoded HealthReport.
+func (c *Client) Health() (*HealthReport, error) {
+	resp, err := c.SendCommand("health")
 	if err != nil {
 		return nil, err
 	}
 	if !resp.OK {
-		errMsg := resp.Error
-		if errMsg == "" {
-			errMsg = "unknown server error"
-		}
-		return nil, fmt.Errorf("policy_versions: server error: %s", errMsg)
+		return nil, fmt.Errorf("health: %w", resp.Err())
 	}
-	if resp.Payload == nil {
-		return nil, fmt.Errorf("policy_versions: response has no payload")
+	var report HealthReport
+	if err := c.decodePayload(resp.Payload, &report); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("health: %w", err)}
 	}
+	return &report, nil
+}
 
-	payloadBytes, err := json.Marshal(resp.Payload)
+// PolicyVersions sends a "policy_versions" command and returns the decoded
+// PolicyVersionsResult containing the current version and version history.
+func (c *Client) PolicyVersions() (*PolicyVersionsResult, error) {
+	resp, err := c.SendCommand("policy_versions")
 	if err != nil {
-		return nil, fmt.Errorf("policy_versions: re-marshal payload: %w", err)
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("policy_versions: %w", resp.Err())
 	}
-
 	var result PolicyVersionsResult
-	if err := json.Unmarshal(payloadBytes, &result); err != nil {
-		return nil, fmt.Errorf("policy_versions: parse payload: %w", err)
+	if err := c.decodePayload(resp.Payload, &result); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("policy_versions: %w", err)}
 	}
 
 	return &result, nil
@@ -186,29 +1657,16 @@ func (c *Client) PolicyRollback(targetVersion uint64) (*PolicyRollbackResult, er
 		Command: "policy_rollback",
 		Payload: PolicyRollbackRequest{TargetVersion: targetVersion},
 	}
-	resp, err := c.sendRequest(req)
+	resp, err := c.sendRequest(context.Background(), req)
 	if err != nil {
 		return nil, err
 	}
 	if !resp.OK {
-		errMsg := resp.Error
-		if errMsg == "" {
-			errMsg = "unknown server error"
-		}
-		return nil, fmt.Errorf("policy_rollback: server error: %s", errMsg)
-	}
-	if resp.Payload == nil {
-		return nil, fmt.Errorf("policy_rollback: response has no payload")
+		return nil, fmt.Errorf("policy_rollback: %w", resp.Err())
 	}
-
-	payloadBytes, err := json.Marshal(resp.Payload)
-	if err != nil {
-		return nil, fmt.Errorf("policy_rollback: re-marshal payload: %w", err)
-	}
-
 	var result PolicyRollbackResult
-	if err := json.Unmarshal(payloadBytes, &result); err != nil {
-		return nil, fmt.Errorf("policy_rollback: parse payload: %w", err)
+	if err := c.decodePayload(resp.Payload, &result); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("policy_rollback: %w", err)}
 	}
 
 	return &result, nil
@@ -222,92 +1680,344 @@ func (c *Client) PolicyReload() (*PolicyReloadResult, error) {
 		return nil, err
 	}
 	if !resp.OK {
-		errMsg := resp.Error
-		if errMsg == "" {
-			errMsg = "unknown server error"
-		}
-		return nil, fmt.Errorf("policy_reload: server error: %s", errMsg)
+		return nil, fmt.Errorf("policy_reload: %w", resp.Err())
 	}
-	if resp.Payload == nil {
-		return nil, fmt.Errorf("policy_reload: response has no payload")
+	var result PolicyReloadResult
+	if err := c.decodePayload(resp.Payload, &result); err != nil {
+		return nil, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("policy_reload: %w", err)}
 	}
 
-	payloadBytes, err := json.Marshal(resp.Payload)
-	if err != nil {
-		return nil, fmt.Errorf("policy_reload: re-marshal payload: %w", err)
+	return &result, nil
+}
+
+// IOStats returns a snapshot of the client's lifetime request and byte
+// counters. It is safe to call concurrently with requests.
+func (c *Client) IOStats() IOStats {
+	c.ioMu.Lock()
+	defer c.ioMu.Unlock()
+	return c.ioStats
+}
+
+// addIO applies update to the IO counters under the lock.
+func (c *Client) addIO(update func(*IOStats)) {
+	c.ioMu.Lock()
+	defer c.ioMu.Unlock()
+	update(&c.ioStats)
+}
+
+// countingWriter adds every byte written through it to the client's
+// BytesSent counter.
+type countingWriter struct {
+	w io.Writer
+	c *Client
+	n int // bytes written through this writer
+}
+
+// Write implements io.Writer.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += n
+	cw.c.addIO(func(s *IOStats) { s.BytesSent += uint64(n) }) // #nosec G115 -- n is never negative.
+	return n, err
+}
+
+// countingReader adds every byte read through it to the client's
+// BytesReceived counter.
+type countingReader struct {
+	r io.Reader
+	c *Client
+	n int // bytes read through this reader
+}
+
+// Read implements io.Reader.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	cr.c.addIO(func(s *IOStats) { s.BytesReceived += uint64(n) }) // #nosec G115 -- n is never negative.
+	return n, err
+}
+
+// idleReader extends the connection's read deadline by idle before every Read,
+// so the deadline only fires after idle passes without any bytes arriving.
+// A non-zero hardDeadline is never exceeded.
+type idleReader struct {
+	ctx          context.Context
+	conn         net.Conn
+	idle         time.Duration
+	hardDeadline time.Time
+}
+
+// Read implements io.Reader.
+func (r *idleReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); errors.Is(err, context.Canceled) {
+		return 0, err
 	}
+	deadline := time.Now().Add(r.idle)
+	if !r.hardDeadline.IsZero() && r.hardDeadline.Before(deadline) {
+		deadline = r.hardDeadline
+	}
+	if err := r.conn.SetReadDeadline(deadline); err != nil {
+		return 0, fmt.Errorf("set read deadline: %w", err)
+	}
+	return r.conn.Read(p)
+}
 
-	var result PolicyReloadResult
-	if err := json.Unmarshal(payloadBytes, &result); err != nil {
-		return nil, fmt.Errorf("policy_reload: parse payload: %w", err)
+// checkNoTrailingBytes performs a short read after the response body and
+// returns an error if the server sent anything beyond the declared length.
+// A read timeout or EOF both mean the frame was well-formed. The probe never
+// extends past the deadline of ctx.
+func checkNoTrailingBytes(ctx context.Context, conn net.Conn, respLen int) error {
+	probeDeadline := time.Now().Add(strictTrailingWindow)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(probeDeadline) {
+		probeDeadline = deadline
 	}
+	if err := conn.SetReadDeadline(probeDeadline); err != nil {
+		return fmt.Errorf("set trailing-byte probe deadline: %w", err)
+	}
+	var probe [1]byte
+	n, err := conn.Read(probe[:])
+	if n > 0 {
+		return fmt.Errorf("response has trailing bytes beyond declared length %d", respLen)
+	}
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	return fmt.Errorf("probe for trailing bytes: %w", err)
+}
 
-	return &result, nil
+// rawStats is an intermediate struct that handles the C++ serialization quirk:
+// captured_at is sent as captured_at_ms (Unix epoch milliseconds), not as an
+// RFC 3339 string. An RFC 3339 captured_at is accepted too, so a core that
+// switches to it keeps working; see capturedAt. All other fields are
+// identical to StatsSnapshot.
+type rawStats struct {
+	TotalConnections uint64     `json:"total_connections"`
+	ActiveSessions   uint64     `json:"active_sessions"`
+	TotalQueries     uint64     `json:"total_queries"`
+	BlockedQueries   uint64     `json:"blocked_queries"`
+	MonitoredBlocks  uint64     `json:"monitored_blocks"`
+	QPS              statsFloat `json:"qps"`
+	BlockRate        statsFloat `json:"block_rate"`
+	// C++ side serialises the timestamp as Unix epoch milliseconds.
+	CapturedAtMs *int64     `json:"captured_at_ms"`
+	CapturedAt   *time.Time `json:"captured_at"`
 }
 
-// writeFull writes all bytes in buf to w, looping until all bytes are written
-// or an error occurs. This handles the rare case where Write returns n < len(buf)
-// without an error, which technically violates the io.Writer contract but can
-// occur on some platforms or under resource pressure.
-func writeFull(w io.Writer, buf []byte) error {
-	for len(buf) > 0 {
-		n, err := w.Write(buf)
-		buf = buf[n:]
-		if err != nil {
+// capturedAt returns the capture time from captured_at_ms if present,
+// otherwise from captured_at, in UTC. With neither it is the zero time.
+func (r *rawStats) capturedAt() time.Time {
+	switch {
+	case r.CapturedAtMs != nil:
+		return time.UnixMilli(*r.CapturedAtMs).UTC()
+	case r.CapturedAt != nil:
+		return r.CapturedAt.UTC()
+	}
+	return time.Time{}
+}
+
+// statsFloat is a float64 that also accepts the quoted "NaN"/"Inf" spellings
+// some encoders emit, since standard JSON has no literal for non-finite numbers.
+type statsFloat float64
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *statsFloat) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
 			return err
 		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid float string %q", s)
+		}
+		*f = statsFloat(v)
+		return nil
 	}
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = statsFloat(v)
 	return nil
 }
 
-// rawStats is an intermediate struct that handles the C++ serialization quirk:
-// captured_at is sent as captured_at_ms (Unix epoch milliseconds), not as an
-// RFC 3339 string. All other fields are identical to StatsSnapshot.
-type rawStats struct {
-	TotalConnections uint64  `json:"total_connections"`
-	ActiveSessions   uint64  `json:"active_sessions"`
-	TotalQueries     uint64  `json:"total_queries"`
-	BlockedQueries   uint64  `json:"blocked_queries"`
-	MonitoredBlocks  uint64  `json:"monitored_blocks"`
-	QPS              float64 `json:"qps"`
-	BlockRate        float64 `json:"block_rate"`
-	// C++ side serialises the timestamp as Unix epoch milliseconds.
-	CapturedAtMs int64 `json:"captured_at_ms"`
+// finiteStat returns v unchanged when it is finite. Otherwise it returns
+// ErrNonFiniteStat in strict mode, or 0 plus a warning in the default mode.
+func (c *Client) finiteStat(field string, v statsFloat) (float64, error) {
+	f := float64(v)
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f, nil
+	}
+	if c.strictStats {
+		return 0, fmt.Errorf("%w: %s=%v", ErrNonFiniteStat, field, f)
+	}
+	if c.warn != nil {
+		c.warn(fmt.Sprintf("stats: server reported %s=%v, using 0", field, f))
+	}
+	return 0, nil
 }
 
 // GetStats sends a "stats" command and returns the decoded StatsSnapshot.
 func (c *Client) GetStats() (*StatsSnapshot, error) {
-	resp, err := c.SendCommand("stats")
+	return c.GetStatsContext(context.Background())
+}
+
+// GetStatsContext is like GetStats but honors ctx; see SendCommandContext.
+func (c *Client) GetStatsContext(ctx context.Context) (*StatsSnapshot, error) {
+	snap, _, err := c.GetStatsTimed(ctx)
+	return snap, err
+}
+
+// GetStatsTimed is like GetStatsContext but also returns the control-plane
+// round-trip time of the stats request, from dialing to the complete
+// response, which tells a slow core apart from a slow data path. Only the
+// attempt that got the response is timed, not retries or the version check.
+// The duration is zero when the request fails.
+func (c *Client) GetStatsTimed(ctx context.Context) (*StatsSnapshot, time.Duration, error) {
+	snap := new(StatsSnapshot)
+	rtt, err := c.getStatsInto(ctx, snap)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	return snap, rtt, nil
+}
+
+// GetStatsInto is like GetStats but decodes into the caller's snap instead
+// of allocating a new one, for loops that poll many times. snap is left
+// unchanged when an error is returned.
+func (c *Client) GetStatsInto(snap *StatsSnapshot) error {
+	_, err := c.getStatsInto(context.Background(), snap)
+	return err
+}
+
+// getStatsInto sends a "stats" command, fills snap from the response and
+// returns the round-trip time.
+func (c *Client) getStatsInto(ctx context.Context, snap *StatsSnapshot) (time.Duration, error) {
+	resp, err := c.SendCommandContext(ctx, "stats")
+	if err != nil {
+		return 0, err
 	}
 	if !resp.OK {
-		return nil, fmt.Errorf("server error: %s", resp.Error)
+		return 0, resp.Err()
+	}
+	var raw rawStats
+	if err := c.decodePayload(resp.Payload, &raw); err != nil {
+		return 0, &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("stats: %w", err)}
 	}
-	if resp.Payload == nil {
-		return nil, fmt.Errorf("stats response has no payload")
+	if err := c.fillStats(snap, &raw); err != nil {
+		return 0, err
 	}
+	return resp.rtt, nil
+}
 
-	// Re-marshal the payload interface{} so we can unmarshal into rawStats.
-	payloadBytes, err := json.Marshal(resp.Payload)
+// fillStats converts a decoded stats payload into *snap, applying the
+// non-finite value policy (see WithStrictStats).
+func (c *Client) fillStats(snap *StatsSnapshot, raw *rawStats) error {
+	qps, err := c.finiteStat("qps", raw.QPS)
 	if err != nil {
-		return nil, fmt.Errorf("re-marshal stats payload: %w", err)
+		return err
 	}
-
-	var raw rawStats
-	if err := json.Unmarshal(payloadBytes, &raw); err != nil {
-		return nil, fmt.Errorf("parse stats payload: %w", err)
+	blockRate, err := c.finiteStat("block_rate", raw.BlockRate)
+	if err != nil {
+		return err
 	}
 
-	snap := &StatsSnapshot{
+	*snap = StatsSnapshot{
 		TotalConnections: raw.TotalConnections,
 		ActiveSessions:   raw.ActiveSessions,
 		TotalQueries:     raw.TotalQueries,
 		BlockedQueries:   raw.BlockedQueries,
 		MonitoredBlocks:  raw.MonitoredBlocks,
-		QPS:              raw.QPS,
-		BlockRate:        raw.BlockRate,
-		CapturedAt:       time.UnixMilli(raw.CapturedAtMs).UTC(),
+		QPS:              qps,
+		BlockRate:        blockRate,
+		CapturedAt:       raw.capturedAt(),
+	}
+	return nil
+}
+
+// SubscribeStats asks the core to push a stats snapshot every interval over
+// one long-lived connection and calls fn with each, until ctx is cancelled,
+// fn returns an error, or the core ends the subscription. The core answers
+// the "stats_subscribe" command with a header response carrying
+// "stream":true, then sends one frame per snapshot and, if it stops on its
+// own, an empty terminating frame. Dial and the header exchange are bounded
+// by the client timeout; afterwards each snapshot must arrive within interval
+// plus the client timeout. Cancelling ctx is the normal way to stop, and
+// SubscribeStats then returns ctx.Err(). An error returned by fn is returned
+// as is.
+func (c *Client) SubscribeStats(ctx context.Context, interval time.Duration, fn func(*StatsSnapshot) error) (err error) {
+	if interval <= 0 {
+		return fmt.Errorf("stats_subscribe: invalid interval %s: must be positive", interval)
+	}
+	c.checkVersion(ctx)
+	ctx, finish := c.startTrace(ctx, "stats_subscribe")
+	defer func() { finish(err) }()
+
+	body, err := c.encodeRequest(CommandRequest{
+		Command: "stats_subscribe",
+		Args:    map[string]interface{}{"interval_ms": interval.Milliseconds()},
+	})
+	if err != nil {
+		return err
+	}
+
+	setupCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := c.dial(setupCtx)
+	if err != nil {
+		return transportErr(setupCtx, err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	resp, err := c.exchange(setupCtx, conn, body)
+	if err != nil {
+		return transportErr(setupCtx, err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("stats_subscribe: %w", resp.Err())
+	}
+	if !resp.Stream {
+		return &ProtocolError{Phase: PhaseDecode, Err: errors.New("stats_subscribe: response does not start a stream")}
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	r := &countingReader{r: conn, c: c}
+	for {
+		if err := conn.SetDeadline(time.Now().Add(interval + c.timeout)); err != nil {
+			return fmt.Errorf("stats_subscribe: set read deadline: %w", err)
+		}
+		// A cancellation that expired the deadline before the reset above
+		// must still stop the subscription.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := c.receiveFrame(r, true, nil)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return transportErr(ctx, fmt.Errorf("stats_subscribe: read stream: %w", err))
+		}
+		if frame == nil {
+			return nil
+		}
+		var raw rawStats
+		if err := c.codec.Unmarshal(frame, &raw); err != nil {
+			return &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("stats_subscribe: parse stream item: %w", err)}
+		}
+		snap := new(StatsSnapshot)
+		if err := c.fillStats(snap, &raw); err != nil {
+			return err
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
 	}
-	return snap, nil
 }
@@ -1,12 +1,26 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -30,6 +44,65 @@ func startMockServer(t *testing.T, respPayload []byte) string {
 		_ = os.Remove(sockPath)
 	})
 
+	go serveOne(ln, respPayload)
+
+	return sockPath
+}
+
+// startMockTCPServer is startMockServer over TCP on a loopback port. It
+// returns the address in "tcp://host:port" form.
+func startMockTCPServer(t *testing.T, respPayload []byte) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go serveOne(ln, respPayload)
+	return "tcp://" + ln.Addr().String()
+}
+
+// serveOne accepts a single connection on ln, drains one framed request, and
+// writes respPayload (already framed).
+func serveOne(ln net.Listener, respPayload []byte) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Drain the request: 4-byte LE length prefix + body.
+	var lenBuf [4]byte
+	if _, err := readFull(conn, lenBuf[:]); err != nil {
+		return
+	}
+	reqLen := binary.LittleEndian.Uint32(lenBuf[:])
+	reqBody := make([]byte, reqLen)
+	if _, err := readFull(conn, reqBody); err != nil {
+		return
+	}
+
+	// Write the pre-built response frame.
+	_, _ = conn.Write(respPayload)
+}
+
+// startCapturingServer is like startMockServer but also delivers the decoded
+// request body of the single connection it serves on the returned channel.
+func startCapturingServer(t *testing.T, respPayload []byte) (string, <-chan []byte) {
+	t.Helper()
+
+	dir := t.TempDir()
+	sockPath := filepath.Join(dir, "capture.sock")
+
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	received := make(chan []byte, 1)
 	go func() {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -37,22 +110,20 @@ func startMockServer(t *testing.T, respPayload []byte) string {
 		}
 		defer func() { _ = conn.Close() }()
 
-		// Drain the request: 4-byte LE length prefix + body.
 		var lenBuf [4]byte
 		if _, err := readFull(conn, lenBuf[:]); err != nil {
 			return
 		}
-		reqLen := binary.LittleEndian.Uint32(lenBuf[:])
-		reqBody := make([]byte, reqLen)
+		reqBody := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
 		if _, err := readFull(conn, reqBody); err != nil {
 			return
 		}
+		received <- reqBody
 
-		// Write the pre-built response frame.
 		_, _ = conn.Write(respPayload)
 	}()
 
-	return sockPath
+	return sockPath, received
 }
 
 // readFull reads exactly len(buf) bytes from conn.
@@ -159,6 +230,122 @@ func TestFraming(t *testing.T) {
 	}
 }
 
+// TestFraming_Args verifies that args round-trip through the framed request
+// and that the "args" key is absent for argument-less commands.
+func TestFraming_Args(t *testing.T) {
+	respJSON := []byte(`{"ok":true}`)
+
+	sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+	c := NewClient(sockPath, 3*time.Second)
+	args := map[string]interface{}{"id": "s1", "force": true, "limit": float64(10)}
+	if _, err := c.SendCommandArgs("kill_session", args); err != nil {
+		t.Fatalf("SendCommandArgs: %v", err)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "kill_session" || !reflect.DeepEqual(req.Args, args) {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	sockPath, received = startCapturingServer(t, frameResponse(respJSON))
+	c = NewClient(sockPath, 3*time.Second)
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if body := <-received; bytes.Contains(body, []byte(`"args"`)) {
+		t.Errorf("argument-less request should omit args, got %s", body)
+	}
+}
+
+// TestGetStatsTimed verifies that the round trip covers a core that is slow
+// to answer, and that a failed request reports no duration.
+func TestGetStatsTimed(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	sockPath := startRawServer(t, func(conn net.Conn, _ []byte) bool {
+		time.Sleep(delay)
+		_, _ = conn.Write(frameResponse([]byte(`{"ok":true,"payload":{"total_queries":7,"captured_at_ms":0}}`)))
+		return false
+	})
+	snap, rtt, err := NewClient(sockPath, 3*time.Second).GetStatsTimed(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatsTimed: %v", err)
+	}
+	if snap.TotalQueries != 7 {
+		t.Errorf("TotalQueries: got %d, want 7", snap.TotalQueries)
+	}
+	if rtt < delay {
+		t.Errorf("rtt %v is shorter than the core's %v delay", rtt, delay)
+	}
+
+	missing := NewClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second)
+	if _, rtt, err := missing.GetStatsTimed(context.Background()); err == nil || rtt != 0 {
+		t.Errorf("failed request: got rtt %v, err %v", rtt, err)
+	}
+}
+
+// TestGetStatsInto verifies that GetStatsInto fills every field GetStats
+// does, overwriting stale values, and leaves snap untouched on failure.
+func TestGetStatsInto(t *testing.T) {
+	want, err := NewClient(startMockServer(t, frameResponse(benchStatsJSON)), 3*time.Second).GetStats()
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+
+	snap := StatsSnapshot{TotalQueries: 99999, QPS: 1}
+	c := NewClient(startMockServer(t, frameResponse(benchStatsJSON)), 3*time.Second)
+	if err := c.GetStatsInto(&snap); err != nil {
+		t.Fatalf("GetStatsInto: %v", err)
+	}
+	if !reflect.DeepEqual(snap, *want) {
+		t.Errorf("GetStatsInto = %+v, want %+v", snap, *want)
+	}
+
+	before := snap
+	c = NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"internal error"}`))), 3*time.Second)
+	if err := c.GetStatsInto(&snap); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if snap != before {
+		t.Errorf("snap changed on failure: %+v", snap)
+	}
+}
+
+// TestGetStats_CapturedAtForms verifies that an RFC 3339 captured_at is used
+// when captured_at_ms is absent, that captured_at_ms wins when both are sent,
+// and that a payload with neither yields the zero time rather than an error.
+func TestGetStats_CapturedAtForms(t *testing.T) {
+	want := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name    string
+		payload string
+		want    time.Time
+	}{
+		{"RFC 3339", `{"total_queries":1,"captured_at":"2025-03-01T21:00:00+09:00"}`, want},
+		{"both", `{"total_queries":1,"captured_at_ms":1740830400000,"captured_at":"2030-01-01T00:00:00Z"}`, want},
+		{"neither", `{"total_queries":1}`, time.Time{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			respJSON := []byte(`{"ok":true,"payload":` + tt.payload + `}`)
+			snap, err := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second).GetStats()
+			if err != nil {
+				t.Fatalf("GetStats: %v", err)
+			}
+			if !snap.CapturedAt.Equal(tt.want) || snap.CapturedAt.Location() != time.UTC {
+				t.Errorf("CapturedAt: got %v, want %v", snap.CapturedAt, tt.want)
+			}
+		})
+	}
+
+	respJSON := []byte(`{"ok":true,"payload":{"captured_at":"yesterday"}}`)
+	_, err := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second).GetStats()
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.Phase != PhaseDecode {
+		t.Errorf("malformed captured_at: expected a decode ProtocolError, got %v", err)
+	}
+}
+
 // TestGetStats_CapturedAtMs verifies that captured_at_ms (epoch ms) is
 // correctly converted to time.Time.
 func TestGetStats_CapturedAtMs(t *testing.T) {
@@ -216,6 +403,34 @@ func TestGetStats_ServerError(t *testing.T) {
 	}
 }
 
+// TestGetStats_WrongPayloadType verifies that a payload that is not a JSON
+// object is reported as a decode error naming the type the core sent.
+func TestGetStats_WrongPayloadType(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`[1,2,3]`, "payload is a JSON array, want an object"},
+		{`"ok"`, "payload is a JSON string, want an object"},
+		{`42`, "payload is a JSON number, want an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			respJSON := []byte(`{"ok":true,"payload":` + tt.payload + `}`)
+			c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+			_, err := c.GetStats()
+			var perr *ProtocolError
+			if !errors.As(err, &perr) || perr.Phase != PhaseDecode {
+				t.Fatalf("expected decode ProtocolError, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
 // TestPolicyExplain_Block verifies that a block decision is correctly decoded.
 func TestPolicyExplain_Block(t *testing.T) {
 	payload := map[string]interface{}{
@@ -364,3 +579,2505 @@ func TestTimeout(t *testing.T) {
 		t.Errorf("timeout took too long: %v", elapsed)
 	}
 }
+
+// TestStrictLengthPrefix_TrailingBytes verifies that strict mode rejects a
+// response followed by bytes the length prefix did not account for, while the
+// default mode ignores them.
+func TestStrictLengthPrefix_TrailingBytes(t *testing.T) {
+	frame := append(frameResponse([]byte(`{"ok":true}`)), []byte("junk")...)
+
+	lenient := NewClient(startMockServer(t, frame), 3*time.Second)
+	if _, err := lenient.SendCommand("stats"); err != nil {
+		t.Fatalf("default mode: unexpected error: %v", err)
+	}
+
+	strict := NewClient(startMockServer(t, frame), 3*time.Second, WithStrictLengthPrefix())
+	_, err := strict.SendCommand("stats")
+	if err == nil {
+		t.Fatal("strict mode: expected error for trailing bytes, got nil")
+	}
+	if !strings.Contains(err.Error(), "trailing bytes") {
+		t.Errorf("error should mention trailing bytes, got: %v", err)
+	}
+}
+
+// TestStrictLengthPrefix_ExactFrame verifies that strict mode accepts a
+// correctly framed response.
+func TestStrictLengthPrefix_ExactFrame(t *testing.T) {
+	sockPath := startMockServer(t, frameResponse([]byte(`{"ok":true}`)))
+
+	c := NewClient(sockPath, 3*time.Second, WithStrictLengthPrefix())
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+}
+
+// TestGetStats_NonFinite verifies that quoted NaN/Inf values for qps and
+// block_rate are replaced with 0 and reported as warnings by default.
+func TestGetStats_NonFinite(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"NaN string", `{"qps":"NaN","block_rate":0.5,"captured_at_ms":0}`},
+		{"Inf string", `{"qps":1.5,"block_rate":"+Inf","captured_at_ms":0}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respJSON := []byte(`{"ok":true,"payload":` + tt.payload + `}`)
+			sockPath := startMockServer(t, frameResponse(respJSON))
+
+			var warnings []string
+			c := NewClient(sockPath, 3*time.Second, WithWarningHandler(func(msg string) {
+				warnings = append(warnings, msg)
+			}))
+			snap, err := c.GetStats()
+			if err != nil {
+				t.Fatalf("GetStats: %v", err)
+			}
+			if math.IsNaN(snap.QPS) || math.IsInf(snap.QPS, 0) ||
+				math.IsNaN(snap.BlockRate) || math.IsInf(snap.BlockRate, 0) {
+				t.Errorf("expected finite values, got qps=%v block_rate=%v", snap.QPS, snap.BlockRate)
+			}
+			if len(warnings) != 1 {
+				t.Errorf("expected 1 warning, got %d: %v", len(warnings), warnings)
+			}
+		})
+	}
+}
+
+// TestGetStats_NonFiniteStrict verifies that strict mode surfaces a non-finite
+// value as ErrNonFiniteStat.
+func TestGetStats_NonFiniteStrict(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"qps":"NaN","block_rate":0,"captured_at_ms":0}}`)
+	sockPath := startMockServer(t, frameResponse(respJSON))
+
+	c := NewClient(sockPath, 3*time.Second, WithStrictStats())
+	_, err := c.GetStats()
+	if !errors.Is(err, ErrNonFiniteStat) {
+		t.Fatalf("expected ErrNonFiniteStat, got: %v", err)
+	}
+}
+
+// TestReadBudget_SlowDribble verifies that a server which declares a large
+// body and then sends it one byte at a time is cut off by the read budget
+// well before the overall timeout.
+func TestReadBudget_SlowDribble(t *testing.T) {
+	dir := t.TempDir()
+	sockPath := filepath.Join(dir, "dribble.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		var lenBuf [4]byte
+		if _, err := readFull(conn, lenBuf[:]); err != nil {
+			return
+		}
+		if _, err := readFull(conn, make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))); err != nil {
+			return
+		}
+
+		// Declare 16 MiB, then dribble one byte every 20ms.
+		binary.LittleEndian.PutUint32(lenBuf[:], MaxResponseBytes)
+		if _, err := conn.Write(lenBuf[:]); err != nil {
+			return
+		}
+		for i := 0; i < 500; i++ {
+			if _, err := conn.Write([]byte{'x'}); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	c := NewClient(sockPath, 5*time.Second, WithReadBudget(200*time.Millisecond))
+	start := time.Now()
+	_, err = c.SendCommand("stats")
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected error from read budget, got nil")
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got: %v", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("read budget not enforced, took %v", elapsed)
+	}
+}
+
+// TestBodyRead_Deadline verifies that a body dribbled in after a prompt
+// header still fails at the request deadline, with a timeout error that says
+// how much of the body arrived.
+func TestBodyRead_Deadline(t *testing.T) {
+	frame := frameResponse([]byte(`{"ok":true,"payload":"` + strings.Repeat("x", 1000) + `"}`))
+	sockPath := startChunkedServer(t, frame, 1, 20*time.Millisecond)
+
+	c := NewClient(sockPath, 300*time.Millisecond)
+	start := time.Now()
+	_, err := c.SendCommand("stats")
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got: %v", err)
+	}
+	var pe *ProtocolError
+	if !errors.As(err, &pe) || pe.Phase != PhaseReadBody {
+		t.Errorf("expected a %s ProtocolError, got: %v", PhaseReadBody, err)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("of %d body bytes", len(frame)-frameHeaderLen)) {
+		t.Errorf("error does not say how much of the body arrived: %v", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("deadline not enforced on the body, took %v", elapsed)
+	}
+}
+
+// TestRequestVersion verifies that the version field is omitted by default and
+// serialized when overridden with WithRequestVersion.
+func TestRequestVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{"default", nil, ProtocolVersion},
+		{"override", []Option{WithRequestVersion(3)}, 3},
+		{"omitted", []Option{WithRequestVersion(0)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true}`)))
+
+			c := NewClient(sockPath, 3*time.Second, tt.opts...)
+			if _, err := c.SendCommand("stats"); err != nil {
+				t.Fatalf("SendCommand: %v", err)
+			}
+
+			var req map[string]interface{}
+			if err := json.Unmarshal(<-received, &req); err != nil {
+				t.Fatalf("parse request body: %v", err)
+			}
+			v, present := req["version"]
+			if tt.want == 0 {
+				if present {
+					t.Errorf("expected version to be omitted, got %v", v)
+				}
+				return
+			}
+			if v != float64(tt.want) {
+				t.Errorf("version: got %v, want %d", v, tt.want)
+			}
+		})
+	}
+}
+
+// startChunkedServer starts a mock UDS server that writes frame in chunks of
+// chunkSize bytes, pausing delay between chunks.
+func startChunkedServer(t *testing.T, frame []byte, chunkSize int, delay time.Duration) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	sockPath := filepath.Join(dir, "chunked.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		var lenBuf [4]byte
+		if _, err := readFull(conn, lenBuf[:]); err != nil {
+			return
+		}
+		if _, err := readFull(conn, make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))); err != nil {
+			return
+		}
+		for off := 0; off < len(frame); off += chunkSize {
+			end := min(off+chunkSize, len(frame))
+			if _, err := conn.Write(frame[off:end]); err != nil {
+				return
+			}
+			time.Sleep(delay)
+		}
+	}()
+
+	return sockPath
+}
+
+// TestIdleReadTimeout_LargeChunkedPayload verifies that a response taking
+// longer than the overall timeout succeeds under idle-based timing as long as
+// bytes keep arriving, and fails with the fixed deadline.
+func TestIdleReadTimeout_LargeChunkedPayload(t *testing.T) {
+	padding := strings.Repeat("x", 64*1024)
+	frame := frameResponse([]byte(`{"ok":true,"payload":{"pad":"` + padding + `"}}`))
+	const chunk = 8 * 1024 // ~9 chunks * 50ms ≈ 450ms total
+
+	fixed := NewClient(startChunkedServer(t, frame, chunk, 50*time.Millisecond), 200*time.Millisecond)
+	if _, err := fixed.SendCommand("sessions"); err == nil {
+		t.Fatal("fixed deadline: expected timeout, got nil")
+	}
+
+	adaptive := NewClient(startChunkedServer(t, frame, chunk, 50*time.Millisecond), 200*time.Millisecond,
+		WithIdleReadTimeout(150*time.Millisecond))
+	resp, err := adaptive.SendCommand("sessions")
+	if err != nil {
+		t.Fatalf("idle deadline: SendCommand: %v", err)
+	}
+	if !resp.OK {
+		t.Error("expected OK=true")
+	}
+}
+
+// TestIdleReadTimeout_Stall verifies that a server that stops sending is still
+// detected after the idle timeout.
+func TestIdleReadTimeout_Stall(t *testing.T) {
+	frame := frameResponse([]byte(`{"ok":true}`))
+	// Send the 4-byte header, then stall for longer than the idle timeout.
+	sockPath := startChunkedServer(t, frame, 4, 2*time.Second)
+
+	c := NewClient(sockPath, 5*time.Second, WithIdleReadTimeout(100*time.Millisecond))
+	start := time.Now()
+	_, err := c.SendCommand("stats")
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("idle timeout not enforced, took %v", elapsed)
+	}
+}
+
+// TestReadTimeout_FreshAfterDial verifies that the read timeout starts once
+// the request is written, so a slow but successful dial does not shorten it,
+// and that it fails a stalled read long before the overall timeout.
+func TestReadTimeout_FreshAfterDial(t *testing.T) {
+	frame := frameResponse([]byte(`{"ok":true}`))
+	// Send the 4-byte header, then stall for longer than the read timeout.
+	sockPath := startChunkedServer(t, frame, 4, 2*time.Second)
+
+	const dialDelay, readTimeout = 150 * time.Millisecond, 200 * time.Millisecond
+	slowDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		time.Sleep(dialDelay)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	c := NewClient(sockPath, 5*time.Second, WithDialer(slowDial),
+		WithDialTimeout(time.Second), WithReadTimeout(readTimeout))
+
+	start := time.Now()
+	_, err := c.SendCommand("stats")
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected read timeout, got: %v", err)
+	}
+	if errors.Is(err, ErrConnect) {
+		t.Errorf("dial succeeded, but the error is reported as a connect failure: %v", err)
+	}
+	if elapsed < dialDelay+readTimeout {
+		t.Errorf("read deadline counted from before the dial: failed after %v", elapsed)
+	}
+	if elapsed > time.Second {
+		t.Errorf("read timeout not enforced, took %v", elapsed)
+	}
+}
+
+// TestDialTimeout verifies that a hanging dial fails after the dial timeout
+// instead of the overall timeout.
+func TestDialTimeout(t *testing.T) {
+	hang := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	c := NewClient("/unused.sock", 5*time.Second, WithDialer(hang), WithDialTimeout(100*time.Millisecond))
+
+	start := time.Now()
+	_, err := c.SendCommand("stats")
+	if !errors.Is(err, ErrConnect) || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected connect timeout, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial timeout not enforced, took %v", elapsed)
+	}
+}
+
+// TestSendCommandContext_CancelMidRead verifies that cancelling the context
+// while the client is blocked reading a response aborts promptly with a
+// wrapped context.Canceled, with and without idle-read mode.
+func TestSendCommandContext_CancelMidRead(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"idle read", []Option{WithIdleReadTimeout(time.Second)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := frameResponse([]byte(`{"ok":true}`))
+			// Send the 4-byte header, then stall.
+			sockPath := startChunkedServer(t, frame, 4, 2*time.Second)
+
+			c := NewClient(sockPath, 5*time.Second, tt.opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			start := time.Now()
+			_, err := c.SendCommandContext(ctx, "stats")
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("cancellation not honored promptly, took %v", elapsed)
+			}
+		})
+	}
+}
+
+// TestGetStatsContext_DeadlineEarlierThanTimeout verifies that a context
+// deadline shorter than the client timeout bounds the request.
+func TestGetStatsContext_DeadlineEarlierThanTimeout(t *testing.T) {
+	frame := frameResponse([]byte(`{"ok":true}`))
+	sockPath := startChunkedServer(t, frame, 4, 2*time.Second)
+
+	c := NewClient(sockPath, 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetStatsContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("context deadline not applied, took %v", elapsed)
+	}
+}
+
+// TestEvalPolicy verifies allow and block decisions, including the matched
+// rule, and that the query and db are sent in the policy_eval payload.
+func TestEvalPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		rule   string
+	}{
+		{"allow", "allow", "default-allow"},
+		{"block", "block", "block-statement"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respJSON, err := json.Marshal(map[string]interface{}{
+				"ok": true,
+				"payload": map[string]interface{}{
+					"action":       tt.action,
+					"matched_rule": tt.rule,
+					"reason":       "test",
+				},
+			})
+			if err != nil {
+				t.Fatalf("marshal mock response: %v", err)
+			}
+			sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+
+			c := NewClient(sockPath, 3*time.Second)
+			decision, err := c.EvalPolicy("SELECT * FROM users", "app")
+			if err != nil {
+				t.Fatalf("EvalPolicy: %v", err)
+			}
+			if decision.Action != tt.action || decision.MatchedRule != tt.rule {
+				t.Errorf("decision: got %+v, want action=%s rule=%s", decision, tt.action, tt.rule)
+			}
+
+			var req struct {
+				Command string            `json:"command"`
+				Payload PolicyEvalRequest `json:"payload"`
+			}
+			if err := json.Unmarshal(<-received, &req); err != nil {
+				t.Fatalf("parse request body: %v", err)
+			}
+			if req.Command != "policy_eval" || req.Payload.Query != "SELECT * FROM users" || req.Payload.DB != "app" {
+				t.Errorf("unexpected request: %+v", req)
+			}
+		})
+	}
+}
+
+// TestEvalPolicy_NotImplemented verifies that both the 501 placeholder and an
+// unknown-command rejection map to ErrNotImplemented.
+func TestEvalPolicy_NotImplemented(t *testing.T) {
+	for _, respJSON := range []string{
+		`{"ok":false,"error":"not implemented","code":501,"command":"policy_eval"}`,
+		`{"ok":false,"error":"unknown command 'policy_eval'"}`,
+	} {
+		sockPath := startMockServer(t, frameResponse([]byte(respJSON)))
+
+		c := NewClient(sockPath, 3*time.Second)
+		_, err := c.EvalPolicy("SELECT 1", "")
+		if !errors.Is(err, ErrNotImplemented) {
+			t.Errorf("response %s: expected ErrNotImplemented, got: %v", respJSON, err)
+		}
+	}
+}
+
+// TestIOStats verifies that the byte counters match the framed request and
+// response exactly and accumulate across requests.
+func TestIOStats(t *testing.T) {
+	respJSON := []byte(`{"ok":true}`)
+	reqJSON, err := json.Marshal(CommandRequest{Command: "stats", Version: ProtocolVersion})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+
+	want := IOStats{
+		Requests:      1,
+		BytesSent:     uint64(4 + len(reqJSON)),
+		BytesReceived: uint64(4 + len(respJSON)),
+	}
+	if got := c.IOStats(); got != want {
+		t.Errorf("IOStats: got %+v, want %+v", got, want)
+	}
+
+	// A second request on a fresh connection accumulates.
+	c.network, c.address = "unix", startMockServer(t, frameResponse(respJSON))
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if got := c.IOStats(); got.Requests != 2 || got.BytesSent != 2*want.BytesSent {
+		t.Errorf("IOStats after second request: got %+v", got)
+	}
+}
+
+// TestListSessions verifies that the sessions payload is decoded and that
+// started_at_ms is converted to a UTC time, while last_activity_ms is kept.
+func TestListSessions(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","client_addr":"10.0.0.5:51234","database":"app","user":"svc",` +
+		`"state":"idle","started_at_ms":1700000000000,"query_count":42,"last_activity_ms":1700000060000}]}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	sessions, err := c.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	want := Session{
+		ID:         "s1",
+		ClientAddr: "10.0.0.5:51234",
+		Database:   "app",
+		User:       "svc",
+		State:      "idle",
+		StartedAt:  time.UnixMilli(1700000000000).UTC(),
+		QueryCount: 42,
+
+		LastActivityMs: 1700000060000,
+	}
+	if len(sessions) != 1 || sessions[0] != want {
+		t.Errorf("got %+v, want [%+v]", sessions, want)
+	}
+}
+
+// TestListSessionsFiltered verifies that the set filter fields are sent as
+// args, that an honoring core's reply is returned as is, and that a core
+// ignoring the args is caught and filtered client-side with a warning.
+func TestListSessionsFiltered(t *testing.T) {
+	all := []byte(`{"ok":true,"payload":[` +
+		`{"id":"s1","user":"bob","database":"orders","state":"active"},` +
+		`{"id":"s2","user":"bob","database":"orders","state":"idle"},` +
+		`{"id":"s3","user":"eve","database":"orders","state":"active"}]}`)
+	matching := []byte(`{"ok":true,"payload":[{"id":"s1","user":"bob","database":"orders","state":"active"}]}`)
+	filter := SessionFilter{User: "bob", Database: "orders", State: "active"}
+
+	for _, tt := range []struct {
+		name     string
+		resp     []byte
+		wantWarn bool
+	}{
+		{"server filters", matching, false},
+		{"server ignores args", all, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sockPath, received := startCapturingServer(t, frameResponse(tt.resp))
+			var warnings []string
+			c := NewClient(sockPath, 3*time.Second, WithWarningHandler(func(msg string) { warnings = append(warnings, msg) }))
+			sessions, err := c.ListSessionsFiltered(filter)
+			if err != nil {
+				t.Fatalf("ListSessionsFiltered: %v", err)
+			}
+			if ids := SessionList(sessions).IDs(); !reflect.DeepEqual(ids, []string{"s1"}) {
+				t.Errorf("got sessions %q, want [s1]", ids)
+			}
+			if got := string(<-received); got != `{"command":"sessions","version":1,"args":{"database":"orders","state":"active","user":"bob"}}` {
+				t.Errorf("unexpected request %s", got)
+			}
+			if (len(warnings) > 0) != tt.wantWarn {
+				t.Errorf("warnings = %q, want a warning: %v", warnings, tt.wantWarn)
+			}
+		})
+	}
+
+	sockPath, received := startCapturingServer(t, frameResponse(all))
+	sessions, err := NewClient(sockPath, 3*time.Second).ListSessionsFiltered(SessionFilter{Database: "orders"})
+	if err != nil || len(sessions) != 3 {
+		t.Errorf("database filter: got %d sessions, %v", len(sessions), err)
+	}
+	if got := string(<-received); got != `{"command":"sessions","version":1,"args":{"database":"orders"}}` {
+		t.Errorf("only set fields should be sent, got %s", got)
+	}
+}
+
+// TestListSessions_NotImplemented verifies that the 501 placeholder maps to
+// ErrNotImplemented.
+func TestListSessions_NotImplemented(t *testing.T) {
+	respJSON := []byte(`{"ok":false,"error":"not implemented","code":501,"command":"sessions"}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	if _, err := c.ListSessions(); !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestListSessions_WrongPayloadType verifies that an object payload, where
+// the sessions command returns an array, is reported by its JSON type.
+func TestListSessions_WrongPayloadType(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"sessions":[]}}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	_, err := c.ListSessions()
+	if err == nil || !strings.Contains(err.Error(), "sessions: payload is a JSON object, want an array") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestKillSession verifies that the request carries the kill_session command
+// and the session ID argument, and that server errors are surfaced.
+func TestKillSession(t *testing.T) {
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true}`)))
+	c := NewClient(sockPath, 3*time.Second)
+
+	if err := c.KillSession("s42"); err != nil {
+		t.Fatalf("KillSession: %v", err)
+	}
+	var req struct {
+		Command string            `json:"command"`
+		Args    map[string]string `json:"args"`
+	}
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "kill_session" || req.Args["id"] != "s42" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	c = NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"no such session"}`))), 3*time.Second)
+	if err := c.KillSession("s42"); err == nil || !strings.Contains(err.Error(), "no such session") {
+		t.Errorf("expected server error, got: %v", err)
+	}
+
+	c = NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"unknown command 'kill_session'"}`))), 3*time.Second)
+	if err := c.KillSession("s42"); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestResetStats verifies the stats_reset request body and the 501 mapping.
+func TestResetStats(t *testing.T) {
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true}`)))
+	if err := NewClient(sockPath, 3*time.Second).ResetStats(); err != nil {
+		t.Fatalf("ResetStats: %v", err)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "stats_reset" || req.Args != nil || req.Payload != nil {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	c := NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"not implemented","code":501}`))), 3*time.Second)
+	if err := c.ResetStats(); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestPing verifies that Ping times a "ping" round-trip, leaving out a
+// failed attempt and its backoff, and maps 501.
+func TestPing(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	sockPath := startRawServer(t, func(conn net.Conn, _ []byte) bool {
+		time.Sleep(delay)
+		_, _ = conn.Write(frameResponse([]byte(`{"ok":true}`)))
+		return false
+	})
+	rtt, err := NewClient(sockPath, 3*time.Second).Ping()
+	if err != nil || rtt < delay {
+		t.Errorf("Ping = %v, %v; want at least %v", rtt, err, delay)
+	}
+
+	// The backoff before the retry is at least 200ms; only the retry counts.
+	lossy, _ := startLosingServer(t, frameResponse([]byte(`{"ok":true}`)), 1)
+	rtt, err = NewClient(lossy, 3*time.Second, WithRetry(2, 400*time.Millisecond)).Ping()
+	if err != nil || rtt >= 150*time.Millisecond {
+		t.Errorf("Ping after a retry = %v, %v; want the retried attempt's time only", rtt, err)
+	}
+
+	c := NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"unknown command: ping"}`))), 3*time.Second)
+	if _, err := c.Ping(); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestAuditTail verifies the limit argument and the decoding of entries, and
+// that an unknown command maps to ErrNotImplemented.
+func TestAuditTail(t *testing.T) {
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true,"payload":[`+
+		`{"id":7,"timestamp_ms":1700000000123,"client_addr":"10.0.0.5:51234","user":"app","query":"DROP TABLE users","rule":"no-ddl","action":"block"}]}`)))
+	entries, err := NewClient(sockPath, 3*time.Second).AuditTail(50)
+	if err != nil {
+		t.Fatalf("AuditTail: %v", err)
+	}
+	want := []AuditEntry{{ID: 7, TimestampMs: 1700000000123, ClientAddr: "10.0.0.5:51234", User: "app",
+		Query: "DROP TABLE users", Rule: "no-ddl", Action: "block"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "audit_tail" || req.Args["limit"] != float64(50) {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	c := NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"unknown command: audit_tail"}`))), 3*time.Second)
+	if _, err := c.AuditTail(50); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestAuditTailSince verifies that since is sent as since_ms and that entries
+// older than it are dropped client-side, keeping one stamped exactly at since.
+func TestAuditTailSince(t *testing.T) {
+	since := time.UnixMilli(1700000000000)
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true,"payload":[`+
+		`{"id":3,"timestamp_ms":1700000000001},{"id":2,"timestamp_ms":1700000000000},{"id":1,"timestamp_ms":1699999999999}]}`)))
+	var warnings []string
+	c := NewClient(sockPath, 3*time.Second, WithWarningHandler(func(msg string) { warnings = append(warnings, msg) }))
+	entries, err := c.AuditTailSince(50, since)
+	if err != nil {
+		t.Fatalf("AuditTailSince: %v", err)
+	}
+	var ids []uint64
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint64{3, 2}) {
+		t.Errorf("ids = %v, want [3 2]", ids)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "filtered 1 of 3") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Args["since_ms"] != float64(1700000000000) {
+		t.Errorf("since_ms = %v, want 1700000000000", req.Args["since_ms"])
+	}
+
+	sockPath, received = startCapturingServer(t, frameResponse([]byte(`{"ok":true,"payload":[]}`)))
+	if _, err := NewClient(sockPath, 3*time.Second).AuditTail(50); err != nil {
+		t.Fatalf("AuditTail: %v", err)
+	}
+	if body := <-received; bytes.Contains(body, []byte("since_ms")) {
+		t.Errorf("zero since should not send since_ms, got %s", body)
+	}
+}
+
+func TestAuditRotate(t *testing.T) {
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true,"payload":{"flushed":42}}`)))
+	flushed, err := NewClient(sockPath, 3*time.Second).AuditRotate()
+	if err != nil {
+		t.Fatalf("AuditRotate: %v", err)
+	}
+	if flushed != 42 {
+		t.Errorf("flushed = %d, want 42", flushed)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "audit_rotate" {
+		t.Errorf("command = %q, want audit_rotate", req.Command)
+	}
+
+	c := NewClient(startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"unknown command: audit_rotate"}`))), 3*time.Second)
+	if _, err := c.AuditRotate(); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestLogLevel verifies that SetLogLevel sends the level in args, that
+// GetLogLevel decodes the current level, and that 501 maps to
+// ErrNotImplemented.
+func TestLogLevel(t *testing.T) {
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true}`)))
+	if err := NewClient(sockPath, 3*time.Second).SetLogLevel("debug"); err != nil {
+		t.Fatalf("SetLogLevel: %v", err)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "set_log_level" || req.Args["level"] != "debug" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	c := NewClient(startMockServer(t, frameResponse([]byte(`{"ok":true,"payload":{"level":"warn"}}`))), 3*time.Second)
+	if level, err := c.GetLogLevel(); err != nil || level != "warn" {
+		t.Errorf("GetLogLevel = %q, %v; want warn", level, err)
+	}
+
+	notImpl := frameResponse([]byte(`{"ok":false,"error":"unknown command","code":501}`))
+	if err := NewClient(startMockServer(t, notImpl), 3*time.Second).SetLogLevel("info"); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("SetLogLevel: expected ErrNotImplemented, got: %v", err)
+	}
+	if _, err := NewClient(startMockServer(t, notImpl), 3*time.Second).GetLogLevel(); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("GetLogLevel: expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestSetLogLevel_Invalid verifies that an unknown level is rejected before
+// anything is dialed.
+func TestSetLogLevel_Invalid(t *testing.T) {
+	for _, level := range []string{"verbose", "DEBUG", ""} {
+		err := NewClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second).SetLogLevel(level)
+		if err == nil || !strings.Contains(err.Error(), "unknown level") {
+			t.Errorf("SetLogLevel(%q) = %v, want unknown level error", level, err)
+		}
+		if errors.Is(err, ErrConnect) || errors.Is(err, ErrSocketNotFound) {
+			t.Errorf("SetLogLevel(%q) dialed: %v", level, err)
+		}
+	}
+}
+
+// TestTCPTransport verifies that the framing works unchanged over a
+// tcp:// address.
+func TestTCPTransport(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"total_queries":7,"captured_at_ms":0}}`)
+	c := NewClient(startMockTCPServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	snap, err := c.GetStats()
+	if err != nil {
+		t.Fatalf("GetStats over TCP: %v", err)
+	}
+	if snap.TotalQueries != 7 {
+		t.Errorf("TotalQueries: got %d, want 7", snap.TotalQueries)
+	}
+}
+
+// TestTCPKeepAlive is a smoke test: enabling keepalive must not break TCP
+// requests and is ignored for Unix sockets. The socket option itself is not
+// inspected, as that is platform-specific.
+func TestTCPKeepAlive(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"total_queries":7,"captured_at_ms":0}}`)
+	for _, addr := range []string{
+		startMockTCPServer(t, frameResponse(respJSON)),
+		startMockServer(t, frameResponse(respJSON)),
+	} {
+		c := NewClient(addr, 3*time.Second, WithTCPKeepAlive(30*time.Second))
+		if snap, err := c.GetStats(); err != nil || snap.TotalQueries != 7 {
+			t.Errorf("%s: GetStats = %+v, %v", addr, snap, err)
+		}
+	}
+}
+
+// TestParseAddress verifies scheme handling for client addresses.
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in, network, address string
+		wantErr              bool
+	}{
+		{"/tmp/dbgate.sock", "unix", "/tmp/dbgate.sock", false},
+		{"unix:///var/run/dbgate.sock", "unix", "/var/run/dbgate.sock", false},
+		{"tcp://10.0.0.1:9000", "tcp", "10.0.0.1:9000", false},
+		{"tcp://[::1]:9000", "tcp", "[::1]:9000", false},
+		{"tcp://no-port", "", "", true},
+		{"unix://", "", "", true},
+		{"http://host:80", "", "", true},
+	}
+	for _, tt := range tests {
+		network, address, err := ParseAddress(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAddress(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if network != tt.network || address != tt.address {
+			t.Errorf("ParseAddress(%q) = %q, %q; want %q, %q", tt.in, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+// startMockTLSServer is startMockTCPServer behind TLS, using the httptest
+// certificate (valid for 127.0.0.1). It returns the address and a pool that
+// trusts the server certificate.
+func startMockTLSServer(t *testing.T, respPayload []byte) (string, *x509.CertPool) {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	serverCfg := srv.TLS.Clone()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	srv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go serveOne(ln, respPayload)
+	return "tcp://" + ln.Addr().String(), pool
+}
+
+// TestTLSTransport verifies that a TLS handshake completes before framing when
+// the server certificate is trusted, and that an untrusted certificate fails.
+func TestTLSTransport(t *testing.T) {
+	respJSON := []byte(`{"ok":true}`)
+
+	addr, pool := startMockTLSServer(t, frameResponse(respJSON))
+	c := NewClient(addr, 3*time.Second, WithTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+	resp, err := c.SendCommand("stats")
+	if err != nil {
+		t.Fatalf("SendCommand over TLS: %v", err)
+	}
+	if !resp.OK {
+		t.Errorf("expected OK response, got %+v", resp)
+	}
+
+	addr, _ = startMockTLSServer(t, frameResponse(respJSON))
+	c = NewClient(addr, 3*time.Second, WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	if _, err := c.SendCommand("stats"); err == nil || !strings.Contains(err.Error(), "tls handshake") {
+		t.Errorf("expected handshake failure for untrusted certificate, got: %v", err)
+	}
+}
+
+// startFlakyServer serves frame on a UDS socket but closes the first failures
+// connections without responding. It returns the socket path and a counter
+// of accepted connections.
+func startFlakyServer(t *testing.T, frame []byte, failures int32) (string, *atomic.Int32) {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "flaky.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if accepted.Add(1) <= failures {
+				_ = conn.Close()
+				continue
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				var lenBuf [4]byte
+				if _, err := readFull(conn, lenBuf[:]); err != nil {
+					return
+				}
+				body := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+				if _, err := readFull(conn, body); err != nil {
+					return
+				}
+				_, _ = conn.Write(frame)
+			}()
+		}
+	}()
+	return sockPath, &accepted
+}
+
+// TestRetry_RecoversAfterDroppedConnections verifies that connections closed
+// before a response are retried until the server answers.
+func TestRetry_RecoversAfterDroppedConnections(t *testing.T) {
+	sockPath, accepted := startFlakyServer(t, frameResponse([]byte(`{"ok":true}`)), 2)
+
+	c := NewClient(sockPath, 3*time.Second, WithRetry(3, 10*time.Millisecond))
+	resp, err := c.SendCommand("stats")
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if !resp.OK || accepted.Load() != 3 {
+		t.Errorf("got resp=%+v after %d connections, want OK after 3", resp, accepted.Load())
+	}
+
+	// Without retries the first dropped connection is reported.
+	sockPath, _ = startFlakyServer(t, frameResponse([]byte(`{"ok":true}`)), 1)
+	if _, err := NewClient(sockPath, 3*time.Second).SendCommand("stats"); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("expected ErrNoResponse without retries, got: %v", err)
+	}
+}
+
+// TestRetry_DialFailure verifies that dial errors are retried, and that a
+// server appearing during the backoff is reached.
+func TestRetry_DialFailure(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "late.sock")
+	listening := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ln, err := net.Listen("unix", sockPath)
+		listening <- ln
+		if err != nil {
+			return
+		}
+		serveOne(ln, frameResponse([]byte(`{"ok":true}`)))
+	}()
+
+	c := NewClient(sockPath, 3*time.Second, WithRetry(10, 50*time.Millisecond))
+	_, err := c.SendCommand("stats")
+	if ln := <-listening; ln != nil {
+		_ = ln.Close()
+	}
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+}
+
+// TestRetry_NotOnServerError verifies that an ok:false answer is returned
+// without retrying.
+func TestRetry_NotOnServerError(t *testing.T) {
+	sockPath, accepted := startFlakyServer(t, frameResponse([]byte(`{"ok":false,"error":"boom"}`)), 0)
+
+	c := NewClient(sockPath, 3*time.Second, WithRetry(5, 10*time.Millisecond))
+	resp, err := c.SendCommand("stats")
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if resp.OK || accepted.Load() != 1 {
+		t.Errorf("got resp=%+v after %d connections, want one ok:false", resp, accepted.Load())
+	}
+}
+
+// startBusyServer answers the first busy connections with a CodeBusy
+// response carrying retryAfterMs and later ones with {"ok":true}. It returns
+// the socket path and a channel receiving the time of each request.
+func startBusyServer(t *testing.T, busy int, retryAfterMs int) (string, <-chan time.Time) {
+	t.Helper()
+	busyFrame := frameResponse([]byte(fmt.Sprintf(`{"ok":false,"error":"busy","code":503,"retry_after_ms":%d}`, retryAfterMs)))
+	okFrame := frameResponse([]byte(`{"ok":true}`))
+	accepted := make(chan time.Time, 16)
+	var n atomic.Int32
+	sockPath := startRawServer(t, func(conn net.Conn, _ []byte) bool {
+		accepted <- time.Now()
+		if int(n.Add(1)) <= busy {
+			_, _ = conn.Write(busyFrame)
+		} else {
+			_, _ = conn.Write(okFrame)
+		}
+		return false
+	})
+	return sockPath, accepted
+}
+
+// TestRetry_Busy verifies that busy answers to an idempotent command are
+// retried after the core's retry_after_ms until it succeeds.
+func TestRetry_Busy(t *testing.T) {
+	const retryAfter = 80 * time.Millisecond
+	sockPath, accepted := startBusyServer(t, 2, int(retryAfter.Milliseconds()))
+
+	c := NewClient(sockPath, 3*time.Second, WithRetry(5, time.Millisecond))
+	resp, err := c.SendCommand("stats")
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if !resp.OK {
+		t.Fatalf("got resp=%+v, want OK", resp)
+	}
+	if len(accepted) != 3 {
+		t.Fatalf("got %d connections, want 3", len(accepted))
+	}
+	prev := <-accepted
+	for range 2 {
+		next := <-accepted
+		if gap := next.Sub(prev); gap < retryAfter {
+			t.Errorf("retried after %v, want at least retry_after_ms %v", gap, retryAfter)
+		}
+		prev = next
+	}
+}
+
+// TestRetry_BusyNotRetried verifies that a busy answer is returned as is to
+// a command that is not idempotent, and once retries run out.
+func TestRetry_BusyNotRetried(t *testing.T) {
+	sockPath, accepted := startBusyServer(t, 1, 10)
+	c := NewClient(sockPath, 3*time.Second, WithRetry(5, time.Millisecond))
+	resp, err := c.SendCommand("kill_session")
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if resp.Code != CodeBusy || resp.RetryAfterMs != 10 || len(accepted) != 1 {
+		t.Errorf("got resp=%+v after %d connections, want one busy answer", resp, len(accepted))
+	}
+
+	sockPath, accepted = startBusyServer(t, 5, 10)
+	c = NewClient(sockPath, 3*time.Second, WithRetry(2, time.Millisecond))
+	resp, err = c.SendCommand("stats")
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if resp.Code != CodeBusy || len(accepted) != 2 {
+		t.Errorf("got resp=%+v after %d connections, want busy after 2", resp, len(accepted))
+	}
+}
+
+// TestRetry_RespectsTimeout verifies that retries never run past the client
+// timeout in total.
+func TestRetry_RespectsTimeout(t *testing.T) {
+	sockPath, _ := startFlakyServer(t, nil, math.MaxInt32)
+
+	c := NewClient(sockPath, 300*time.Millisecond, WithRetry(100, 20*time.Millisecond))
+	start := time.Now()
+	if _, err := c.SendCommand("stats"); err == nil {
+		t.Fatal("expected error from a server that always drops connections")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("retries exceeded the timeout budget: %v", elapsed)
+	}
+}
+
+// startStallingServer drains each request and never replies, keeping the
+// connection open until the client closes it. It returns the socket path and
+// a counter of requests received.
+func startStallingServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	var accepted atomic.Int32
+	sockPath := startRawServer(t, func(net.Conn, []byte) bool {
+		accepted.Add(1)
+		return true
+	})
+	return sockPath, &accepted
+}
+
+// TestAttemptTimeout verifies that each attempt against a stalled server is
+// cut off by the attempt timeout and retried until the total budget runs
+// out, so the attempt count is about total/attempt.
+func TestAttemptTimeout(t *testing.T) {
+	sockPath, accepted := startStallingServer(t)
+
+	const total, perAttempt = 500 * time.Millisecond, 100 * time.Millisecond
+	c := NewClient(sockPath, total, WithRetry(100, time.Millisecond), WithAttemptTimeout(perAttempt))
+	start := time.Now()
+	_, err := c.SendCommand("stats")
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got: %v", err)
+	}
+	// The backoff between attempts may push the last one past the budget.
+	want := int32(total / perAttempt)
+	if got := accepted.Load(); got < want-1 || got > want {
+		t.Errorf("made %d attempts, want %d", got, want)
+	}
+	if elapsed > total+200*time.Millisecond {
+		t.Errorf("attempts exceeded the total budget: %v", elapsed)
+	}
+
+	// Without retries the attempt timeout still bounds the single attempt.
+	sockPath, accepted = startStallingServer(t)
+	start = time.Now()
+	_, err = NewClient(sockPath, total, WithAttemptTimeout(perAttempt)).SendCommand("stats")
+	if elapsed := time.Since(start); !errors.Is(err, ErrTimeout) || elapsed > total/2 || accepted.Load() != 1 {
+		t.Errorf("single attempt: err=%v after %v and %d attempts", err, elapsed, accepted.Load())
+	}
+}
+
+// startKeepAliveServer serves frame for every request on a connection until
+// the client closes it. It returns the socket path and a counter of accepted
+// connections.
+func startKeepAliveServer(t testing.TB, frame []byte) (string, *atomic.Int32) {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "keepalive.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer func() { _ = conn.Close() }()
+				for {
+					var lenBuf [4]byte
+					if _, err := readFull(conn, lenBuf[:]); err != nil {
+						return
+					}
+					body := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+					if _, err := readFull(conn, body); err != nil {
+						return
+					}
+					if _, err := conn.Write(frame); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return sockPath, &accepted
+}
+
+// TestKeepAlive_SequentialReuse verifies that sequential requests share one
+// connection and that Close releases it.
+func TestKeepAlive_SequentialReuse(t *testing.T) {
+	sockPath, accepted := startKeepAliveServer(t, frameResponse([]byte(`{"ok":true}`)))
+
+	c := NewClient(sockPath, 3*time.Second, WithKeepAlive())
+	for i := 0; i < 3; i++ {
+		if _, err := c.SendCommand("stats"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("expected 1 connection for 3 requests, got %d", n)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("request after Close: %v", err)
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("expected a new connection after Close, got %d total", n)
+	}
+	_ = c.Close()
+}
+
+// TestKeepAlive_ReconnectAfterEOF verifies that a connection closed by the
+// server between calls is detected and transparently redialed.
+func TestKeepAlive_ReconnectAfterEOF(t *testing.T) {
+	// startFlakyServer with no failures closes each connection after one
+	// response, like the current dbgate core.
+	sockPath, accepted := startFlakyServer(t, frameResponse([]byte(`{"ok":true}`)), 0)
+
+	c := NewClient(sockPath, 3*time.Second, WithKeepAlive())
+	defer func() { _ = c.Close() }()
+	for i := 0; i < 3; i++ {
+		resp, err := c.SendCommand("stats")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if !resp.OK {
+			t.Fatalf("request %d: unexpected response %+v", i, resp)
+		}
+	}
+	if n := accepted.Load(); n != 3 {
+		t.Errorf("expected one redial per request, got %d connections", n)
+	}
+}
+
+// startLosingServer serves frame for every request on a connection until the
+// client closes it, except that the lose-th request overall (1-based) is read
+// in full and answered by closing the connection, as if the response was
+// lost after the server acted on it. It returns the socket path and a counter
+// of requests received.
+func startLosingServer(t *testing.T, frame []byte, lose int32) (string, *atomic.Int32) {
+	t.Helper()
+	var received atomic.Int32
+	sockPath := startRawServer(t, func(conn net.Conn, _ []byte) bool {
+		if received.Add(1) == lose {
+			return false
+		}
+		_, err := conn.Write(frame)
+		return err == nil
+	})
+	return sockPath, &received
+}
+
+// TestResend_OnlyIdempotent verifies that a request whose response was lost
+// after the server read it is resent, on reconnect or by WithRetry, only for
+// idempotent commands or those marked so with WithIdempotent.
+func TestResend_OnlyIdempotent(t *testing.T) {
+	ok := frameResponse([]byte(`{"ok":true}`))
+	tests := []struct {
+		name       string
+		opts       []Option
+		warmUp     bool // send a stats request first so the connection is reused
+		cmd        string
+		lose       int32
+		wantResent bool
+	}{
+		{"keep-alive idempotent", []Option{WithKeepAlive()}, true, "stats", 2, true},
+		{"keep-alive not idempotent", []Option{WithKeepAlive()}, true, "kill_session", 2, false},
+		{"keep-alive override", []Option{WithKeepAlive(), WithIdempotent("kill_session", true)}, true, "kill_session", 2, true},
+		{"keep-alive unknown command", []Option{WithKeepAlive()}, true, "frobnicate", 2, false},
+		{"retry idempotent", []Option{WithRetry(3, time.Millisecond)}, false, "sessions", 1, true},
+		{"retry not idempotent", []Option{WithRetry(3, time.Millisecond)}, false, "stats_reset", 1, false},
+		{"retry override", []Option{WithRetry(3, time.Millisecond), WithIdempotent("stats", false)}, false, "stats", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sockPath, received := startLosingServer(t, ok, tt.lose)
+			c := NewClient(sockPath, 3*time.Second, tt.opts...)
+			defer func() { _ = c.Close() }()
+			if tt.warmUp {
+				if _, err := c.SendCommand("stats"); err != nil {
+					t.Fatalf("warm-up request: %v", err)
+				}
+			}
+
+			_, err := c.SendCommandArgs(tt.cmd, map[string]interface{}{"id": "s1"})
+			want := tt.lose
+			if tt.wantResent {
+				want++
+				if err != nil {
+					t.Fatalf("expected the request to be resent, got: %v", err)
+				}
+			} else if !errors.Is(err, ErrNoResponse) {
+				t.Fatalf("expected the original ErrNoResponse, got: %v", err)
+			}
+			if n := received.Load(); n != want {
+				t.Errorf("server received %d requests, want %d", n, want)
+			}
+		})
+	}
+}
+
+// TestIsIdempotent verifies the default classification of known and unknown
+// commands.
+func TestIsIdempotent(t *testing.T) {
+	for _, cmd := range []string{"stats", "sessions", "ping", "health"} {
+		if !IsIdempotent(cmd) {
+			t.Errorf("IsIdempotent(%q) = false, want true", cmd)
+		}
+	}
+	for _, cmd := range []string{"kill_session", "stats_reset", "policy_reload", "policy_rollback", "frobnicate"} {
+		if IsIdempotent(cmd) {
+			t.Errorf("IsIdempotent(%q) = true, want false", cmd)
+		}
+	}
+}
+
+// TestNegotiate verifies matching, older, and newer server versions.
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverVer    int
+		wantMismatch bool
+	}{
+		{"matching", ProtocolVersion, false},
+		{"newer server", ProtocolVersion + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respJSON, err := json.Marshal(map[string]interface{}{
+				"ok":      true,
+				"payload": map[string]interface{}{"version": tt.serverVer},
+			})
+			if err != nil {
+				t.Fatalf("marshal mock response: %v", err)
+			}
+			sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+
+			got, err := NewClient(sockPath, 3*time.Second).Negotiate()
+			if tt.wantMismatch != errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("Negotiate error = %v, wantMismatch %v", err, tt.wantMismatch)
+			}
+			if !tt.wantMismatch && err != nil {
+				t.Fatalf("Negotiate: %v", err)
+			}
+			if got != tt.serverVer {
+				t.Errorf("server version: got %d, want %d", got, tt.serverVer)
+			}
+
+			var req CommandRequest
+			if err := json.Unmarshal(<-received, &req); err != nil {
+				t.Fatalf("parse request body: %v", err)
+			}
+			if req.Command != "hello" || req.Version != ProtocolVersion {
+				t.Errorf("unexpected request: %+v", req)
+			}
+		})
+	}
+}
+
+// TestNegotiate_NotImplemented verifies that a core without "hello" maps to
+// ErrNotImplemented.
+func TestNegotiate_NotImplemented(t *testing.T) {
+	respJSON := []byte(`{"ok":false,"error":"unknown command 'hello'"}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+	if _, err := c.Negotiate(); !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestSentinelErrors verifies that each failure class is distinguishable with
+// errors.Is while keeping a readable message.
+func TestSentinelErrors(t *testing.T) {
+	stalled := startChunkedServer(t, frameResponse([]byte(`{"ok":true}`)), 4, 2*time.Second)
+	tests := []struct {
+		name    string
+		addr    string
+		want    error
+		notWant error
+		msg     string
+	}{
+		{
+			name:    "not implemented",
+			addr:    startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"not implemented","code":501}`))),
+			want:    ErrNotImplemented,
+			notWant: ErrServerError,
+			msg:     "server error: not implemented",
+		},
+		{
+			name:    "server error",
+			addr:    startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"stats unavailable"}`))),
+			want:    ErrServerError,
+			notWant: ErrNotImplemented,
+			msg:     "server error: stats unavailable",
+		},
+		{
+			name:    "timeout",
+			addr:    stalled,
+			want:    ErrTimeout,
+			notWant: ErrConnect,
+			msg:     "read response",
+		},
+		{
+			name:    "connect",
+			addr:    filepath.Join(t.TempDir(), "missing.sock"),
+			want:    ErrConnect,
+			notWant: ErrTimeout,
+			msg:     "connect to",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.addr, 200*time.Millisecond).GetStats()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected errors.Is(err, %v), got: %v", tt.want, err)
+			}
+			if errors.Is(err, tt.notWant) {
+				t.Errorf("error unexpectedly matches %v: %v", tt.notWant, err)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("error message %q should contain %q", err.Error(), tt.msg)
+			}
+		})
+	}
+}
+
+// TestServerError_Shapes verifies that code and detail of an ok:false answer
+// reach the ServerError, including through helpers that decode their own
+// payloads, and that a flat error string still works.
+func TestServerError_Shapes(t *testing.T) {
+	rich := []byte(`{"ok":false,"error":"policy file rejected","code":422,"detail":{"line":12,"field":"block_statements"}}`)
+	flat := []byte(`{"ok":false,"error":"stats unavailable"}`)
+
+	_, err := NewClient(startMockServer(t, frameResponse(rich)), 3*time.Second).GetStats()
+	var se *ServerError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected a *ServerError, got: %v", err)
+	}
+	if se.Message != "policy file rejected" || se.Code != 422 || se.Detail["line"] != float64(12) || se.Detail["field"] != "block_statements" {
+		t.Errorf("unexpected rich error: %+v", se)
+	}
+	if !errors.Is(err, ErrServerError) || err.Error() != "server error: policy file rejected" {
+		t.Errorf("rich error: got %q", err)
+	}
+
+	_, err = NewClient(startMockServer(t, frameResponse(rich)), 3*time.Second).PolicyReload()
+	if !errors.As(err, &se) || se.Code != 422 || se.Detail["line"] != float64(12) {
+		t.Errorf("PolicyReload: unexpected error: %v", err)
+	}
+
+	_, err = NewClient(startMockServer(t, frameResponse(flat)), 3*time.Second).GetStats()
+	if !errors.As(err, &se) {
+		t.Fatalf("expected a *ServerError, got: %v", err)
+	}
+	if se.Message != "stats unavailable" || se.Code != 0 || se.Detail != nil || !errors.Is(err, ErrServerError) {
+		t.Errorf("unexpected flat error: %+v", se)
+	}
+}
+
+// TestResponseCode verifies that Code is decoded, that a legacy server that
+// omits it still yields 501 for the empty-error placeholder, and that only
+// 501 maps to ErrNotImplemented.
+func TestResponseCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		respJSON string
+		wantCode int
+		wantNI   bool
+	}{
+		{"explicit 501", `{"ok":false,"error":"sessions are coming soon","code":501}`, 501, true},
+		{"legacy empty error", `{"ok":false}`, 501, true},
+		{"other code", `{"ok":false,"error":"bad request","code":400}`, 400, false},
+		{"no code with message", `{"ok":false,"error":"policy store locked"}`, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(startMockServer(t, frameResponse([]byte(tt.respJSON))), 3*time.Second)
+			resp, err := c.SendCommand("sessions")
+			if err != nil {
+				t.Fatalf("SendCommand: %v", err)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("Code: got %d, want %d", resp.Code, tt.wantCode)
+			}
+			if got := errors.Is(resp.Err(), ErrNotImplemented); got != tt.wantNI {
+				t.Errorf("errors.Is(resp.Err(), ErrNotImplemented) = %v, want %v", got, tt.wantNI)
+			}
+		})
+	}
+}
+
+// TestHealth verifies that the health payload is decoded.
+func TestHealth(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"status":"ok","uptime_seconds":3600,` +
+		`"policy_loaded":true,"backend_reachable":true}}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	report, err := c.Health()
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	want := HealthReport{Status: "ok", UptimeSeconds: 3600, PolicyLoaded: true, BackendReachable: true}
+	if *report != want {
+		t.Errorf("got %+v, want %+v", *report, want)
+	}
+}
+
+// TestDryRun verifies that a dry-run client hands each request body to the
+// hook and fails with ErrDryRun without dialing, on the plain and streamed
+// send paths alike.
+func TestDryRun(t *testing.T) {
+	var bodies []string
+	var dials int
+	c := NewClient("/nonexistent/dbgate.sock", time.Second,
+		WithRequestVersion(2),
+		WithDryRun(func(body []byte) { bodies = append(bodies, string(body)) }),
+		WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials++
+			return nil, errors.New("dialed")
+		}))
+
+	if _, err := c.SendCommandArgs("kill_session", map[string]interface{}{"id": "s1"}); !errors.Is(err, ErrDryRun) {
+		t.Errorf("SendCommandArgs: expected ErrDryRun, got %v", err)
+	}
+	if err := c.StreamSessions(context.Background(), SessionFilter{}, func(Session) error { return nil }); !errors.Is(err, ErrDryRun) {
+		t.Errorf("StreamSessions: expected ErrDryRun, got %v", err)
+	}
+	want := []string{
+		`{"command":"kill_session","version":2,"args":{"id":"s1"}}`,
+		`{"command":"sessions","version":2,"args":{"stream":true}}`,
+	}
+	if !reflect.DeepEqual(bodies, want) {
+		t.Errorf("bodies = %q, want %q", bodies, want)
+	}
+	if dials != 0 || c.IOStats().Requests != 0 {
+		t.Errorf("dry run dialed %d times, stats %+v", dials, c.IOStats())
+	}
+}
+
+// TestMaxRequestBytes verifies that an oversized request fails before any
+// byte reaches the server, and that WithMaxRequestBytes raises the limit.
+func TestMaxRequestBytes(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "guard.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var received atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				n, _ := io.Copy(io.Discard, conn)
+				received.Add(n)
+			}()
+		}
+	}()
+
+	args := map[string]interface{}{"blob": strings.Repeat("x", MaxRequestBytes)}
+	c := NewClient(sockPath, time.Second)
+	_, err = c.SendCommandArgs("kill_session", args)
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("expected ErrRequestTooLarge, got: %v", err)
+	}
+	if s := c.IOStats(); s.Requests != 0 || s.BytesSent != 0 {
+		t.Errorf("expected nothing sent, got %+v", s)
+	}
+
+	small := NewClient(sockPath, time.Second, WithMaxRequestBytes(64))
+	if _, err := small.SendCommandArgs("kill_session", map[string]interface{}{"id": strings.Repeat("s", 64)}); !errors.Is(err, ErrRequestTooLarge) {
+		t.Fatalf("expected ErrRequestTooLarge with a 64-byte limit, got: %v", err)
+	}
+
+	// Give the server a moment to account any bytes that did arrive.
+	time.Sleep(20 * time.Millisecond)
+	if n := received.Load(); n != 0 {
+		t.Errorf("server received %d bytes, want 0", n)
+	}
+}
+
+// TestMaxResponseBytes verifies that a configured smaller limit rejects a
+// response with ErrResponseTooLarge carrying the advertised length and the
+// limit, and that a larger limit accepts a frame above the 16 MiB default.
+func TestMaxResponseBytes(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":"` + strings.Repeat("x", 100) + `"}`)
+	small := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second, WithMaxResponseBytes(64))
+	_, err := small.SendCommand("stats")
+	var tooLarge *ResponseTooLargeError
+	if !errors.Is(err, ErrResponseTooLarge) || !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrResponseTooLarge, got: %v", err)
+	}
+	if tooLarge.Length != uint32(len(respJSON)) || tooLarge.Limit != 64 {
+		t.Errorf("got length %d limit %d, want %d and 64", tooLarge.Length, tooLarge.Limit, len(respJSON))
+	}
+
+	big := strings.Repeat("x", MaxResponseBytes+1024)
+	respJSON = []byte(`{"ok":true,"payload":"` + big + `"}`)
+	sock := startMockServer(t, frameResponse(respJSON))
+	if _, err := NewClient(sock, 3*time.Second).SendCommand("stats"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("default limit: expected ErrResponseTooLarge, got: %v", err)
+	}
+
+	sock = startMockServer(t, frameResponse(respJSON))
+	resp, err := NewClient(sock, 3*time.Second, WithMaxResponseBytes(32<<20)).SendCommand("stats")
+	if err != nil {
+		t.Fatalf("SendCommand with 32 MiB limit: %v", err)
+	}
+	if s, _ := resp.Payload.(string); len(s) != len(big) {
+		t.Errorf("payload length %d, want %d", len(s), len(big))
+	}
+}
+
+// TestStreamSessions verifies that a streamed reply is delivered one session
+// at a time until the empty terminating frame.
+func TestStreamSessions(t *testing.T) {
+	var stream []byte
+	stream = append(stream, frameResponse([]byte(`{"ok":true,"stream":true}`))...)
+	for _, id := range []string{"s1", "s2", "s3"} {
+		item := fmt.Sprintf(`{"id":%q,"user":"svc","database":"app","state":"idle","started_at_ms":1700000000000,"query_count":1}`, id)
+		stream = append(stream, frameResponse([]byte(item))...)
+	}
+	stream = append(stream, 0, 0, 0, 0) // terminator
+
+	sockPath, received := startCapturingServer(t, stream)
+	c := NewClient(sockPath, 3*time.Second, WithStrictLengthPrefix())
+
+	var ids []string
+	err := c.StreamSessions(context.Background(), SessionFilter{}, func(s Session) error {
+		if !s.StartedAt.Equal(time.UnixMilli(1700000000000)) {
+			t.Errorf("%s: StartedAt = %v", s.ID, s.StartedAt)
+		}
+		ids = append(ids, s.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamSessions: %v", err)
+	}
+	if strings.Join(ids, ",") != "s1,s2,s3" {
+		t.Errorf("got sessions %v, want [s1 s2 s3]", ids)
+	}
+
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	if req.Command != "sessions" || req.Args["stream"] != true {
+		t.Errorf("unexpected request: %+v", req)
+	}
+}
+
+// TestStreamSessions_Fallback verifies that a regular (non-streamed) payload
+// is delivered through the same callback.
+func TestStreamSessions_Fallback(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":[{"id":"a"},{"id":"b"}]}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	var ids []string
+	err := c.StreamSessions(context.Background(), SessionFilter{}, func(s Session) error {
+		ids = append(ids, s.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamSessions: %v", err)
+	}
+	if strings.Join(ids, ",") != "a,b" {
+		t.Errorf("got sessions %v, want [a b]", ids)
+	}
+}
+
+// TestStreamSessions_Filter verifies that the filter is sent with the stream
+// flag, and that sessions from a core ignoring it are skipped with a warning.
+func TestStreamSessions_Filter(t *testing.T) {
+	var stream []byte
+	stream = append(stream, frameResponse([]byte(`{"ok":true,"stream":true}`))...)
+	stream = append(stream, frameResponse([]byte(`{"id":"s1","user":"bob"}`))...)
+	stream = append(stream, frameResponse([]byte(`{"id":"s2","user":"eve"}`))...)
+	stream = append(stream, 0, 0, 0, 0)
+
+	sockPath, received := startCapturingServer(t, stream)
+	var warnings []string
+	c := NewClient(sockPath, 3*time.Second, WithWarningHandler(func(msg string) { warnings = append(warnings, msg) }))
+
+	var ids []string
+	err := c.StreamSessions(context.Background(), SessionFilter{User: "bob"}, func(s Session) error {
+		ids = append(ids, s.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamSessions: %v", err)
+	}
+	if got := string(<-received); got != `{"command":"sessions","version":1,"args":{"stream":true,"user":"bob"}}` {
+		t.Errorf("request = %s", got)
+	}
+	if strings.Join(ids, ",") != "s1" {
+		t.Errorf("got sessions %v, want [s1]", ids)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "filtered 1 of 2 sessions") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+// TestStreamSessions_CallbackError verifies that an error from the callback
+// stops the stream and is returned unchanged.
+func TestStreamSessions_CallbackError(t *testing.T) {
+	var stream []byte
+	stream = append(stream, frameResponse([]byte(`{"ok":true,"stream":true}`))...)
+	stream = append(stream, frameResponse([]byte(`{"id":"s1"}`))...)
+	stream = append(stream, frameResponse([]byte(`{"id":"s2"}`))...)
+	stream = append(stream, 0, 0, 0, 0)
+	c := NewClient(startMockServer(t, stream), 3*time.Second)
+
+	stopErr := errors.New("stop")
+	calls := 0
+	err := c.StreamSessions(context.Background(), SessionFilter{}, func(Session) error {
+		calls++
+		return stopErr
+	})
+	if !errors.Is(err, stopErr) || calls != 1 {
+		t.Fatalf("expected stop after first session, got err=%v calls=%d", err, calls)
+	}
+}
+
+// startHoldingServer reads one request, sends it on the captured channel,
+// writes stream and then keeps the connection open until the test ends, like
+// a core pushing updates that have not come yet.
+func startHoldingServer(t *testing.T, stream []byte) (string, <-chan []byte) {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "holding.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		_ = ln.Close()
+	})
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		var lenBuf [4]byte
+		if _, err := readFull(conn, lenBuf[:]); err != nil {
+			return
+		}
+		reqBody := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+		if _, err := readFull(conn, reqBody); err != nil {
+			return
+		}
+		received <- reqBody
+		if _, err := conn.Write(stream); err != nil {
+			return
+		}
+		<-done
+	}()
+	return sockPath, received
+}
+
+// TestSubscribeStats verifies that pushed snapshots are delivered in order
+// over one connection and that cancelling ctx ends the subscription with
+// ctx.Err() while the core is still connected.
+func TestSubscribeStats(t *testing.T) {
+	var stream []byte
+	stream = append(stream, frameResponse([]byte(`{"ok":true,"stream":true}`))...)
+	for i := 1; i <= 3; i++ {
+		item := fmt.Sprintf(`{"total_queries":%d,"blocked_queries":0,"qps":%d.5,"block_rate":0,"captured_at_ms":1700000000000}`, i*100, i)
+		stream = append(stream, frameResponse([]byte(item))...)
+	}
+	sockPath, received := startHoldingServer(t, stream)
+	c := NewClient(sockPath, 3*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var totals []uint64
+	err := c.SubscribeStats(ctx, time.Second, func(snap *StatsSnapshot) error {
+		totals = append(totals, snap.TotalQueries)
+		if len(totals) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	if fmt.Sprint(totals) != "[100 200 300]" {
+		t.Errorf("got totals %v, want [100 200 300]", totals)
+	}
+
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	if req.Command != "stats_subscribe" || req.Args["interval_ms"] != float64(1000) {
+		t.Errorf("unexpected request: %+v", req)
+	}
+}
+
+// TestSubscribeStats_EndAndErrors verifies that an empty frame ends the
+// subscription cleanly, that a callback error is returned unchanged, and
+// that a core without stats_subscribe maps to ErrNotImplemented.
+func TestSubscribeStats_EndAndErrors(t *testing.T) {
+	var stream []byte
+	stream = append(stream, frameResponse([]byte(`{"ok":true,"stream":true}`))...)
+	stream = append(stream, frameResponse([]byte(`{"total_queries":1,"captured_at_ms":1700000000000}`))...)
+	stream = append(stream, 0, 0, 0, 0)
+
+	calls := 0
+	err := NewClient(startMockServer(t, stream), 3*time.Second).SubscribeStats(context.Background(), time.Second, func(*StatsSnapshot) error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("ended stream: err=%v calls=%d, want nil after 1", err, calls)
+	}
+
+	stopErr := errors.New("stop")
+	err = NewClient(startMockServer(t, stream), 3*time.Second).SubscribeStats(context.Background(), time.Second, func(*StatsSnapshot) error {
+		return stopErr
+	})
+	if !errors.Is(err, stopErr) {
+		t.Errorf("expected the callback error, got: %v", err)
+	}
+
+	respJSON := []byte(`{"ok":false,"error":"unknown command","code":501}`)
+	err = NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second).SubscribeStats(context.Background(), time.Second, func(*StatsSnapshot) error {
+		t.Error("callback called for a failed subscription")
+		return nil
+	})
+	if !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+
+	if err := NewClient("/unused.sock", time.Second).SubscribeStats(context.Background(), 0, nil); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
+
+// TestValidatePolicy verifies the policy_validate request and that errors
+// are decoded from both objects and bare strings.
+func TestValidatePolicy(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"valid":false,"errors":[` +
+		`{"line":3,"message":"unknown action \"deny\""},"missing rules section"]}}`)
+	sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+	c := NewClient(sockPath, 3*time.Second)
+
+	result, err := c.ValidatePolicy([]byte("rules: []\n"))
+	if err != nil {
+		t.Fatalf("ValidatePolicy: %v", err)
+	}
+	want := PolicyValidation{Errors: []PolicyError{
+		{Line: 3, Message: `unknown action "deny"`},
+		{Message: "missing rules section"},
+	}}
+	if !reflect.DeepEqual(*result, want) {
+		t.Errorf("got %+v, want %+v", *result, want)
+	}
+
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	if req.Command != "policy_validate" || req.Args["policy"] != "rules: []\n" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	notImpl := []byte(`{"ok":false,"error":"not implemented","code":501}`)
+	c = NewClient(startMockServer(t, frameResponse(notImpl)), 3*time.Second)
+	if _, err := c.ValidatePolicy([]byte("x")); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestGetPolicy verifies both accepted policy_show payload shapes.
+func TestGetPolicy(t *testing.T) {
+	for _, respJSON := range []string{
+		`{"ok":true,"payload":"version: 1\n"}`,
+		`{"ok":true,"payload":{"policy":"version: 1\n","version":4}}`,
+	} {
+		c := NewClient(startMockServer(t, frameResponse([]byte(respJSON))), 3*time.Second)
+		doc, err := c.GetPolicy()
+		if err != nil {
+			t.Fatalf("GetPolicy(%s): %v", respJSON, err)
+		}
+		if string(doc) != "version: 1\n" {
+			t.Errorf("GetPolicy(%s) = %q", respJSON, doc)
+		}
+	}
+}
+
+// TestServerVersion verifies that the version payload is decoded.
+func TestServerVersion(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"version":"0.4.0","build_hash":"3f2a9c1","protocol_version":1}}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	info, err := c.ServerVersion()
+	if err != nil {
+		t.Fatalf("ServerVersion: %v", err)
+	}
+	want := VersionInfo{Version: "0.4.0", BuildHash: "3f2a9c1", ProtocolVersion: 1}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+}
+
+// TestCapabilities verifies that the command list is decoded and sorted, that
+// a missing list is empty rather than nil, and that an older core's 501 maps
+// to ErrNotImplemented.
+func TestCapabilities(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		resp string
+		want []string
+	}{
+		{"list", `{"ok":true,"payload":{"commands":["version","stats","sessions"]}}`, []string{"sessions", "stats", "version"}},
+		{"no payload", `{"ok":true}`, []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewClient(startMockServer(t, frameResponse([]byte(tt.resp))), 3*time.Second).Capabilities()
+			if err != nil {
+				t.Fatalf("Capabilities: %v", err)
+			}
+			if got == nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	respJSON := []byte(`{"ok":false,"error":"unknown command","code":501}`)
+	_, err := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second).Capabilities()
+	if !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("expected ErrNotImplemented, got: %v", err)
+	}
+}
+
+// TestDo_CustomStruct verifies that Do sends cmd and args and decodes the
+// payload into a caller-defined struct.
+func TestDo_CustomStruct(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"name":"orders","rows":42}}`)
+	sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+	c := NewClient(sockPath, 3*time.Second)
+
+	var out struct {
+		Name string `json:"name"`
+		Rows int    `json:"rows"`
+	}
+	args := map[string]interface{}{"table": "orders"}
+	if err := c.Do(context.Background(), "table_info", args, &out); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if out.Name != "orders" || out.Rows != 42 {
+		t.Errorf("unexpected payload: %+v", out)
+	}
+
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil {
+		t.Fatalf("parse request body: %v", err)
+	}
+	if req.Command != "table_info" || !reflect.DeepEqual(req.Args, args) {
+		t.Errorf("unexpected request: %+v", req)
+	}
+}
+
+// TestDo_Map verifies decoding into a map, and that a nil out discards the
+// payload.
+func TestDo_Map(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"status":"ok","uptime_seconds":7}}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	var out map[string]interface{}
+	if err := c.Do(context.Background(), "health", nil, &out); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if out["status"] != "ok" || out["uptime_seconds"] != float64(7) {
+		t.Errorf("unexpected payload: %v", out)
+	}
+
+	c = NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+	if err := c.Do(context.Background(), "health", nil, nil); err != nil {
+		t.Errorf("Do with nil out: %v", err)
+	}
+}
+
+// TestDo_ServerError verifies that ok:false surfaces as a ServerError and
+// that out is left untouched.
+func TestDo_ServerError(t *testing.T) {
+	respJSON := []byte(`{"ok":false,"error":"unknown command: table_info","code":501}`)
+	c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second)
+
+	out := map[string]interface{}{"keep": true}
+	err := c.Do(context.Background(), "table_info", nil, &out)
+	var se *ServerError
+	if !errors.As(err, &se) || !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("expected not-implemented ServerError, got %v", err)
+	}
+	if len(out) != 1 || out["keep"] != true {
+		t.Errorf("out was modified: %v", out)
+	}
+}
+
+// TestProtocolError_Phases verifies the phase recorded for a refused dial, a
+// truncated body and an undecodable response, and that the underlying errors
+// remain reachable through errors.Is.
+func TestProtocolError_Phases(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	refused := "tcp://" + ln.Addr().String()
+	_ = ln.Close()
+
+	truncated := make([]byte, 4, 14)
+	binary.LittleEndian.PutUint32(truncated, 100)
+	truncated = append(truncated, `{"ok":true`...)
+
+	tests := []struct {
+		name      string
+		addr      string
+		wantPhase Phase
+		wantIs    error
+	}{
+		{"refused dial", refused, PhaseDial, syscall.ECONNREFUSED},
+		{"partial body", startMockServer(t, truncated), PhaseReadBody, io.ErrUnexpectedEOF},
+		{"garbage JSON", startMockServer(t, frameResponse([]byte("<html>oops</html>"))), PhaseDecode, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.addr, time.Second).SendCommand("stats")
+			var pe *ProtocolError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected *ProtocolError, got %T: %v", err, err)
+			}
+			if pe.Phase != tt.wantPhase {
+				t.Errorf("phase: got %q, want %q", pe.Phase, tt.wantPhase)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.wantIs)
+			}
+		})
+	}
+}
+
+// TestTruncatedResponse verifies that a body cut short by the server closing
+// the connection reports how many bytes were announced and received.
+func TestTruncatedResponse(t *testing.T) {
+	frame := make([]byte, 4, 44)
+	binary.LittleEndian.PutUint32(frame, 100)
+	frame = append(frame, strings.Repeat("x", 40)...)
+
+	_, err := NewClient(startMockServer(t, frame), time.Second).SendCommand("stats")
+	var te *TruncatedResponseError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected *TruncatedResponseError, got %T: %v", err, err)
+	}
+	if te.Expected != 100 || te.Received != 40 {
+		t.Errorf("got %d expected / %d received, want 100 / 40", te.Expected, te.Received)
+	}
+	if !errors.Is(err, ErrTruncatedResponse) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("error should match ErrTruncatedResponse and io.ErrUnexpectedEOF: %v", err)
+	}
+	if !strings.Contains(err.Error(), "got 40 of 100 bytes") {
+		t.Errorf("message does not report the byte counts: %v", err)
+	}
+}
+
+// startRawServer serves every connection it accepts, concurrently: it reads
+// each request frame with ReadFrame and hands it to respond with the
+// connection, until respond returns false or the client closes the
+// connection.
+func startRawServer(t *testing.T, respond func(conn net.Conn, req []byte) bool) string {
+	t.Helper()
+	sockPath := filepath.Join(t.TempDir(), "raw.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				for {
+					req, err := ReadFrame(conn, MaxResponseBytes)
+					if err != nil || !respond(conn, req) {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return sockPath
+}
+
+// TestHeaderRead_StallTimeout verifies that a response header cut off by the
+// deadline is reported as ErrTimeout wrapping os.ErrDeadlineExceeded.
+func TestHeaderRead_StallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	sockPath := startRawServer(t, func(conn net.Conn, _ []byte) bool {
+		_, _ = conn.Write([]byte{0x10, 0x00}) // half of the length prefix
+		<-release
+		return false
+	})
+
+	_, err := NewClient(sockPath, 150*time.Millisecond).SendCommand("stats")
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected ErrTimeout wrapping os.ErrDeadlineExceeded, got: %v", err)
+	}
+	if errors.Is(err, ErrNoResponse) {
+		t.Errorf("a stalled header must not be reported as ErrNoResponse: %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 of 4 header bytes") {
+		t.Errorf("message should say how much of the header arrived: %v", err)
+	}
+}
+
+// TestHeaderRead_ClosedWithoutReply verifies that a connection closed right
+// after the request is reported as ErrNoResponse, not as a timeout.
+func TestHeaderRead_ClosedWithoutReply(t *testing.T) {
+	sockPath := startRawServer(t, func(net.Conn, []byte) bool { return false })
+
+	_, err := NewClient(sockPath, time.Second).SendCommand("stats")
+	if !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("expected ErrNoResponse, got: %v", err)
+	}
+	if errors.Is(err, ErrTimeout) {
+		t.Errorf("an immediate close must not be reported as a timeout: %v", err)
+	}
+}
+
+// TestObserver verifies that the observer receives plausibly ordered phase
+// durations for a slow core, the error of a failed command, and that a
+// panicking observer does not break the request.
+func TestObserver(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	sockPath := startRawServer(t, func(conn net.Conn, _ []byte) bool {
+		time.Sleep(delay)
+		_, _ = conn.Write(frameResponse([]byte(`{"ok":true}`)))
+		return false
+	})
+
+	var got []CommandMetrics
+	c := NewClient(sockPath, 3*time.Second, WithObserver(func(m CommandMetrics) { got = append(got, m) }))
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("observer called %d times, want 1", len(got))
+	}
+	m := got[0]
+	if m.Command != "stats" || m.Err != nil {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+	if m.DialDuration <= 0 || m.WriteDuration <= 0 || m.ReadDuration < delay {
+		t.Errorf("implausible phases: %+v", m)
+	}
+	if sum := m.DialDuration + m.WriteDuration + m.ReadDuration; m.TotalDuration < sum {
+		t.Errorf("total %v is less than the phases' sum %v", m.TotalDuration, sum)
+	}
+
+	got = nil
+	missing := NewClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second,
+		WithObserver(func(m CommandMetrics) { got = append(got, m) }))
+	_, err := missing.SendCommand("health")
+	if len(got) != 1 || !errors.Is(got[0].Err, ErrConnect) || got[0].Err != err || got[0].ReadDuration != 0 {
+		t.Errorf("failed command metrics = %+v, want ErrConnect and no read", got)
+	}
+
+	var warnings []string
+	panicky := NewClient(startMockServer(t, frameResponse([]byte(`{"ok":true}`))), 3*time.Second,
+		WithObserver(func(CommandMetrics) { panic("boom") }),
+		WithWarningHandler(func(msg string) { warnings = append(warnings, msg) }))
+	if _, err := panicky.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand with panicking observer: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "boom") {
+		t.Errorf("warnings = %q, want the recovered panic", warnings)
+	}
+}
+
+// TestLogger verifies what WithLogger records at Info, Debug and LevelTrace.
+func TestLogger(t *testing.T) {
+	respJSON := []byte(`{"ok":true}`)
+	for _, tt := range []struct {
+		level       slog.Level
+		want, avoid []string
+	}{
+		{slog.LevelInfo, []string{`msg="sending command" command=stats addr=`}, []string{"bytes_written", "hex="}},
+		{slog.LevelDebug, []string{"sending command", "bytes_written=", "bytes_read=15", "msg=\"command done\" command=stats duration="}, []string{"hex="}},
+		{LevelTrace, []string{"dump_bytes=11", `7b 22 6f 6b 22`}, nil},
+	} {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: tt.level}))
+		c := NewClient(startMockServer(t, frameResponse(respJSON)), 3*time.Second, WithLogger(logger))
+		if _, err := c.SendCommand("stats"); err != nil {
+			t.Fatalf("SendCommand: %v", err)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(buf.String(), w) {
+				t.Errorf("level %v: log missing %q:\n%s", tt.level, w, buf.String())
+			}
+		}
+		for _, a := range tt.avoid {
+			if strings.Contains(buf.String(), a) {
+				t.Errorf("level %v: log should not contain %q:\n%s", tt.level, a, buf.String())
+			}
+		}
+	}
+}
+
+// TestSocketPathCheck verifies that a missing path and a path that is not a
+// socket fail with their own sentinels, both also matching ErrConnect.
+func TestSocketPathCheck(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "dbgate.sock")
+	if err := os.WriteFile(regular, []byte("not a socket"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    error
+		notWant error
+		msg     string
+	}{
+		{"regular file", regular, ErrNotASocket, ErrSocketNotFound, "is a regular file"},
+		{"directory", dir, ErrNotASocket, ErrSocketNotFound, "is a directory"},
+		{"missing", filepath.Join(dir, "missing.sock"), ErrSocketNotFound, ErrNotASocket, "does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.path, time.Second).SendCommand("stats")
+			if !errors.Is(err, tt.want) || !errors.Is(err, ErrConnect) || errors.Is(err, tt.notWant) {
+				t.Fatalf("expected %v and ErrConnect, got: %v", tt.want, err)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("error %q does not contain %q", err, tt.msg)
+			}
+		})
+	}
+
+	// TCP addresses are not checked.
+	_, err := NewClient("tcp://127.0.0.1:1", time.Second).SendCommand("stats")
+	if err == nil || errors.Is(err, ErrSocketNotFound) || errors.Is(err, ErrNotASocket) {
+		t.Errorf("expected a plain dial error for TCP, got: %v", err)
+	}
+}
+
+// TestWithDialer verifies that a custom dialer is used with the parsed
+// network and address, here handing the client one end of a net.Pipe with a
+// scripted server on the other.
+func TestWithDialer(t *testing.T) {
+	var gotNetwork, gotAddr string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		gotNetwork, gotAddr = network, addr
+		clientEnd, serverEnd := net.Pipe()
+		go func() {
+			defer func() { _ = serverEnd.Close() }()
+			if _, err := ReadFrame(serverEnd, MaxResponseBytes); err != nil {
+				return
+			}
+			_, _ = serverEnd.Write(frameResponse([]byte(`{"ok":true,"payload":{"status":"ok"}}`)))
+		}()
+		return clientEnd, nil
+	}
+
+	c := NewClient("tcp://dbgate.internal:9000", 3*time.Second, WithDialer(dial))
+	report, err := c.Health()
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if report.Status != "ok" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if gotNetwork != "tcp" || gotAddr != "dbgate.internal:9000" {
+		t.Errorf("dialer got %q %q", gotNetwork, gotAddr)
+	}
+
+	failing := NewClient("/unused.sock", time.Second, WithDialer(func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("proxy refused")
+	}))
+	if _, err := failing.SendCommand("stats"); !errors.Is(err, ErrConnect) || !strings.Contains(err.Error(), "proxy refused") {
+		t.Errorf("expected ErrConnect from the dialer, got: %v", err)
+	}
+}
+
+// TestCompression verifies that WithCompression asks for compression, that a
+// gzipped session list is decoded like a plain one, and that a core ignoring
+// the flag still works; without the option the flag is not sent and a
+// gzipped reply is rejected.
+func TestCompression(t *testing.T) {
+	var sessions []string
+	for i := range 500 {
+		sessions = append(sessions, fmt.Sprintf(`{"id":"s%d","client_addr":"10.0.0.%d:5000","database":"app","user":"svc","state":"idle","query_count":%d}`, i, i%250, i))
+	}
+	respJSON := []byte(`{"ok":true,"payload":[` + strings.Join(sessions, ",") + `]}`)
+
+	for _, tt := range []struct {
+		name  string
+		frame []byte
+	}{
+		{"gzip", gzipFrame(t, respJSON)},
+		{"ignored", frameResponse(respJSON)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sockPath, received := startCapturingServer(t, tt.frame)
+			got, err := NewClient(sockPath, 3*time.Second, WithCompression()).ListSessions()
+			if err != nil {
+				t.Fatalf("ListSessions: %v", err)
+			}
+			if len(got) != 500 || got[499].ID != "s499" || got[499].QueryCount != 499 {
+				t.Errorf("unexpected sessions: %d, last %+v", len(got), got[len(got)-1])
+			}
+			var req CommandRequest
+			if err := json.Unmarshal(<-received, &req); err != nil || !req.Compress {
+				t.Errorf("request did not ask for compression: %+v, %v", req, err)
+			}
+		})
+	}
+
+	sockPath, received := startCapturingServer(t, frameResponse([]byte(`{"ok":true}`)))
+	if _, err := NewClient(sockPath, 3*time.Second).SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if body := <-received; bytes.Contains(body, []byte("compress")) {
+		t.Errorf("compress flag sent without WithCompression: %s", body)
+	}
+
+	sockPath, _ = startCapturingServer(t, gzipFrame(t, respJSON))
+	_, err := NewClient(sockPath, 3*time.Second).ListSessions()
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.Phase != PhaseReadHeader || !strings.Contains(err.Error(), "compression was not requested") {
+		t.Errorf("unrequested gzip frame: expected a header ProtocolError, got %v", err)
+	}
+}
+
+// TestRequestCompression verifies that WithRequestCompression sends a large
+// request compressed, which the server reads back intact.
+func TestRequestCompression(t *testing.T) {
+	policy := strings.Repeat("rules: []\n", MinCompressBytes)
+	received := make(chan []byte, 1)
+	sockPath := startRawServer(t, func(conn net.Conn, req []byte) bool {
+		received <- req
+		_, _ = conn.Write(frameResponse([]byte(`{"ok":true}`)))
+		return false
+	})
+	c := NewClient(sockPath, 3*time.Second, WithRequestCompression())
+	if _, err := c.SendCommandArgs("policy_validate", map[string]interface{}{"policy": policy}); err != nil {
+		t.Fatalf("SendCommandArgs: %v", err)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil || req.Args["policy"] != policy {
+		t.Fatalf("server read %+v, %v; want the policy intact", req.Command, err)
+	}
+	if got := c.IOStats().BytesSent; got >= uint64(len(policy)) {
+		t.Errorf("sent %d bytes for a %d-byte policy, want it compressed", got, len(policy))
+	}
+}
+
+// TestMaxResponseBytes_Cap verifies that a limit the length prefix cannot
+// express is lowered to MaxFrameLength.
+func TestMaxResponseBytes_Cap(t *testing.T) {
+	if got := NewClient("unused.sock", time.Second, WithMaxResponseBytes(^uint32(0))).maxResponseBytes; got != MaxFrameLength {
+		t.Errorf("limit = %d, want %d", got, MaxFrameLength)
+	}
+}
+
+// startDispatchServer starts a server that keeps each connection open and
+// answers "hello" with ProtocolVersion and every other command with
+// benchStatsJSON, counting the hellos it receives.
+func startDispatchServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	helloFrame := frameResponse([]byte(fmt.Sprintf(`{"ok":true,"payload":{"version":%d}}`, ProtocolVersion)))
+	statsFrame := frameResponse(benchStatsJSON)
+	var hellos atomic.Int32
+	sockPath := startRawServer(t, func(conn net.Conn, body []byte) bool {
+		frame := statsFrame
+		var req CommandRequest
+		if json.Unmarshal(body, &req) == nil && req.Command == "hello" {
+			hellos.Add(1)
+			frame = helloFrame
+		}
+		_, err := conn.Write(frame)
+		return err == nil
+	})
+	return sockPath, &hellos
+}
+
+// TestClient_Concurrent fires many requests at one client from several
+// goroutines, with and without keep-alive, while reading its shared state.
+// Run with -race, it checks that the persistent connection, the negotiated
+// version and the pooled payload buffers are not raced on.
+func TestClient_Concurrent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"one-shot", nil},
+		{"keep-alive", []Option{WithKeepAlive()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sockPath, hellos := startDispatchServer(t)
+			c := NewClient(sockPath, 5*time.Second, append(tt.opts, WithVersionCheck())...)
+			t.Cleanup(func() { _ = c.Close() })
+
+			const workers, calls = 16, 20
+			var wg sync.WaitGroup
+			for w := range workers {
+				wg.Go(func() {
+					var snap StatsSnapshot
+					for i := range calls {
+						var err error
+						switch (w + i) % 3 {
+						case 0:
+							var resp *Response
+							resp, err = c.SendCommand("stats")
+							if err == nil && !resp.OK {
+								err = resp.Err()
+							}
+						case 1:
+							var got *StatsSnapshot
+							got, err = c.GetStats()
+							if err == nil && got.TotalQueries != 1250 {
+								err = fmt.Errorf("total_queries = %d, want 1250", got.TotalQueries)
+							}
+						default:
+							err = c.GetStatsInto(&snap)
+						}
+						if err != nil {
+							t.Errorf("worker %d call %d: %v", w, i, err)
+							return
+						}
+						_ = c.NegotiatedVersion()
+						_ = c.IOStats()
+					}
+				})
+			}
+			wg.Wait()
+
+			if got := hellos.Load(); got != 1 {
+				t.Errorf("hello sent %d times, want 1", got)
+			}
+			if got := c.NegotiatedVersion(); got != ProtocolVersion {
+				t.Errorf("NegotiatedVersion = %d, want %d", got, ProtocolVersion)
+			}
+			if got, want := c.IOStats().Requests, uint64(workers*calls+1); got != want {
+				t.Errorf("requests = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+// benchStatsJSON is a representative stats response for the GetStats
+// benchmarks.
+var benchStatsJSON = []byte(`{"ok":true,"payload":{"total_connections":42,"active_sessions":3,` +
+	`"total_queries":1250,"blocked_queries":15,"monitored_blocks":2,"qps":25.5,"block_rate":0.012,"captured_at_ms":1740218645123}}`)
+
+// BenchmarkGetStats measures one stats poll over a kept-alive connection,
+// allocating a fresh snapshot per call.
+func BenchmarkGetStats(b *testing.B) {
+	sockPath, _ := startKeepAliveServer(b, frameResponse(benchStatsJSON))
+	c := NewClient(sockPath, 3*time.Second, WithKeepAlive())
+	defer func() { _ = c.Close() }()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := c.GetStats(); err != nil {
+			b.Fatalf("GetStats: %v", err)
+		}
+	}
+}
+
+// BenchmarkGetStatsInto is BenchmarkGetStats reusing one snapshot.
+func BenchmarkGetStatsInto(b *testing.B) {
+	sockPath, _ := startKeepAliveServer(b, frameResponse(benchStatsJSON))
+	c := NewClient(sockPath, 3*time.Second, WithKeepAlive())
+	defer func() { _ = c.Close() }()
+
+	var snap StatsSnapshot
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := c.GetStatsInto(&snap); err != nil {
+			b.Fatalf("GetStatsInto: %v", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package client
+
+import "encoding/json"
+
+// Codec marshals requests and unmarshals responses and their payloads. The
+// default, StdlibCodec(), wraps encoding/json; WithCodec swaps in a faster
+// implementation with the same semantics, such as json-iterator or Sonic.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// StdlibCodec returns the default Codec, backed by encoding/json.
+func StdlibCodec() Codec {
+	return stdlibCodec{}
+}
+
+// stdlibCodec implements StdlibCodec. The client recognizes it by type to
+// take encoding/json fast paths.
+type stdlibCodec struct{}
+
+func (stdlibCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (stdlibCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// WithCodec makes the client encode requests and decode responses, stream
+// items and payloads with codec instead of encoding/json. The codec must
+// honor the json struct tags and json.Unmarshaler implementations of this
+// package's types. A nil codec keeps StdlibCodec().
+func WithCodec(codec Codec) Option {
+	return func(c *Client) {
+		if codec != nil {
+			c.codec = codec
+		}
+	}
+}
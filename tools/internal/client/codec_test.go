@@ -0,0 +1,49 @@
+package client
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingCodec is an encoding/json Codec recording how often each method is
+// called.
+type countingCodec struct {
+	marshals, unmarshals atomic.Int32
+}
+
+func (c *countingCodec) Marshal(v any) ([]byte, error) {
+	c.marshals.Add(1)
+	return json.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v any) error {
+	c.unmarshals.Add(1)
+	return json.Unmarshal(data, v)
+}
+
+// TestWithCodec verifies that the configured codec encodes the request and
+// decodes both the response and its payload.
+func TestWithCodec(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"total_queries":7,"qps":1.5,"captured_at_ms":0}}`)
+	sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+
+	codec := &countingCodec{}
+	snap, err := NewClient(sockPath, 3*time.Second, WithCodec(codec)).GetStats()
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if snap.TotalQueries != 7 || snap.QPS != 1.5 {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+	var req CommandRequest
+	if err := json.Unmarshal(<-received, &req); err != nil || req.Command != "stats" {
+		t.Errorf("unexpected request %+v: %v", req, err)
+	}
+	// Marshal: the request and the payload re-marshal. Unmarshal: the
+	// response and the payload.
+	if m, u := codec.marshals.Load(), codec.unmarshals.Load(); m != 2 || u != 2 {
+		t.Errorf("codec calls: %d marshal, %d unmarshal; want 2 and 2", m, u)
+	}
+}
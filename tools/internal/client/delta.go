@@ -0,0 +1,31 @@
+package client
+
+// ComputeDelta returns the observed rates between snapshot a and the later
+// snapshot b. If a counter in b is lower than in a the core was restarted or
+// the counter wrapped; that counter's growth is reported as 0 and Reset is
+// set. QPS is 0 when no time elapsed and BlockRate is 0 when no queries were
+// observed.
+func ComputeDelta(a, b *StatsSnapshot) DeltaStats {
+	var d DeltaStats
+	d.Elapsed = b.CapturedAt.Sub(a.CapturedAt)
+
+	if b.TotalQueries < a.TotalQueries {
+		// After a reset blocked_queries is not comparable either.
+		d.Reset = true
+		return d
+	}
+	d.Queries = b.TotalQueries - a.TotalQueries
+	if b.BlockedQueries < a.BlockedQueries {
+		d.Reset = true
+	} else {
+		d.BlockedQueries = b.BlockedQueries - a.BlockedQueries
+	}
+
+	if secs := d.Elapsed.Seconds(); secs > 0 {
+		d.QPS = float64(d.Queries) / secs
+	}
+	if d.Queries > 0 {
+		d.BlockRate = float64(d.BlockedQueries) / float64(d.Queries)
+	}
+	return d
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// TestComputeDelta verifies the observed rates, including counter resets and
+// the division-by-zero cases.
+func TestComputeDelta(t *testing.T) {
+	t0 := time.UnixMilli(1700000000000).UTC()
+	tests := []struct {
+		name string
+		a, b StatsSnapshot
+		want DeltaStats
+	}{
+		{
+			name: "steady growth",
+			a:    StatsSnapshot{TotalQueries: 1000, BlockedQueries: 10, CapturedAt: t0},
+			b:    StatsSnapshot{TotalQueries: 1500, BlockedQueries: 60, CapturedAt: t0.Add(10 * time.Second)},
+			want: DeltaStats{Elapsed: 10 * time.Second, Queries: 500, BlockedQueries: 50, QPS: 50, BlockRate: 0.1},
+		},
+		{
+			name: "total wrapped",
+			a:    StatsSnapshot{TotalQueries: 1000, BlockedQueries: 10, CapturedAt: t0},
+			b:    StatsSnapshot{TotalQueries: 20, BlockedQueries: 2, CapturedAt: t0.Add(10 * time.Second)},
+			want: DeltaStats{Elapsed: 10 * time.Second, Reset: true},
+		},
+		{
+			name: "blocked wrapped",
+			a:    StatsSnapshot{TotalQueries: 1000, BlockedQueries: 10, CapturedAt: t0},
+			b:    StatsSnapshot{TotalQueries: 1100, BlockedQueries: 5, CapturedAt: t0.Add(10 * time.Second)},
+			want: DeltaStats{Elapsed: 10 * time.Second, Queries: 100, QPS: 10, Reset: true},
+		},
+		{
+			name: "no queries",
+			a:    StatsSnapshot{TotalQueries: 1000, BlockedQueries: 10, CapturedAt: t0},
+			b:    StatsSnapshot{TotalQueries: 1000, BlockedQueries: 10, CapturedAt: t0.Add(10 * time.Second)},
+			want: DeltaStats{Elapsed: 10 * time.Second},
+		},
+		{
+			name: "no time elapsed",
+			a:    StatsSnapshot{TotalQueries: 1000, CapturedAt: t0},
+			b:    StatsSnapshot{TotalQueries: 1100, BlockedQueries: 1, CapturedAt: t0},
+			want: DeltaStats{Queries: 100, BlockedQueries: 1, BlockRate: 0.01},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeDelta(&tt.a, &tt.b); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
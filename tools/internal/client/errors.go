@@ -0,0 +1,221 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrNotImplemented is returned when the core does not implement a
+	// command, either as the explicit 501 "not implemented" placeholder or by
+	// rejecting it as an unknown command.
+	ErrNotImplemented = errors.New("not implemented by server")
+
+	// ErrServerError matches a *ServerError for which the core answered
+	// ok:false for a reason other than not implementing the command.
+	ErrServerError = errors.New("server error")
+
+	// ErrTimeout matches errors caused by the request deadline (the client
+	// timeout, a read budget, or the caller's context deadline) expiring.
+	ErrTimeout = errors.New("request timed out")
+
+	// ErrConnect matches errors from connecting to the core, including TLS
+	// handshake failures and invalid addresses.
+	ErrConnect = errors.New("connect failed")
+
+	// ErrSocketNotFound is returned, along with ErrConnect, when the Unix
+	// socket path does not exist, e.g. because the core is not running or
+	// the path is misspelled.
+	ErrSocketNotFound = errors.New("socket not found")
+
+	// ErrNotASocket is returned, along with ErrConnect, when the Unix socket
+	// path exists but is not a socket, e.g. a regular file or a directory.
+	ErrNotASocket = errors.New("not a socket")
+
+	// ErrNonFiniteStat is returned by GetStats in strict mode when the server
+	// reports NaN or Inf for a floating-point stats field.
+	ErrNonFiniteStat = errors.New("non-finite stats value")
+
+	// ErrRequestTooLarge is returned when a marshaled request exceeds the
+	// client's MaxRequestBytes limit. Nothing is sent in that case.
+	ErrRequestTooLarge = errors.New("request too large")
+
+	// ErrDryRun is returned instead of sending a request when the client was
+	// built with WithDryRun. The request was handed to the dry-run hook and
+	// no connection was made.
+	ErrDryRun = errors.New("dry run: request not sent")
+
+	// ErrResponseTooLarge matches a *ResponseTooLargeError: the core
+	// announced a response frame longer than the client's limit.
+	ErrResponseTooLarge = errors.New("response too large")
+
+	// ErrTruncatedResponse matches a *TruncatedResponseError: the core
+	// closed the connection before sending the whole response frame.
+	ErrTruncatedResponse = errors.New("response truncated")
+
+	// ErrVersionMismatch is returned by Negotiate when the server speaks a
+	// newer protocol version than ProtocolVersion.
+	ErrVersionMismatch = errors.New("protocol version mismatch")
+
+	// ErrNoResponse is returned when the core closed the connection without
+	// sending any response bytes, e.g. while restarting. The request was most
+	// likely not processed, so it is safe to retry (see WithRetry).
+	ErrNoResponse = errors.New("connection closed before response")
+)
+
+// Phase identifies the stage of a request/response exchange at which a
+// ProtocolError occurred.
+type Phase string
+
+// Phases of an exchange, in order.
+const (
+	PhaseDial       Phase = "dial"        // connecting, including the TLS handshake
+	PhaseWrite      Phase = "write"       // sending the request frame
+	PhaseReadHeader Phase = "read header" // reading the 4-byte length prefix
+	PhaseReadBody   Phase = "read body"   // reading the response body
+	PhaseDecode     Phase = "decode"      // parsing the response JSON
+)
+
+// ProtocolError records the exchange phase at which a transport or framing
+// failure happened. Its message is the underlying error's, and errors.Is and
+// errors.As see through it to Err.
+type ProtocolError struct {
+	Phase Phase
+	Err   error
+}
+
+// Error implements error.
+func (e *ProtocolError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// ServerError is an ok:false answer from the core, carrying its message and,
+// when the core sends them, its code and structured detail. A core that only
+// sends the error string leaves Code zero and Detail nil. It matches
+// ErrNotImplemented with errors.Is if NotImplemented is set, and
+// ErrServerError otherwise, so callers can tell the two apart.
+type ServerError struct {
+	Message        string
+	Code           int
+	Detail         map[string]interface{}
+	NotImplemented bool
+}
+
+// Error implements error.
+func (e *ServerError) Error() string {
+	return "server error: " + e.Message
+}
+
+// Is reports whether target is the sentinel this error matches.
+func (e *ServerError) Is(target error) bool {
+	if e.NotImplemented {
+		return target == ErrNotImplemented
+	}
+	return target == ErrServerError
+}
+
+// ResponseTooLargeError reports a frame whose declared length exceeds the
+// read limit (see WithMaxResponseBytes). It matches ErrResponseTooLarge with
+// errors.Is.
+type ResponseTooLargeError struct {
+	Length uint32 // length announced in the frame header
+	Limit  uint32 // largest length the reader accepts
+}
+
+// Error implements error.
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("invalid frame length %d: %v (limit is %d bytes)", e.Length, ErrResponseTooLarge, e.Limit)
+}
+
+// Is reports whether target is ErrResponseTooLarge.
+func (e *ResponseTooLargeError) Is(target error) bool {
+	return target == ErrResponseTooLarge
+}
+
+// TruncatedResponseError reports a response frame whose body ended early,
+// typically because the core died mid-write. It matches ErrTruncatedResponse
+// with errors.Is, and io.ErrUnexpectedEOF through Unwrap.
+type TruncatedResponseError struct {
+	Expected uint32 // body length announced in the frame header
+	Received uint32 // body bytes read before the connection closed
+}
+
+// Error implements error.
+func (e *TruncatedResponseError) Error() string {
+	return fmt.Sprintf("%v: got %d of %d bytes", ErrTruncatedResponse, e.Received, e.Expected)
+}
+
+// Is reports whether target is ErrTruncatedResponse.
+func (e *TruncatedResponseError) Is(target error) bool {
+	return target == ErrTruncatedResponse
+}
+
+// Unwrap returns io.ErrUnexpectedEOF.
+func (e *TruncatedResponseError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// kindError tags err with one of the exported sentinel errors while keeping
+// err's message, so errors.Is matches both the sentinel and err's own chain.
+type kindError struct {
+	kind error
+	err  error
+}
+
+// Error implements error.
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns both the sentinel and the underlying error.
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Err returns nil for an ok:true response and a *ServerError otherwise. The
+// error matches ErrNotImplemented if the core does not implement the command,
+// and ErrServerError for any other failure.
+func (r *Response) Err() error {
+	if r.OK {
+		return nil
+	}
+	if r.notImplemented() {
+		msg := r.Error
+		if msg == "" {
+			msg = "not implemented"
+		}
+		return &ServerError{Message: msg, Code: r.Code, Detail: r.Detail, NotImplemented: true}
+	}
+	return &ServerError{Message: r.Error, Code: r.Code, Detail: r.Detail}
+}
+
+// notImplemented reports whether r is the core's answer to a command it does
+// not implement.
+func (r *Response) notImplemented() bool {
+	return r.Code == CodeNotImplemented
+}
+
+// busy reports whether r is the core's answer that it is overloaded and the
+// request should be retried later.
+func (r *Response) busy() bool {
+	return !r.OK && r.Code == CodeBusy
+}
+
+// normalizeCode fills in Code for failures from servers that do not send one:
+// ok:false with an empty error (the legacy 501 placeholder) and the core's
+// "unknown command" rejection both mean the command is not implemented.
+func (r *Response) normalizeCode() {
+	if r.OK || r.Code != 0 {
+		return
+	}
+	if r.Error == "" || r.Error == "not implemented" || strings.HasPrefix(r.Error, "unknown command") {
+		r.Code = CodeNotImplemented
+	}
+}
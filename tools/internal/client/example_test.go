@@ -0,0 +1,112 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// ExampleClient_GetStats fetches a stats snapshot under a deadline, sorts
+// failures by their typed errors, and cancels a request the core never
+// answers. The core is an in-process stand-in, so the example runs anywhere.
+func ExampleClient_GetStats() {
+	sockPath, stop, err := startExampleCore()
+	if err != nil {
+		fmt.Println("start core:", err)
+		return
+	}
+	defer stop()
+
+	c := client.NewClient(sockPath, 5*time.Second)
+
+	// A deadline bounds the whole request, dial to decoded response.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	snap, err := c.GetStatsContext(ctx)
+	if err != nil {
+		fmt.Println("stats failed:", describe(err))
+		return
+	}
+	fmt.Printf("queries=%d blocked=%d qps=%.1f\n", snap.TotalQueries, snap.BlockedQueries, snap.QPS)
+
+	// The stand-in core reads the second request but never answers it, as a
+	// wedged core would. Cancelling ctx, e.g. on Ctrl+C, abandons the request
+	// instead of waiting for the client timeout.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = c.GetStatsContext(ctx)
+	fmt.Println("stats failed:", describe(err))
+
+	// Output:
+	// queries=1200 blocked=3 qps=42.5
+	// stats failed: cancelled
+}
+
+// describe maps an error from the client to what an operator should check.
+func describe(err error) string {
+	var serverErr *client.ServerError
+	var protoErr *client.ProtocolError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, client.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timed out; is the core overloaded?"
+	case errors.Is(err, client.ErrSocketNotFound), errors.Is(err, client.ErrConnect):
+		return "cannot reach the core; is it running?"
+	case errors.Is(err, client.ErrNotImplemented):
+		return "the core does not support this command"
+	case errors.As(err, &serverErr):
+		return "the core refused: " + serverErr.Error()
+	case errors.As(err, &protoErr):
+		return "malformed response in phase " + string(protoErr.Phase)
+	}
+	return err.Error()
+}
+
+// startExampleCore listens on a Unix socket in a temporary directory. It
+// answers the first request with a stats snapshot and leaves later ones
+// unanswered until stop is called.
+func startExampleCore() (sockPath string, stop func(), err error) {
+	dir, err := os.MkdirTemp("", "dbgate-example")
+	if err != nil {
+		return "", nil, err
+	}
+	sockPath = filepath.Join(dir, "dbgate.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				if _, err := client.ReadFrame(conn, client.MaxRequestBytes); err != nil {
+					return
+				}
+				if n > 0 {
+					<-done
+					return
+				}
+				_ = client.WriteFrame(conn, []byte(`{"ok":true,"payload":{"total_queries":1200,"blocked_queries":3,"qps":42.5,"captured_at_ms":1700000000000}}`))
+			}()
+		}
+	}()
+	return sockPath, func() {
+		close(done)
+		_ = ln.Close()
+		_ = os.RemoveAll(dir)
+	}, nil
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// frameHeaderLen is the size of the little-endian length prefix that precedes
+// every JSON body on the wire.
+const frameHeaderLen = 4
+
+// compressedFlag is the high bit of the length prefix. A core asked for
+// compression (see WithCompression) sets it on response frames whose body is
+// gzip-compressed; the low 31 bits are then the compressed length. Frames
+// without it are plain JSON, so a core that ignores the request stays
+// compatible. A client that did not ask for compression rejects the flag.
+// With WithRequestCompression the client marks its own gzip requests the
+// same way.
+const compressedFlag = 1 << 31
+
+// MinCompressBytes is the smallest request body WithRequestCompression
+// compresses; below it gzip saves too little to be worth it.
+const MinCompressBytes = 1024
+
+// WriteFrame writes body to w as a single [4byte LE len][body] frame.
+func WriteFrame(w io.Writer, body []byte) error {
+	return writeFrame(w, body, false)
+}
+
+// writeFrame implements WriteFrame. With compress, a body of at least
+// MinCompressBytes is written gzip-compressed with compressedFlag set.
+func writeFrame(w io.Writer, body []byte, compress bool) error {
+	var flag uint32
+	if compress && len(body) >= MinCompressBytes {
+		var err error
+		if body, err = gzipBody(body); err != nil {
+			return err
+		}
+		flag = compressedFlag
+	}
+	if uint64(len(body)) > MaxFrameLength {
+		return fmt.Errorf("frame body too large: %d", len(body))
+	}
+	var lenBuf [frameHeaderLen]byte
+	bodyLen := uint32(len(body)) // #nosec G115 -- bounded by the explicit check above.
+	binary.LittleEndian.PutUint32(lenBuf[:], bodyLen|flag)
+	if err := writeFull(w, lenBuf[:]); err != nil {
+		return fmt.Errorf("write length prefix: %w", err)
+	}
+	if err := writeFull(w, body); err != nil {
+		return fmt.Errorf("write frame body: %w", err)
+	}
+	return nil
+}
+
+// ReadFrame reads a single [4byte LE len][body] frame from r and returns the
+// body. A declared length of 0 or greater than maxLen is rejected before any
+// body bytes are read; the latter with a *ResponseTooLargeError. The body
+// buffer grows with the bytes actually received rather than being allocated
+// up front, so a peer that declares a large frame and then stalls cannot
+// force a large allocation. Errors are *ProtocolError with PhaseReadHeader or
+// PhaseReadBody; a body cut short by the peer closing the connection is
+// reported as a *TruncatedResponseError.
+//
+// A length prefix with compressedFlag set announces a gzip body, which is
+// decompressed before it is returned. Both the compressed length and the
+// decompressed size must be within maxLen.
+func ReadFrame(r io.Reader, maxLen uint32) ([]byte, error) {
+	return readFrame(r, maxLen, true, false, nil)
+}
+
+// readFrame implements ReadFrame. Unless allowCompressed is set, a length
+// prefix with compressedFlag is rejected in PhaseReadHeader, as the reply of
+// a core that was not asked for compression. With allowEmpty it accepts the
+// empty frame that terminates a streamed response, returning a nil body for
+// it. A non-nil beforeBody runs once the length prefix has been accepted,
+// before any body bytes are read; an error from it aborts the read in
+// PhaseReadBody.
+func readFrame(r io.Reader, maxLen uint32, allowCompressed, allowEmpty bool, beforeBody func() error) ([]byte, error) {
+	var lenBuf [frameHeaderLen]byte
+	if n, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		if n > 0 {
+			// A split prefix cut off by a deadline or close is easy to
+			// mistake for no reply at all; say how much arrived.
+			err = fmt.Errorf("got %d of %d header bytes: %w", n, frameHeaderLen, err)
+		}
+		return nil, &ProtocolError{Phase: PhaseReadHeader, Err: fmt.Errorf("read length prefix: %w", err)}
+	}
+	bodyLen := binary.LittleEndian.Uint32(lenBuf[:])
+	if bodyLen == 0 && allowEmpty {
+		return nil, nil
+	}
+	compressed := bodyLen&compressedFlag != 0
+	if compressed && !allowCompressed {
+		// Either a plain frame too large for any limit or a compressed one
+		// the core should not have sent; neither can be read.
+		return nil, &ProtocolError{Phase: PhaseReadHeader, Err: fmt.Errorf("%w, or a compressed frame of %d bytes, but compression was not requested",
+			&ResponseTooLargeError{Length: bodyLen, Limit: maxLen}, bodyLen&^compressedFlag)}
+	}
+	bodyLen &^= compressedFlag
+	if bodyLen == 0 {
+		return nil, &ProtocolError{Phase: PhaseReadHeader, Err: fmt.Errorf("invalid frame length %d", bodyLen)}
+	}
+	if bodyLen > maxLen {
+		return nil, &ProtocolError{Phase: PhaseReadHeader, Err: &ResponseTooLargeError{Length: bodyLen, Limit: maxLen}}
+	}
+
+	if beforeBody != nil {
+		if err := beforeBody(); err != nil {
+			return nil, &ProtocolError{Phase: PhaseReadBody, Err: err}
+		}
+	}
+
+	var body bytes.Buffer
+	if n, err := io.CopyN(&body, r, int64(bodyLen)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = &TruncatedResponseError{Expected: bodyLen, Received: uint32(n)} // #nosec G115 -- n <= bodyLen
+		} else {
+			// As for the header, say how far a body cut off by a deadline got.
+			err = fmt.Errorf("got %d of %d body bytes: %w", n, bodyLen, err)
+		}
+		return nil, &ProtocolError{Phase: PhaseReadBody, Err: fmt.Errorf("read frame body: %w", err)}
+	}
+	if compressed {
+		return gunzipBody(body.Bytes(), maxLen)
+	}
+	return body.Bytes(), nil
+}
+
+// gzipBody compresses a request body for a compressed frame.
+func gzipBody(body []byte) ([]byte, error) {
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	if _, err := zw.Write(body); err != nil {
+		return nil, fmt.Errorf("compress frame body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress frame body: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// gunzipBody decompresses a gzip frame body, failing with ErrResponseTooLarge
+// once it inflates beyond maxLen bytes so that a small frame cannot expand
+// without bound.
+func gunzipBody(body []byte, maxLen uint32) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, &ProtocolError{Phase: PhaseReadBody, Err: fmt.Errorf("decompress frame body: %w", err)}
+	}
+	var out bytes.Buffer
+	n, err := io.Copy(&out, io.LimitReader(zr, int64(maxLen)+1))
+	if err != nil {
+		return nil, &ProtocolError{Phase: PhaseReadBody, Err: fmt.Errorf("decompress frame body: %w", err)}
+	}
+	if n > int64(maxLen) {
+		return nil, &ProtocolError{Phase: PhaseReadBody, Err: fmt.Errorf("decompress frame body: %w (limit is %d bytes)", ErrResponseTooLarge, maxLen)}
+	}
+	if n == 0 {
+		return nil, &ProtocolError{Phase: PhaseReadBody, Err: errors.New("decompress frame body: empty body")}
+	}
+	return out.Bytes(), nil
+}
+
+// writeFull writes all bytes in buf to w, looping until all bytes are written
+// or an error occurs. This handles the rare case where Write returns n < len(buf)
+// without an error, which technically violates the io.Writer contract but can
+// occur on some platforms or under resource pressure.
+func writeFull(w io.Writer, buf []byte) error {
+	for len(buf) > 0 {
+		n, err := w.Write(buf)
+		buf = buf[n:]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestFrame_RoundTrip verifies that ReadFrame returns exactly what WriteFrame
+// wrote, including the 4-byte LE length prefix on the wire.
+func TestFrame_RoundTrip(t *testing.T) {
+	body := []byte(`{"command":"stats"}`)
+
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, body); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if got, want := buf.Len(), frameHeaderLen+len(body); got != want {
+		t.Fatalf("frame size: got %d, want %d", got, want)
+	}
+
+	got, err := ReadFrame(&buf, MaxResponseBytes)
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("body: got %q, want %q", got, body)
+	}
+}
+
+// TestReadFrame_InvalidLength verifies that zero and over-limit lengths are
+// rejected before the body is read.
+func TestReadFrame_InvalidLength(t *testing.T) {
+	for _, n := range []int{0, 65} {
+		var buf bytes.Buffer
+		if err := WriteFrame(&buf, make([]byte, n)); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+		_, err := ReadFrame(&buf, 64)
+		if err == nil || !strings.Contains(err.Error(), "invalid frame length") {
+			t.Errorf("length %d: expected invalid frame length error, got %v", n, err)
+		}
+	}
+}
+
+// gzipFrame returns body gzip-compressed in a frame whose length prefix has
+// the compressed flag set, as a core sends it when asked for compression.
+func gzipFrame(t *testing.T, body []byte) []byte {
+	t.Helper()
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(body); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	frame := make([]byte, frameHeaderLen+zbuf.Len())
+	binary.LittleEndian.PutUint32(frame, uint32(zbuf.Len())|compressedFlag)
+	copy(frame[frameHeaderLen:], zbuf.Bytes())
+	return frame
+}
+
+// TestReadFrame_Compressed verifies that a flagged frame is decompressed,
+// that the decompressed size is held to the limit, and that a body that is
+// not gzip is rejected.
+func TestReadFrame_Compressed(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"id":"s1","user":"app"},`), 1000)
+	frame := gzipFrame(t, body)
+	if len(frame) >= len(body) {
+		t.Fatalf("test frame did not compress: %d bytes for %d", len(frame), len(body))
+	}
+	got, err := ReadFrame(bytes.NewReader(frame), MaxResponseBytes)
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("decompressed body differs: got %d bytes, want %d", len(got), len(body))
+	}
+
+	// The compressed frame fits the limit but its contents do not.
+	limit := uint32(len(body) - 1)
+	_, err = ReadFrame(bytes.NewReader(frame), limit)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("inflating past the limit: expected ErrResponseTooLarge, got %v", err)
+	}
+
+	bogus := make([]byte, frameHeaderLen+8)
+	binary.LittleEndian.PutUint32(bogus, 8|compressedFlag)
+	_, err = ReadFrame(bytes.NewReader(bogus), MaxResponseBytes)
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.Phase != PhaseReadBody || !strings.Contains(err.Error(), "decompress") {
+		t.Errorf("corrupt body: expected a decompress ProtocolError, got %v", err)
+	}
+}
+
+// TestWriteFrame_Compressed verifies that a compressed write gzips a body of
+// at least MinCompressBytes behind the compressed flag, which ReadFrame
+// reverses, and leaves a smaller body plain.
+func TestWriteFrame_Compressed(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"rules":[]},`), MinCompressBytes)
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, body, true); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+	prefix := binary.LittleEndian.Uint32(buf.Bytes())
+	if prefix&compressedFlag == 0 || int(prefix&^compressedFlag) != buf.Len()-frameHeaderLen || buf.Len() >= len(body) {
+		t.Fatalf("prefix %#x for a %d-byte frame of a %d-byte body, want a smaller compressed frame", prefix, buf.Len(), len(body))
+	}
+	got, err := ReadFrame(&buf, MaxResponseBytes)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("ReadFrame = %d bytes, %v; want the original %d bytes", len(got), err, len(body))
+	}
+
+	small := []byte(`{"command":"stats"}`)
+	buf.Reset()
+	if err := writeFrame(&buf, small, true); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+	if prefix := binary.LittleEndian.Uint32(buf.Bytes()); prefix != uint32(len(small)) {
+		t.Errorf("small body: prefix %#x, want the plain length %d", prefix, len(small))
+	}
+}
+
+// TestReadFrame_UnrequestedFlag verifies that without compression a length
+// prefix with the high bit set is reported as too large, since it is too
+// large for any limit when read as a plain length.
+func TestReadFrame_UnrequestedFlag(t *testing.T) {
+	frame := make([]byte, frameHeaderLen)
+	binary.LittleEndian.PutUint32(frame, compressedFlag|8)
+	_, err := readFrame(bytes.NewReader(frame), MaxFrameLength, false, false, nil)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Length != compressedFlag|8 || !strings.Contains(err.Error(), "compression was not requested") {
+		t.Errorf("expected a ResponseTooLargeError naming the unrequested compression, got %v", err)
+	}
+}
+
+// BenchmarkFraming measures WriteFrame/ReadFrame throughput over an in-memory
+// pipe for a range of payload sizes.
+func BenchmarkFraming(b *testing.B) {
+	for _, size := range []int{64, 1 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			body := bytes.Repeat([]byte{'x'}, size)
+			w, r := net.Pipe()
+			defer func() { _ = r.Close() }()
+
+			go func() {
+				defer func() { _ = w.Close() }()
+				for i := 0; i < b.N; i++ {
+					if err := WriteFrame(w, body); err != nil {
+						return
+					}
+				}
+			}()
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ReadFrame(r, MaxResponseBytes); err != nil {
+					b.Fatalf("ReadFrame: %v", err)
+				}
+			}
+		})
+	}
+}
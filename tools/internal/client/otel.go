@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// spanName is the name of the span started for every command.
+const spanName = "dbgate.command"
+
+// WithTracer starts an OpenTelemetry span named "dbgate.command" around every
+// command sent by the client, carrying the command, the socket and the bytes
+// sent and received, and recording the error if the command fails. Only the
+// OTel API is referenced here; setting up a provider and exporter is left to
+// the caller.
+func WithTracer(tracer oteltrace.Tracer) Option {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+// startSpan starts the command span for cmd when a tracer is set, returning
+// the context carrying it and a function that ends it with the finished
+// command's metrics. Without a tracer ctx is returned unchanged and the end
+// function does nothing.
+func (c *Client) startSpan(ctx context.Context, cmd string) (context.Context, func(CommandMetrics)) {
+	if c.tracer == nil {
+		return ctx, func(CommandMetrics) {}
+	}
+	ctx, span := c.tracer.Start(ctx, spanName,
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(
+			attribute.String("command", cmd),
+			attribute.String("socket", c.addr),
+		))
+	return ctx, func(m CommandMetrics) {
+		span.SetAttributes(
+			attribute.Int("bytes.sent", m.BytesSent),
+			attribute.Int("bytes.received", m.BytesReceived),
+		)
+		if m.Err != nil {
+			span.RecordError(m.Err)
+			span.SetStatus(codes.Error, m.Err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracer verifies the span recorded for a successful command, with its
+// attributes and byte counts, and that a failed command's span carries the
+// error.
+func TestTracer(t *testing.T) {
+	respJSON := []byte(`{"ok":true}`)
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+	c := NewClient(sockPath, 3*time.Second, WithTracer(tracer))
+	if _, err := c.SendCommand("stats"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	reqBody := <-received
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "dbgate.command" || span.Status().Code == codes.Error {
+		t.Errorf("unexpected span %q with status %+v", span.Name(), span.Status())
+	}
+	got := attribute.NewSet(span.Attributes()...)
+	want := attribute.NewSet(
+		attribute.String("command", "stats"),
+		attribute.String("socket", sockPath),
+		attribute.Int("bytes.sent", 4+len(reqBody)),
+		attribute.Int("bytes.received", 4+len(respJSON)),
+	)
+	if !got.Equals(&want) {
+		t.Errorf("attributes = %v, want %v", got.Encoded(attribute.DefaultEncoder()), want.Encoded(attribute.DefaultEncoder()))
+	}
+
+	missing := NewClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second, WithTracer(tracer))
+	_, err := missing.SendCommand("health")
+	if !errors.Is(err, ErrConnect) {
+		t.Fatalf("expected ErrConnect, got: %v", err)
+	}
+	spans = recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	span = spans[1]
+	if span.Status().Code != codes.Error || span.Status().Description != err.Error() {
+		t.Errorf("status = %+v, want the error", span.Status())
+	}
+	if events := span.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("events = %+v, want the recorded error", events)
+	}
+}
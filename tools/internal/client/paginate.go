@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"maps"
+)
+
+// maxPages bounds the requests of one paginated listing, so that a core that
+// keeps returning a cursor cannot keep the client looping forever.
+const maxPages = 1000
+
+// WithPageSize asks the core to return paginated listings, ListSessions and
+// AuditTail among them, at most n items per response, by sending
+// args["page_size"]. A core that pages answers with a "next_cursor", and the
+// client resends the command with it in args["cursor"] until the cursor is
+// empty, assembling the full result. Cores that ignore page_size answer in
+// one response, as before. 0, the default, sends no page size; a core that
+// pages on its own is still followed.
+func WithPageSize(n int) Option {
+	return func(c *Client) {
+		c.pageSize = n
+	}
+}
+
+// paginate sends cmd with args, then again with each cursor the core returns,
+// until it returns none. page is called with every successful response and
+// returns the cursor of the next page, normally resp.NextCursor; it may
+// return "" to stop early. A core answering ok:false fails the listing as Do
+// does, and so does a cursor the core already returned or more than maxPages
+// pages.
+func (c *Client) paginate(ctx context.Context, cmd string, args map[string]interface{}, page func(*Response) (string, error)) error {
+	seen := make(map[string]bool)
+	cursor := ""
+	for n := 1; ; n++ {
+		pageArgs := maps.Clone(args)
+		if c.pageSize > 0 || cursor != "" {
+			if pageArgs == nil {
+				pageArgs = make(map[string]interface{})
+			}
+			if c.pageSize > 0 {
+				pageArgs["page_size"] = c.pageSize
+			}
+			if cursor != "" {
+				pageArgs["cursor"] = cursor
+			}
+		}
+		resp, err := c.sendRequest(ctx, CommandRequest{Command: cmd, Args: pageArgs})
+		if err != nil {
+			return err
+		}
+		if !resp.OK {
+			return fmt.Errorf("%s: %w", cmd, resp.Err())
+		}
+		cursor, err = page(resp)
+		if err != nil || cursor == "" {
+			return err
+		}
+		if seen[cursor] {
+			return &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("%s: core repeated cursor %q after %d pages", cmd, cursor, n)}
+		}
+		if n >= maxPages {
+			return &ProtocolError{Phase: PhaseDecode, Err: fmt.Errorf("%s: more than %d pages", cmd, maxPages)}
+		}
+		seen[cursor] = true
+	}
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startPagingServer starts a server that answers each request with the
+// response JSON respond returns for it, and passes the requests on in order.
+func startPagingServer(t *testing.T, respond func(CommandRequest) string) (string, <-chan CommandRequest) {
+	t.Helper()
+	requests := make(chan CommandRequest, maxPages+1)
+	sockPath := startRawServer(t, func(conn net.Conn, body []byte) bool {
+		var req CommandRequest
+		if json.Unmarshal(body, &req) != nil {
+			return false
+		}
+		requests <- req
+		_, _ = conn.Write(frameResponse([]byte(respond(req))))
+		return false
+	})
+	return sockPath, requests
+}
+
+// drainRequests returns the requests received so far.
+func drainRequests(requests <-chan CommandRequest) []CommandRequest {
+	var reqs []CommandRequest
+	for {
+		select {
+		case req := <-requests:
+			reqs = append(reqs, req)
+		default:
+			return reqs
+		}
+	}
+}
+
+// TestListSessions_Pages verifies that ListSessions sends the page size,
+// follows next_cursor and assembles the sessions of both pages.
+func TestListSessions_Pages(t *testing.T) {
+	sockPath, requests := startPagingServer(t, func(req CommandRequest) string {
+		if req.Args["cursor"] == "p2" {
+			return `{"ok":true,"payload":[{"id":"3"}]}`
+		}
+		return `{"ok":true,"payload":[{"id":"1"},{"id":"2"}],"next_cursor":"p2"}`
+	})
+
+	sessions, err := NewClient(sockPath, 3*time.Second, WithPageSize(2)).ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Errorf("session ids = %v, want [1 2 3]", ids)
+	}
+
+	reqs := drainRequests(requests)
+	if len(reqs) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(reqs))
+	}
+	for i, wantCursor := range []interface{}{nil, "p2"} {
+		if reqs[i].Command != "sessions" || reqs[i].Args["page_size"] != float64(2) || reqs[i].Args["cursor"] != wantCursor {
+			t.Errorf("request %d = %+v, want page_size 2 and cursor %v", i, reqs[i], wantCursor)
+		}
+	}
+}
+
+// TestAuditTail_Pages verifies that AuditTail stops requesting pages once
+// limit entries have arrived.
+func TestAuditTail_Pages(t *testing.T) {
+	sockPath, requests := startPagingServer(t, func(req CommandRequest) string {
+		switch req.Args["cursor"] {
+		case nil:
+			return `{"ok":true,"payload":[{"id":9},{"id":8}],"next_cursor":"p2"}`
+		case "p2":
+			return `{"ok":true,"payload":[{"id":7},{"id":6}],"next_cursor":"p3"}`
+		}
+		return `{"ok":true,"payload":[{"id":5}]}`
+	})
+
+	entries, err := NewClient(sockPath, 3*time.Second, WithPageSize(2)).AuditTail(3)
+	if err != nil {
+		t.Fatalf("AuditTail: %v", err)
+	}
+	var ids []uint64
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint64{9, 8, 7}) {
+		t.Errorf("ids = %v, want [9 8 7]", ids)
+	}
+	if reqs := drainRequests(requests); len(reqs) != 2 {
+		t.Errorf("sent %d requests, want 2", len(reqs))
+	}
+}
+
+// TestPaginate_Unpaged verifies that without WithPageSize no paging args are
+// sent and a core answering in one response takes one request.
+func TestPaginate_Unpaged(t *testing.T) {
+	sockPath, requests := startPagingServer(t, func(CommandRequest) string {
+		return `{"ok":true,"payload":[{"id":"1"}]}`
+	})
+	if _, err := NewClient(sockPath, 3*time.Second).ListSessions(); err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	reqs := drainRequests(requests)
+	if len(reqs) != 1 || reqs[0].Args != nil {
+		t.Errorf("requests = %+v, want one without args", reqs)
+	}
+}
+
+// TestPaginate_Loop verifies that a core repeating a cursor, or paging
+// without end, fails the listing instead of looping forever.
+func TestPaginate_Loop(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  func(n int) string
+		wantErr string
+		wantReq int
+	}{
+		{"repeated cursor", func(int) string { return "again" }, `repeated cursor "again"`, 2},
+		{"endless", func(n int) string { return fmt.Sprintf("c%d", n) }, fmt.Sprintf("more than %d pages", maxPages), maxPages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := 0
+			sockPath, requests := startPagingServer(t, func(CommandRequest) string {
+				n++
+				return fmt.Sprintf(`{"ok":true,"payload":[],"next_cursor":%q}`, tt.cursor(n))
+			})
+			_, err := NewClient(sockPath, 3*time.Second, WithPageSize(10)).ListSessions()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want error containing %q", err, tt.wantErr)
+			}
+			if got := len(drainRequests(requests)); got != tt.wantReq {
+				t.Errorf("sent %d requests, want %d", got, tt.wantReq)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// payloadBufPool holds the buffers decodePayload re-marshals payloads into,
+// so that hot polling loops do not allocate one per response.
+var payloadBufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledPayloadBuf caps the capacity of buffers returned to
+// payloadBufPool; a rare large payload should not pin its buffer forever.
+const maxPooledPayloadBuf = 64 << 10
+
+// decodePayload decodes a response payload, as produced by json.Unmarshal
+// into interface{}, into out, which must be a pointer as for json.Unmarshal.
+// The payload is re-marshaled and decoded with the client's codec.
+// If the payload's JSON type cannot fill out, e.g. an array where out is a
+// struct, the error names the type the core sent instead of surfacing an
+// unmarshal error about Go types. A nil payload is an error; callers that
+// accept one check for it first.
+func (c *Client) decodePayload(payload interface{}, out interface{}) error {
+	if payload == nil {
+		return errors.New("response has no payload")
+	}
+	if want := wantJSONType(reflect.TypeOf(out)); want != "" {
+		if got := jsonType(payload); got != "" && got != want {
+			return fmt.Errorf("payload is a JSON %s, want %s", got, article(want))
+		}
+	}
+
+	// Re-marshal the payload interface{} so we can unmarshal into out.
+	if _, std := c.codec.(stdlibCodec); !std {
+		payloadBytes, err := c.codec.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("re-marshal payload: %w", err)
+		}
+		if err := c.codec.Unmarshal(payloadBytes, out); err != nil {
+			return fmt.Errorf("parse payload: %w", err)
+		}
+		return nil
+	}
+	buf := payloadBufPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledPayloadBuf {
+			buf.Reset()
+			payloadBufPool.Put(buf)
+		}
+	}()
+	if err := json.NewEncoder(buf).Encode(payload); err != nil {
+		return fmt.Errorf("re-marshal payload: %w", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), out); err != nil {
+		return fmt.Errorf("parse payload: %w", err)
+	}
+	return nil
+}
+
+// jsonType returns the JSON type name of a value decoded into interface{},
+// or "" for values json.Unmarshal does not produce.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return ""
+}
+
+// wantJSONType returns the JSON type that can be decoded into the value t
+// points to: "object" for structs and maps, "array" for slices and arrays,
+// or "" if t is not that specific (e.g. interface{} or a json.Unmarshaler).
+func wantJSONType(t reflect.Type) string {
+	if t == nil || t.Kind() != reflect.Pointer {
+		return ""
+	}
+	t = t.Elem()
+	if reflect.PointerTo(t).Implements(reflect.TypeFor[json.Unmarshaler]()) {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "" // []byte decodes from a base64 string
+		}
+		return "array"
+	}
+	return ""
+}
+
+// article prefixes a JSON type name with "a" or "an".
+func article(name string) string {
+	if name == "object" || name == "array" {
+		return "an " + name
+	}
+	return "a " + name
+}
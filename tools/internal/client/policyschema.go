@@ -0,0 +1,158 @@
+package client
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// policySchemaJSON is the JSON schema of the policy file format.
+//
+//go:embed policy.schema.json
+var policySchemaJSON []byte
+
+// policySchemaURL names the embedded schema for the compiler.
+const policySchemaURL = "policy.schema.json"
+
+// compiledPolicySchema compiles the embedded schema on first use.
+var compiledPolicySchema = sync.OnceValues(func() (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(policySchemaJSON))
+	if err != nil {
+		return nil, err
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(policySchemaURL, doc); err != nil {
+		return nil, err
+	}
+	return c.Compile(policySchemaURL)
+})
+
+// ValidatePolicyLocal checks contents, a YAML (or JSON) policy document,
+// against the policy schema embedded in this package, without contacting a
+// core. Each PolicyError carries the JSON pointer of the offending value in
+// Path and, where it can be found, its line. The schema covers the structure
+// the core's loader reads, not every check the core makes, so a policy that
+// passes may still be refused by ValidatePolicy. The error is non-nil only
+// if the schema itself cannot be compiled.
+func ValidatePolicyLocal(contents []byte) (*PolicyValidation, error) {
+	schema, err := compiledPolicySchema()
+	if err != nil {
+		return nil, fmt.Errorf("compile policy schema: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(contents, &root); err != nil {
+		return invalidPolicy(PolicyError{Message: err.Error()}), nil
+	}
+	var doc any
+	if err := root.Decode(&doc); err != nil {
+		return invalidPolicy(PolicyError{Message: err.Error()}), nil
+	}
+	// The validator takes JSON values, so round-trip the document through
+	// JSON; this also rejects YAML that has no JSON equivalent.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return invalidPolicy(PolicyError{Message: "policy is not representable as JSON: " + err.Error()}), nil
+	}
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+
+	var verr *jsonschema.ValidationError
+	if err := schema.Validate(inst); !errors.As(err, &verr) {
+		if err != nil {
+			return nil, fmt.Errorf("validate policy: %w", err)
+		}
+		return &PolicyValidation{Valid: true}, nil
+	}
+	var errs []PolicyError
+	for _, leaf := range schemaErrorLeaves(verr, nil) {
+		path := jsonPointer(leaf.InstanceLocation)
+		errs = append(errs, PolicyError{
+			Line:    yamlLine(&root, path),
+			Path:    path,
+			Message: leaf.ErrorKind.LocalizedString(policyErrorPrinter),
+		})
+	}
+	slices.SortStableFunc(errs, func(a, b PolicyError) int { return a.Line - b.Line })
+	return &PolicyValidation{Valid: false, Errors: errs}, nil
+}
+
+// policyErrorPrinter formats schema violations.
+var policyErrorPrinter = message.NewPrinter(language.English)
+
+// schemaErrorLeaves appends the innermost causes of e to leaves. The outer
+// errors only say that a subschema failed, e.g. through a $ref.
+func schemaErrorLeaves(e *jsonschema.ValidationError, leaves []*jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(e.Causes) == 0 {
+		return append(leaves, e)
+	}
+	for _, cause := range e.Causes {
+		leaves = schemaErrorLeaves(cause, leaves)
+	}
+	return leaves
+}
+
+// jsonPointer joins instance location tokens into a JSON pointer.
+func jsonPointer(tokens []string) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(tok))
+	}
+	return b.String()
+}
+
+// invalidPolicy returns a failed PolicyValidation holding the single e.
+func invalidPolicy(e PolicyError) *PolicyValidation {
+	return &PolicyValidation{Valid: false, Errors: []PolicyError{e}}
+}
+
+// yamlLine returns the line of the value at the JSON pointer ptr in the
+// document root, or 0 if the pointer does not resolve.
+func yamlLine(root *yaml.Node, ptr string) int {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if ptr == "" {
+		return n.Line
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+		for n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		var next *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == tok {
+					next = n.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(tok); err == nil && i >= 0 && i < len(n.Content) {
+				next = n.Content[i]
+			}
+		}
+		if next == nil {
+			return 0
+		}
+		n = next
+	}
+	return n.Line
+}
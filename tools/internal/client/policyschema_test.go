@@ -0,0 +1,74 @@
+package client
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestValidatePolicyLocal_Valid verifies that the sample policy shipped in
+// config/ passes the embedded schema.
+func TestValidatePolicyLocal_Valid(t *testing.T) {
+	contents, err := os.ReadFile("../../../config/policy.yaml")
+	if err != nil {
+		t.Fatalf("read sample policy: %v", err)
+	}
+	result, err := ValidatePolicyLocal(contents)
+	if err != nil {
+		t.Fatalf("ValidatePolicyLocal: %v", err)
+	}
+	if !result.Valid || len(result.Errors) != 0 {
+		t.Errorf("sample policy reported invalid: %+v", result.Errors)
+	}
+}
+
+// TestValidatePolicyLocal_Invalid verifies that schema violations are reported
+// with the JSON pointer and line of the offending value.
+func TestValidatePolicyLocal_Invalid(t *testing.T) {
+	policy := `global:
+  max_connections: lots
+access_control:
+  - user: admin
+    mode: monitr
+sql_rules:
+  block_patterns: []
+`
+	result, err := ValidatePolicyLocal([]byte(policy))
+	if err != nil {
+		t.Fatalf("ValidatePolicyLocal: %v", err)
+	}
+	if result.Valid {
+		t.Fatal("expected the policy to be invalid")
+	}
+	want := []struct {
+		path string
+		line int
+	}{
+		{"/global/max_connections", 2},
+		{"/access_control/0/mode", 5},
+		{"/sql_rules/block_patterns", 7},
+	}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("got %d errors, want %d: %+v", len(result.Errors), len(want), result.Errors)
+	}
+	for i, w := range want {
+		e := result.Errors[i]
+		if e.Path != w.path || e.Line != w.line || e.Message == "" {
+			t.Errorf("error %d = %+v, want path %s on line %d", i, e, w.path, w.line)
+		}
+	}
+}
+
+// TestValidatePolicyLocal_Malformed verifies that a document that is not
+// YAML, or not a mapping, is reported as invalid rather than as an error.
+func TestValidatePolicyLocal_Malformed(t *testing.T) {
+	for _, policy := range []string{"global: [unclosed\n", "- just\n- a list\n", ""} {
+		result, err := ValidatePolicyLocal([]byte(policy))
+		if err != nil {
+			t.Fatalf("ValidatePolicyLocal(%q): %v", policy, err)
+		}
+		if result.Valid || len(result.Errors) == 0 || strings.TrimSpace(result.Errors[0].Message) == "" {
+			t.Errorf("ValidatePolicyLocal(%q) = %+v, want an error", policy, result)
+		}
+	}
+}
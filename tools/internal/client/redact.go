@@ -0,0 +1,128 @@
+package client
+
+import "strings"
+
+// RedactSQL replaces the string and numeric literals in query with ?, so
+// queries from the audit log can be shown without the values they carried.
+// Keywords, identifiers (including `quoted` ones), operators, comments and
+// whitespace are kept as is.
+//
+// The tokenizer follows MySQL's default lexing: '...' and "..." are both
+// string literals, quotes are escaped by doubling them or with a backslash,
+// and X'..', B'..' and N'..' prefixes belong to the literal. An unterminated
+// string is redacted to the end of the query. It is not a parser: it never
+// fails, and anything it does not recognize is copied through.
+func RedactSQL(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i)
+			b.WriteByte('?')
+		case c == '`':
+			end := skipQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '#' || c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 4
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			i = skipNumber(query, i)
+			b.WriteByte('?')
+		case isIdentByte(c):
+			end := i
+			for end < len(query) && isIdentByte(query[end]) {
+				end++
+			}
+			// X'0F', B'01' and N'text' are literals with a type prefix.
+			if end == i+1 && end < len(query) && query[end] == '\'' && strings.ContainsRune("xXbBnN", rune(c)) {
+				i = skipQuoted(query, end)
+				b.WriteByte('?')
+				continue
+			}
+			b.WriteString(query[i:end])
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// skipQuoted returns the index just past the quoted token starting at
+// query[start], or len(query) if it is not terminated. The quote is escaped
+// by doubling it; in strings, but not `identifiers`, a backslash escapes the
+// next byte.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// skipNumber returns the index just past the numeric literal starting at
+// query[start]: decimal with an optional fraction and exponent, or 0x hex.
+func skipNumber(query string, start int) int {
+	i := start
+	if strings.HasPrefix(query[i:], "0x") || strings.HasPrefix(query[i:], "0X") {
+		i += 2
+		for i < len(query) && strings.IndexByte("0123456789abcdefABCDEF", query[i]) >= 0 {
+			i++
+		}
+		return i
+	}
+	for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+		i++
+	}
+	if i < len(query) && (query[i] == 'e' || query[i] == 'E') {
+		j := i + 1
+		if j < len(query) && (query[j] == '+' || query[j] == '-') {
+			j++
+		}
+		if j < len(query) && isDigit(query[j]) {
+			i = j
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentByte reports whether c can be part of an unquoted identifier or
+// keyword. Bytes of multi-byte UTF-8 characters count, as in MySQL.
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c == '_' || c == '$' || c >= 0x80
+}
@@ -0,0 +1,59 @@
+package client
+
+import "testing"
+
+// TestRedactSQL verifies that literals are replaced while keywords,
+// identifiers, comments and placeholders are kept.
+func TestRedactSQL(t *testing.T) {
+	tests := []struct {
+		name, query, want string
+	}{
+		{
+			name:  "strings and numbers",
+			query: "SELECT * FROM users WHERE name = 'alice' AND age > 30",
+			want:  "SELECT * FROM users WHERE name = ? AND age > ?",
+		},
+		{
+			name:  "escaped quotes",
+			query: `UPDATE t SET bio = 'it''s \'quoted\'' , note = "say \"hi\"" WHERE id = 1`,
+			want:  "UPDATE t SET bio = ? , note = ? WHERE id = ?",
+		},
+		{
+			name:  "injection",
+			query: "SELECT * FROM users WHERE id = '1' OR '1'='1' -- ' AND pw = 'x'",
+			want:  "SELECT * FROM users WHERE id = ? OR ?=? -- ' AND pw = 'x'",
+		},
+		{
+			name:  "identifiers with digits",
+			query: "SELECT t1.col2, `order 1` FROM db2.t1 LIMIT 10 OFFSET 20",
+			want:  "SELECT t1.col2, `order 1` FROM db2.t1 LIMIT ? OFFSET ?",
+		},
+		{
+			name:  "numeric forms",
+			query: "SELECT -1.5, .5, 1e-3, 0xFF, X'0A', b'01', N'text' FROM dual",
+			want:  "SELECT -?, ?, ?, ?, ?, ?, ? FROM dual",
+		},
+		{
+			name:  "comments and placeholders",
+			query: "SELECT /* 'keep' 42 */ a FROM t WHERE b = ? # trailing 'x'\nAND c IN (1, 2)",
+			want:  "SELECT /* 'keep' 42 */ a FROM t WHERE b = ? # trailing 'x'\nAND c IN (?, ?)",
+		},
+		{
+			name:  "unterminated string",
+			query: "SELECT 'secret",
+			want:  "SELECT ?",
+		},
+		{
+			name:  "multi-byte identifiers",
+			query: "SELECT 이름 FROM 사용자 WHERE 나이 = 7",
+			want:  "SELECT 이름 FROM 사용자 WHERE 나이 = ?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactSQL(tt.query); got != tt.want {
+				t.Errorf("RedactSQL(%q)\n got %q\nwant %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
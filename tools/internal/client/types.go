@@ -6,10 +6,13 @@
 // Response: Response        <- JSON <- [4byte LE len][JSON]
 //
 // Supported commands: "stats" | "policy_explain" | "sessions" | "policy_reload" |
-// "policy_versions" | "policy_rollback"
+// "policy_versions" | "policy_rollback" | "policy_eval" | "kill_session" | "hello" |
+// "health" | "policy_validate" | "policy_show" | "version" | "stats_reset" | "ping" |
+// "audit_tail"
 package client
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -26,13 +29,49 @@ type StatsSnapshot struct {
 	CapturedAt       time.Time `json:"captured_at"`
 }
 
+// DeltaStats is the change between two StatsSnapshots, computed client-side by
+// ComputeDelta. It is not reported by the server.
+type DeltaStats struct {
+	Elapsed        time.Duration `json:"elapsed"`         // b.CapturedAt - a.CapturedAt
+	Queries        uint64        `json:"queries"`         // total_queries growth over Elapsed
+	BlockedQueries uint64        `json:"blocked_queries"` // blocked_queries growth over Elapsed
+	QPS            float64       `json:"qps"`             // Queries / Elapsed seconds
+	BlockRate      float64       `json:"block_rate"`      // BlockedQueries / Queries
+	Reset          bool          `json:"reset"`           // a counter went backwards (core restart)
+}
+
+// IOStats is client-side accounting of control-plane traffic over the
+// lifetime of a Client. It is not reported by the server.
+type IOStats struct {
+	Requests      uint64 `json:"requests"`       // round-trips attempted after a successful dial
+	BytesSent     uint64 `json:"bytes_sent"`     // framed request bytes, including length prefixes
+	BytesReceived uint64 `json:"bytes_received"` // framed response bytes, including length prefixes
+}
+
+// CommandMetrics is the client-side timing of one command, passed to the
+// observer registered with WithObserver. Phase durations are summed over
+// retry attempts; a phase that was never reached is 0.
+type CommandMetrics struct {
+	Command       string
+	DialDuration  time.Duration // connecting, including the TLS handshake
+	WriteDuration time.Duration // sending the request frame
+	ReadDuration  time.Duration // from request sent to response read, i.e. core processing plus transfer
+	TotalDuration time.Duration // the whole call, including encoding, retries and backoff
+	BytesSent     int           // framed request bytes written, over all attempts
+	BytesReceived int           // framed response bytes read, over all attempts
+	Err           error         // the error returned to the caller, nil on success
+}
+
 // CommandRequest is a UDS request sent to the C++ dbgate core.
 // Version is optional; defaults to 1 if omitted.
 // Payload is used by commands such as policy_explain that require input parameters.
+// Args carries named parameters for commands such as kill_session.
 type CommandRequest struct {
-	Command string      `json:"command"`           // "stats" | "policy_explain" | "sessions" | "policy_reload"
-	Version int         `json:"version,omitempty"` // protocol version, default 1
-	Payload interface{} `json:"payload,omitempty"` // optional command payload
+	Command  string                 `json:"command"`            // "stats" | "policy_explain" | "sessions" | "policy_reload"
+	Version  int                    `json:"version,omitempty"`  // protocol version, default 1
+	Payload  interface{}            `json:"payload,omitempty"`  // optional command payload
+	Args     map[string]interface{} `json:"args,omitempty"`     // optional named arguments
+	Compress bool                   `json:"compress,omitempty"` // ask for gzip response frames (WithCompression)
 }
 
 // PolicyExplainRequest is the request payload for the "policy_explain" command.
@@ -56,13 +95,199 @@ type PolicyExplainResult struct {
 	MonitorMode       bool     `json:"monitor_mode"`             // true when policy engine is in monitor-only mode
 }
 
+// PolicyEvalRequest is the request payload for the "policy_eval" command.
+type PolicyEvalRequest struct {
+	Query string `json:"query"`        // SQL statement to evaluate
+	DB    string `json:"db,omitempty"` // default database the query runs against
+}
+
+// PolicyDecision is the response payload for the "policy_eval" command.
+// It reports whether the query would be allowed and which rule decided it.
+type PolicyDecision struct {
+	Action      string `json:"action"`           // "allow" | "block" | "log"
+	MatchedRule string `json:"matched_rule"`     // rule ID used for the decision
+	Reason      string `json:"reason,omitempty"` // human-readable decision reason
+}
+
+// PolicyValidation is the response payload for the "policy_validate" command.
+type PolicyValidation struct {
+	Valid  bool          `json:"valid"`
+	Errors []PolicyError `json:"errors,omitempty"`
+}
+
+// PolicyError is one problem found in a policy file. Line is 0 when the core
+// does not report a position. Path, set by ValidatePolicyLocal, is the JSON
+// pointer of the offending value, e.g. /access_control/0/mode.
+type PolicyError struct {
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Besides {"line","message"}
+// objects it accepts a bare string, which becomes Message.
+func (e *PolicyError) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*e = PolicyError{}
+		return json.Unmarshal(data, &e.Message)
+	}
+	type plain PolicyError
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// VersionInfo is the response payload for the "version" command.
+type VersionInfo struct {
+	Version         string `json:"version"`          // core release, e.g. "0.4.0"
+	BuildHash       string `json:"build_hash"`       // VCS revision the core was built from
+	ProtocolVersion int    `json:"protocol_version"` // highest UDS protocol version the core speaks
+}
+
+// CapabilitiesResult is the response payload for the "capabilities" command.
+type CapabilitiesResult struct {
+	Commands []string `json:"commands"` // names of the commands the core implements
+}
+
+// HelloResult is the response payload for the "hello" command.
+type HelloResult struct {
+	Version int `json:"version"` // highest protocol version the server speaks
+}
+
+// HealthReport is the response payload for the "health" command.
+type HealthReport struct {
+	Status           string `json:"status"` // "ok" when the core is fully healthy
+	UptimeSeconds    int64  `json:"uptime_seconds"`
+	PolicyLoaded     bool   `json:"policy_loaded"`
+	BackendReachable bool   `json:"backend_reachable"`
+}
+
+// Session is one active proxy session as reported by the "sessions" command.
+type Session struct {
+	ID         string    `json:"id"`
+	ClientAddr string    `json:"client_addr"`
+	Database   string    `json:"database"`
+	User       string    `json:"user"`
+	State      string    `json:"state"`
+	StartedAt  time.Time `json:"started_at"`
+	QueryCount uint64    `json:"query_count"`
+
+	// LastActivityMs is when the session last ran a query, in Unix epoch
+	// milliseconds, or 0 if the core does not report it.
+	LastActivityMs int64 `json:"last_activity_ms,omitempty"`
+}
+
+// SessionList is the response payload for the "sessions" command.
+type SessionList []Session
+
+// IDs returns the session IDs in list order.
+func (l SessionList) IDs() []string {
+	ids := make([]string, len(l))
+	for i, s := range l {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// SessionFilter selects sessions for ListSessionsFiltered. Each set field
+// must match exactly; empty fields match every session.
+type SessionFilter struct {
+	User     string // MySQL user name
+	Database string // database the session is connected to
+	State    string // session state, e.g. "active" or "idle"
+}
+
+// IsZero reports whether f has no criteria.
+func (f SessionFilter) IsZero() bool {
+	return f == SessionFilter{}
+}
+
+// Match reports whether s passes every set criterion.
+func (f SessionFilter) Match(s Session) bool {
+	return (f.User == "" || s.User == f.User) &&
+		(f.Database == "" || s.Database == f.Database) &&
+		(f.State == "" || s.State == f.State)
+}
+
+// args returns the set criteria as "sessions" command arguments, or nil if
+// there are none.
+func (f SessionFilter) args() map[string]interface{} {
+	if f.IsZero() {
+		return nil
+	}
+	args := make(map[string]interface{}, 3)
+	if f.User != "" {
+		args["user"] = f.User
+	}
+	if f.Database != "" {
+		args["database"] = f.Database
+	}
+	if f.State != "" {
+		args["state"] = f.State
+	}
+	return args
+}
+
+// AuditEntry is one blocked query from the core's audit ring buffer, as
+// reported by the "audit_tail" command. ID increases monotonically, so it
+// identifies entries across calls.
+type AuditEntry struct {
+	ID          uint64 `json:"id"`
+	TimestampMs int64  `json:"timestamp_ms"` // when the query was blocked, Unix epoch ms
+	ClientAddr  string `json:"client_addr"`
+	User        string `json:"user"`
+	Query       string `json:"query"`
+	Rule        string `json:"rule"`   // ID of the rule that matched
+	Action      string `json:"action"` // "block" | "log"
+}
+
+// AuditRotateResult is the response payload for the "audit_rotate" command.
+type AuditRotateResult struct {
+	Flushed uint64 `json:"flushed"` // entries dropped from the ring buffer
+}
+
+// LogLevels lists the log levels the core accepts in "set_log_level", from
+// most to least verbose.
+var LogLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+// LogLevelResult is the response payload for the "get_log_level" command.
+type LogLevelResult struct {
+	Level string `json:"level"`
+}
+
+// CodeNotImplemented is the Response.Code the core uses for commands it does
+// not implement yet (HTTP 501 semantics).
+const CodeNotImplemented = 501
+
+// CodeBusy is the Response.Code the core uses when it is overloaded and did
+// not process the request (HTTP 503 semantics). The response may carry
+// RetryAfterMs; see WithRetry.
+const CodeBusy = 503
+
 // Response is the common UDS response wrapper from the C++ dbgate core.
 // On success: OK=true,  Payload contains the result.
-// On failure: OK=false, Error contains a diagnostic message.
+// On failure: OK=false, Error contains a diagnostic message and Code, when
+// the server sends one, classifies the failure (e.g. CodeNotImplemented).
+// Detail optionally carries structured information about the failure.
 type Response struct {
-	OK      bool        `json:"ok"`
-	Error   string      `json:"error,omitempty"`
-	Payload interface{} `json:"payload,omitempty"`
+	OK      bool                   `json:"ok"`
+	Error   string                 `json:"error,omitempty"`
+	Code    int                    `json:"code,omitempty"`
+	Detail  map[string]interface{} `json:"detail,omitempty"`
+	Payload interface{}            `json:"payload,omitempty"`
+	// RetryAfterMs is how long a busy core (CodeBusy) asks the client to
+	// wait before resending; 0 leaves the backoff to the client.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+	// Stream announces that the payload follows as one frame per item,
+	// terminated by an empty frame (see StreamSessions).
+	Stream bool `json:"stream,omitempty"`
+	// NextCursor, set by a core paginating a listing, is sent back in
+	// args["cursor"] to fetch the next page; empty on the last page (see
+	// WithPageSize).
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// rtt is how long the attempt that got this response took, from
+	// dialing to the complete response; retries, their backoff and the
+	// version check before them are not included.
+	rtt time.Duration
 }
 
 // PolicyVersionMeta represents metadata for a stored policy version.
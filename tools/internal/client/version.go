@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// WithVersionCheck makes the client negotiate the protocol version (see
+// Negotiate) before its first command, once per Client however many
+// goroutines share it, and report a server version that differs from the
+// one the client sends through the warning handler. The check never fails
+// a command. Its hello is a single attempt with a budget of its own, not
+// retried even with WithRetry. A core without "hello" is skipped silently,
+// and one that cannot be dialed is left to the command to report; any other
+// failed hello is reported through the warning handler. Dry-run clients do
+// not check.
+func WithVersionCheck() Option {
+	return func(c *Client) {
+		c.versionCheck = true
+	}
+}
+
+// WithKnownVersion is WithVersionCheck for a core whose protocol version v is
+// already known, e.g. from an earlier run: the check compares v with the
+// version the client sends without sending a hello. NegotiatedVersion reports
+// v until Negotiate is called.
+func WithKnownVersion(v int) Option {
+	return func(c *Client) {
+		c.versionCheck = true
+		c.knownVersion = v
+		c.negotiated = v
+	}
+}
+
+// WithVersionHandler calls fn with the outcome of the hello the check of
+// WithVersionCheck sends: the version the core reported, or the error, which
+// wraps ErrNotImplemented for a core without "hello". It lets a caller
+// remember the answer, e.g. across runs with WithKnownVersion, and skip the
+// check for a core that cannot negotiate. fn is not called for a known
+// version or a check cancelled with its command.
+func WithVersionHandler(fn func(version int, err error)) Option {
+	return func(c *Client) {
+		c.versionHandler = fn
+	}
+}
+
+// NegotiatedVersion returns the protocol version the core reported the last
+// time this client sent "hello", through Negotiate or the check of
+// WithVersionCheck, or 0 if it never has.
+func (c *Client) NegotiatedVersion() int {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	return c.negotiated
+}
+
+// checkVersion runs the WithVersionCheck negotiation on the first call.
+func (c *Client) checkVersion(ctx context.Context) {
+	if !c.versionCheck || c.dryRun != nil {
+		return
+	}
+	c.versionOnce.Do(func() {
+		v, err := c.knownVersion, error(nil)
+		if v == 0 {
+			v, err = c.checkHello(ctx)
+			if c.versionHandler != nil && !errors.Is(err, context.Canceled) {
+				c.versionHandler(v, err)
+			}
+		}
+		var protoErr *ProtocolError
+		switch {
+		case err == nil, errors.Is(err, ErrVersionMismatch):
+		case errors.Is(err, context.Canceled):
+			return // the command is cancelled as well and reports it
+		case errors.Is(err, ErrNotImplemented):
+			c.logger.DebugContext(ctx, "core does not negotiate a protocol version", "err", err)
+			return
+		case errors.As(err, &protoErr) && protoErr.Phase == PhaseDial:
+			c.logger.DebugContext(ctx, "skipping the version check", "err", err)
+			return
+		default:
+			if c.warn != nil {
+				c.warn(fmt.Sprintf("could not check the dbgate core's protocol version: %v", err))
+			}
+			return
+		}
+		want := c.requestVersion
+		if want == 0 {
+			want = 1 // the server's default for a request without a version
+		}
+		if v != want && c.warn != nil {
+			c.warn(fmt.Sprintf("dbgate core speaks protocol version %d, this client sends version %d; some commands may not work as expected", v, want))
+		}
+	})
+}
+
+// checkHello sends the hello of the version check in a single attempt. It
+// gets the client timeout of its own rather than a share of ctx's deadline,
+// but is still cancelled with ctx.
+func (c *Client) checkHello(ctx context.Context) (int, error) {
+	hctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	defer stop()
+	return c.negotiate(hctx, 1)
+}
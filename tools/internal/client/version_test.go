@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startVersionServer starts a server that answers "hello" with version and
+// every other command with ok, counting the hellos it receives.
+func startVersionServer(t *testing.T, version int) (string, *atomic.Int32) {
+	t.Helper()
+	helloFrame := frameResponse([]byte(fmt.Sprintf(`{"ok":true,"payload":{"version":%d}}`, version)))
+	okFrame := frameResponse([]byte(`{"ok":true}`))
+	var hellos atomic.Int32
+	sockPath := startRawServer(t, func(conn net.Conn, body []byte) bool {
+		frame := okFrame
+		var req CommandRequest
+		if json.Unmarshal(body, &req) == nil && req.Command == "hello" {
+			hellos.Add(1)
+			frame = helloFrame
+		}
+		_, _ = conn.Write(frame)
+		return false
+	})
+	return sockPath, &hellos
+}
+
+// TestVersionCheck_Once verifies that concurrent commands on one client
+// negotiate only once.
+func TestVersionCheck_Once(t *testing.T) {
+	sockPath, hellos := startVersionServer(t, ProtocolVersion)
+	c := NewClient(sockPath, 3*time.Second, WithVersionCheck())
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := c.SendCommand("ping"); err != nil {
+				t.Errorf("SendCommand: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	if _, err := c.SendCommand("ping"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if got := hellos.Load(); got != 1 {
+		t.Errorf("hello sent %d times, want 1", got)
+	}
+}
+
+// TestVersionCheck_Warning verifies that a version skew is reported once
+// through the warning handler without failing the command, that a matching
+// version or a client without the option stays quiet, and that a known
+// version is checked without a hello.
+func TestVersionCheck_Warning(t *testing.T) {
+	tests := []struct {
+		name       string
+		server     int
+		opts       []Option
+		wantHellos int32
+		wantWarn   bool
+	}{
+		{"skew newer", ProtocolVersion + 1, []Option{WithVersionCheck()}, 1, true},
+		{"skew older", ProtocolVersion, []Option{WithVersionCheck(), WithRequestVersion(ProtocolVersion + 1)}, 1, true},
+		{"match", ProtocolVersion, []Option{WithVersionCheck()}, 1, false},
+		{"disabled", ProtocolVersion + 1, nil, 0, false},
+		{"known skew", ProtocolVersion + 1, []Option{WithKnownVersion(ProtocolVersion + 1)}, 0, true},
+		{"known match", ProtocolVersion + 1, []Option{WithKnownVersion(ProtocolVersion)}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sockPath, hellos := startVersionServer(t, tt.server)
+			var warnings []string
+			opts := append(tt.opts, WithWarningHandler(func(msg string) {
+				warnings = append(warnings, msg)
+			}))
+			c := NewClient(sockPath, 3*time.Second, opts...)
+
+			for range 2 {
+				resp, err := c.SendCommand("ping")
+				if err != nil || !resp.OK {
+					t.Fatalf("SendCommand = %+v, %v", resp, err)
+				}
+			}
+			if got := hellos.Load(); got != tt.wantHellos {
+				t.Errorf("hello sent %d times, want %d", got, tt.wantHellos)
+			}
+			if !tt.wantWarn {
+				if len(warnings) != 0 {
+					t.Errorf("unexpected warnings: %q", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], fmt.Sprintf("protocol version %d", tt.server)) {
+				t.Errorf("warnings = %q, want one naming version %d", warnings, tt.server)
+			}
+		})
+	}
+}
+
+// TestVersionCheck_Failures verifies that a hello that cannot be dialed is
+// sent once, not retried, and left to the command to report, and that any
+// other failed hello is reported through the warning handler.
+func TestVersionCheck_Failures(t *testing.T) {
+	var dials atomic.Int32
+	var warnings []string
+	c := NewClient("unused.sock", 3*time.Second, WithVersionCheck(), WithRetry(3, time.Millisecond),
+		WithWarningHandler(func(msg string) { warnings = append(warnings, msg) }),
+		WithDialer(func(context.Context, string, string) (net.Conn, error) {
+			dials.Add(1)
+			return nil, &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+		}))
+	if _, err := c.SendCommand("ping"); !errors.Is(err, ErrConnect) {
+		t.Fatalf("expected ErrConnect, got %v", err)
+	}
+	if got := dials.Load(); got != 4 {
+		t.Errorf("dialed %d times, want 1 for the hello and 3 for the command", got)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+
+	sockPath, _ := startVersionServer(t, 0)
+	warnings = nil
+	c = NewClient(sockPath, 3*time.Second, WithVersionCheck(), WithWarningHandler(func(msg string) { warnings = append(warnings, msg) }))
+	if _, err := c.SendCommand("ping"); err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "could not check the dbgate core's protocol version: hello: invalid server version 0") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+// TestVersionCheck_Handler verifies that the handler gets the outcome of the
+// check's hello, including a core without "hello", and is not called for a
+// known version.
+func TestVersionCheck_Handler(t *testing.T) {
+	sockPath, _ := startVersionServer(t, ProtocolVersion)
+	noHello := startMockServer(t, frameResponse([]byte(`{"ok":false,"error":"unknown command","code":501}`)))
+	tests := []struct {
+		name      string
+		sockPath  string
+		opts      []Option
+		wantCalls int
+		wantV     int
+		wantErr   error
+	}{
+		{"hello", sockPath, []Option{WithVersionCheck()}, 1, ProtocolVersion, nil},
+		{"no hello", noHello, []Option{WithVersionCheck()}, 1, 0, ErrNotImplemented},
+		{"known", sockPath, []Option{WithKnownVersion(ProtocolVersion)}, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, gotV int
+			var gotErr error
+			c := NewClient(tt.sockPath, 3*time.Second, append(tt.opts, WithVersionHandler(func(v int, err error) {
+				calls++
+				gotV, gotErr = v, err
+			}))...)
+			for range 2 {
+				_, _ = c.SendCommand("ping")
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			if gotV != tt.wantV || !errors.Is(gotErr, tt.wantErr) || (tt.wantErr == nil) != (gotErr == nil) {
+				t.Errorf("handler got %d, %v; want %d, %v", gotV, gotErr, tt.wantV, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// WithWireDump writes every frame the client sends or receives to w, as a
+// labeled hex and ASCII dump of the exact bytes on the wire: the 4-byte
+// length prefix followed by the body, still compressed if the core gzipped
+// it. It is meant for debugging framing disagreements with the core. A frame
+// cut short by an error is dumped as far as it got. Dumps of concurrent
+// requests do not interleave; the bytes sent and received are not altered.
+func WithWireDump(w io.Writer) Option {
+	return func(c *Client) {
+		c.wireDump = &wireDump{w: w}
+	}
+}
+
+// wireDump serializes frame dumps to w.
+type wireDump struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// frame writes one labeled dump of b, the bytes of a frame that went to
+// (sent) or came from addr.
+func (d *wireDump) frame(sent bool, addr string, b []byte, err error) {
+	label := fmt.Sprintf("<-- received %d bytes from %s", len(b), addr)
+	if sent {
+		label = fmt.Sprintf("--> sent %d bytes to %s", len(b), addr)
+	}
+	if err != nil {
+		label += " (incomplete: " + err.Error() + ")"
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, _ = io.WriteString(d.w, label+"\n"+hex.Dump(b))
+}
+
+// sendFrame writes body to w as a frame, compressed with
+// WithRequestCompression, and dumps it if WithWireDump is set.
+func (c *Client) sendFrame(w io.Writer, body []byte) error {
+	if c.wireDump == nil {
+		return writeFrame(w, body, c.requestCompression)
+	}
+	tap := &tapWriter{w: w}
+	err := writeFrame(tap, body, c.requestCompression)
+	c.wireDump.frame(true, c.addr, tap.buf.Bytes(), err)
+	return err
+}
+
+// receiveFrame reads a frame from r as readFrame does, accepting a compressed
+// one only with WithCompression, and dumps it if WithWireDump is set.
+func (c *Client) receiveFrame(r io.Reader, allowEmpty bool, beforeBody func() error) ([]byte, error) {
+	if c.wireDump == nil {
+		return readFrame(r, c.maxResponseBytes, c.compression, allowEmpty, beforeBody)
+	}
+	var buf bytes.Buffer
+	body, err := readFrame(io.TeeReader(r, &buf), c.maxResponseBytes, c.compression, allowEmpty, beforeBody)
+	c.wireDump.frame(false, c.addr, buf.Bytes(), err)
+	return body, err
+}
+
+// tapWriter passes writes through to w and keeps a copy of the bytes w
+// accepted.
+type tapWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (t *tapWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.buf.Write(p[:n])
+	return n, err
+}
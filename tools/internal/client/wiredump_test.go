@@ -0,0 +1,56 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWireDump verifies that a stats round trip dumps both frames, length
+// prefix included, and that the exchange itself is unaffected.
+func TestWireDump(t *testing.T) {
+	respJSON := []byte(`{"ok":true,"payload":{"total_queries":7,"captured_at_ms":0}}`)
+	sockPath, received := startCapturingServer(t, frameResponse(respJSON))
+	var dump bytes.Buffer
+	c := NewClient(sockPath, 3*time.Second, WithWireDump(&dump))
+
+	snap, err := c.GetStats()
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if snap.TotalQueries != 7 {
+		t.Errorf("total_queries = %d, want 7", snap.TotalQueries)
+	}
+	reqBody := <-received
+
+	out := dump.String()
+	sent := strings.Index(out, "--> sent ")
+	recv := strings.Index(out, "<-- received ")
+	if sent < 0 || recv < sent {
+		t.Fatalf("dump lacks sent then received frames:\n%s", out)
+	}
+	// hex.Dump of a frame starts with its length prefix.
+	for _, frame := range []struct {
+		section string
+		bodyLen int
+	}{
+		{out[sent:recv], len(reqBody)},
+		{out[recv:], len(respJSON)},
+	} {
+		var prefix [4]byte
+		binary.LittleEndian.PutUint32(prefix[:], uint32(frame.bodyLen))
+		want := fmt.Sprintf("00000000  %02x %02x %02x %02x ", prefix[0], prefix[1], prefix[2], prefix[3])
+		if !strings.Contains(frame.section, want) {
+			t.Errorf("dump section lacks length prefix %q:\n%s", want, frame.section)
+		}
+		if !strings.Contains(frame.section, " bytes ") || !strings.Contains(frame.section, sockPath) {
+			t.Errorf("dump section is not labeled with size and address:\n%s", frame.section)
+		}
+	}
+	if !strings.Contains(out[sent:recv], `|....{"command":`) {
+		t.Errorf("dump lacks the ASCII column of the request:\n%s", out)
+	}
+}
@@ -112,7 +112,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := indexData{}
-	stats, err := s.client.GetStats()
+	stats, err := s.client.GetStatsContext(r.Context())
 	if err != nil {
 		data.Error = err.Error()
 		s.logger.Warn("get stats for index", slog.String("error", err.Error()))
@@ -128,7 +128,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleStats renders the stats partial for htmx polling.
-func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := parseTemplates()
 	if err != nil {
 		s.logger.Error("parse templates", slog.String("error", err.Error()))
@@ -137,7 +137,7 @@ func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request) {
 	}
 
 	data := indexData{}
-	stats, err := s.client.GetStats()
+	stats, err := s.client.GetStatsContext(r.Context())
 	if err != nil {
 		data.Error = err.Error()
 		s.logger.Warn("get stats", slog.String("error", err.Error()))
@@ -154,7 +154,7 @@ func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request) {
 
 // handleSessions renders the sessions partial. Returns "Coming Soon" if the
 // C++ side returns a 501-equivalent (ok=false).
-func (s *Server) handleSessions(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
 	tmpl, err := parseTemplates()
 	if err != nil {
 		s.logger.Error("parse templates", slog.String("error", err.Error()))
@@ -163,7 +163,7 @@ func (s *Server) handleSessions(w http.ResponseWriter, _ *http.Request) {
 	}
 
 	data := sessionsData{}
-	resp, err := s.client.SendCommand("sessions")
+	resp, err := s.client.SendCommandContext(r.Context(), "sessions")
 	if err != nil {
 		data.Error = err.Error()
 	} else if !resp.OK {
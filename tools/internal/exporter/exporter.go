@@ -0,0 +1,243 @@
+// Package exporter publishes dbgate core statistics as Prometheus metrics.
+//
+// The exporter polls the core's "stats" command on a fixed interval and
+// serves the most recent snapshot on /metrics. Cumulative core counters are
+// exposed as Prometheus counters; instantaneous values as gauges. A failed
+// poll keeps the previous snapshot and increments dbgate_scrape_errors_total.
+// Static labels, such as env="prod", can be attached to every metric so that
+// several instances feeding one Prometheus are told apart without relabeling.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	descActiveSessions = prometheus.NewDesc("dbgate_active_sessions",
+		"Number of currently active proxy sessions.", nil, nil)
+	descTotalQueries = prometheus.NewDesc("dbgate_total_queries_total",
+		"Total number of queries processed by the proxy.", nil, nil)
+	descBlockedQueries = prometheus.NewDesc("dbgate_blocked_queries_total",
+		"Total number of queries blocked by policy.", nil, nil)
+	descMonitoredBlocks = prometheus.NewDesc("dbgate_monitored_blocks_total",
+		"Total number of queries that would have been blocked in monitor mode.", nil, nil)
+	descTotalConnections = prometheus.NewDesc("dbgate_total_connections_total",
+		"Total number of client connections accepted by the proxy.", nil, nil)
+	descQPS = prometheus.NewDesc("dbgate_qps",
+		"Queries per second as reported by the core.", nil, nil)
+	descBlockRate = prometheus.NewDesc("dbgate_block_rate",
+		"Fraction of queries blocked (0-1) as reported by the core.", nil, nil)
+)
+
+// labelNameRE matches a valid Prometheus label name.
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseLabels turns name=value pairs into static labels. Names must follow the
+// Prometheus naming rules and must not start with "__", which is reserved for
+// internal use; each name may be given once. A nil map is returned for no
+// pairs.
+func ParseLabels(pairs []string) (prometheus.Labels, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(prometheus.Labels, len(pairs))
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid label %q: want name=value", pair)
+		case !labelNameRE.MatchString(name):
+			return nil, fmt.Errorf("invalid label %q: name must match %s", pair, labelNameRE)
+		case strings.HasPrefix(name, "__"):
+			return nil, fmt.Errorf("invalid label %q: names starting with __ are reserved", pair)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("invalid label %q: %s given more than once", pair, name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// Exporter polls a dbgate core and exposes its statistics to Prometheus.
+type Exporter struct {
+	client   *client.Client
+	interval time.Duration
+	logger   *slog.Logger
+	registry *prometheus.Registry
+
+	scrapeErrors prometheus.Counter
+
+	mu   sync.Mutex
+	last *client.StatsSnapshot
+}
+
+// New creates an Exporter that polls c every interval. labels, which may be
+// nil, are attached to every metric served, dbgate_scrape_errors_total
+// included.
+func New(c *client.Client, interval time.Duration, logger *slog.Logger, labels prometheus.Labels) *Exporter {
+	e := &Exporter{
+		client:   c,
+		interval: interval,
+		logger:   logger,
+		registry: prometheus.NewRegistry(),
+		scrapeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dbgate_scrape_errors_total",
+			Help: "Number of failed attempts to fetch stats from the dbgate core.",
+		}),
+	}
+	prometheus.WrapRegistererWith(labels, e.registry).MustRegister(e, e.scrapeErrors)
+	return e
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	describeSnapshot(ch)
+}
+
+// describeSnapshot sends the descriptors of the snapshot metrics.
+func describeSnapshot(ch chan<- *prometheus.Desc) {
+	ch <- descActiveSessions
+	ch <- descTotalQueries
+	ch <- descBlockedQueries
+	ch <- descMonitoredBlocks
+	ch <- descTotalConnections
+	ch <- descQPS
+	ch <- descBlockRate
+}
+
+// Collect implements prometheus.Collector. Nothing is emitted until the first
+// successful poll.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	snap := e.last
+	e.mu.Unlock()
+	if snap == nil {
+		return
+	}
+	collectSnapshot(ch, snap)
+}
+
+// collectSnapshot sends the metrics for snap.
+func collectSnapshot(ch chan<- prometheus.Metric, snap *client.StatsSnapshot) {
+	ch <- prometheus.MustNewConstMetric(descActiveSessions, prometheus.GaugeValue, float64(snap.ActiveSessions))
+	ch <- prometheus.MustNewConstMetric(descTotalQueries, prometheus.CounterValue, float64(snap.TotalQueries))
+	ch <- prometheus.MustNewConstMetric(descBlockedQueries, prometheus.CounterValue, float64(snap.BlockedQueries))
+	ch <- prometheus.MustNewConstMetric(descMonitoredBlocks, prometheus.CounterValue, float64(snap.MonitoredBlocks))
+	ch <- prometheus.MustNewConstMetric(descTotalConnections, prometheus.CounterValue, float64(snap.TotalConnections))
+	ch <- prometheus.MustNewConstMetric(descQPS, prometheus.GaugeValue, snap.QPS)
+	ch <- prometheus.MustNewConstMetric(descBlockRate, prometheus.GaugeValue, snap.BlockRate)
+}
+
+// snapshotCollector exposes one fixed snapshot.
+type snapshotCollector struct {
+	snap *client.StatsSnapshot
+}
+
+// Describe implements prometheus.Collector.
+func (s snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	describeSnapshot(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	collectSnapshot(ch, s.snap)
+}
+
+// WriteText writes snap in the Prometheus text exposition format, with the
+// metric names and help text served on /metrics, after a comment line with
+// the capture time. It suits one-shot dumps such as node_exporter's textfile
+// collector. labels, which may be nil, are attached to every metric.
+// dbgate_scrape_errors_total is specific to the polling exporter and is not
+// included.
+func WriteText(w io.Writer, snap *client.StatsSnapshot, labels prometheus.Labels) error {
+	registry := prometheus.NewRegistry()
+	if err := prometheus.WrapRegistererWith(labels, registry).Register(snapshotCollector{snap: snap}); err != nil {
+		return fmt.Errorf("register snapshot: %w", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return fmt.Errorf("gather snapshot: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "# dbgate stats captured at %s\n", snap.CapturedAt.UTC().Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return fmt.Errorf("write metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// Handler returns the /metrics HTTP handler.
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// Poll fetches one stats snapshot. On failure the previous snapshot is kept
+// and dbgate_scrape_errors_total is incremented.
+func (e *Exporter) Poll(ctx context.Context) {
+	snap, err := e.client.GetStatsContext(ctx)
+	if err != nil {
+		e.scrapeErrors.Inc()
+		e.logger.Warn("scrape dbgate stats", slog.String("error", err.Error()))
+		return
+	}
+	e.mu.Lock()
+	e.last = snap
+	e.mu.Unlock()
+}
+
+// Run polls the core every interval and serves /metrics on listenAddr until
+// ctx is cancelled. It performs a graceful shutdown with a 5-second deadline.
+func (e *Exporter) Run(ctx context.Context, listenAddr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", e.Handler())
+	srv := &http.Server{
+		Addr:              listenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		e.logger.Info("exporter starting", "addr", listenAddr, "interval", e.interval)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	e.Poll(ctx)
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ticker.C:
+			e.Poll(ctx)
+		case <-ctx.Done():
+			e.logger.Info("shutting down exporter")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package exporter
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// mockUDSServer serves respJSON (framed) to every connection on a temporary
+// socket and returns its path.
+func mockUDSServer(t *testing.T, respJSON string) string {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "mock.sock")
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	frame := make([]byte, 4+len(respJSON))
+	binary.LittleEndian.PutUint32(frame[:4], uint32(len(respJSON)))
+	copy(frame[4:], respJSON)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				var hdr [4]byte
+				if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+					return
+				}
+				if _, err := io.CopyN(io.Discard, conn, int64(binary.LittleEndian.Uint32(hdr[:]))); err != nil {
+					return
+				}
+				_, _ = conn.Write(frame)
+			}()
+		}
+	}()
+	return sockPath
+}
+
+// scrape returns the /metrics body served by e.
+func scrape(t *testing.T, e *Exporter) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+// TestExporter_Metrics verifies that a successful poll publishes the stats as
+// counters and gauges under the expected names.
+func TestExporter_Metrics(t *testing.T) {
+	sock := mockUDSServer(t, `{"ok":true,"payload":{"total_connections":5,"active_sessions":2,`+
+		`"total_queries":100,"blocked_queries":4,"monitored_blocks":1,"qps":12.5,"block_rate":0.04,"captured_at_ms":0}}`)
+	e := New(client.NewClient(sock, 3*time.Second), time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+
+	e.Poll(context.Background())
+	body := scrape(t, e)
+	for _, want := range []string{
+		"# TYPE dbgate_total_queries_total counter",
+		"dbgate_total_queries_total 100",
+		"dbgate_blocked_queries_total 4",
+		"dbgate_total_connections_total 5",
+		"# TYPE dbgate_active_sessions gauge",
+		"dbgate_active_sessions 2",
+		"dbgate_qps 12.5",
+		"dbgate_block_rate 0.04",
+		"dbgate_scrape_errors_total 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+// TestExporter_ScrapeError verifies that a failed poll increments the error
+// counter instead of failing.
+func TestExporter_ScrapeError(t *testing.T) {
+	c := client.NewClient(filepath.Join(t.TempDir(), "missing.sock"), 500*time.Millisecond)
+	e := New(c, time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+
+	e.Poll(context.Background())
+	e.Poll(context.Background())
+	body := scrape(t, e)
+	if !strings.Contains(body, "dbgate_scrape_errors_total 2") {
+		t.Errorf("expected 2 scrape errors:\n%s", body)
+	}
+	if strings.Contains(body, "dbgate_qps") {
+		t.Errorf("no stats should be published before a successful poll:\n%s", body)
+	}
+}
+
+// TestWriteText verifies the one-shot exposition of a snapshot.
+func TestWriteText(t *testing.T) {
+	snap := &client.StatsSnapshot{TotalQueries: 100, ActiveSessions: 2, QPS: 12.5, CapturedAt: time.Unix(1700000000, 0)}
+
+	var out strings.Builder
+	if err := WriteText(&out, snap, nil); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	body := out.String()
+	if !strings.HasPrefix(body, "# dbgate stats captured at 2023-11-14T22:13:20Z\n") {
+		t.Errorf("missing timestamp comment:\n%s", body)
+	}
+	for _, want := range []string{
+		"# TYPE dbgate_qps gauge",
+		"dbgate_qps 12.5",
+		"# TYPE dbgate_total_queries_total counter",
+		"dbgate_total_queries_total 100",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("output missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "dbgate_scrape_errors_total") {
+		t.Errorf("one-shot output should not carry the scrape error counter:\n%s", body)
+	}
+}
+
+// TestLabels verifies that static labels appear on every metric line, both
+// on /metrics and in the one-shot output.
+func TestLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"env=prod", "region=us"})
+	if err != nil {
+		t.Fatalf("ParseLabels: %v", err)
+	}
+
+	sock := mockUDSServer(t, `{"ok":true,"payload":{"total_queries":100,"qps":12.5,"captured_at_ms":0}}`)
+	e := New(client.NewClient(sock, 3*time.Second), time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)), labels)
+	e.Poll(context.Background())
+
+	var text strings.Builder
+	if err := WriteText(&text, &client.StatsSnapshot{TotalQueries: 100}, labels); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+
+	for name, body := range map[string]string{"/metrics": scrape(t, e), "WriteText": text.String()} {
+		samples := 0
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			samples++
+			if !strings.Contains(line, `{env="prod",region="us"} `) {
+				t.Errorf("%s: line without the labels: %q", name, line)
+			}
+		}
+		if samples < 7 {
+			t.Errorf("%s: expected every metric, got %d samples:\n%s", name, samples, body)
+		}
+	}
+}
+
+// TestParseLabels verifies the Prometheus naming rules.
+func TestParseLabels(t *testing.T) {
+	if labels, err := ParseLabels(nil); labels != nil || err != nil {
+		t.Errorf("no pairs: got %v, %v", labels, err)
+	}
+	if labels, err := ParseLabels([]string{"_zone=a=b", "env="}); err != nil || labels["_zone"] != "a=b" || labels["env"] != "" {
+		t.Errorf("valid pairs: got %v, %v", labels, err)
+	}
+	for _, bad := range [][]string{{"env"}, {"1env=x"}, {"env-name=x"}, {"__name__=x"}, {"=x"}, {"env=a", "env=b"}} {
+		if _, err := ParseLabels(bad); err == nil {
+			t.Errorf("ParseLabels(%q): expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package top
+
+import "os"
+
+// cancelableInput returns in itself: this platform has no way to interrupt
+// a blocked terminal read, so the key reader ends only with the next key.
+func cancelableInput(in *os.File) (*os.File, func() error, error) {
+	return in, func() error { return nil }, nil
+}
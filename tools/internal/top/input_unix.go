@@ -0,0 +1,33 @@
+//go:build unix
+
+package top
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// cancelableInput returns a duplicate of in whose blocked reads
+// SetReadDeadline can interrupt, and a func that closes it. The duplicate
+// shares in's open file description, which is switched to non-blocking mode
+// until the func restores it.
+func cancelableInput(in *os.File) (*os.File, func() error, error) {
+	inFd := int(in.Fd()) // #nosec G115 -- file descriptors fit in int
+	fd, err := syscall.Dup(inFd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("duplicate terminal input: %w", err)
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		return nil, nil, fmt.Errorf("set terminal input non-blocking: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), in.Name()) // #nosec G115 -- fd is a valid descriptor
+	return f, func() error {
+		err := f.Close()
+		if nerr := syscall.SetNonblock(inFd, false); nerr != nil && err == nil {
+			err = fmt.Errorf("set terminal input blocking: %w", nerr)
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package top
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestCancelableInput verifies that a read blocked on the duplicate returns
+// once its deadline is set, so that Run can stop reading keys.
+func TestCancelableInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer func() { _ = w.Close() }()
+	defer func() { _ = r.Close() }()
+
+	in, closeIn, err := cancelableInput(r)
+	if err != nil {
+		t.Fatalf("cancelableInput: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := in.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := in.SetReadDeadline(time.Now()); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("read returned %v, want a deadline error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read was not interrupted")
+	}
+	if err := closeIn(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
@@ -0,0 +1,402 @@
+// Package top implements the interactive session view behind "dbgate-cli top".
+//
+// The package is split in two layers. Model holds the view state and is
+// changed only through Update, which returns the side effect the caller should
+// perform (refresh, kill, quit); it does no I/O and is rendered by View. Run
+// drives a Model against a real terminal and a *client.Client, through a
+// refresh loop that tests run headless. Only Run depends on the terminal, so
+// the CLI pulls in nothing extra unless top is used.
+package top
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// SortKey selects the order of the session table.
+type SortKey int
+
+const (
+	// SortQueries orders sessions by query count, highest first.
+	SortQueries SortKey = iota
+	// SortDuration orders sessions by time since they started, longest first.
+	SortDuration
+)
+
+// String returns the name shown in the header.
+func (k SortKey) String() string {
+	if k == SortDuration {
+		return "duration"
+	}
+	return "queries"
+}
+
+// SortSessions orders sessions in place by key. Ties are broken by session ID
+// so rows do not jump between refreshes.
+func SortSessions(sessions []client.Session, key SortKey) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		switch key {
+		case SortDuration:
+			if !a.StartedAt.Equal(b.StartedAt) {
+				return a.StartedAt.Before(b.StartedAt)
+			}
+		default:
+			if a.QueryCount != b.QueryCount {
+				return a.QueryCount > b.QueryCount
+			}
+		}
+		return a.ID < b.ID
+	})
+}
+
+// Key is a decoded keypress.
+type Key int
+
+// Keys decoded from terminal input.
+const (
+	KeyRune Key = iota // a printable character, in Msg.Rune
+	KeyUp              // up arrow
+	KeyDown            // down arrow
+	KeyQuit            // Ctrl+C
+)
+
+// Msg is an input to Model.Update: a keypress, a refresh result or a kill
+// result. Exactly one group of fields is meaningful, as selected by Kind.
+type Msg struct {
+	Kind MsgKind
+
+	// MsgKey
+	Key  Key
+	Rune rune
+
+	// MsgRefresh
+	Sessions []client.Session
+	Stats    *client.StatsSnapshot
+	At       time.Time
+
+	// MsgRefresh and MsgKilled
+	Err error
+
+	// MsgKilled
+	ID string
+}
+
+// MsgKind identifies the kind of a Msg.
+type MsgKind int
+
+// Msg kinds.
+const (
+	MsgKey     MsgKind = iota // a keypress
+	MsgRefresh                // the result of polling sessions and stats
+	MsgKilled                 // the result of a kill request
+)
+
+// Action is the side effect Update asks the caller to perform.
+type Action int
+
+// Actions returned by Update.
+const (
+	ActionNone    Action = iota // nothing to do
+	ActionRefresh               // poll sessions and stats now
+	ActionKill                  // kill Model.KillTarget
+	ActionQuit                  // restore the terminal and exit
+)
+
+// historyLen is how many QPS samples the sparkline keeps.
+const historyLen = 120
+
+// Model is the state of the top view.
+type Model struct {
+	Sessions []client.Session
+	Stats    *client.StatsSnapshot
+	QPS      []float64 // QPS of the last historyLen refreshes, oldest first
+	Sort     SortKey
+	Selected int       // index into Sessions
+	Updated  time.Time // time of the last successful refresh
+	Status   string    // one-line message for the status bar
+
+	// KillTarget is the session ID awaiting confirmation, or being killed
+	// once Update has returned ActionKill.
+	KillTarget string
+	confirm    bool
+}
+
+// Update applies msg to the model and returns the action to perform.
+//
+// Keys: q or Ctrl+C quits, up/down move the selection, s toggles the sort
+// order, n and d sort by query count and duration, r refreshes now, and k
+// asks to kill the selected session, which y confirms and any other key
+// cancels.
+func (m *Model) Update(msg Msg) Action {
+	switch msg.Kind {
+	case MsgRefresh:
+		if msg.Err != nil {
+			m.Status = "refresh failed: " + msg.Err.Error()
+			return ActionNone
+		}
+		selectedID := m.selectedID()
+		m.Sessions = msg.Sessions
+		m.Stats = msg.Stats
+		if msg.Stats != nil {
+			m.QPS = append(m.QPS, msg.Stats.QPS)
+			if len(m.QPS) > historyLen {
+				m.QPS = slices.Delete(m.QPS, 0, len(m.QPS)-historyLen)
+			}
+		}
+		m.Updated = msg.At
+		m.Status = ""
+		m.resort(selectedID)
+		return ActionNone
+
+	case MsgKilled:
+		m.KillTarget = ""
+		if msg.Err != nil {
+			m.Status = fmt.Sprintf("kill %s failed: %v", msg.ID, msg.Err)
+			return ActionNone
+		}
+		m.Status = fmt.Sprintf("session %s killed", msg.ID)
+		return ActionRefresh
+
+	case MsgKey:
+		return m.updateKey(msg)
+	}
+	return ActionNone
+}
+
+// updateKey handles a MsgKey.
+func (m *Model) updateKey(msg Msg) Action {
+	if msg.Key == KeyQuit {
+		return ActionQuit
+	}
+
+	if m.confirm {
+		m.confirm = false
+		if msg.Key == KeyRune && (msg.Rune == 'y' || msg.Rune == 'Y') {
+			m.Status = "killing session " + m.KillTarget + "..."
+			return ActionKill
+		}
+		m.KillTarget = ""
+		m.Status = "kill cancelled"
+		return ActionNone
+	}
+
+	switch msg.Key {
+	case KeyUp:
+		if m.Selected > 0 {
+			m.Selected--
+		}
+		return ActionNone
+	case KeyDown:
+		if m.Selected < len(m.Sessions)-1 {
+			m.Selected++
+		}
+		return ActionNone
+	}
+
+	switch msg.Rune {
+	case 'q', 'Q':
+		return ActionQuit
+	case 's':
+		if m.Sort == SortQueries {
+			m.setSort(SortDuration)
+		} else {
+			m.setSort(SortQueries)
+		}
+	case 'n':
+		m.setSort(SortQueries)
+	case 'd':
+		m.setSort(SortDuration)
+	case 'r':
+		return ActionRefresh
+	case 'k':
+		id := m.selectedID()
+		if id == "" {
+			m.Status = "no session selected"
+			return ActionNone
+		}
+		m.KillTarget = id
+		m.confirm = true
+		m.Status = fmt.Sprintf("kill session %s? (y/N)", id)
+	}
+	return ActionNone
+}
+
+// setSort changes the sort order, keeping the selected session selected.
+func (m *Model) setSort(key SortKey) {
+	id := m.selectedID()
+	m.Sort = key
+	m.resort(id)
+}
+
+// resort sorts Sessions and moves the selection to the session with ID id,
+// or clamps it when that session is gone.
+func (m *Model) resort(id string) {
+	SortSessions(m.Sessions, m.Sort)
+	for i, s := range m.Sessions {
+		if s.ID == id {
+			m.Selected = i
+			return
+		}
+	}
+	if m.Selected >= len(m.Sessions) {
+		m.Selected = len(m.Sessions) - 1
+	}
+	if m.Selected < 0 {
+		m.Selected = 0
+	}
+}
+
+// selectedID returns the ID of the selected session, or "" if there is none.
+func (m *Model) selectedID() string {
+	if m.Selected < 0 || m.Selected >= len(m.Sessions) {
+		return ""
+	}
+	return m.Sessions[m.Selected].ID
+}
+
+// View renders the model as newline-separated lines fitting width x height:
+// the stats with a QPS sparkline and block gauges, then the session table.
+// The selected row is shown in reverse video. now is used for session
+// durations.
+func (m *Model) View(width, height int, now time.Time) string {
+	var lines []string
+
+	status := "QPS: -  Block Rate: -"
+	if m.Stats != nil {
+		status = fmt.Sprintf("QPS: %.2f  Block Rate: %.2f%%  Active: %d  Total Queries: %d",
+			m.Stats.QPS, m.Stats.BlockRate*100, m.Stats.ActiveSessions, m.Stats.TotalQueries)
+	}
+	lines = append(lines, status)
+	lines = append(lines, qpsLine(m.QPS, width))
+	lines = append(lines, gaugeLine(m.Stats))
+	lines = append(lines, fmt.Sprintf("Sessions: %d  Sort: %s  Updated: %s",
+		len(m.Sessions), m.Sort, formatUpdated(m.Updated)))
+	lines = append(lines, "")
+	lines = append(lines, fmt.Sprintf("%-12s %-21s %-12s %-12s %-8s %9s %10s",
+		"ID", "CLIENT", "USER", "DATABASE", "STATE", "DURATION", "QUERIES"))
+
+	// Reserve the header (6 lines) and the footer (2 lines).
+	rows := height - 8
+	if rows < 1 {
+		rows = 1
+	}
+	first := 0
+	if m.Selected >= rows {
+		first = m.Selected - rows + 1
+	}
+	for i := first; i < len(m.Sessions) && i < first+rows; i++ {
+		s := m.Sessions[i]
+		row := fmt.Sprintf("%-12s %-21s %-12s %-12s %-8s %9s %10d",
+			clip(s.ID, 12), clip(s.ClientAddr, 21), clip(s.User, 12), clip(s.Database, 12),
+			clip(s.State, 8), formatDuration(now.Sub(s.StartedAt)), s.QueryCount)
+		row = clip(row, width)
+		if i == m.Selected {
+			row = "\033[7m" + row + strings.Repeat(" ", max(width-len(row), 0)) + "\033[0m"
+		}
+		lines = append(lines, row)
+	}
+	if len(m.Sessions) == 0 {
+		lines = append(lines, "No active sessions")
+	}
+
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, clip(m.Status, width))
+	lines = append(lines, clip("q quit  up/down select  s sort  n queries  d duration  r refresh  k kill", width))
+
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "\033") {
+			lines[i] = clip(l, width)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sparkBlocks are the bars of the QPS sparkline, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// qpsLine renders the QPS history as a sparkline scaled to its own peak,
+// showing as many of the latest samples as fit in width.
+func qpsLine(history []float64, width int) string {
+	if len(history) == 0 {
+		return "QPS history: -"
+	}
+	peak := slices.Max(history)
+	label, suffix := "QPS history: ", fmt.Sprintf("  peak %.2f", peak)
+	n := min(len(history), width-len(label)-len(suffix))
+	if n < 1 {
+		return label + suffix[2:]
+	}
+	var b strings.Builder
+	b.WriteString(label)
+	for _, v := range history[len(history)-n:] {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[min(max(i, 0), len(sparkBlocks)-1)])
+	}
+	b.WriteString(suffix)
+	return b.String()
+}
+
+// gaugeWidth is the number of cells in a gauge bar.
+const gaugeWidth = 20
+
+// gaugeLine renders the share of blocked and monitored queries as gauges.
+func gaugeLine(s *client.StatsSnapshot) string {
+	if s == nil {
+		return "Blocked: -  Monitored: -"
+	}
+	monitored := 0.0
+	if s.TotalQueries > 0 {
+		monitored = float64(s.MonitoredBlocks) / float64(s.TotalQueries)
+	}
+	return "Blocked " + gauge(s.BlockRate) + "  Monitored " + gauge(monitored)
+}
+
+// gauge renders a fraction in 0..1 as a bar followed by its percentage.
+func gauge(frac float64) string {
+	frac = min(max(frac, 0), 1)
+	filled := int(frac*gaugeWidth + 0.5)
+	return fmt.Sprintf("[%s%s] %6.2f%%", strings.Repeat("#", filled), strings.Repeat(" ", gaugeWidth-filled), frac*100)
+}
+
+// clip truncates s to at most n runes.
+func clip(s string, n int) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// formatDuration renders d as H:MM:SS, clamping negative durations (clock
+// skew between the core and this host) to zero.
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	s := int64(d / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// formatUpdated renders the last refresh time, or "never".
+func formatUpdated(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("15:04:05")
+}
@@ -0,0 +1,163 @@
+package top
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+var t0 = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testSessions() []client.Session {
+	return []client.Session{
+		{ID: "a", QueryCount: 10, StartedAt: t0.Add(-1 * time.Minute)},
+		{ID: "b", QueryCount: 30, StartedAt: t0.Add(-2 * time.Minute)},
+		{ID: "c", QueryCount: 20, StartedAt: t0.Add(-3 * time.Minute)},
+		{ID: "d", QueryCount: 30, StartedAt: t0.Add(-3 * time.Minute)},
+	}
+}
+
+func ids(sessions []client.Session) string {
+	out := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, s.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+// TestSortSessions verifies both orders, with ties broken by ID.
+func TestSortSessions(t *testing.T) {
+	for _, tt := range []struct {
+		key  SortKey
+		want string
+	}{
+		{SortQueries, "b,d,c,a"},
+		{SortDuration, "c,d,b,a"},
+	} {
+		s := testSessions()
+		SortSessions(s, tt.key)
+		if got := ids(s); got != tt.want {
+			t.Errorf("sort by %s = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+// TestUpdate_RefreshKeepsSelection verifies that the selected session stays
+// selected across a refresh and a sort change.
+func TestUpdate_RefreshKeepsSelection(t *testing.T) {
+	var m Model
+	m.Update(Msg{Kind: MsgRefresh, Sessions: testSessions(), Stats: &client.StatsSnapshot{QPS: 1}, At: t0})
+	if got := ids(m.Sessions); got != "b,d,c,a" {
+		t.Fatalf("sessions = %s, want sorted by queries", got)
+	}
+
+	m.Update(Msg{Kind: MsgKey, Key: KeyDown})
+	m.Update(Msg{Kind: MsgKey, Key: KeyDown})
+	if m.selectedID() != "c" {
+		t.Fatalf("selected %q, want c", m.selectedID())
+	}
+
+	m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 's'})
+	if m.Sort != SortDuration || m.selectedID() != "c" || m.Selected != 0 {
+		t.Errorf("after sort toggle: sort=%s selected=%q at %d", m.Sort, m.selectedID(), m.Selected)
+	}
+
+	// a disappears: the selection is clamped instead of pointing past the end.
+	m.Selected = 3
+	m.Update(Msg{Kind: MsgRefresh, Sessions: testSessions()[1:3], At: t0})
+	if m.Selected != 1 {
+		t.Errorf("selected = %d after shrink, want 1", m.Selected)
+	}
+
+	// A failed refresh keeps the last data and reports the error.
+	m.Update(Msg{Kind: MsgRefresh, Err: errors.New("boom")})
+	if len(m.Sessions) != 2 || !strings.Contains(m.Status, "boom") {
+		t.Errorf("failed refresh: sessions=%d status=%q", len(m.Sessions), m.Status)
+	}
+}
+
+// TestUpdate_Kill verifies that k asks for confirmation, y returns
+// ActionKill for the selected session and any other key cancels.
+func TestUpdate_Kill(t *testing.T) {
+	var m Model
+	m.Update(Msg{Kind: MsgRefresh, Sessions: testSessions(), At: t0})
+
+	if a := m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'k'}); a != ActionNone {
+		t.Fatalf("k returned %v, want ActionNone", a)
+	}
+	if a := m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'x'}); a != ActionNone || m.KillTarget != "" {
+		t.Fatalf("cancel: action=%v target=%q", a, m.KillTarget)
+	}
+
+	m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'k'})
+	if a := m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'y'}); a != ActionKill || m.KillTarget != "b" {
+		t.Fatalf("confirm: action=%v target=%q, want ActionKill b", a, m.KillTarget)
+	}
+
+	if a := m.Update(Msg{Kind: MsgKilled, ID: "b"}); a != ActionRefresh {
+		t.Errorf("killed returned %v, want ActionRefresh", a)
+	}
+	if a := m.Update(Msg{Kind: MsgKilled, ID: "b", Err: client.ErrNotImplemented}); a != ActionNone || !strings.Contains(m.Status, "failed") {
+		t.Errorf("kill failure: action=%v status=%q", a, m.Status)
+	}
+
+	var empty Model
+	empty.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'k'})
+	if empty.confirm {
+		t.Error("k with no sessions should not ask for confirmation")
+	}
+}
+
+// TestUpdate_Quit verifies q and Ctrl+C, including during a kill prompt.
+func TestUpdate_Quit(t *testing.T) {
+	var m Model
+	if a := m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'q'}); a != ActionQuit {
+		t.Errorf("q returned %v", a)
+	}
+	m.Update(Msg{Kind: MsgRefresh, Sessions: testSessions(), At: t0})
+	m.Update(Msg{Kind: MsgKey, Key: KeyRune, Rune: 'k'})
+	if a := m.Update(Msg{Kind: MsgKey, Key: KeyQuit}); a != ActionQuit {
+		t.Errorf("Ctrl+C during prompt returned %v", a)
+	}
+}
+
+// TestView verifies the status bar and that rows fit the given size.
+func TestView(t *testing.T) {
+	m := Model{Stats: &client.StatsSnapshot{QPS: 12.5, BlockRate: 0.25}}
+	m.Update(Msg{Kind: MsgRefresh, Sessions: testSessions(), Stats: m.Stats, At: t0})
+
+	lines := strings.Split(m.View(200, 10, t0), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("view has %d lines, want 10", len(lines))
+	}
+	if !strings.Contains(lines[0], "QPS: 12.50") || !strings.Contains(lines[0], "Block Rate: 25.00%") {
+		t.Errorf("status bar = %q", lines[0])
+	}
+	// Height 10 leaves room for two rows; the selected one is highlighted.
+	if !strings.Contains(lines[6], "\033[7mb ") || !strings.Contains(lines[6], "0:02:00") || !strings.HasPrefix(lines[7], "d ") {
+		t.Errorf("rows = %q, %q", lines[6], lines[7])
+	}
+}
+
+// TestDecodeKeys verifies arrows, Ctrl+C and printable keys.
+func TestDecodeKeys(t *testing.T) {
+	got := DecodeKeys([]byte("k\x1b[A\x1b[B\x1b[Cq\x03"))
+	want := []Msg{
+		{Kind: MsgKey, Key: KeyRune, Rune: 'k'},
+		{Kind: MsgKey, Key: KeyUp},
+		{Kind: MsgKey, Key: KeyDown},
+		{Kind: MsgKey, Key: KeyRune, Rune: 'q'},
+		{Kind: MsgKey, Key: KeyQuit},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d keys, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Key != want[i].Key || got[i].Rune != want[i].Rune {
+			t.Errorf("key %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+	"golang.org/x/term"
+)
+
+// ANSI sequences used to take over the terminal and give it back on exit.
+const (
+	enterScreen = "\033[?1049h\033[?25l" // alternate screen, hide cursor
+	leaveScreen = "\033[?25h\033[?1049l" // show cursor, main screen
+	clearScreen = "\033[H\033[2J"
+)
+
+// ErrNotTerminal is returned by Run when in or out is not a terminal.
+var ErrNotTerminal = errors.New("top needs an interactive terminal")
+
+// IsTerminal reports whether in and out are both terminals, which Run needs;
+// a caller can fall back to plain output when they are not.
+func IsTerminal(in, out *os.File) bool {
+	return term.IsTerminal(int(in.Fd())) && term.IsTerminal(int(out.Fd())) // #nosec G115 -- file descriptors fit in int
+}
+
+// Run shows the top view on the terminal attached to in and out until the
+// user quits or ctx is cancelled. Sessions and stats are polled every
+// interval; each poll and kill is bounded by timeout. The terminal is
+// switched to raw mode and the alternate screen, and restored before Run
+// returns, which also stops reading keys from in where the platform allows.
+func Run(ctx context.Context, in, out *os.File, c *client.Client, interval, timeout time.Duration) (err error) {
+	if !IsTerminal(in, out) {
+		return ErrNotTerminal
+	}
+	inFd, outFd := int(in.Fd()), int(out.Fd()) // #nosec G115 -- file descriptors fit in int
+	keysIn, closeKeys, err := cancelableInput(in)
+	if err != nil {
+		return err
+	}
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return errors.Join(fmt.Errorf("set terminal raw mode: %w", err), closeKeys())
+	}
+	fmt.Fprint(out, enterScreen)
+
+	ctx, cancel := context.WithCancel(ctx)
+	keys := make(chan Msg)
+	keysDone := make(chan struct{})
+	go func() {
+		defer close(keysDone)
+		readKeys(keysIn, func(msg Msg) {
+			select {
+			case keys <- msg:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	defer func() {
+		cancel()
+		// Unblock the pending read so that no key is taken from in after
+		// Run returns.
+		if keysIn.SetReadDeadline(time.Now()) == nil {
+			<-keysDone
+		}
+		fmt.Fprint(out, leaveScreen)
+		err = errors.Join(err, closeKeys())
+		if rerr := term.Restore(inFd, state); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("restore terminal: %w", rerr))
+		}
+	}()
+
+	l := loop{
+		keys: keys,
+		draw: func(m *Model) { draw(out, outFd, m) },
+		poll: func(ctx context.Context) Msg { return poll(ctx, c, timeout) },
+		kill: func(ctx context.Context, id string) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return c.KillSessionContext(ctx, id)
+		},
+		interval: interval,
+	}
+	return l.run(ctx)
+}
+
+// loop is the refresh loop of Run without the terminal, so that it can be
+// driven headless: keys come from a channel, frames go to draw, and poll and
+// kill stand for the client.
+type loop struct {
+	keys     <-chan Msg
+	draw     func(*Model)
+	poll     func(context.Context) Msg // returns a MsgRefresh
+	kill     func(ctx context.Context, id string) error
+	interval time.Duration
+}
+
+// run polls every interval and applies keys and results to a Model, drawing
+// it after each change, until a quit key or ctx is cancelled. Polls and kills
+// run in goroutines so that keys are handled while they are in flight; at
+// most one poll is in flight at a time.
+func (l *loop) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan Msg)
+	send := func(msg Msg) {
+		select {
+		case results <- msg:
+		case <-ctx.Done():
+		}
+	}
+	refreshing := false
+	refresh := func() {
+		if refreshing {
+			return
+		}
+		refreshing = true
+		go func() {
+			send(l.poll(ctx))
+		}()
+	}
+	kill := func(id string) {
+		go func() {
+			send(Msg{Kind: MsgKilled, ID: id, Err: l.kill(ctx, id)})
+		}()
+	}
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	var m Model
+	refresh()
+	for {
+		l.draw(&m)
+
+		var msg Msg
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			refresh()
+			continue
+		case msg = <-l.keys:
+		case msg = <-results:
+			if msg.Kind == MsgRefresh {
+				refreshing = false
+			}
+		}
+		switch m.Update(msg) {
+		case ActionQuit:
+			return nil
+		case ActionRefresh:
+			refresh()
+		case ActionKill:
+			kill(m.KillTarget)
+		case ActionNone:
+		}
+	}
+}
+
+// poll fetches stats and sessions under one timeout and returns them as a
+// MsgRefresh.
+func poll(ctx context.Context, c *client.Client, timeout time.Duration) Msg {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stats, err := c.GetStatsContext(ctx)
+	if err != nil {
+		return Msg{Kind: MsgRefresh, Err: err}
+	}
+	var sessions []client.Session
+	err = c.StreamSessions(ctx, client.SessionFilter{}, func(s client.Session) error {
+		sessions = append(sessions, s)
+		return nil
+	})
+	if err != nil {
+		return Msg{Kind: MsgRefresh, Err: err}
+	}
+	return Msg{Kind: MsgRefresh, Sessions: sessions, Stats: stats, At: time.Now()}
+}
+
+// draw redraws the whole screen in one write.
+func draw(out io.Writer, fd int, m *Model) {
+	width, height, err := term.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	// Raw mode disables output newline translation.
+	view := strings.ReplaceAll(m.View(width, height, time.Now()), "\n", "\r\n")
+	fmt.Fprint(out, clearScreen+view)
+}
+
+// readKeys decodes keypresses from r until it fails. A read error is reported
+// as KeyQuit so a closed terminal ends the view.
+func readKeys(r io.Reader, send func(Msg)) {
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for _, msg := range DecodeKeys(buf[:n]) {
+			send(msg)
+		}
+		if err != nil {
+			send(Msg{Kind: MsgKey, Key: KeyQuit})
+			return
+		}
+	}
+}
+
+// DecodeKeys turns raw terminal input into key messages. Arrow keys arrive as
+// ESC [ A and ESC [ B; Ctrl+C is byte 3 because raw mode disables signals.
+// Other escape sequences are dropped.
+func DecodeKeys(b []byte) []Msg {
+	var msgs []Msg
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == 3:
+			msgs = append(msgs, Msg{Kind: MsgKey, Key: KeyQuit})
+		case b[i] == 0x1b && i+2 < len(b) && b[i+1] == '[':
+			switch b[i+2] {
+			case 'A':
+				msgs = append(msgs, Msg{Kind: MsgKey, Key: KeyUp})
+			case 'B':
+				msgs = append(msgs, Msg{Kind: MsgKey, Key: KeyDown})
+			}
+			i += 2
+		case b[i] >= 0x20 && b[i] < 0x7f:
+			msgs = append(msgs, Msg{Kind: MsgKey, Key: KeyRune, Rune: rune(b[i])})
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,132 @@
+package top
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dongwonkwak/dbgate/tools/internal/client"
+)
+
+// fakePoll returns a poll func whose n-th call reports QPS n and one session,
+// counting its calls.
+func fakePoll(polls *atomic.Int32) func(context.Context) Msg {
+	return func(context.Context) Msg {
+		n := polls.Add(1)
+		return Msg{
+			Kind:     MsgRefresh,
+			Sessions: []client.Session{{ID: "s1", StartedAt: t0}},
+			Stats:    &client.StatsSnapshot{QPS: float64(n), TotalQueries: 100, MonitoredBlocks: 10, BlockRate: 0.25},
+			At:       t0,
+		}
+	}
+}
+
+// TestLoop_Refresh verifies that the loop polls every interval, collects the
+// QPS history for the sparkline and draws it, and stops on a quit key.
+func TestLoop_Refresh(t *testing.T) {
+	var polls atomic.Int32
+	keys := make(chan Msg, 1)
+	var last Model
+	l := loop{
+		keys: keys,
+		draw: func(m *Model) {
+			last = *m
+			if len(m.QPS) == 3 {
+				keys <- Msg{Kind: MsgKey, Key: KeyQuit}
+			}
+		},
+		poll:     fakePoll(&polls),
+		kill:     func(context.Context, string) error { return nil },
+		interval: time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("the loop did not quit")
+	}
+	if !slices.Equal(last.QPS, []float64{1, 2, 3}) {
+		t.Errorf("QPS history = %v, want [1 2 3]", last.QPS)
+	}
+	lines := strings.Split(last.View(80, 12, t0), "\n")
+	if lines[1] != "QPS history: ▃▅█  peak 3.00" {
+		t.Errorf("sparkline = %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "Blocked [#####               ]  25.00%") ||
+		!strings.Contains(lines[2], "Monitored [##                  ]  10.00%") {
+		t.Errorf("gauges = %q", lines[2])
+	}
+}
+
+// TestLoop_Kill verifies that a confirmed kill reaches kill with the
+// selected session and is followed by a refresh.
+func TestLoop_Kill(t *testing.T) {
+	var polls atomic.Int32
+	keys := make(chan Msg, 3)
+	killed := make(chan string, 1)
+	sent := false
+	l := loop{
+		keys: keys,
+		draw: func(m *Model) {
+			switch {
+			case len(m.Sessions) == 1 && !sent:
+				sent = true
+				keys <- Msg{Kind: MsgKey, Key: KeyRune, Rune: 'k'}
+				keys <- Msg{Kind: MsgKey, Key: KeyRune, Rune: 'y'}
+			case sent && m.Status == "" && polls.Load() == 2:
+				keys <- Msg{Kind: MsgKey, Key: KeyRune, Rune: 'q'}
+			}
+		},
+		poll: fakePoll(&polls),
+		kill: func(ctx context.Context, id string) error {
+			killed <- id
+			return ctx.Err()
+		},
+		interval: time.Hour,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if id := <-killed; id != "s1" {
+		t.Errorf("killed %q, want s1", id)
+	}
+	// With an hour-long interval, the second poll is the refresh after the kill.
+	if got := polls.Load(); got != 2 {
+		t.Errorf("polled %d times, want a refresh after the kill", got)
+	}
+}
+
+// TestLoop_Cancel verifies that cancelling ctx ends the loop while a poll is
+// in flight.
+func TestLoop_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := loop{
+		keys: make(chan Msg),
+		draw: func(*Model) {},
+		poll: func(ctx context.Context) Msg {
+			cancel()
+			<-ctx.Done()
+			return Msg{Kind: MsgRefresh, Err: ctx.Err()}
+		},
+		kill:     func(context.Context, string) error { return nil },
+		interval: time.Hour,
+	}
+	done := make(chan error, 1)
+	go func() { done <- l.run(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after cancellation")
+	}
+}